@@ -0,0 +1,274 @@
+package excel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// CSVQuote CSV字段加引号的策略
+type CSVQuote int
+
+const (
+	QuoteMinimal    CSVQuote = iota // 仅在包含分隔符、引号、换行或首尾空格时加引号
+	QuoteAll                        // 所有字段都加引号
+	QuoteNonNumeric                 // 不是十进制数字（如12、-0.5、1E+20）的字段都加引号（包括空字段）
+	QuoteNone                       // 从不加引号，字段包含分隔符、引号或换行时报错
+)
+
+// csvDecimalPattern QuoteNonNumeric不加引号的数字写法，不包含千位分隔符、NaN、Inf和十六进制
+var csvDecimalPattern = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)([eE][-+]?\d+)?$`)
+
+// CSVEncoding CSV输出编码
+type CSVEncoding string
+
+const (
+	EncodingUTF8    CSVEncoding = "UTF-8"
+	EncodingGBK     CSVEncoding = "GBK"
+	EncodingGB18030 CSVEncoding = "GB18030"
+)
+
+// CSVOptions CSV导出选项，零值为UTF-8编码、逗号分隔、按需加引号、\n换行
+type CSVOptions struct {
+	Delimiter rune        // 字段分隔符，默认为逗号，TSV使用'\t'
+	Quote     CSVQuote    // 加引号策略，默认为QuoteMinimal
+	UseCRLF   bool        // 是否使用\r\n换行（Windows），默认为\n
+	BOM       bool        // 是否在开头写入UTF-8 BOM，便于Excel识别编码，仅对UTF-8有效
+	Encoding  CSVEncoding // 输出编码，默认为UTF-8；GBK无法表示的字符会报错，可改用GB18030
+	RawValues bool        // 是否输出原始值，为false时按单元格的数字格式输出（如"1,234.50"、"12%"、"2024-01-02"）
+}
+
+// CSVWriter CSV写入器，按选项处理分隔符、引号、换行和编码
+type CSVWriter struct {
+	w       *bufio.Writer
+	options CSVOptions
+	encoder *encoding.Encoder
+	records int
+}
+
+// NewCSVWriter 创建CSV写入器，写入完成后需要调用Flush
+func NewCSVWriter(w io.Writer, options CSVOptions) (*CSVWriter, error) {
+	if options.Delimiter == 0 {
+		options.Delimiter = ','
+	}
+	if d := options.Delimiter; d == '"' || d == '\r' || d == '\n' || d == utf8.RuneError || !utf8.ValidRune(d) {
+		return nil, fmt.Errorf("无效的CSV分隔符 %q", d)
+	}
+	if options.Quote < QuoteMinimal || options.Quote > QuoteNone {
+		return nil, fmt.Errorf("无效的CSV引号策略 %d", options.Quote)
+	}
+	writer := &CSVWriter{w: bufio.NewWriter(w), options: options}
+	switch strings.ToUpper(string(options.Encoding)) {
+	case "", "UTF-8", "UTF8":
+		if options.BOM {
+			if _, err := writer.w.WriteString("\uFEFF"); err != nil {
+				return nil, err
+			}
+		}
+	case "GBK":
+		writer.encoder = simplifiedchinese.GBK.NewEncoder()
+	case "GB18030":
+		writer.encoder = simplifiedchinese.GB18030.NewEncoder()
+	default:
+		return nil, fmt.Errorf("不支持的CSV编码 %s", options.Encoding)
+	}
+	return writer, nil
+}
+
+// needsQuote 判断字段在QuoteMinimal策略下是否需要加引号
+func (w *CSVWriter) needsQuote(field string) bool {
+	if field == "" {
+		return false
+	}
+	if strings.ContainsRune(field, w.options.Delimiter) || strings.ContainsAny(field, "\"\r\n") {
+		return true
+	}
+	first, _ := utf8.DecodeRuneInString(field)
+	last, _ := utf8.DecodeLastRuneInString(field)
+	return first == ' ' || first == '\t' || last == ' ' || last == '\t'
+}
+
+// Write 写入一条记录
+func (w *CSVWriter) Write(record []string) error {
+	w.records++
+	var line strings.Builder
+	for i, field := range record {
+		if i > 0 {
+			line.WriteRune(w.options.Delimiter)
+		}
+		quote := false
+		switch w.options.Quote {
+		case QuoteAll:
+			quote = true
+		case QuoteNonNumeric:
+			quote = !csvDecimalPattern.MatchString(field)
+		case QuoteNone:
+			if strings.ContainsRune(field, w.options.Delimiter) || strings.ContainsAny(field, "\"\r\n") {
+				return fmt.Errorf("第%d条记录第%d个字段包含分隔符、引号或换行，不加引号无法写出", w.records, i+1)
+			}
+		default:
+			quote = w.needsQuote(field)
+		}
+		if !quote {
+			line.WriteString(field)
+			continue
+		}
+		line.WriteByte('"')
+		line.WriteString(strings.ReplaceAll(field, `"`, `""`))
+		line.WriteByte('"')
+	}
+	if w.options.UseCRLF {
+		line.WriteString("\r\n")
+	} else {
+		line.WriteByte('\n')
+	}
+	if w.encoder == nil {
+		_, err := w.w.WriteString(line.String())
+		return err
+	}
+	encoded, err := w.encoder.String(line.String())
+	if err != nil {
+		for _, r := range line.String() {
+			if _, e := w.encoder.String(string(r)); e != nil {
+				return fmt.Errorf("第%d条记录包含%s编码无法表示的字符 %q", w.records, w.options.Encoding, r)
+			}
+		}
+		return err
+	}
+	_, err = w.w.WriteString(encoded)
+	return err
+}
+
+// Flush 将缓冲的数据写入底层的io.Writer
+func (w *CSVWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// cellFormatter 按单元格样式中的数字格式格式化单元格的值，缓存样式ID对应的格式代码
+type cellFormatter struct {
+	file  *excelize.File
+	sheet string
+	codes map[int]string
+}
+
+// numFmtCode 返回样式的数字格式代码，ok为false表示未知的内置格式（日期时间等），需要交给excelize处理
+func (f *cellFormatter) numFmtCode(styleID int) (code string, ok bool) {
+	if code, ok := f.codes[styleID]; ok {
+		return code, code != ""
+	}
+	defer func() { f.codes[styleID] = code }()
+	styles := f.file.Styles
+	if styles == nil || styles.CellXfs == nil || styleID < 0 || styleID >= len(styles.CellXfs.Xf) {
+		return "General", true
+	}
+	id := 0
+	if numFmtID := styles.CellXfs.Xf[styleID].NumFmtID; numFmtID != nil {
+		id = *numFmtID
+	}
+	if builtin, ok := builtinNumberFormats[id]; ok {
+		return builtin, true
+	}
+	if styles.NumFmts != nil {
+		for _, numFmt := range styles.NumFmts.NumFmt {
+			if numFmt != nil && numFmt.NumFmtID == id {
+				return numFmt.FormatCode, true
+			}
+		}
+	}
+	return "", false
+}
+
+// format 返回单元格按数字格式显示的文本，raw为单元格的原始值
+func (f *cellFormatter) format(cell, raw string) (string, error) {
+	cellType, err := f.file.GetCellType(f.sheet, cell)
+	if err != nil {
+		return "", err
+	}
+	styleID, err := f.file.GetCellStyle(f.sheet, cell)
+	if err != nil {
+		return "", err
+	}
+	code, ok := f.numFmtCode(styleID)
+	switch cellType {
+	case excelize.CellTypeUnset, excelize.CellTypeNumber:
+		if value, err := strconv.ParseFloat(raw, 64); err == nil && ok {
+			if text, ok := formatNumber(value, code); ok {
+				return text, nil
+			}
+		}
+		return f.file.GetCellValue(f.sheet, cell)
+	case excelize.CellTypeSharedString, excelize.CellTypeInlineString, excelize.CellTypeFormula:
+		if ok {
+			return formatText(raw, code), nil
+		}
+	}
+	return f.file.GetCellValue(f.sheet, cell)
+}
+
+// WriteCSV 将工作表写为CSV，sheet为空时写出当前工作表
+// 按数字格式输出时需要读取单元格样式，整张工作表会被加载到内存；RawValues为true时逐行读取，内存占用不随行数增长
+// 工作表中间的空行按空记录写出，每条记录的字段数为该行最后一个非空单元格的列号
+func (p *ExcelProcessor) WriteCSV(w io.Writer, sheet string, options CSVOptions) error {
+	if sheet == "" {
+		sheet = p.sheetName
+	}
+	if !p.SheetExists(sheet) {
+		return fmt.Errorf("工作表 %s 不存在", sheet)
+	}
+	writer, err := NewCSVWriter(w, options)
+	if err != nil {
+		return err
+	}
+	formatter := &cellFormatter{file: p.file, sheet: sheet, codes: make(map[int]string)}
+	for row, err := range p.Rows(sheet, RowsOptions{}) {
+		if err != nil {
+			return err
+		}
+		record := row.Values()
+		if !options.RawValues {
+			record = make([]string, row.Len())
+			for i, raw := range row.Values() {
+				if raw == "" {
+					continue
+				}
+				if record[i], err = formatter.format(row.Cell(i).Name(), raw); err != nil {
+					return err
+				}
+			}
+		}
+		if err = writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// writeCSVFile 将工作表写入CSV文件
+func writeCSVFile(p *ExcelProcessor, csvPath, sheet string, options CSVOptions) error {
+	file, err := os.Create(csvPath)
+	if err != nil {
+		return err
+	}
+	if err = p.WriteCSV(file, sheet, options); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// csvOptions 返回可选参数中的CSV选项，省略时为零值
+func csvOptions(options []CSVOptions) CSVOptions {
+	if len(options) == 0 {
+		return CSVOptions{}
+	}
+	return options[0]
+}
@@ -0,0 +1,149 @@
+package excel
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// newCSVProcessor 创建包含中文、带数字格式的数字和需要加引号的文本的工作表
+func newCSVProcessor(t *testing.T) *ExcelProcessor {
+	t.Helper()
+	p := NewExcelProcessor()
+	t.Cleanup(func() { p.Close() })
+	rows := [][]interface{}{
+		{"商品", "单价", "占比", "备注"},
+		{"键盘", 1234.5, 0.125, "含税, 包邮"},
+		{"鼠标", 1e20, -0.5, `说明"A"`},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := p.file.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	money, percent := "#,##0.00", "0.0%"
+	for _, c := range []struct {
+		cell string
+		code *string
+	}{{"B2", &money}, {"C2", &percent}, {"C3", &percent}} {
+		style, err := p.file.NewStyle(&excelize.Style{CustomNumFmt: c.code})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = p.file.SetCellStyle("Sheet1", c.cell, c.cell, style); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestExportAsCSVEncoding(t *testing.T) {
+	p := newCSVProcessor(t)
+	want := "商品,单价,占比,备注\n" +
+		"键盘,\"1,234.50\",12.5%,\"含税, 包邮\"\n" +
+		"鼠标,1E+20,-50.0%,\"说明\"\"A\"\"\"\n"
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		options CSVOptions
+		decode  func([]byte) ([]byte, error)
+		want    string
+	}{
+		{"utf-8", CSVOptions{}, nil, want},
+		{"bom crlf", CSVOptions{BOM: true, UseCRLF: true}, nil, "\uFEFF" + strings.ReplaceAll(want, "\n", "\r\n")},
+		{"gbk", CSVOptions{Encoding: EncodingGBK}, simplifiedchinese.GBK.NewDecoder().Bytes, want},
+		{"gb18030", CSVOptions{Encoding: EncodingGB18030}, simplifiedchinese.GB18030.NewDecoder().Bytes, want},
+		{"raw tsv", CSVOptions{Delimiter: '\t', RawValues: true}, nil,
+			"商品\t单价\t占比\t备注\n键盘\t1234.5\t0.125\t含税, 包邮\n鼠标\t100000000000000000000\t-0.5\t\"说明\"\"A\"\"\"\n"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".csv")
+		if err := p.ExportAsCSV(path, tt.options); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.decode != nil {
+			if bytes.Equal(data, []byte(tt.want)) {
+				t.Errorf("%s: output should not be UTF-8", tt.name)
+			}
+			if data, err = tt.decode(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: csv = %q, want %q", tt.name, data, tt.want)
+		}
+	}
+
+	// GBK无法表示的字符报错，GB18030可以表示
+	if err := p.file.SetCellValue("Sheet1", "A3", "鼠标😀"); err != nil {
+		t.Fatal(err)
+	}
+	err := p.ExportAsCSV(filepath.Join(dir, "emoji.csv"), CSVOptions{Encoding: EncodingGBK})
+	if err == nil || !strings.Contains(err.Error(), "第3条记录") {
+		t.Errorf("err = %v", err)
+	}
+	if err = p.ExportAsCSV(filepath.Join(dir, "emoji.csv"), CSVOptions{Encoding: EncodingGB18030}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCSVWriterQuote(t *testing.T) {
+	tests := []struct {
+		quote CSVQuote
+		want  string
+	}{
+		{QuoteMinimal, "a,12,,\" b\"\n"},
+		{QuoteAll, "\"a\",\"12\",\"\",\" b\"\n"},
+		{QuoteNonNumeric, "\"a\",12,\"\",\" b\"\n"},
+		{QuoteNone, "a,12,, b\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, err := NewCSVWriter(&buf, CSVOptions{Quote: tt.quote})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Write([]string{"a", "12", "", " b"}); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("quote %d: %q, want %q", tt.quote, buf.String(), tt.want)
+		}
+	}
+
+	// ParseFloat能解析但不是十进制数字的字段也加引号
+	var buf bytes.Buffer
+	w, _ := NewCSVWriter(&buf, CSVOptions{Quote: QuoteNonNumeric, Delimiter: '\t'})
+	if err := w.Write([]string{"-1.5", "1E+20", ".5", "NaN", "Inf", "infinity", "0x1p-2", "1_000", "1,234"}); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if want := "-1.5\t1E+20\t.5\t\"NaN\"\t\"Inf\"\t\"infinity\"\t\"0x1p-2\"\t\"1_000\"\t\"1,234\"\n"; buf.String() != want {
+		t.Errorf("non-numeric: %q, want %q", buf.String(), want)
+	}
+
+	w, _ = NewCSVWriter(&bytes.Buffer{}, CSVOptions{Quote: QuoteNone})
+	if err := w.Write([]string{"a,b"}); err == nil {
+		t.Error("expected error for delimiter without quotes")
+	}
+	if _, err := NewCSVWriter(&bytes.Buffer{}, CSVOptions{Delimiter: '"'}); err == nil {
+		t.Error("expected error for quote delimiter")
+	}
+	if _, err := NewCSVWriter(&bytes.Buffer{}, CSVOptions{Encoding: "BIG5"}); err == nil {
+		t.Error("expected error for unsupported encoding")
+	}
+}
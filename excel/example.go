@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/xuri/excelize/v2"
 )
 
 // 示例：展示Excel工具包的基本使用方法
@@ -203,9 +205,14 @@ func ExampleExportToOtherFormats() {
 	// 保存Excel文件
 	processor.Save("产品列表.xlsx")
 
-	// 导出为CSV
-	// 注意：当前的writeRowsToCSV实现不完整，实际使用时需要修改
-	// processor.ExportAsCSV("产品列表.csv")
+	// 导出为CSV，按单元格的数字格式输出
+	processor.ExportAsCSV("产品列表.csv")
+
+	// 导出为GBK编码、Windows换行的CSV，便于在中文版Excel中直接打开
+	processor.ExportAsCSV("产品列表_gbk.csv", CSVOptions{Encoding: EncodingGBK, UseCRLF: true})
+
+	// 导出为带BOM的UTF-8 TSV，所有字段加引号
+	processor.ExportAsCSV("产品列表.tsv", CSVOptions{Delimiter: '\t', Quote: QuoteAll, BOM: true})
 
 	// 导出为HTML
 	// 注意：当前的writeStringToFile实现不完整，实际使用时需要修改
@@ -214,6 +221,149 @@ func ExampleExportToOtherFormats() {
 	fmt.Println("Excel文件已导出")
 }
 
+// 示例：结构体切片与工作表互相转换
+func ExampleMarshal() {
+	type Product struct {
+		ID      string    `excel:"name=产品ID,width=10,required"`
+		Name    string    `excel:"name=产品名称,width=20,required"`
+		Price   float64   `excel:"name=价格,format='#,##0.00'"`
+		Stock   int       `excel:"name=库存"`
+		Created time.Time `excel:"name=上架日期,width=12,format=yyyy-mm-dd"`
+		Remark  string    `excel:"-"`
+	}
+
+	products := []Product{
+		{ID: "P001", Name: "笔记本电脑", Price: 5699, Stock: 125, Created: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "P002", Name: "智能手机", Price: 3299, Stock: 230, Created: time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+	}
+
+	processor := NewExcelProcessor()
+	if err := Marshal(processor, "产品列表", products); err != nil {
+		log.Fatalf("写入产品列表失败: %v", err)
+	}
+	processor.Save("产品列表_结构体.xlsx")
+
+	// 按表头名称读取，列的顺序可以与结构体字段顺序不同
+	var loaded []Product
+	if err := Unmarshal(processor, "产品列表", &loaded); err != nil {
+		// 错误中包含出错的行号、列名和字段名
+		log.Printf("读取产品列表失败: %v", err)
+		return
+	}
+	fmt.Printf("读取到 %d 个产品\n", len(loaded))
+}
+
+// 示例：流式写入大量数据
+func ExampleStreamWriter() {
+	processor := NewExcelProcessor()
+	defer processor.Close()
+
+	writer, err := processor.NewStreamWriter("订单明细", StreamOptions{
+		Header:        []interface{}{"订单号", "金额", "下单时间"},
+		HeaderStyle:   &excelize.Style{Font: &excelize.Font{Bold: true}},
+		FreezeHeader:  true,
+		ColumnWidths:  []float64{12, 12, 20},
+		ColumnFormats: []string{"", "#,##0.00", "yyyy-mm-dd hh:mm"},
+	})
+	if err != nil {
+		log.Fatalf("创建流式写入器失败: %v", err)
+	}
+
+	// 从通道接收数据，超过1048576行时自动续写到"订单明细_2"等工作表
+	rows := make(chan []interface{}, 100)
+	go func() {
+		defer close(rows)
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+		for i := 1; i <= 10000; i++ {
+			rows <- []interface{}{fmt.Sprintf("SO%06d", i), float64(i) * 1.5, start.Add(time.Duration(i) * time.Minute)}
+		}
+	}()
+	if err = writer.WriteFrom(rows); err != nil {
+		log.Fatalf("写入数据失败: %v", err)
+	}
+	if err = writer.Flush(); err != nil {
+		log.Fatalf("结束写入失败: %v", err)
+	}
+	if err = processor.Save("订单明细.xlsx"); err != nil {
+		log.Fatalf("保存Excel文件失败: %v", err)
+	}
+	fmt.Printf("已写入 %d 行，工作表: %v\n", writer.Rows(), writer.Sheets())
+}
+
+// 示例：逐行读取大文件
+func ExampleRows() {
+	processor, err := OpenExcelFile("订单明细.xlsx")
+	if err != nil {
+		log.Printf("打开文件失败: %v", err)
+		return
+	}
+	defer processor.Close()
+
+	// 第一行为表头，只读取前100行数据
+	total := 0.0
+	for row, err := range processor.Rows("订单明细", RowsOptions{Header: true, Limit: 100, SkipEmpty: true}) {
+		if err != nil {
+			log.Printf("读取失败: %v", err)
+			return
+		}
+		cell, _ := row.Get("金额")
+		amount, err := cell.Float()
+		if err != nil {
+			log.Printf("跳过无效金额: %v", err)
+			continue
+		}
+		total += amount
+	}
+	fmt.Printf("前100行金额合计: %.2f\n", total)
+
+	// 按表头绑定到结构体
+	type Order struct {
+		ID     string    `excel:"name=订单号,required"`
+		Amount float64   `excel:"name=金额"`
+		Time   time.Time `excel:"name=下单时间"`
+	}
+	for order, err := range RowsOf[Order](processor, "订单明细", RowsOptions{Limit: 3}) {
+		if err != nil {
+			log.Printf("跳过无效行: %v", err)
+			continue
+		}
+		fmt.Printf("%s %.2f %s\n", order.ID, order.Amount, order.Time.Format("2006-01-02 15:04"))
+	}
+}
+
+// 示例：导入供应商的CSV并规范为带格式的xlsx
+func ExampleImportCSV() {
+	// 准备一份供应商发来的CSV：编号带前导0，金额带千位分隔符，日期格式不统一
+	content := "商品编号,商品名称,单价,数量,折扣,到货日期,是否含税\n" +
+		"00123,无线鼠标,\"1,299.00\",20,12.5%,2024-03-01,是\n" +
+		"00456,机械键盘,459.5,8,5%,2024/3/15,否\n"
+	if err := os.WriteFile("供应商报价.csv", []byte(content), 0644); err != nil {
+		log.Printf("写入CSV失败: %v", err)
+		return
+	}
+
+	// 自动识别编码和分隔符，按列推断类型；数量列显式指定为整数并加千位分隔符
+	processor, err := ImportCSV("供应商报价.csv", CSVImportOptions{
+		Header:       true,
+		FreezeHeader: true,
+		AutoWidth:    true,
+		Columns: map[string]CSVColumn{
+			"数量": {Type: ColumnInt, Format: "#,##0"},
+		},
+	})
+	if err != nil {
+		log.Printf("导入CSV失败: %v", err)
+		return
+	}
+	defer processor.Close()
+
+	if err = processor.Save("供应商报价.xlsx"); err != nil {
+		log.Printf("保存Excel文件失败: %v", err)
+		return
+	}
+	fmt.Println("CSV已导入为 供应商报价.xlsx")
+}
+
 // 主函数：运行所有示例
 func RunAllExamples() {
 	fmt.Println("====== Excel工具包使用示例 ======")
@@ -233,5 +383,17 @@ func RunAllExamples() {
 	fmt.Println("\n=== 格式导出示例 ===")
 	ExampleExportToOtherFormats()
 
+	fmt.Println("\n=== 结构体映射示例 ===")
+	ExampleMarshal()
+
+	fmt.Println("\n=== 流式写入示例 ===")
+	ExampleStreamWriter()
+
+	fmt.Println("\n=== 逐行读取示例 ===")
+	ExampleRows()
+
+	fmt.Println("\n=== CSV导入示例 ===")
+	ExampleImportCSV()
+
 	fmt.Println("\n====== 所有示例运行完毕 ======")
 }
@@ -283,47 +283,16 @@ func CreateExcel(filePath string, data map[string][][]interface{}) error {
 	return file.SaveAs(filePath)
 }
 
-// ExcelToCSV 将Excel文件转换为CSV文件
-func ExcelToCSV(excelPath, csvPath string, sheetName string) error {
-	// 打开Excel文件
-	file, err := excelize.OpenFile(excelPath)
+// ExcelToCSV 将Excel文件转换为CSV文件，sheetName为空时转换第一个工作表
+// options省略时按单元格数字格式输出UTF-8编码、逗号分隔的CSV
+func ExcelToCSV(excelPath, csvPath string, sheetName string, options ...CSVOptions) error {
+	processor, err := OpenExcelFile(excelPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	// 如果未指定工作表，使用第一个工作表
-	if sheetName == "" {
-		sheetName = file.GetSheetName(0)
-	}
-
-	// 获取工作表数据
-	rows, err := file.GetRows(sheetName)
-	if err != nil {
-		return err
-	}
-
-	// 创建CSV文件
-	return writeRowsToCSV(csvPath, rows)
-}
-
-// writeRowsToCSV 将行数据写入CSV文件
-func writeRowsToCSV(filePath string, rows [][]string) error {
-	file := excelize.NewFile()
-
-	sheet := "Sheet1"
-	for rowIndex, row := range rows {
-		for colIndex, cell := range row {
-			cellName, err := excelize.CoordinatesToCellName(colIndex+1, rowIndex+1)
-			if err != nil {
-				return err
-			}
-			file.SetCellValue(sheet, cellName, cell)
-		}
-	}
+	defer processor.Close()
 
-	// 保存为CSV
-	return file.SaveAs(filePath)
+	return writeCSVFile(processor, csvPath, sheetName, csvOptions(options))
 }
 
 // CellRangeToSlice 将单元格范围转换为二维数组
@@ -563,15 +532,9 @@ func (p *ExcelProcessor) BatchSetValues(data map[string]interface{}) error {
 }
 
 // ExportAsCSV 将当前工作表导出为CSV
-func (p *ExcelProcessor) ExportAsCSV(csvPath string) error {
-	// 获取当前工作表数据
-	rows, err := p.file.GetRows(p.sheetName)
-	if err != nil {
-		return err
-	}
-
-	// 创建CSV文件
-	return writeRowsToCSV(csvPath, rows)
+// options省略时按单元格数字格式输出UTF-8编码、逗号分隔的CSV
+func (p *ExcelProcessor) ExportAsCSV(csvPath string, options ...CSVOptions) error {
+	return writeCSVFile(p, csvPath, p.sheetName, csvOptions(options))
 }
 
 // ExportAsHTML 将当前工作表导出为HTML表格
@@ -0,0 +1,517 @@
+package excel
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// ColumnType CSV导入时的列类型
+type ColumnType int
+
+const (
+	ColumnAuto    ColumnType = iota // 根据数据自动推断
+	ColumnString                    // 文本
+	ColumnInt                       // 整数
+	ColumnFloat                     // 小数
+	ColumnPercent                   // 百分比，"12.5%"写入为0.125
+	ColumnDate                      // 日期或日期时间
+	ColumnBool                      // 布尔值
+)
+
+// String 返回列类型名称
+func (t ColumnType) String() string {
+	switch t {
+	case ColumnAuto:
+		return "自动"
+	case ColumnString:
+		return "文本"
+	case ColumnInt:
+		return "整数"
+	case ColumnFloat:
+		return "小数"
+	case ColumnPercent:
+		return "百分比"
+	case ColumnDate:
+		return "日期"
+	case ColumnBool:
+		return "布尔值"
+	}
+	return "未知类型" + strconv.Itoa(int(t))
+}
+
+// CSVColumn 导入CSV时对单列的显式设置
+type CSVColumn struct {
+	Type   ColumnType // 列类型，ColumnAuto表示自动推断
+	Format string     // 数字格式，如"#,##0.00"、"yyyy/mm/dd"，为空时按类型和数据选择
+	Layout string     // 日期的解析格式（Go时间格式，如"01/02/2006"），为空时识别常见格式
+}
+
+// CSVImportOptions CSV导入选项
+type CSVImportOptions struct {
+	Delimiter    rune                 // 字段分隔符，为0时根据第一行自动识别逗号、制表符、分号或竖线
+	Encoding     CSVEncoding          // 输入编码，为空时自动识别UTF-8和GBK（按GB18030解码）；开头的UTF-8 BOM总是被去掉
+	Header       bool                 // 第一行是否为表头，表头按原文写入，不参与类型推断
+	HeaderStyle  *excelize.Style      // 表头样式，为空时表头加粗
+	FreezeHeader bool                 // 是否冻结表头行
+	AutoWidth    bool                 // 是否按内容设置列宽
+	Columns      map[string]CSVColumn // 按表头名称或列字母（如"A"）显式指定列的设置，优先于自动推断；同一列只能使用其中一种
+}
+
+// csvNumberPattern 可识别的数字写法，允许千位分隔符
+var csvNumberPattern = regexp.MustCompile(`^[-+]?(\d{1,3}(,\d{3})+|\d+)?(\.\d+)?$`)
+
+// csvDateLayouts 自动推断时识别的日期格式，不包含月日顺序有歧义的格式
+var csvDateLayouts = []string{
+	"2006-1-2",
+	"2006-1-2 15:04:05",
+	"2006-1-2 15:04",
+	"2006-1-2T15:04:05",
+	"2006/1/2",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+	"2006.1.2",
+	"2006年1月2日",
+	"2006年1月2日 15:04:05",
+	"2006年1月2日 15:04",
+}
+
+// csvNumber 解析后的数字
+type csvNumber struct {
+	value    float64
+	decimals int  // 小数位数
+	grouped  bool // 包含千位分隔符
+}
+
+// parseCSVNumber 解析数字，strict为true时（自动推断）拒绝前导0和超过15位有效数字的值，
+// 这类值通常是编号、邮编或身份证号，按文本保存才不会丢失
+func parseCSVNumber(s string, strict bool) (csvNumber, bool) {
+	if !csvNumberPattern.MatchString(s) || strings.Trim(s, "+-.") == "" {
+		return csvNumber{}, false
+	}
+	n := csvNumber{grouped: strings.Contains(s, ",")}
+	digits := strings.TrimLeft(s, "+-")
+	intPart, fracPart, _ := strings.Cut(strings.ReplaceAll(digits, ",", ""), ".")
+	n.decimals = len(fracPart)
+	if strict {
+		if len(intPart) > 1 && intPart[0] == '0' {
+			return csvNumber{}, false
+		}
+		if len(strings.TrimLeft(intPart+fracPart, "0")) > 15 {
+			return csvNumber{}, false
+		}
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil {
+		return csvNumber{}, false
+	}
+	n.value = value
+	return n, true
+}
+
+// parseCSVDate 按给定的格式解析日期，时间按所写的时刻保存，不做时区换算
+func parseCSVDate(s string, layouts []string) (t time.Time, layout string, ok bool) {
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, layout, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+// inferBool 自动推断时识别的布尔值写法，不包含1/0和单个字母以免误判
+func inferBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "是", "否":
+		return true
+	}
+	return false
+}
+
+// csvColumnSpec 确定后的列类型和格式
+type csvColumnSpec struct {
+	typ     ColumnType
+	format  string
+	layouts []string
+	strict  bool // 类型为自动推断的结果
+}
+
+// newColumnSpec 根据显式设置和列中的数据确定列类型和格式
+func newColumnSpec(column CSVColumn, values []string) (*csvColumnSpec, error) {
+	if column.Type < ColumnAuto || column.Type > ColumnBool {
+		return nil, fmt.Errorf("无效的列类型 %d", column.Type)
+	}
+	spec := &csvColumnSpec{typ: column.Type, format: column.Format, layouts: csvDateLayouts}
+	if column.Layout != "" {
+		spec.layouts = []string{column.Layout}
+	}
+	if spec.typ == ColumnAuto {
+		spec.typ, spec.strict = inferColumnType(values, spec.layouts), true
+	}
+	if spec.format == "" {
+		spec.format = spec.defaultFormat(values)
+	}
+	return spec, nil
+}
+
+// inferColumnType 推断列类型，所有非空值都能转换为某个类型时才使用该类型，
+// 依次尝试整数、小数、百分比、日期、布尔值，都不满足或全为空时为文本
+func inferColumnType(values []string, layouts []string) ColumnType {
+	isInt, isFloat, isPercent, isDate, isBool := true, true, true, true, true
+	count := 0
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		count++
+		n, ok := parseCSVNumber(value, true)
+		isInt = isInt && ok && n.decimals == 0
+		isFloat = isFloat && ok
+		if isPercent {
+			_, ok = parseCSVNumber(strings.TrimSuffix(value, "%"), true)
+			isPercent = ok && strings.HasSuffix(value, "%")
+		}
+		if isDate {
+			_, _, isDate = parseCSVDate(value, layouts)
+		}
+		isBool = isBool && inferBool(value)
+	}
+	switch {
+	case count == 0:
+		return ColumnString
+	case isInt:
+		return ColumnInt
+	case isFloat:
+		return ColumnFloat
+	case isPercent:
+		return ColumnPercent
+	case isDate:
+		return ColumnDate
+	case isBool:
+		return ColumnBool
+	}
+	return ColumnString
+}
+
+// defaultFormat 按列类型选择数字格式，小数位数取列中最多的位数，千位分隔符与原数据一致
+func (s *csvColumnSpec) defaultFormat(values []string) string {
+	decimals, grouped, withTime, withSeconds := 0, false, false, false
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		switch s.typ {
+		case ColumnInt, ColumnFloat, ColumnPercent:
+			if n, ok := parseCSVNumber(strings.TrimSuffix(value, "%"), false); ok {
+				decimals, grouped = max(decimals, n.decimals), grouped || n.grouped
+			}
+		case ColumnDate:
+			if _, layout, ok := parseCSVDate(value, s.layouts); ok {
+				withTime = withTime || strings.Contains(layout, "15") || strings.Contains(layout, "03")
+				withSeconds = withSeconds || strings.Contains(layout, "05")
+			}
+		}
+	}
+	decimals = min(decimals, 10)
+	number := "0"
+	if grouped {
+		number = "#,##0"
+	}
+	switch s.typ {
+	case ColumnInt:
+		return number
+	case ColumnFloat:
+		if decimals == 0 {
+			return number
+		}
+		return number + "." + strings.Repeat("0", decimals)
+	case ColumnPercent:
+		if decimals == 0 {
+			return "0%"
+		}
+		return "0." + strings.Repeat("0", decimals) + "%"
+	case ColumnDate:
+		switch {
+		case withSeconds:
+			return "yyyy-mm-dd hh:mm:ss"
+		case withTime:
+			return "yyyy-mm-dd hh:mm"
+		}
+		return "yyyy-mm-dd"
+	}
+	return ""
+}
+
+// convert 将CSV字段转换为写入单元格的值，空字段为空单元格
+func (s *csvColumnSpec) convert(field string) (interface{}, error) {
+	value := strings.TrimSpace(field)
+	if value == "" {
+		return nil, nil
+	}
+	switch s.typ {
+	case ColumnInt:
+		n, ok := parseCSVNumber(value, s.strict)
+		if !ok || n.value != math.Trunc(n.value) || math.Abs(n.value) > 1<<53 {
+			return nil, fmt.Errorf("无法将 %q 转换为整数", value)
+		}
+		return int64(n.value), nil
+	case ColumnFloat:
+		n, ok := parseCSVNumber(value, s.strict)
+		if !ok {
+			return nil, fmt.Errorf("无法将 %q 转换为数字", value)
+		}
+		return n.value, nil
+	case ColumnPercent:
+		n, ok := parseCSVNumber(strings.TrimSuffix(value, "%"), s.strict)
+		if !ok {
+			return nil, fmt.Errorf("无法将 %q 转换为百分比", value)
+		}
+		if strings.HasSuffix(value, "%") {
+			n.value /= 100
+		}
+		return n.value, nil
+	case ColumnDate:
+		t, _, ok := parseCSVDate(value, s.layouts)
+		if !ok {
+			return nil, fmt.Errorf("无法将 %q 转换为日期", value)
+		}
+		return t, nil
+	case ColumnBool:
+		return parseCellBool(value)
+	}
+	return field, nil
+}
+
+// decodeCSVText 将CSV内容解码为UTF-8文本并去掉BOM，未指定编码时不是有效UTF-8的内容按GB18030（兼容GBK）解码
+func decodeCSVText(data []byte, encoding CSVEncoding) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	switch strings.ToUpper(string(encoding)) {
+	case "":
+		if utf8.Valid(data) {
+			return string(data), nil
+		}
+		return simplifiedchinese.GB18030.NewDecoder().String(string(data))
+	case "UTF-8", "UTF8":
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("CSV内容不是有效的UTF-8编码")
+		}
+		return string(data), nil
+	case "GBK":
+		return simplifiedchinese.GBK.NewDecoder().String(string(data))
+	case "GB18030":
+		return simplifiedchinese.GB18030.NewDecoder().String(string(data))
+	}
+	return "", fmt.Errorf("不支持的CSV编码 %s", encoding)
+}
+
+// detectDelimiter 统计第一行引号外的候选分隔符，取出现次数最多的一个，都没有时为逗号
+func detectDelimiter(text string) rune {
+	candidates := []rune{',', '\t', ';', '|'}
+	counts := make(map[rune]int, len(candidates))
+	quoted := false
+	for _, r := range text {
+		if r == '"' {
+			quoted = !quoted
+		} else if !quoted && (r == '\n' || r == '\r') {
+			break
+		} else if !quoted {
+			counts[r]++
+		}
+	}
+	delimiter := ','
+	for _, r := range candidates {
+		if counts[r] > counts[delimiter] {
+			delimiter = r
+		}
+	}
+	return delimiter
+}
+
+// displayWidth 估算文本的显示宽度，中文等宽字符按2计算
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x2E80 {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// ReadCSV 读取CSV/TSV并写入工作表，sheet为空时写入当前工作表，工作表不存在时自动创建，已存在时其原有内容将被覆盖
+// 每列的类型根据所有数据行推断，写入带类型的单元格并设置相应的数字格式；
+// 显式指定了类型的列中有无法转换的值时返回包含行号和列名的错误，此时不写入任何数据
+func (p *ExcelProcessor) ReadCSV(r io.Reader, sheet string, options CSVImportOptions) error {
+	if sheet == "" {
+		sheet = p.sheetName
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	text, err := decodeCSVText(data, options.Encoding)
+	if err != nil {
+		return err
+	}
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = options.Delimiter
+	if reader.Comma == 0 {
+		reader.Comma = detectDelimiter(text)
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return fmt.Errorf("解析CSV失败: %w", err)
+	}
+
+	var header []string
+	if options.Header && len(records) > 0 {
+		header, records = records[0], records[1:]
+	}
+	columns := len(header)
+	for _, record := range records {
+		columns = max(columns, len(record))
+	}
+
+	// 按表头名称或列字母匹配显式设置
+	used := make(map[string]bool, len(options.Columns))
+	specs := make([]*csvColumnSpec, columns)
+	values := make([]string, len(records))
+	for i := range specs {
+		letter, _ := excelize.ColumnNumberToName(i + 1)
+		column, ok := CSVColumn{}, false
+		if i < len(header) {
+			name := strings.TrimSpace(header[i])
+			if column, ok = options.Columns[name]; ok {
+				used[name] = true
+				if _, dup := options.Columns[letter]; dup && name != letter {
+					return fmt.Errorf("%s列同时按表头名称 %s 和列字母 %s 设置，只能使用其中一个", letter, name, letter)
+				}
+			}
+		}
+		if !ok {
+			if column, ok = options.Columns[letter]; ok {
+				used[letter] = true
+			}
+		}
+		for j, record := range records {
+			values[j] = ""
+			if i < len(record) {
+				values[j] = record[i]
+			}
+		}
+		if specs[i], err = newColumnSpec(column, values); err != nil {
+			return fmt.Errorf("%s列: %w", letter, err)
+		}
+	}
+	for name := range options.Columns {
+		if !used[name] {
+			return fmt.Errorf("CSV中没有列 %s", name)
+		}
+	}
+
+	// 先转换所有数据，出错时不写入工作表
+	firstRow := 1
+	if header != nil {
+		firstRow = 2
+	}
+	rows := make([][]interface{}, len(records))
+	widths := make([]float64, columns)
+	for i, name := range header {
+		widths[i] = float64(displayWidth(name))
+	}
+	for i, record := range records {
+		rows[i] = make([]interface{}, len(record))
+		for j, field := range record {
+			if rows[i][j], err = specs[j].convert(field); err != nil {
+				letter, _ := excelize.ColumnNumberToName(j + 1)
+				return fmt.Errorf("第%d行 %s列: %w", firstRow+i, letter, err)
+			}
+			widths[j] = max(widths[j], float64(displayWidth(strings.TrimSpace(field))))
+		}
+	}
+
+	streamOptions := StreamOptions{FreezeHeader: options.FreezeHeader, ColumnFormats: make([]string, columns)}
+	for i, spec := range specs {
+		streamOptions.ColumnFormats[i] = spec.format
+	}
+	if options.AutoWidth {
+		for i := range widths {
+			widths[i] = min(max(widths[i]+2, 8), 60)
+		}
+		streamOptions.ColumnWidths = widths
+	}
+	if header != nil {
+		streamOptions.Header = make([]interface{}, len(header))
+		for i, name := range header {
+			streamOptions.Header[i] = name
+		}
+		streamOptions.HeaderStyle = options.HeaderStyle
+		if streamOptions.HeaderStyle == nil {
+			streamOptions.HeaderStyle = &excelize.Style{Font: &excelize.Font{Bold: true}}
+		}
+	}
+	writer, err := p.NewStreamWriter(sheet, streamOptions)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err = writer.WriteRow(row...); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// ImportCSV 将CSV/TSV文件导入新的工作簿，工作表以文件名命名，保存请调用Save
+func ImportCSV(csvPath string, options CSVImportOptions) (*ExcelProcessor, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	processor := NewExcelProcessor()
+	if sheet := csvSheetName(csvPath); sheet != "" && sheet != processor.sheetName {
+		if err = processor.file.SetSheetName(processor.sheetName, sheet); err != nil {
+			processor.Close()
+			return nil, err
+		}
+		processor.sheetName = sheet
+	}
+	if err = processor.ReadCSV(file, "", options); err != nil {
+		processor.Close()
+		return nil, err
+	}
+	return processor, nil
+}
+
+// csvSheetName 由文件名生成工作表名，去掉工作表名不允许的字符并截断到31个字符
+func csvSheetName(csvPath string) string {
+	name := strings.TrimSuffix(filepath.Base(csvPath), filepath.Ext(csvPath))
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "' ")
+	if runes := []rune(name); len(runes) > excelize.MaxSheetNameLength {
+		name = string(runes[:excelize.MaxSheetNameLength])
+	}
+	return name
+}
@@ -0,0 +1,187 @@
+package excel
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// gbk 将UTF-8文本编码为GBK
+func gbk(t *testing.T, text string) string {
+	t.Helper()
+	encoded, err := simplifiedchinese.GBK.NewEncoder().String(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestDecodeCSVText(t *testing.T) {
+	text := "名称,数量\n键盘,1\n"
+	tests := []struct {
+		name     string
+		data     string
+		encoding CSVEncoding
+		err      bool
+	}{
+		{"utf-8", text, "", false},
+		{"utf-8 bom", "\uFEFF" + text, "", false},
+		{"explicit utf-8 bom", "\uFEFF" + text, EncodingUTF8, false},
+		{"gbk detected", gbk(t, text), "", false},
+		{"explicit gbk", gbk(t, text), EncodingGBK, false},
+		{"explicit gb18030", gbk(t, text), EncodingGB18030, false},
+		{"gbk as utf-8", gbk(t, text), EncodingUTF8, true},
+		{"unsupported", text, "BIG5", true},
+	}
+	for _, tt := range tests {
+		got, err := decodeCSVText([]byte(tt.data), tt.encoding)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected error", tt.name)
+			}
+			continue
+		}
+		if err != nil || got != text {
+			t.Errorf("%s: %q, %v", tt.name, got, err)
+		}
+	}
+}
+
+func TestInferColumnType(t *testing.T) {
+	tests := []struct {
+		values []string
+		typ    ColumnType
+		format string
+	}{
+		{[]string{"1", "-20", ""}, ColumnInt, "0"},
+		{[]string{"1,234", "56"}, ColumnInt, "#,##0"},
+		{[]string{"1,234.5", "2.25"}, ColumnFloat, "#,##0.00"},
+		{[]string{"1.5", "2"}, ColumnFloat, "0.0"},
+		{[]string{"12.5%", "3%"}, ColumnPercent, "0.0%"},
+		{[]string{"12%", "3"}, ColumnString, ""},
+		{[]string{"007", "123"}, ColumnString, ""},
+		{[]string{"0.5", "0"}, ColumnFloat, "0.0"},
+		{[]string{"110101199003071234"}, ColumnString, ""},
+		{[]string{"1,23", "4"}, ColumnString, ""},
+		{[]string{"2024-01-02", "2024/1/3"}, ColumnDate, "yyyy-mm-dd"},
+		{[]string{"2024-01-02 08:30", "2024-01-03"}, ColumnDate, "yyyy-mm-dd hh:mm"},
+		{[]string{"01/02/2024"}, ColumnString, ""},
+		{[]string{"是", "否", "TRUE"}, ColumnBool, ""},
+		{[]string{"1", "0", "是"}, ColumnString, ""},
+		{[]string{"", " "}, ColumnString, ""},
+	}
+	for _, tt := range tests {
+		spec, err := newColumnSpec(CSVColumn{}, tt.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.typ != tt.typ || spec.format != tt.format {
+			t.Errorf("%q: %s %q, want %s %q", tt.values, spec.typ, spec.format, tt.typ, tt.format)
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	csvText := "编号;名称;金额;占比;日期;已付;邮编\n" +
+		"007;键盘;\"1,234\";12.5%;01/02/2024;是;010000\n" +
+		"012;\"鼠标;无线\";56;3%;01/03/2024;否;\n"
+	path := filepath.Join(t.TempDir(), "订单:2024.csv")
+	if err := os.WriteFile(path, []byte(gbk(t, csvText)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ImportCSV(path, CSVImportOptions{
+		Header:    true,
+		AutoWidth: true,
+		Columns: map[string]CSVColumn{
+			"金额": {Type: ColumnFloat, Format: "#,##0.00"},
+			"日期": {Type: ColumnDate, Layout: "01/02/2006"},
+			"G":  {Type: ColumnInt},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.sheetName != "订单_2024" {
+		t.Errorf("sheet = %q", p.sheetName)
+	}
+
+	f := reopen(t, p)
+	formatter := &cellFormatter{file: f, sheet: p.sheetName, codes: make(map[int]string)}
+	want := [][]string{
+		{"编号", "名称", "金额", "占比", "日期", "已付", "邮编"},
+		{"007", "键盘", "1,234.00", "12.5%", "2024-01-02", "TRUE", "10000"},
+		{"012", "鼠标;无线", "56.00", "3.0%", "2024-01-03", "FALSE"},
+	}
+	rows, err := f.GetRows(p.sheetName, excelize.Options{RawCellValue: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([][]string, len(rows))
+	for i, row := range rows {
+		for j, raw := range row {
+			cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			text, err := formatter.format(cell, raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[i] = append(got[i], text)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+	// 前导0的编号保存为文本（流式写入为内联字符串），数字保存为带类型的数值
+	types := map[string]excelize.CellType{"A2": excelize.CellTypeInlineString, "C2": excelize.CellTypeUnset, "D2": excelize.CellTypeUnset}
+	for cell, typ := range types {
+		if got, _ := f.GetCellType(p.sheetName, cell); got != typ {
+			t.Errorf("%s type = %v, want %v", cell, got, typ)
+		}
+	}
+	if raw, _ := f.GetCellValue(p.sheetName, "D2", excelize.Options{RawCellValue: true}); raw != "0.125" {
+		t.Errorf("percent raw value = %q", raw)
+	}
+	if width, _ := f.GetColWidth(p.sheetName, "B"); width != 11 {
+		t.Errorf("column B width = %v", width)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	csvText := "编号,金额\n1,12\n2,abc\n"
+	tests := []struct {
+		name    string
+		columns map[string]CSVColumn
+		want    string
+	}{
+		{"conversion", map[string]CSVColumn{"金额": {Type: ColumnInt}}, "第3行 B列"},
+		{"missing column", map[string]CSVColumn{"备注": {Type: ColumnString}}, "CSV中没有列 备注"},
+		{"invalid type", map[string]CSVColumn{"A": {Type: ColumnType(99)}}, "A列: 无效的列类型"},
+		{"ambiguous", map[string]CSVColumn{"金额": {Type: ColumnInt}, "B": {Type: ColumnString}}, "B列同时按表头名称 金额 和列字母 B 设置"},
+	}
+	for _, tt := range tests {
+		p := NewExcelProcessor()
+		err := p.ReadCSV(strings.NewReader(csvText), "", CSVImportOptions{Header: true, Columns: tt.columns})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+		if rows, _ := p.file.GetRows("Sheet1"); len(rows) != 0 {
+			t.Errorf("%s: nothing should be written, got %q", tt.name, rows)
+		}
+		p.Close()
+	}
+
+	// 没有显式设置时混合的列按文本导入
+	p := NewExcelProcessor()
+	defer p.Close()
+	if err := p.ReadCSV(strings.NewReader(csvText), "", CSVImportOptions{Header: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopen(t, p).GetCellType("Sheet1", "B2"); got != excelize.CellTypeInlineString {
+		t.Errorf("mixed column type = %v", got)
+	}
+}
@@ -0,0 +1,575 @@
+package excel
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 结构体与工作表之间的映射，字段通过excel标签配置，例如：
+//
+//	type Product struct {
+//		Name  string  `excel:"name=产品名称,width=20,required"`
+//		Price float64 `excel:"name=价格,format=0.00"`
+//		Note  string  `excel:"-"`
+//	}
+//
+// 标签选项：name为表头名称（默认为字段名），width为列宽，format为数字格式（含逗号时用单引号括起），
+// required表示读取时单元格不能为空，"-"表示忽略该字段。匿名嵌入的结构体字段会被展开。
+
+// fieldSpec 结构体字段与列的映射
+type fieldSpec struct {
+	index    []int
+	name     string
+	width    float64
+	format   string
+	required bool
+}
+
+// structSchema 结构体对应的所有列
+type structSchema struct {
+	fields []fieldSpec
+}
+
+// schemaCache 按结构体类型缓存解析结果
+var schemaCache sync.Map
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// schemaOf 解析结构体类型的excel标签
+func schemaOf(t reflect.Type) (*structSchema, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("类型 %s 不是结构体", t)
+	}
+	if s, ok := schemaCache.Load(t); ok {
+		return s.(*structSchema), nil
+	}
+	s := &structSchema{}
+	if err := s.collect(t, nil); err != nil {
+		return nil, err
+	}
+	if len(s.fields) == 0 {
+		return nil, fmt.Errorf("结构体 %s 没有可导出的字段", t)
+	}
+	seen := make(map[string]bool, len(s.fields))
+	for _, f := range s.fields {
+		if seen[f.name] {
+			return nil, fmt.Errorf("结构体 %s 的表头名称 %s 重复", t, f.name)
+		}
+		seen[f.name] = true
+	}
+	schemaCache.Store(t, s)
+	return s, nil
+}
+
+// collect 收集结构体的字段，展开匿名嵌入的结构体
+func (s *structSchema) collect(t reflect.Type, parent []int) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("excel")
+		if tag == "-" {
+			continue
+		}
+		index := append(append([]int{}, parent...), i)
+		if sf.Anonymous && tag == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != timeType {
+				if sf.Type.Kind() == reflect.Ptr {
+					return fmt.Errorf("字段 %s: 不支持嵌入结构体指针", sf.Name)
+				}
+				if err := s.collect(ft, index); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		spec, err := parseFieldTag(sf.Name, tag)
+		if err != nil {
+			return err
+		}
+		if !supportedFieldType(sf.Type) {
+			return fmt.Errorf("字段 %s: 不支持的类型 %s", sf.Name, sf.Type)
+		}
+		spec.index = index
+		s.fields = append(s.fields, spec)
+	}
+	return nil
+}
+
+// splitTag 按逗号拆分标签选项，单引号内的逗号不拆分
+func splitTag(tag string) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(tag); i++ {
+		switch tag[i] {
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, tag[start:])
+}
+
+// parseFieldTag 解析excel标签，形如"name=产品名称,width=20,format=0.00,required"
+// 含逗号的值用单引号括起，如format='#,##0.00'
+func parseFieldTag(fieldName, tag string) (fieldSpec, error) {
+	spec := fieldSpec{name: fieldName}
+	for _, part := range splitTag(tag) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		if v := strings.TrimSpace(value); len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+			value = v[1 : len(v)-1]
+		}
+		switch strings.TrimSpace(key) {
+		case "name":
+			if value = strings.TrimSpace(value); value != "" {
+				spec.name = value
+			}
+		case "width":
+			width, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || width <= 0 {
+				return spec, fmt.Errorf("字段 %s: 无效的列宽 %q", fieldName, value)
+			}
+			spec.width = width
+		case "format":
+			spec.format = value
+		case "required":
+			spec.required = true
+		default:
+			return spec, fmt.Errorf("字段 %s: 未知的标签选项 %q", fieldName, key)
+		}
+	}
+	return spec, nil
+}
+
+// supportedFieldType 判断字段类型能否与单元格相互转换
+func supportedFieldType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType || t.Implements(textUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// headers 返回所有列的表头
+func (s *structSchema) headers() []interface{} {
+	headers := make([]interface{}, len(s.fields))
+	for i, f := range s.fields {
+		headers[i] = f.name
+	}
+	return headers
+}
+
+// cellValues 将结构体转换为一行单元格的值，空指针和零值时间写为空单元格
+func (s *structSchema) cellValues(v reflect.Value) []interface{} {
+	values := make([]interface{}, len(s.fields))
+	for i, f := range s.fields {
+		fv := v.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		switch {
+		case fv.Type() == timeType:
+			if t := fv.Interface().(time.Time); !t.IsZero() {
+				values[i] = t
+			}
+		case fv.Type().Implements(textMarshalerType):
+			text, err := fv.Interface().(encoding.TextMarshaler).MarshalText()
+			if err == nil {
+				values[i] = string(text)
+			}
+		default:
+			values[i] = fv.Interface()
+		}
+	}
+	return values
+}
+
+// applyColumns 设置各列的列宽和数据区域（第firstRow到lastRow行）的数字格式
+func (s *structSchema) applyColumns(file *excelize.File, sheet string, firstRow, lastRow int) error {
+	for i, f := range s.fields {
+		col, err := excelize.ColumnNumberToName(i + 1)
+		if err != nil {
+			return err
+		}
+		if f.width > 0 {
+			if err = file.SetColWidth(sheet, col, col, f.width); err != nil {
+				return err
+			}
+		}
+		if f.format == "" || lastRow < firstRow {
+			continue
+		}
+		format := f.format
+		style, err := file.NewStyle(&excelize.Style{CustomNumFmt: &format})
+		if err != nil {
+			return err
+		}
+		if err = file.SetCellStyle(sheet, col+strconv.Itoa(firstRow), col+strconv.Itoa(lastRow), style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Marshal 将结构体切片写入工作表，第一行为表头，之后每个元素一行
+// 工作表不存在时自动创建，不改变处理器的当前工作表；工作表已存在时，原有内容中超出新数据范围的
+// 行和列会被清空（保留单元格样式），T为指针类型时元素不能为nil
+func Marshal[T any](processor *ExcelProcessor, sheet string, rows []T) error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	isPtr := t.Kind() == reflect.Ptr
+	if isPtr {
+		t = t.Elem()
+	}
+	schema, err := schemaOf(t)
+	if err != nil {
+		return err
+	}
+	if isPtr {
+		for i, row := range rows {
+			if reflect.ValueOf(row).IsNil() {
+				return fmt.Errorf("第%d个元素为nil", i+1)
+			}
+		}
+	}
+	file := processor.file
+	if sheet == "" {
+		sheet = processor.sheetName
+	}
+	var oldRows [][]string
+	if processor.SheetExists(sheet) {
+		if oldRows, err = file.GetRows(sheet, excelize.Options{RawCellValue: true}); err != nil {
+			return err
+		}
+	} else if _, err = file.NewSheet(sheet); err != nil {
+		return err
+	}
+	headers := schema.headers()
+	if err = file.SetSheetRow(sheet, "A1", &headers); err != nil {
+		return err
+	}
+	for i, row := range rows {
+		v := reflect.ValueOf(row)
+		if isPtr {
+			v = v.Elem()
+		}
+		values := schema.cellValues(v)
+		if err = file.SetSheetRow(sheet, "A"+strconv.Itoa(i+2), &values); err != nil {
+			return err
+		}
+	}
+	// 清空原有内容中新数据没有覆盖的单元格
+	for i, old := range oldRows {
+		from := 0
+		if i <= len(rows) {
+			from = len(headers)
+		}
+		for col := from; col < len(old); col++ {
+			cell, err := excelize.CoordinatesToCellName(col+1, i+1)
+			if err != nil {
+				return err
+			}
+			if err = file.SetCellValue(sheet, cell, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return schema.applyColumns(file, sheet, 2, len(rows)+1)
+}
+
+// UnmarshalError 读取单元格时的错误
+type UnmarshalError struct {
+	Row    int    // 行号，从1开始
+	Column string // 列名，如"B"，表头缺失时为空
+	Field  string // 结构体字段名
+	Header string // 表头名称
+	Err    error
+}
+
+func (e *UnmarshalError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("字段 %s（%s）: %v", e.Field, e.Header, e.Err)
+	}
+	return fmt.Sprintf("第%d行 %s列 字段 %s（%s）: %v", e.Row, e.Column, e.Field, e.Header, e.Err)
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// UnmarshalErrors 读取工作表时的所有错误
+type UnmarshalErrors []*UnmarshalError
+
+func (e UnmarshalErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// headerBinding 结构体字段与工作表列的对应关系，column为从0开始的列序号，-1表示工作表中没有该列
+type headerBinding struct {
+	schema  *structSchema
+	columns []int
+}
+
+// bindHeader 按表头名称（忽略首尾空白）匹配列，列的顺序可以与字段顺序不同
+// 必填字段缺少对应的列时返回错误
+func (s *structSchema) bindHeader(header []string, t reflect.Type) (*headerBinding, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, ok := positions[name]; !ok && name != "" {
+			positions[name] = i
+		}
+	}
+	b := &headerBinding{schema: s, columns: make([]int, len(s.fields))}
+	var errs UnmarshalErrors
+	for i, f := range s.fields {
+		col, ok := positions[f.name]
+		if !ok {
+			col = -1
+			if f.required {
+				errs = append(errs, &UnmarshalError{Row: 1, Field: fieldName(t, f.index), Header: f.name, Err: fmt.Errorf("缺少必填列")})
+			}
+		}
+		b.columns[i] = col
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return b, nil
+}
+
+// fieldName 返回字段在结构体中的名称
+func fieldName(t reflect.Type, index []int) string {
+	return t.FieldByIndex(index).Name
+}
+
+// decodeRow 将一行原始单元格值写入结构体，rowNum为行号（从1开始）
+func (b *headerBinding) decodeRow(row []string, rowNum int, v reflect.Value) UnmarshalErrors {
+	var errs UnmarshalErrors
+	for i, f := range b.schema.fields {
+		col := b.columns[i]
+		cell := ""
+		if col >= 0 && col < len(row) {
+			cell = strings.TrimSpace(row[col])
+		}
+		var err error
+		if cell == "" {
+			if f.required {
+				err = fmt.Errorf("必填字段为空")
+			}
+		} else {
+			err = setField(v.FieldByIndex(f.index), cell)
+		}
+		if err != nil {
+			name, _ := excelize.ColumnNumberToName(col + 1)
+			errs = append(errs, &UnmarshalError{Row: rowNum, Column: name, Field: fieldName(v.Type(), f.index), Header: f.name, Err: err})
+		}
+	}
+	return errs
+}
+
+// setField 将单元格的原始值转换为字段类型，数字为未应用数字格式的值，日期为Excel序列号或常见的日期字符串
+func setField(fv reflect.Value, cell string) error {
+	if fv.Kind() == reflect.Ptr {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setField(ptr.Elem(), cell); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+	if fv.Type() == timeType {
+		t, err := parseCellTime(cell)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(cell))
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(cell)
+	case reflect.Bool:
+		b, err := parseCellBool(cell)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(cell, 10, fv.Type().Bits())
+		if err != nil {
+			// 原始值可能带有小数部分，如"12.0"
+			f, ferr := strconv.ParseFloat(cell, 64)
+			if ferr != nil || f != float64(int64(f)) || fv.OverflowInt(int64(f)) {
+				return fmt.Errorf("无法将 %q 转换为整数", cell)
+			}
+			n = int64(f)
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(cell, 10, fv.Type().Bits())
+		if err != nil {
+			f, ferr := strconv.ParseFloat(cell, 64)
+			if ferr != nil || f < 0 || f != float64(uint64(f)) || fv.OverflowUint(uint64(f)) {
+				return fmt.Errorf("无法将 %q 转换为非负整数", cell)
+			}
+			n = uint64(f)
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(cell, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("无法将 %q 转换为数字", cell)
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的类型 %s", fv.Type())
+	}
+	return nil
+}
+
+// cellTimeLayouts 可识别的日期时间字符串格式
+var cellTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"2006/1/2",
+	"2006-1-2",
+	"2006.01.02",
+	"2006年1月2日",
+	"15:04:05",
+}
+
+// parseCellTime 解析Excel日期序列号或日期字符串
+func parseCellTime(cell string) (time.Time, error) {
+	if f, err := strconv.ParseFloat(cell, 64); err == nil {
+		return excelize.ExcelDateToTime(f, false)
+	}
+	for _, layout := range cellTimeLayouts {
+		if t, err := time.ParseInLocation(layout, cell, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法将 %q 转换为日期", cell)
+}
+
+// parseCellBool 解析布尔值，支持TRUE/FALSE、1/0、是/否等写法
+func parseCellBool(cell string) (bool, error) {
+	switch strings.ToLower(cell) {
+	case "1", "true", "t", "yes", "y", "是", "对", "√":
+		return true, nil
+	case "0", "false", "f", "no", "n", "否", "错", "×":
+		return false, nil
+	}
+	return false, fmt.Errorf("无法将 %q 转换为布尔值", cell)
+}
+
+// Unmarshal 按表头名称将工作表读取到结构体切片，第一行为表头，完全为空的行被跳过
+// 列的顺序可以与字段顺序不同，表头中没有的非必填字段保持零值；
+// 任何单元格转换失败时返回包含所有错误行、列和字段的UnmarshalErrors，且不修改out
+func Unmarshal[T any](processor *ExcelProcessor, sheet string, out *[]T) error {
+	if out == nil {
+		return fmt.Errorf("out不能为空")
+	}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	isPtr := t.Kind() == reflect.Ptr
+	if isPtr {
+		t = t.Elem()
+	}
+	schema, err := schemaOf(t)
+	if err != nil {
+		return err
+	}
+	if sheet == "" {
+		sheet = processor.sheetName
+	}
+	if !processor.SheetExists(sheet) {
+		return fmt.Errorf("工作表 %s 不存在", sheet)
+	}
+	rows, err := processor.file.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("工作表 %s 缺少表头", sheet)
+	}
+	binding, err := schema.bindHeader(rows[0], t)
+	if err != nil {
+		return err
+	}
+	result := make([]T, 0, len(rows)-1)
+	var errs UnmarshalErrors
+	for i, row := range rows[1:] {
+		if isEmptyRow(row) {
+			continue
+		}
+		item := reflect.New(t)
+		errs = append(errs, binding.decodeRow(row, i+2, item.Elem())...)
+		if isPtr {
+			result = append(result, item.Interface().(T))
+		} else {
+			result = append(result, item.Elem().Interface().(T))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	*out = result
+	return nil
+}
+
+// isEmptyRow 判断一行是否所有单元格都为空白
+func isEmptyRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
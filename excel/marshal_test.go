@@ -0,0 +1,148 @@
+package excel
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// grade 通过TextMarshaler读写的字段类型
+type grade int
+
+func (g grade) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("A", int(g))), nil
+}
+
+func (g *grade) UnmarshalText(text []byte) error {
+	if strings.Trim(string(text), "A") != "" {
+		return fmt.Errorf("invalid grade %q", text)
+	}
+	*g = grade(len(text))
+	return nil
+}
+
+type marshalItem struct {
+	Name   string   `excel:"name=名称,required"`
+	Price  float64  `excel:"name=价格,format='#,##0.00'"`
+	Ratio  float64  `excel:"name=占比,format=0.0%"`
+	OnSale bool     `excel:"name=在售"`
+	Stock  *int     `excel:"name=库存"`
+	Note   *string  `excel:"name=备注"`
+	Grade  grade    `excel:"name=等级"`
+	Skip   string   `excel:"-"`
+	Tags   []string `excel:"-"`
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	stock, note := 12, "新品"
+	items := []marshalItem{
+		{Name: "键盘", Price: 1234.5, Ratio: 0.125, OnSale: true, Stock: &stock, Note: &note, Grade: 3},
+		{Name: "鼠标", Price: 0.5, Ratio: 1, Grade: 1},
+	}
+	p := NewExcelProcessor()
+	defer p.Close()
+	if err := Marshal(p, "商品", items); err != nil {
+		t.Fatal(err)
+	}
+	// 数字格式按format标签写入
+	formatter := &cellFormatter{file: p.file, sheet: "商品", codes: make(map[int]string)}
+	cells := map[string]string{"A1": "名称", "B2": "1,234.50", "B3": "0.50", "C2": "12.5%", "D2": "TRUE", "D3": "FALSE", "G2": "AAA"}
+	for cell, want := range cells {
+		raw, _ := p.file.GetCellValue("商品", cell, excelize.Options{RawCellValue: true})
+		if got, err := formatter.format(cell, raw); err != nil || got != want {
+			t.Errorf("%s = %q, want %q (%v)", cell, got, want, err)
+		}
+	}
+	if got, _ := p.file.GetCellValue("商品", "E3"); got != "" {
+		t.Errorf("nil pointer cell = %q", got)
+	}
+
+	var loaded []marshalItem
+	if err := Unmarshal(p, "商品", &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, items) {
+		t.Errorf("loaded = %+v, want %+v", loaded, items)
+	}
+
+	var pointers []*marshalItem
+	if err := Unmarshal(p, "商品", &pointers); err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 2 || !reflect.DeepEqual(*pointers[0], items[0]) {
+		t.Errorf("pointers = %+v", pointers)
+	}
+	if err := Marshal(p, "指针", pointers); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := p.file.GetCellValue("指针", "A3"); got != "鼠标" {
+		t.Errorf("pointer rows A3 = %q", got)
+	}
+}
+
+func TestMarshalNilElement(t *testing.T) {
+	p := NewExcelProcessor()
+	defer p.Close()
+	err := Marshal(p, "商品", []*marshalItem{{Name: "键盘"}, nil, {Name: "鼠标"}})
+	if err == nil || !strings.Contains(err.Error(), "第2个元素为nil") {
+		t.Fatalf("err = %v", err)
+	}
+	if p.SheetExists("商品") {
+		t.Error("sheet should not be created when marshal fails")
+	}
+}
+
+func TestMarshalOverwrite(t *testing.T) {
+	type narrow struct {
+		Name string `excel:"name=名称"`
+	}
+	p := NewExcelProcessor()
+	defer p.Close()
+	items := []marshalItem{{Name: "键盘", Price: 1}, {Name: "鼠标", Price: 2}, {Name: "耳机", Price: 3}}
+	if err := Marshal(p, "商品", items); err != nil {
+		t.Fatal(err)
+	}
+	// 行数和列数都减少后，原有的多余内容被清空
+	if err := Marshal(p, "商品", []narrow{{Name: "显示器"}}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := p.file.GetRows("商品")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"名称"}, {"显示器"}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	p := NewExcelProcessor()
+	defer p.Close()
+	rows := [][]interface{}{
+		{"在售", "名称", "库存", "等级"},
+		{"是", "键盘", "12", "AA"},
+		{"maybe", "", "1.5", "B"},
+	}
+	for i, row := range rows {
+		if err := p.file.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+1), &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var loaded []marshalItem
+	err := Unmarshal(p, "", &loaded)
+	errs, ok := err.(UnmarshalErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("err = %v", err)
+	}
+	for i, want := range []string{"第3行 B列 字段 Name（名称）", "第3行 A列 字段 OnSale（在售）", "第3行 C列 字段 Stock（库存）", "第3行 D列 字段 Grade（等级）"} {
+		if !strings.HasPrefix(errs[i].Error(), want) {
+			t.Errorf("errs[%d] = %v, want prefix %q", i, errs[i], want)
+		}
+	}
+	if loaded != nil {
+		t.Error("out should not be modified on error")
+	}
+}
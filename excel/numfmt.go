@@ -0,0 +1,495 @@
+package excel
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 数字格式渲染：excelize只对日期格式和少数内置格式做了格式化，自定义的数字格式（如"#,##0.00"、"0.0%"、
+// "¥#,##0;[Red]-¥#,##0"）会原样返回数值，这里按Excel的规则实现数字部分：
+// 常规格式（最多11个字符，必要时使用科学计数法）、正数;负数;零;文本四个分节、千位分隔符、尾部逗号缩放、百分比、科学计数法、引号和反斜杠字面量。
+// 日期时间、分数和带条件（如[>=1000]）的格式仍交给excelize处理。
+
+// builtinNumberFormats 内置数字格式ID对应的格式代码（日期时间格式除外）
+var builtinNumberFormats = map[int]string{
+	0:  "General",
+	1:  "0",
+	2:  "0.00",
+	3:  "#,##0",
+	4:  "#,##0.00",
+	9:  "0%",
+	10: "0.00%",
+	11: "0.00E+00",
+	37: "#,##0_);(#,##0)",
+	38: "#,##0_);[Red](#,##0)",
+	39: "#,##0.00_);(#,##0.00)",
+	40: "#,##0.00_);[Red](#,##0.00)",
+	48: "##0.0E+0",
+	49: "@",
+}
+
+// numFmtToken 格式分节中的一个元素，digit为数字占位符（0、#、?），general表示常规格式的位置
+type numFmtToken struct {
+	literal string
+	digit   byte
+	general bool
+}
+
+// numFmtSection 解析后的一个格式分节
+type numFmtSection struct {
+	integer  []numFmtToken // 小数点前的元素
+	fraction []numFmtToken // 小数点与指数之间的元素
+	exponent []numFmtToken // 指数部分的元素
+	expSign  bool          // 指数为E+时正指数也显示符号
+	hasExp   bool
+	hasPoint bool
+	grouping bool // 使用千位分隔符
+	scale    int  // 尾部逗号的个数，每个表示除以1000
+	percent  int  // 百分号的个数，每个表示乘以100
+	text     bool // 包含文本占位符@
+	general  bool // 包含常规格式General，如"[Blue]-General"
+	special  bool // 包含日期时间或分数等需要交给excelize处理的元素
+	cond     bool // 包含条件，如[>=1000]，按条件选择分节，需要交给excelize处理
+}
+
+// splitNumFmtSections 按分号拆分格式分节，忽略引号、反斜杠转义和方括号内的分号
+func splitNumFmtSections(code string) []string {
+	var sections []string
+	start, quoted, bracket := 0, false, false
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\\':
+			i++
+		case c == '[':
+			bracket = true
+		case c == ']':
+			bracket = false
+		case c == ';' && !bracket:
+			sections = append(sections, code[start:i])
+			start = i + 1
+		}
+	}
+	return append(sections, code[start:])
+}
+
+// parseNumFmtSection 解析一个格式分节
+func parseNumFmtSection(code string) numFmtSection {
+	var s numFmtSection
+	runes := []rune(code)
+	part := &s.integer
+	lastDigit := -1 // 最后一个数字占位符在part中的位置
+	pendingCommas := 0
+	flushCommas := func() {
+		// 占位符之间的逗号为千位分隔符，之后再无占位符的逗号为缩放
+		if pendingCommas > 0 && part == &s.integer {
+			s.grouping = true
+		}
+		pendingCommas = 0
+	}
+	addLiteral := func(text string) {
+		if pendingCommas > 0 {
+			s.scale += pendingCommas
+			pendingCommas = 0
+		}
+		*part = append(*part, numFmtToken{literal: text})
+	}
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case (c == 'G' || c == 'g') && i+7 <= len(runes) && strings.EqualFold(string(runes[i:i+7]), "General"):
+			s.general = true
+			*part = append(*part, numFmtToken{general: true})
+			i += 6
+		case c == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			addLiteral(string(runes[i+1 : min(end, len(runes))]))
+			i = end
+		case c == '\\' && i+1 < len(runes):
+			addLiteral(string(runes[i+1]))
+			i++
+		case c == '_' && i+1 < len(runes):
+			addLiteral(" ")
+			i++
+		case c == '*' && i+1 < len(runes):
+			i++
+		case c == '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			inner := string(runes[i+1 : min(end, len(runes))])
+			if strings.HasPrefix(inner, "$") {
+				// 货币符号，如[$¥-804]
+				symbol, _, _ := strings.Cut(inner[1:], "-")
+				addLiteral(symbol)
+			} else if lower := strings.ToLower(inner); strings.Trim(lower, "hms") == "" && lower != "" {
+				s.special = true // 经过的时间，如[h]
+			} else if strings.ContainsAny(inner[:min(1, len(inner))], "<>=") {
+				s.cond = true
+			}
+			// 颜色忽略
+			i = end
+		case c == '0' || c == '#' || c == '?':
+			if pendingCommas > 0 {
+				flushCommas()
+			}
+			*part = append(*part, numFmtToken{digit: byte(c)})
+			lastDigit = len(*part) - 1
+		case c == ',':
+			if lastDigit >= 0 {
+				pendingCommas++
+			} else {
+				addLiteral(",")
+			}
+		case c == '.' && !s.hasPoint && !s.hasExp:
+			s.scale += pendingCommas
+			pendingCommas = 0
+			s.hasPoint = true
+			part, lastDigit = &s.fraction, -1
+		case (c == 'E' || c == 'e') && i+1 < len(runes) && (runes[i+1] == '+' || runes[i+1] == '-') && !s.hasExp:
+			s.scale += pendingCommas
+			pendingCommas = 0
+			s.hasExp, s.expSign = true, runes[i+1] == '+'
+			part, lastDigit = &s.exponent, -1
+			i++
+		case c == '%':
+			s.percent++
+			addLiteral("%")
+		case c == '@':
+			s.text = true
+			addLiteral("@")
+		case c == '/' || strings.ContainsRune("yYmMdDhHsS", c) || (c == 'A' || c == 'a') && i+4 < len(runes) && strings.EqualFold(string(runes[i:i+5]), "AM/PM"):
+			s.special = true
+			addLiteral(string(c))
+		default:
+			addLiteral(string(c))
+		}
+	}
+	s.scale += pendingCommas
+	return s
+}
+
+// digitCount 统计元素中各类数字占位符的个数
+func digitCount(tokens []numFmtToken) (total, zeros int) {
+	for _, t := range tokens {
+		if t.digit != 0 {
+			total++
+			if t.digit == '0' {
+				zeros++
+			}
+		}
+	}
+	return total, zeros
+}
+
+// formatNumber 按数字格式代码格式化数值，ok为false表示格式需要交给excelize处理（日期时间、分数、条件）
+func formatNumber(value float64, code string) (string, bool) {
+	if code == "" || strings.EqualFold(code, "General") {
+		return generalNumber(value), true
+	}
+	sections := splitNumFmtSections(code)
+	// 带条件的格式按条件而不是正负选择分节，条件可能出现在任一分节中
+	for _, section := range sections {
+		if strings.Contains(section, "[") && parseNumFmtSection(section).cond {
+			return "", false
+		}
+	}
+	index, negative := 0, value < 0
+	switch {
+	case value < 0 && len(sections) >= 2:
+		index, value, negative = 1, -value, false
+	case value == 0 && len(sections) >= 3:
+		index = 2
+	}
+	s := parseNumFmtSection(sections[index])
+	if s.special {
+		return "", false
+	}
+	if negative {
+		value = -value
+	}
+	if s.text {
+		// 文本格式的数字按常规格式显示
+		result := generalNumber(value)
+		if negative {
+			result = "-" + result
+		}
+		return result, true
+	}
+	if s.general {
+		var b strings.Builder
+		if negative {
+			b.WriteByte('-')
+		}
+		for _, t := range s.integer {
+			if t.general {
+				b.WriteString(generalNumber(value))
+			} else {
+				b.WriteString(t.literal)
+			}
+		}
+		return b.String(), true
+	}
+	value *= math.Pow(100, float64(s.percent))
+	value /= math.Pow(1000, float64(s.scale))
+	// 舍入为0的负数同Excel显示为"-0"
+	result := s.render(value)
+	if negative {
+		result = "-" + result
+	}
+	return result, true
+}
+
+// generalNumber 按Excel常规格式显示数值：最多占11个字符（不含负号），放不下时减少小数位，
+// 仍然放不下或数量级过大、过小时使用保留5位小数的科学计数法，如1.23457E+11、1E-10
+func generalNumber(value float64) string {
+	if value == 0 {
+		return "0"
+	}
+	width := 11
+	if value < 0 {
+		width = 12
+	}
+	var result string
+	switch exponent := int(math.Floor(math.Log10(math.Abs(value)))); {
+	case exponent >= -4 && exponent <= -1:
+		result = strconv.FormatFloat(value, 'g', 10+exponent, 64)
+	case exponent >= -9 && exponent <= 9:
+		result = trimFractionZeros(strconv.FormatFloat(value, 'f', 12, 64))
+		if len(result) > width {
+			result = strconv.FormatFloat(value, 'g', 10, 64)
+		}
+		if len(result) > width {
+			result = strconv.FormatFloat(value, 'e', 5, 64)
+		}
+	case exponent == 10:
+		result = strconv.FormatFloat(value, 'f', 0, 64)
+	default:
+		result = strconv.FormatFloat(value, 'e', 5, 64)
+	}
+	// 科学计数法去掉尾数末尾的0，指数至少两位
+	mantissa, exp, ok := strings.Cut(strings.ToUpper(result), "E")
+	if !ok {
+		return trimFractionZeros(result)
+	}
+	return trimFractionZeros(mantissa) + "E" + exp
+}
+
+// trimFractionZeros 去掉小数部分末尾的0和多余的小数点
+func trimFractionZeros(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// render 按分节格式化非负数值
+func (s numFmtSection) render(value float64) string {
+	intDigits, intZeros := digitCount(s.integer)
+	fracDigits, fracZeros := digitCount(s.fraction)
+	exponent := 0
+	if s.hasExp && value != 0 {
+		// 整数占位符多于1个时按其个数的倍数取指数（工程计数法）
+		step := max(1, intDigits)
+		exponent = int(math.Floor(math.Log10(value)/float64(step))) * step
+		value /= math.Pow(10, float64(exponent))
+		// 舍入后可能进位到下一个数量级
+		if rounded, _ := strconv.ParseFloat(roundDecimal(value, fracDigits), 64); rounded >= math.Pow(10, float64(step)) {
+			value /= math.Pow(10, float64(step))
+			exponent += step
+		}
+	}
+	formatted := roundDecimal(value, fracDigits)
+	intPart, fracPart, _ := strings.Cut(formatted, ".")
+	if intPart == "0" {
+		intPart = ""
+	}
+	if len(intPart) < intZeros {
+		intPart = strings.Repeat("0", intZeros-len(intPart)) + intPart
+	}
+
+	var b strings.Builder
+	b.WriteString(s.renderInteger(intPart))
+	if s.hasPoint {
+		// 去掉#位置上的尾部0，?位置上的尾部0替换为空格
+		frac := []byte(fracPart)
+		for i := len(frac) - 1; i >= fracZeros && frac[i] == '0'; i-- {
+			frac[i] = 0
+		}
+		b.WriteByte('.')
+		d := 0
+		for _, t := range s.fraction {
+			if t.digit == 0 {
+				b.WriteString(t.literal)
+				continue
+			}
+			switch {
+			case frac[d] != 0:
+				b.WriteByte(frac[d])
+			case t.digit == '?':
+				b.WriteByte(' ')
+			}
+			d++
+		}
+	}
+	if s.hasExp {
+		b.WriteByte('E')
+		sign := ""
+		if exponent < 0 {
+			sign, exponent = "-", -exponent
+		} else if s.expSign {
+			sign = "+"
+		}
+		b.WriteString(sign)
+		_, expZeros := digitCount(s.exponent)
+		digits := strconv.Itoa(exponent)
+		if len(digits) < expZeros {
+			digits = strings.Repeat("0", expZeros-len(digits)) + digits
+		}
+		placed := false
+		for _, t := range s.exponent {
+			if t.digit == 0 {
+				b.WriteString(t.literal)
+			} else if !placed {
+				b.WriteString(digits)
+				placed = true
+			}
+		}
+	}
+	return b.String()
+}
+
+// renderInteger 将整数部分的数字填入占位符，多出的数字放在第一个占位符处
+func (s numFmtSection) renderInteger(digits string) string {
+	first := -1
+	for i, t := range s.integer {
+		if t.digit != 0 {
+			first = i
+			break
+		}
+	}
+	var b strings.Builder
+	if first < 0 {
+		// 没有数字占位符，如"@"或纯字面量
+		for _, t := range s.integer {
+			b.WriteString(t.literal)
+		}
+		return b.String()
+	}
+	if s.grouping {
+		digits = groupThousands(digits)
+		for i, t := range s.integer {
+			switch {
+			case t.digit == 0:
+				b.WriteString(t.literal)
+			case i == first:
+				b.WriteString(digits)
+			}
+		}
+		return b.String()
+	}
+	// 从右向左逐个填入占位符，?位置上缺少的数字以空格补齐
+	out := make([]string, len(s.integer))
+	d := len(digits)
+	for i := len(s.integer) - 1; i >= 0; i-- {
+		t := s.integer[i]
+		switch {
+		case t.digit == 0:
+			out[i] = t.literal
+		case i == first:
+			out[i] = digits[:d]
+			if d == 0 && t.digit == '?' {
+				out[i] = " "
+			}
+		case d > 0:
+			out[i] = digits[d-1 : d]
+			d--
+		case t.digit == '?':
+			out[i] = " "
+		}
+	}
+	for _, part := range out {
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// roundDecimal 将非负数按四舍五入保留digits位小数，以最短十进制表示为准（1.005保留两位为1.01，同Excel）
+func roundDecimal(value float64, digits int) string {
+	s := strconv.FormatFloat(value, 'f', -1, 64)
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if len(fracPart) <= digits {
+		if digits == 0 {
+			return intPart
+		}
+		return intPart + "." + fracPart + strings.Repeat("0", digits-len(fracPart))
+	}
+	roundUp := fracPart[digits] >= '5'
+	number := []byte(intPart + fracPart[:digits])
+	for i := len(number) - 1; roundUp && i >= 0; i-- {
+		if number[i] == '9' {
+			number[i] = '0'
+			continue
+		}
+		number[i]++
+		roundUp = false
+	}
+	if roundUp {
+		number = append([]byte{'1'}, number...)
+	}
+	point := len(number) - digits
+	if digits == 0 {
+		return string(number)
+	}
+	return string(number[:point]) + "." + string(number[point:])
+}
+
+// groupThousands 为整数数字串加上千位分隔符
+func groupThousands(digits string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+// formatText 按格式的文本分节格式化文本，没有文本分节时原样返回
+func formatText(text, code string) string {
+	sections := splitNumFmtSections(code)
+	var section string
+	switch {
+	case len(sections) >= 4:
+		section = sections[3]
+	case len(sections) == 1 && strings.Contains(code, "@"):
+		section = sections[0]
+	default:
+		return text
+	}
+	s := parseNumFmtSection(section)
+	var b strings.Builder
+	for _, t := range s.integer {
+		if t.literal == "@" {
+			b.WriteString(text)
+		} else {
+			b.WriteString(t.literal)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package excel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		code  string
+		value float64
+		want  string
+	}{
+		{"General", 0, "0"},
+		{"General", -1234.5, "-1234.5"},
+		{"General", 1e20, "1E+20"},
+		{"General", 1e-10, "1E-10"},
+		{"General", 1.0 / 3, "0.333333333"},
+		{"General", 123456789012, "1.23457E+11"},
+		{"General", 12345678901, "12345678901"},
+		{"General", 0.0000123456789, "1.23457E-05"},
+		{"General", 0.00001, "0.00001"},
+		{"", 1234567.891234, "1234567.891"},
+		{"0", 2.5, "3"},
+		{"0", -0.4, "-0"},
+		{"0.00", 0, "0.00"},
+		{"0.00", 1.005, "1.01"},
+		{"0.00", 0.125, "0.13"},
+		{"0.00", -1234.5678, "-1234.57"},
+		{"#,##0.00", 1234567.891, "1,234,567.89"},
+		{"#,##0.00", -0.5, "-0.50"},
+		{"#,##0.00", 0, "0.00"},
+		{"#,##0", 999.5, "1,000"},
+		{"0%", 0, "0%"},
+		{"0%", 0.125, "13%"},
+		{"0%", -0.5, "-50%"},
+		{"0.0%", 0.125, "12.5%"},
+		{"0.0%", -0.0004, "-0.0%"},
+		{"#,##0;(#,##0);\"zero\"", 1234.4, "1,234"},
+		{"#,##0;(#,##0);\"zero\"", -1234.5, "(1,235)"},
+		{"#,##0;(#,##0);\"zero\"", 0, "zero"},
+		{"0.00;[Red]-0.00;-", -2, "-2.00"},
+		{"0.00;[Red]-0.00;-", 0, "-"},
+		{"¥#,##0.00;[Red]¥-#,##0.00", -12.5, "¥-12.50"},
+		{"[$¥-804]#,##0", 1500, "¥1,500"},
+		{"#,##0,\"K\"", 1234567, "1,235K"},
+		{"0.00E+00", 12345, "1.23E+04"},
+		{"##0.0E+0", 1234.5678, "1.2E+3"},
+		{"##0.0E+0", 0.125, "125.0E-3"},
+		{"0.0?", 1.5, "1.5 "},
+		{"#.##", 0.5, ".5"},
+		{"\"ID-\"0000", 42, "ID-0042"},
+		{"@", 1e20, "1E+20"},
+		{"0;-0;0;@", 3, "3"},
+		{"[Red]General;[Blue]-General", -0.5, "-0.5"},
+	}
+	for _, tt := range tests {
+		got, ok := formatNumber(tt.value, tt.code)
+		if !ok || got != tt.want {
+			t.Errorf("formatNumber(%v, %q) = %q, %v, want %q", tt.value, tt.code, got, ok, tt.want)
+		}
+	}
+
+	for _, code := range []string{"yyyy-mm-dd", "[h]:mm", "# ?/?", "m/d/yy h:mm AM/PM", `[>=1000]#,##0,"K";0`, `0;[Red][<=-100]-0`} {
+		if _, ok := formatNumber(45000, code); ok {
+			t.Errorf("%q should be left to excelize", code)
+		}
+	}
+}
+
+func TestFormatNumberMatchesExcelize(t *testing.T) {
+	// excelize 2.7.1对内置数字格式的渲染与Excel不一致的情况不参与比较：
+	// 常规格式不限制11个字符、小数按银行家舍入（0.125显示为0.12）、格式4缺少千位分隔符、
+	// 格式9和10的零显示为"000%"、格式48按"0.00E+00"渲染，这些情况由TestFormatNumber按Excel的结果覆盖
+	ids := []int{1, 2, 3, 9, 10, 11, 37, 38, 39, 40}
+	values := []float64{0, 42, 1234.5678, -1234.5678, 0.3333333, -0.25, 1e-10, 123456789012}
+	skip := map[string]bool{"9/0": true, "10/0": true}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	for _, id := range ids {
+		style, err := f.NewStyle(&excelize.Style{NumFmt: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, value := range values {
+			if skip[fmt.Sprintf("%d/%v", id, value)] {
+				continue
+			}
+			if err = f.SetCellValue("Sheet1", "A1", value); err != nil {
+				t.Fatal(err)
+			}
+			if err = f.SetCellStyle("Sheet1", "A1", "A1", style); err != nil {
+				t.Fatal(err)
+			}
+			want, err := f.GetCellValue("Sheet1", "A1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, ok := formatNumber(value, builtinNumberFormats[id]); !ok || got != want {
+				t.Errorf("format %d (%q) of %v = %q, excelize %q", id, builtinNumberFormats[id], value, got, want)
+			}
+		}
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	tests := []struct {
+		code, text, want string
+	}{
+		{"@", "abc", "abc"},
+		{"\"编号：\"@", "A01", "编号：A01"},
+		{"0;-0;0;\"[\"@\"]\"", "abc", "[abc]"},
+		{"0.00", "abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := formatText(tt.text, tt.code); got != tt.want {
+			t.Errorf("formatText(%q, %q) = %q, want %q", tt.text, tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package excel
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// RowsOptions 逐行读取选项
+type RowsOptions struct {
+	Skip      int  // 跳过开头的行数（如标题行），在表头之前
+	Header    bool // 跳过Skip行后的第一行是否为表头，为表头时可按名称取值和绑定结构体
+	Limit     int  // 最多返回的数据行数，0表示不限制
+	SkipEmpty bool // 是否跳过所有单元格都为空白的行
+}
+
+// Cell 单元格的原始值，数字为未应用数字格式的值，日期为Excel序列号
+type Cell struct {
+	Value  string
+	Row    int // 行号，从1开始
+	Column int // 列号，从1开始
+}
+
+// Name 返回单元格名称，如"B3"
+func (c Cell) Name() string {
+	name, _ := excelize.CoordinatesToCellName(c.Column, c.Row)
+	return name
+}
+
+// IsEmpty 判断单元格是否为空白
+func (c Cell) IsEmpty() bool {
+	return strings.TrimSpace(c.Value) == ""
+}
+
+// String 返回去掉首尾空白的值
+func (c Cell) String() string {
+	return strings.TrimSpace(c.Value)
+}
+
+// cellError 生成包含单元格位置的错误
+func (c Cell) cellError(err error) error {
+	return fmt.Errorf("单元格 %s: %w", c.Name(), err)
+}
+
+// Int 将单元格转换为整数，允许"12.0"这样没有小数部分的原始值
+func (c Cell) Int() (int64, error) {
+	var n int64
+	if err := setField(reflect.ValueOf(&n).Elem(), c.String()); err != nil {
+		return 0, c.cellError(err)
+	}
+	return n, nil
+}
+
+// Float 将单元格转换为浮点数
+func (c Cell) Float() (float64, error) {
+	f, err := strconv.ParseFloat(c.String(), 64)
+	if err != nil {
+		return 0, c.cellError(fmt.Errorf("无法将 %q 转换为数字", c.String()))
+	}
+	return f, nil
+}
+
+// Bool 将单元格转换为布尔值，支持TRUE/FALSE、1/0、是/否等写法
+func (c Cell) Bool() (bool, error) {
+	b, err := parseCellBool(c.String())
+	if err != nil {
+		return false, c.cellError(err)
+	}
+	return b, nil
+}
+
+// Time 将单元格转换为时间，支持Excel日期序列号和常见的日期字符串
+func (c Cell) Time() (time.Time, error) {
+	t, err := parseCellTime(c.String())
+	if err != nil {
+		return time.Time{}, c.cellError(err)
+	}
+	return t, nil
+}
+
+// rowsHeader 表头信息，所有行共用
+type rowsHeader struct {
+	names    []string
+	index    map[string]int
+	bindings map[reflect.Type]*headerBinding
+}
+
+// Row 工作表中的一行，仅在迭代的当次循环内有效
+type Row struct {
+	Number int // 行号，从1开始
+	values []string
+	header *rowsHeader
+}
+
+// Values 返回这一行所有单元格的原始值
+func (r *Row) Values() []string {
+	return r.values
+}
+
+// Len 返回这一行的单元格数（到最后一个非空单元格为止）
+func (r *Row) Len() int {
+	return len(r.values)
+}
+
+// IsEmpty 判断这一行是否所有单元格都为空白
+func (r *Row) IsEmpty() bool {
+	return isEmptyRow(r.values)
+}
+
+// Cell 返回第i列（从0开始）的单元格，超出范围时为空单元格
+func (r *Row) Cell(i int) Cell {
+	c := Cell{Row: r.Number, Column: i + 1}
+	if i >= 0 && i < len(r.values) {
+		c.Value = r.values[i]
+	}
+	return c
+}
+
+// Get 按表头名称返回单元格，表头名称忽略首尾空白，没有表头或没有该列时ok为false
+func (r *Row) Get(name string) (Cell, bool) {
+	if r.header == nil {
+		return Cell{Row: r.Number}, false
+	}
+	i, ok := r.header.index[strings.TrimSpace(name)]
+	if !ok {
+		return Cell{Row: r.Number}, false
+	}
+	return r.Cell(i), true
+}
+
+// Header 返回表头，没有表头时为nil
+func (r *Row) Header() []string {
+	if r.header == nil {
+		return nil
+	}
+	return r.header.names
+}
+
+// Scan 按表头名称将这一行写入结构体指针，字段通过excel标签映射（同Unmarshal）
+// 转换失败时返回包含行、列和字段的UnmarshalErrors
+func (r *Row) Scan(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Scan需要非空的结构体指针")
+	}
+	if r.header == nil {
+		return fmt.Errorf("没有表头，无法按名称绑定结构体")
+	}
+	t := v.Elem().Type()
+	binding := r.header.bindings[t]
+	if binding == nil {
+		schema, err := schemaOf(t)
+		if err != nil {
+			return err
+		}
+		if binding, err = schema.bindHeader(r.header.names, t); err != nil {
+			return err
+		}
+		r.header.bindings[t] = binding
+	}
+	if errs := binding.decodeRow(r.values, r.Number, v.Elem()); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Rows 逐行读取工作表，sheet为空时读取当前工作表
+// 行数据按需从工作表XML中解析，不会一次性加载整张表，内存占用不随行数增长；
+// 但excelize打开文件时会将压缩后的文件和共享字符串表读入内存，超过16MB的工作表XML解压到临时文件
+// 迭代出错时产生一次非空的error并结束
+func (p *ExcelProcessor) Rows(sheet string, options RowsOptions) iter.Seq2[*Row, error] {
+	return func(yield func(*Row, error) bool) {
+		if sheet == "" {
+			sheet = p.sheetName
+		}
+		rows, err := p.file.Rows(sheet)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rows.Close()
+
+		var header *rowsHeader
+		number, count := 0, 0
+		for rows.Next() {
+			number++
+			values, err := rows.Columns(excelize.Options{RawCellValue: true})
+			if err != nil {
+				yield(nil, fmt.Errorf("读取第%d行失败: %w", number, err))
+				return
+			}
+			if number <= options.Skip {
+				continue
+			}
+			if options.Header && header == nil {
+				header = &rowsHeader{names: values, index: make(map[string]int, len(values)), bindings: make(map[reflect.Type]*headerBinding)}
+				for i, name := range values {
+					name = strings.TrimSpace(name)
+					if _, ok := header.index[name]; !ok && name != "" {
+						header.index[name] = i
+					}
+				}
+				continue
+			}
+			if options.SkipEmpty && isEmptyRow(values) {
+				continue
+			}
+			if options.Limit > 0 && count >= options.Limit {
+				return
+			}
+			count++
+			if !yield(&Row{Number: number, values: values, header: header}, nil) {
+				return
+			}
+		}
+		if err = rows.Error(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// RowsOf 逐行读取工作表并按表头绑定到结构体，第一行（Skip之后）必须为表头
+// T可以是结构体或结构体指针，为指针时每行返回新分配的结构体
+// 某一行转换失败时产生该行的UnmarshalErrors，调用方可以选择跳过该行继续迭代
+func RowsOf[T any](processor *ExcelProcessor, sheet string, options RowsOptions) iter.Seq2[T, error] {
+	options.Header = true
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	return func(yield func(T, error) bool) {
+		for row, err := range processor.Rows(sheet, options) {
+			var item T
+			if err == nil {
+				if t.Kind() == reflect.Ptr {
+					item = reflect.New(t.Elem()).Interface().(T)
+					err = row.Scan(item)
+				} else {
+					err = row.Scan(&item)
+				}
+			}
+			if !yield(item, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package excel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRowsProcessor 创建包含标题行、表头和数据行的工作表
+func newRowsProcessor(t *testing.T) *ExcelProcessor {
+	t.Helper()
+	p := NewExcelProcessor()
+	t.Cleanup(func() { p.Close() })
+	rows := [][]interface{}{
+		{"2024年订单"},
+		{" 编号 ", "客户", "金额", "已付", "日期"},
+		{1, "张三", 12.5, true, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{},
+		{"2", "李四", "abc", "是", "2024-01-03"},
+		{3.0, "王五", 100, false, "2024/1/4"},
+	}
+	for i, row := range rows {
+		if err := p.file.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+1), &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func TestRowsOptions(t *testing.T) {
+	p := newRowsProcessor(t)
+	tests := []struct {
+		name    string
+		options RowsOptions
+		numbers []int
+	}{
+		{"all", RowsOptions{}, []int{1, 2, 3, 4, 5, 6}},
+		{"skip", RowsOptions{Skip: 2}, []int{3, 4, 5, 6}},
+		{"header", RowsOptions{Skip: 1, Header: true}, []int{3, 4, 5, 6}},
+		{"skip empty", RowsOptions{Skip: 1, Header: true, SkipEmpty: true}, []int{3, 5, 6}},
+		{"limit", RowsOptions{Skip: 1, Header: true, SkipEmpty: true, Limit: 2}, []int{3, 5}},
+		{"skip all", RowsOptions{Skip: 10}, nil},
+	}
+	for _, tt := range tests {
+		var numbers []int
+		for row, err := range p.Rows("", tt.options) {
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			numbers = append(numbers, row.Number)
+		}
+		if !reflect.DeepEqual(numbers, tt.numbers) {
+			t.Errorf("%s: rows = %v, want %v", tt.name, numbers, tt.numbers)
+		}
+	}
+
+	for _, err := range p.Rows("missing", RowsOptions{}) {
+		if err == nil {
+			t.Error("expected error for missing sheet")
+		}
+	}
+}
+
+func TestRowsHeaderAndCells(t *testing.T) {
+	p := newRowsProcessor(t)
+	var rows []*Row
+	for row, err := range p.Rows("", RowsOptions{Skip: 1, Header: true, SkipEmpty: true}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Row仅在当次循环内有效，复制一份供循环外检查
+		copied := *row
+		rows = append(rows, &copied)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("%d rows", len(rows))
+	}
+	first := rows[0]
+	if got := first.Header(); len(got) != 5 || got[0] != " 编号 " {
+		t.Errorf("header = %q", got)
+	}
+	// 表头名称忽略首尾空白
+	if c, ok := first.Get("编号"); !ok || c.Name() != "A3" || c.Value != "1" {
+		t.Errorf("Get(编号) = %+v, %v", c, ok)
+	}
+	if _, ok := first.Get("备注"); ok {
+		t.Error("Get of missing column should fail")
+	}
+	if c := first.Cell(10); !c.IsEmpty() || c.Name() != "K3" {
+		t.Errorf("out of range cell = %+v", c)
+	}
+
+	if n, err := first.Cell(0).Int(); err != nil || n != 1 {
+		t.Errorf("Int = %d, %v", n, err)
+	}
+	if n, err := rows[2].Cell(0).Int(); err != nil || n != 3 {
+		t.Errorf("Int of 3.0 = %d, %v", n, err)
+	}
+	if f, err := first.Cell(2).Float(); err != nil || f != 12.5 {
+		t.Errorf("Float = %v, %v", f, err)
+	}
+	if b, err := rows[1].Cell(3).Bool(); err != nil || !b {
+		t.Errorf("Bool(是) = %v, %v", b, err)
+	}
+	if b, err := first.Cell(3).Bool(); err != nil || !b {
+		t.Errorf("Bool(TRUE) = %v, %v", b, err)
+	}
+	for i, want := range []string{"2024-01-02", "2024-01-03", "2024-01-04"} {
+		if d, err := rows[i].Cell(4).Time(); err != nil || d.Format("2006-01-02") != want {
+			t.Errorf("row %d Time = %v, %v, want %s", rows[i].Number, d, err, want)
+		}
+	}
+	if _, err := rows[1].Cell(2).Float(); err == nil || !strings.Contains(err.Error(), "单元格 C5") {
+		t.Errorf("Float error = %v", err)
+	}
+	if _, err := rows[1].Cell(1).Int(); err == nil || !strings.Contains(err.Error(), "单元格 B5") {
+		t.Errorf("Int error = %v", err)
+	}
+
+	for row, err := range p.Rows("", RowsOptions{Limit: 1}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dest struct{ Name string }
+		if row.Header() != nil || row.Scan(&dest) == nil {
+			t.Error("row without header should not bind structs")
+		}
+	}
+}
+
+type rowsOrder struct {
+	ID     int       `excel:"name=编号,required"`
+	Client string    `excel:"name=客户"`
+	Amount float64   `excel:"name=金额"`
+	Paid   bool      `excel:"name=已付"`
+	Date   time.Time `excel:"name=日期"`
+	Note   string    `excel:"name=备注"`
+}
+
+func TestRowsOf(t *testing.T) {
+	p := newRowsProcessor(t)
+	options := RowsOptions{Skip: 1, SkipEmpty: true}
+
+	var orders []rowsOrder
+	var errs []error
+	for order, err := range RowsOf[rowsOrder](p, "", options) {
+		if err != nil {
+			// 转换失败的行跳过，继续读取后续行
+			errs = append(errs, err)
+			continue
+		}
+		orders = append(orders, order)
+	}
+	if len(orders) != 2 || orders[0].Client != "张三" || orders[1].ID != 3 || orders[1].Paid {
+		t.Errorf("orders = %+v", orders)
+	}
+	var unmarshalErrs UnmarshalErrors
+	if len(errs) != 1 || !errors.As(errs[0], &unmarshalErrs) || unmarshalErrs[0].Row != 5 || unmarshalErrs[0].Column != "C" {
+		t.Errorf("errs = %v", errs)
+	}
+
+	// T为结构体指针时每行返回新的结构体
+	var pointers []*rowsOrder
+	for order, err := range RowsOf[*rowsOrder](p, "", RowsOptions{Skip: 1, Limit: 1}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		pointers = append(pointers, order)
+	}
+	if len(pointers) != 1 || pointers[0] == nil || pointers[0].ID != 1 || pointers[0].Amount != 12.5 {
+		t.Errorf("pointers = %+v", pointers)
+	}
+
+	for _, err := range RowsOf[int](p, "", RowsOptions{Skip: 1}) {
+		if err == nil {
+			t.Error("expected error for non-struct type")
+		}
+		break
+	}
+}
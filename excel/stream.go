@@ -0,0 +1,227 @@
+package excel
+
+import (
+	"fmt"
+	"iter"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// StreamOptions 流式写入选项，表头样式和列宽需要在写入数据前确定
+type StreamOptions struct {
+	Header        []interface{}   // 表头，为空时不写表头；自动续写的每个工作表第一行都会重复写入
+	HeaderStyle   *excelize.Style // 表头样式，为空时不设置
+	FreezeHeader  bool            // 是否冻结表头行
+	ColumnWidths  []float64       // 从A列开始的各列宽度，0表示使用默认宽度
+	ColumnFormats []string        // 从A列开始的各列数字格式，如"0.00"、"yyyy-mm-dd"，空字符串表示不设置
+	MaxRows       int             // 每个工作表的最大行数（含表头），默认为Excel的上限1048576
+}
+
+// StreamWriter 流式写入器，逐行写入工作表，数据超过临时缓冲后写入磁盘临时文件，内存占用不随行数增长
+// 当前工作表写满后自动续写到新工作表，新工作表命名为"原名_2"、"原名_3"……，名称已被占用时顺延编号，不会覆盖已有的工作表
+// 写入完成后必须调用Flush，再调用ExcelProcessor.Save保存
+type StreamWriter struct {
+	processor    *ExcelProcessor
+	baseSheet    string
+	options      StreamOptions
+	headerStyle  int
+	columnStyles []int
+	writer       *excelize.StreamWriter
+	sheets       []string
+	next         int // 下一个续写工作表的编号
+	row          int // 当前工作表已写入的行数
+	total        int // 已写入的数据行数（不含表头）
+}
+
+// NewStreamWriter 创建流式写入器，工作表不存在时自动创建，已存在时其原有内容将被覆盖
+// 写入期间不要通过SetCellValue等方法修改同一工作表
+func (p *ExcelProcessor) NewStreamWriter(sheet string, options StreamOptions) (*StreamWriter, error) {
+	if sheet == "" {
+		sheet = p.sheetName
+	}
+	if options.MaxRows == 0 {
+		options.MaxRows = excelize.TotalRows
+	}
+	if options.MaxRows < 0 || options.MaxRows > excelize.TotalRows {
+		return nil, fmt.Errorf("每个工作表的最大行数必须在1到%d之间", excelize.TotalRows)
+	}
+	if len(options.Header) > 0 && options.MaxRows < 2 {
+		return nil, fmt.Errorf("有表头时每个工作表至少需要2行")
+	}
+	w := &StreamWriter{processor: p, baseSheet: sheet, options: options, next: 2}
+	if options.HeaderStyle != nil {
+		style, err := p.file.NewStyle(options.HeaderStyle)
+		if err != nil {
+			return nil, err
+		}
+		w.headerStyle = style
+	}
+	w.columnStyles = make([]int, len(options.ColumnFormats))
+	for i, format := range options.ColumnFormats {
+		if format == "" {
+			continue
+		}
+		format := format
+		style, err := p.file.NewStyle(&excelize.Style{CustomNumFmt: &format})
+		if err != nil {
+			return nil, err
+		}
+		w.columnStyles[i] = style
+	}
+	if err := w.nextSheet(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// sheetName 返回编号为n的续写工作表名称，超出31个字符时截断原名
+func (w *StreamWriter) sheetName(n int) string {
+	suffix := "_" + strconv.Itoa(n)
+	name := []rune(w.baseSheet)
+	if len(name)+len([]rune(suffix)) > excelize.MaxSheetNameLength {
+		name = name[:excelize.MaxSheetNameLength-len([]rune(suffix))]
+	}
+	return string(name) + suffix
+}
+
+// nextSheet 结束当前工作表，开始写入下一个工作表并写入列宽、冻结窗格和表头
+// 当前工作表结束后新工作表创建失败时写入器随之结束，不会继续写入已结束的工作表
+func (w *StreamWriter) nextSheet() error {
+	if w.writer != nil {
+		err := w.writer.Flush()
+		w.writer = nil
+		if err != nil {
+			return err
+		}
+	}
+	file := w.processor.file
+	name := w.baseSheet
+	if len(w.sheets) > 0 {
+		// 工作表名称不区分大小写，跳过已被占用的名称
+		for {
+			name = w.sheetName(w.next)
+			w.next++
+			index, err := file.GetSheetIndex(name)
+			if err != nil {
+				return err
+			}
+			if index == -1 {
+				break
+			}
+		}
+	}
+	if !w.processor.SheetExists(name) {
+		if _, err := file.NewSheet(name); err != nil {
+			return err
+		}
+	}
+	writer, err := file.NewStreamWriter(name)
+	if err != nil {
+		return err
+	}
+	for i, width := range w.options.ColumnWidths {
+		if width <= 0 {
+			continue
+		}
+		if err = writer.SetColWidth(i+1, i+1, width); err != nil {
+			return err
+		}
+	}
+	w.row = 0
+	w.sheets = append(w.sheets, name)
+	if len(w.options.Header) == 0 {
+		w.writer = writer
+		return nil
+	}
+	if w.options.FreezeHeader {
+		err = writer.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+		if err != nil {
+			return err
+		}
+	}
+	header := make([]interface{}, len(w.options.Header))
+	for i, value := range w.options.Header {
+		header[i] = excelize.Cell{StyleID: w.headerStyle, Value: value}
+	}
+	if err = writer.SetRow("A1", header); err != nil {
+		return err
+	}
+	w.writer, w.row = writer, 1
+	return nil
+}
+
+// WriteRow 写入一行数据，当前工作表写满时自动续写到新工作表
+// 值可以是excelize.Cell以单独指定样式或公式，nil表示空单元格
+func (w *StreamWriter) WriteRow(values ...interface{}) error {
+	if w.writer == nil {
+		return fmt.Errorf("流式写入器已结束")
+	}
+	if w.row >= w.options.MaxRows {
+		if err := w.nextSheet(); err != nil {
+			return err
+		}
+	}
+	if len(w.columnStyles) > 0 {
+		styled := make([]interface{}, len(values))
+		for i, value := range values {
+			styled[i] = value
+			if i >= len(w.columnStyles) || w.columnStyles[i] == 0 || value == nil {
+				continue
+			}
+			switch value.(type) {
+			case excelize.Cell, *excelize.Cell:
+			default:
+				styled[i] = excelize.Cell{StyleID: w.columnStyles[i], Value: value}
+			}
+		}
+		values = styled
+	}
+	w.row++
+	if err := w.writer.SetRow("A"+strconv.Itoa(w.row), values); err != nil {
+		return fmt.Errorf("写入工作表 %s 第%d行失败: %w", w.sheets[len(w.sheets)-1], w.row, err)
+	}
+	w.total++
+	return nil
+}
+
+// WriteFrom 从通道逐行读取并写入，直到通道关闭
+// 写入出错时立即返回，不再读取通道中剩余的数据，生产者应自行处理退出
+func (w *StreamWriter) WriteFrom(rows <-chan []interface{}) error {
+	for row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSeq 从迭代器逐行读取并写入，写入出错时停止迭代
+func (w *StreamWriter) WriteSeq(rows iter.Seq[[]interface{}]) error {
+	for row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rows 返回已写入的数据行数（不含表头）
+func (w *StreamWriter) Rows() int {
+	return w.total
+}
+
+// Sheets 返回已写入的所有工作表名称
+func (w *StreamWriter) Sheets() []string {
+	return append([]string(nil), w.sheets...)
+}
+
+// Flush 结束流式写入，之后可以调用ExcelProcessor.Save保存文件
+func (w *StreamWriter) Flush() error {
+	if w.writer == nil {
+		return nil
+	}
+	err := w.writer.Flush()
+	w.writer = nil
+	return err
+}
@@ -0,0 +1,125 @@
+package excel
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// reopen 保存到内存后重新打开，流式写入的内容在保存时才写入工作簿
+func reopen(t *testing.T, p *ExcelProcessor) *excelize.File {
+	t.Helper()
+	buf, err := p.file.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestStreamWriterRollover(t *testing.T) {
+	p := NewExcelProcessor()
+	defer p.Close()
+	// 已存在的同名续写工作表（名称不区分大小写）不会被覆盖
+	p.CreateSheet("data_2")
+	if err := p.file.SetCellValue("data_2", "A1", "keep"); err != nil {
+		t.Fatal(err)
+	}
+	w, err := p.NewStreamWriter("Data", StreamOptions{
+		Header:       []interface{}{"ID", "Name"},
+		HeaderStyle:  &excelize.Style{Font: &excelize.Font{Bold: true}},
+		FreezeHeader: true,
+		MaxRows:      3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err = w.WriteRow(i, string(rune('a'+i-1))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Rows() != 5 {
+		t.Errorf("rows = %d, want 5", w.Rows())
+	}
+	sheets := []string{"Data", "Data_3", "Data_4"}
+	if !reflect.DeepEqual(w.Sheets(), sheets) {
+		t.Fatalf("sheets = %v, want %v", w.Sheets(), sheets)
+	}
+
+	f := reopen(t, p)
+	want := [][][]string{
+		{{"ID", "Name"}, {"1", "a"}, {"2", "b"}},
+		{{"ID", "Name"}, {"3", "c"}, {"4", "d"}},
+		{{"ID", "Name"}, {"5", "e"}},
+	}
+	for i, sheet := range sheets {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rows, want[i]) {
+			t.Errorf("%s rows = %q, want %q", sheet, rows, want[i])
+		}
+		// 每个工作表的表头都带有样式
+		if style, _ := f.GetCellStyle(sheet, "B1"); style == 0 {
+			t.Errorf("%s header has no style", sheet)
+		}
+	}
+	if got, _ := f.GetCellValue("data_2", "A1"); got != "keep" {
+		t.Errorf("existing sheet overwritten: A1 = %q", got)
+	}
+
+	// 续写工作表创建失败后写入器结束，不会继续写入已写满的工作表
+	w, err = p.NewStreamWriter("Full", StreamOptions{MaxRows: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteRow(1); err != nil {
+		t.Fatal(err)
+	}
+	w.baseSheet = "Full:"
+	if err = w.WriteRow(2); err == nil {
+		t.Fatal("expected error for invalid sheet name")
+	}
+	w.baseSheet = "Full"
+	if err = w.WriteRow(3); err == nil || w.Rows() != 1 {
+		t.Errorf("write after failed rollover: err = %v, rows = %d", err, w.Rows())
+	}
+}
+
+func TestStreamWriterOptions(t *testing.T) {
+	p := NewExcelProcessor()
+	defer p.Close()
+	if _, err := p.NewStreamWriter("", StreamOptions{Header: []interface{}{"ID"}, MaxRows: 1}); err == nil {
+		t.Error("expected error for header without room for data")
+	}
+	if _, err := p.NewStreamWriter("", StreamOptions{MaxRows: excelize.TotalRows + 1}); err == nil {
+		t.Error("expected error for too many rows")
+	}
+	w, err := p.NewStreamWriter("", StreamOptions{ColumnFormats: []string{"0.00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteRow(1.5, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.WriteRow(2); err == nil {
+		t.Error("expected error after flush")
+	}
+	formatter := &cellFormatter{file: reopen(t, p), sheet: "Sheet1", codes: make(map[int]string)}
+	if got, err := formatter.format("A1", "1.5"); err != nil || got != "1.50" {
+		t.Errorf("A1 = %q, want 1.50 (%v)", got, err)
+	}
+}
@@ -0,0 +1,313 @@
+package watermark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/SmartRick/my-go-sdk/common"
+	"github.com/disintegration/imaging"
+)
+
+// DefaultBatchInclude 批量处理默认包含的图片文件
+var DefaultBatchInclude = []string{"*.jpg", "*.jpeg", "*.png", "*.gif", "*.bmp", "*.tif", "*.tiff"}
+
+// BatchConfig 批量处理目录的配置
+// Image和Text二选一，其中的原图、水印图和合成图路径字段会被忽略
+type BatchConfig struct {
+	InputDir       string                          // 输入目录
+	OutputDir      string                          // 输出目录，按输入目录的相对路径保存结果
+	Recursive      bool                            // 是否递归处理子目录
+	Include        []string                        // 包含的文件（glob模式，匹配文件名或相对路径，不区分大小写），为空时使用DefaultBatchInclude
+	Exclude        []string                        // 排除的文件（glob模式）
+	Workers        int                             // 并发数，为0时使用CPU核数
+	Image          *ImageWatermarkConfig           // 图片水印配置
+	WatermarkImage image.Image                     // 已解码的水印图，为空时从Image.WatermarkImagePath加载
+	Text           *TransparentTextWatermarkConfig // 文字水印配置
+	Progress       func(BatchProgress)             // 进度回调，每处理完一个文件调用一次，调用是串行的
+}
+
+// BatchProgress 批量处理进度
+type BatchProgress struct {
+	Done   int    // 已处理文件数（含失败）
+	Total  int    // 文件总数
+	Path   string // 刚处理完的输入文件
+	Output string // 对应的输出文件
+	Err    error  // 处理错误，成功时为nil
+}
+
+// BatchFileError 单个文件的处理错误
+type BatchFileError struct {
+	Path string // 输入文件
+	Err  error
+}
+
+func (e BatchFileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e BatchFileError) Unwrap() error {
+	return e.Err
+}
+
+// BatchResult 批量处理结果
+type BatchResult struct {
+	Total     int              // 匹配的文件总数
+	Succeeded int              // 成功处理的文件数
+	Failed    []BatchFileError // 处理失败的文件
+}
+
+// batchJob 批量处理中所有文件共享的状态
+type batchJob struct {
+	config  BatchConfig
+	mark    image.Image                    // 已解码的水印图
+	textImg *image.NRGBA                   // 已渲染的文字水印，自动字号时为空
+	image   ImageWatermarkConfig           // 已校验的图片水印配置
+	text    TransparentTextWatermarkConfig // 已校验的文字水印配置
+}
+
+// Batch 批量为目录中的图片添加水印，结果按相对路径保存到输出目录
+// 水印图只解码一次，文字水印只渲染一次（自动字号除外），单个文件失败不会中断其他文件
+// ctx取消时停止处理剩余文件并返回ctx的错误
+func Batch(ctx context.Context, config BatchConfig) (*BatchResult, error) {
+	job, err := newBatchJob(config)
+	if err != nil {
+		return nil, err
+	}
+	files, err := job.collect()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	result := &BatchResult{Total: len(files)}
+	var mu sync.Mutex
+	tasks := make([]common.Task, len(files))
+	for i, path := range files {
+		path := path
+		tasks[i] = func() (interface{}, error) {
+			output, err := job.outputPath(path)
+			if err == nil {
+				err = job.safeProcess(path, output)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				result.Failed = append(result.Failed, BatchFileError{Path: path, Err: err})
+			} else {
+				result.Succeeded++
+			}
+			if config.Progress != nil {
+				config.Progress(BatchProgress{
+					Done:   result.Succeeded + len(result.Failed),
+					Total:  len(files),
+					Path:   path,
+					Output: output,
+					Err:    err,
+				})
+			}
+			return nil, nil
+		}
+	}
+	common.NewParallelizer(workers, 0).RunWithContext(ctx, tasks)
+	return result, ctx.Err()
+}
+
+// newBatchJob 校验配置并准备共享的水印图或文字图像
+func newBatchJob(config BatchConfig) (*batchJob, error) {
+	if config.InputDir == "" || config.OutputDir == "" {
+		return nil, errors.New("batch input_dir and output_dir must not be empty")
+	}
+	if (config.Image == nil) == (config.Text == nil) {
+		return nil, errors.New("batch needs exactly one of image or text watermark config")
+	}
+	for _, pattern := range append(append([]string{}, config.Include...), config.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("batch glob pattern %q error: %w", pattern, err)
+		}
+	}
+	job := &batchJob{config: config, mark: config.WatermarkImage}
+	if config.Image != nil {
+		// 配置错误在开始前报告一次，而不是每个文件报告一次
+		job.image = *config.Image
+		if err := job.image.Output.validate(); err != nil {
+			return nil, err
+		}
+		if err := normalizeImageConfig(&job.image); err != nil {
+			return nil, err
+		}
+		if err := validateScale(job.image); err != nil {
+			return nil, err
+		}
+		if job.mark == nil {
+			mark, err := loadWatermarkImage(config.Image.WatermarkImagePath)
+			if err != nil {
+				return nil, err
+			}
+			job.mark = mark
+		}
+		return job, nil
+	}
+
+	job.text = *config.Text
+	if err := job.text.Output.validate(); err != nil {
+		return nil, err
+	}
+	if err := normalizeTextConfig(&job.text); err != nil {
+		return nil, err
+	}
+	// 自动字号或包含模板变量时文字随图片变化，需要逐张渲染
+	if job.text.AutoFit == 0 && !hasTemplate(job.text.Text) {
+		textImg, err := createTextImage(job.text, 0)
+		if err != nil {
+			return nil, err
+		}
+		job.textImg = textImg
+	}
+	return job, nil
+}
+
+// collect 遍历输入目录，返回匹配的文件列表（跳过输出目录）
+func (j *batchJob) collect() ([]string, error) {
+	root := filepath.Clean(j.config.InputDir)
+	outputDir, _ := filepath.Abs(j.config.OutputDir)
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == root {
+				return nil
+			}
+			if abs, _ := filepath.Abs(path); !j.config.Recursive || abs == outputDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if j.matches(rel) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// matches 判断相对路径是否满足包含和排除规则
+func (j *batchJob) matches(rel string) bool {
+	include := j.config.Include
+	if len(include) == 0 {
+		include = DefaultBatchInclude
+	}
+	return matchAny(include, rel) && !matchAny(j.config.Exclude, rel)
+}
+
+// matchAny 判断文件名或相对路径是否匹配任意一个glob模式
+func matchAny(patterns []string, rel string) bool {
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	name := filepath.Base(rel)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(filepath.ToSlash(pattern))
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// outputPath 计算输入文件对应的输出路径，指定了输出格式时替换扩展名
+func (j *batchJob) outputPath(path string) (string, error) {
+	rel, err := filepath.Rel(j.config.InputDir, path)
+	if err != nil {
+		return "", err
+	}
+	output := filepath.Join(j.config.OutputDir, rel)
+	if opts := j.output(); opts.Format != FormatAuto && !opts.KeepInputFormat {
+		ext := "." + string(opts.Format)
+		if opts.Format == FormatJPEG {
+			ext = ".jpg"
+		}
+		output = strings.TrimSuffix(output, filepath.Ext(output)) + ext
+	}
+	return output, nil
+}
+
+// output 返回当前水印配置的输出选项
+func (j *batchJob) output() OutputOptions {
+	if j.config.Image != nil {
+		return j.image.Output
+	}
+	return j.text.Output
+}
+
+// safeProcess 调用process，将解码或合成时的panic转换为该文件的错误，保证每个文件都被计入结果和进度
+func (j *batchJob) safeProcess(path, output string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("process image panic: %v", r)
+		}
+	}()
+	return j.process(path, output)
+}
+
+// process 为单个文件添加水印并保存
+func (j *batchJob) process(path, output string) error {
+	autoOrient, keepMetadata := j.text.AutoOrient, j.text.KeepMetadata
+	if j.config.Image != nil {
+		autoOrient, keepMetadata = j.image.AutoOrient, j.image.KeepMetadata
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.New("open origin image file error:" + err.Error())
+	}
+	src, err := decodeSource(file, autoOrient, keepMetadata)
+	file.Close()
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	src.name = path
+	opts := j.output()
+	format, err := opts.resolveFormat(src.format, output)
+	if err != nil {
+		return err
+	}
+
+	var result *composite
+	switch {
+	case j.config.Image != nil:
+		result, err = composeImageWatermark(src, format, j.mark, j.image)
+	case j.textImg != nil && (src.anim == nil || format != imaging.GIF || j.text.GIF.FirstFrameOnly):
+		var img image.Image
+		img, err = overlayTextWatermark(src.img, j.textImg, j.text)
+		result = &composite{img: img}
+	default:
+		result, err = composeTextWatermark(src, format, j.text)
+	}
+	if err != nil {
+		return err
+	}
+	if err = PrepareOutputPath(output); err != nil {
+		return errors.New("prepare composite image path error:" + err.Error())
+	}
+	return saveComposite(result, output, format, src.meta, opts)
+}
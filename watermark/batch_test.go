@@ -0,0 +1,151 @@
+package watermark
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestBatch(t *testing.T) {
+	input := t.TempDir()
+	for _, rel := range []string{"a.png", "sub/b.JPG", "sub/deep/c.png", "skip/d.png"} {
+		path := filepath.Join(input, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := imaging.Save(imaging.New(200, 100, color.White), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(input, "notes.txt"), []byte("not an image"), 0644)
+	os.WriteFile(filepath.Join(input, "broken.png"), []byte("not a png"), 0644)
+	// 输出目录位于输入目录内时不应被再次处理
+	output := filepath.Join(input, "out")
+
+	var calls int32
+	config := BatchConfig{
+		InputDir:       input,
+		OutputDir:      output,
+		Recursive:      true,
+		Exclude:        []string{"skip/*"},
+		Workers:        3,
+		Image:          &ImageWatermarkConfig{WatermarkPos: RightBottom, Output: OutputOptions{Format: FormatPNG}},
+		WatermarkImage: imaging.New(40, 20, Red),
+		Progress: func(p BatchProgress) {
+			atomic.AddInt32(&calls, 1)
+			if p.Total != 4 || p.Done < 1 || p.Done > 4 {
+				t.Errorf("progress = %+v", p)
+			}
+		},
+	}
+	result, err := Batch(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 4 || result.Succeeded != 3 || len(result.Failed) != 1 || calls != 4 {
+		t.Fatalf("result = %+v, progress calls = %d", result, calls)
+	}
+	if filepath.Base(result.Failed[0].Path) != "broken.png" {
+		t.Errorf("failed file = %s", result.Failed[0].Path)
+	}
+	for _, rel := range []string{"a.png", "sub/b.png", "sub/deep/c.png"} {
+		img, err := imaging.Open(filepath.Join(output, rel))
+		if err != nil {
+			t.Fatalf("%s: %v", rel, err)
+		}
+		if _, g, _, _ := img.At(190, 95).RGBA(); g>>8 > 128 {
+			t.Errorf("%s: watermark missing", rel)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(output, "skip")); !os.IsNotExist(err) {
+		t.Error("excluded directory should not be processed")
+	}
+
+	// 重复运行时输出目录不会被当作输入
+	result, err = Batch(context.Background(), config)
+	if err != nil || result.Total != 4 {
+		t.Errorf("second run total = %d, err = %v", result.Total, err)
+	}
+
+	flat := config
+	flat.Recursive = false
+	flat.Progress = nil
+	flat.Include = []string{"a.*"}
+	if result, err = Batch(context.Background(), flat); err != nil || result.Total != 1 {
+		t.Errorf("non-recursive total = %d, err = %v", result.Total, err)
+	}
+
+	textConfig := BatchConfig{InputDir: input, OutputDir: t.TempDir(), Include: []string{"a.png"},
+		Text: &TransparentTextWatermarkConfig{FontPath: writeTestFont(t), Text: "batch", Size: 20, Color: Black, WatermarkPos: Center}}
+	if result, err = Batch(context.Background(), textConfig); err != nil || result.Succeeded != 1 {
+		t.Errorf("text batch = %+v, err = %v", result, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = Batch(ctx, config); err != context.Canceled {
+		t.Errorf("cancelled batch err = %v", err)
+	}
+	if _, err = Batch(context.Background(), BatchConfig{InputDir: input, OutputDir: output}); err == nil {
+		t.Error("expected error without watermark config")
+	}
+
+	// 图片水印配置错误在处理文件前报告一次
+	for name, imageConfig := range map[string]ImageWatermarkConfig{
+		"opacity":     {Opacity: 2},
+		"tiled":       {WatermarkPos: Tiled},
+		"scale":       {ScaleMode: ScaleShortEdge},
+		"scale mode":  {ScaleMode: "half"},
+		"filter":      {ResampleFilter: "bicubic"},
+		"size clamps": {MinWatermarkSize: 100, MaxWatermarkSize: 50},
+	} {
+		invalid := config
+		invalid.Image = &imageConfig
+		invalid.Progress = func(BatchProgress) { t.Errorf("%s: no file should be processed", name) }
+		if result, err := Batch(context.Background(), invalid); err == nil {
+			t.Errorf("%s: expected error, result = %+v", name, result)
+		}
+	}
+}
+
+// panicImage 访问时panic的图片，模拟解码器或合成过程中的panic
+type panicImage struct{}
+
+func (panicImage) ColorModel() color.Model { return color.NRGBAModel }
+func (panicImage) Bounds() image.Rectangle { panic("corrupt image") }
+func (panicImage) At(x, y int) color.Color { return color.Transparent }
+
+func TestBatchPanic(t *testing.T) {
+	input := t.TempDir()
+	for _, name := range []string{"a.png", "b.png"} {
+		if err := imaging.Save(imaging.New(100, 100, color.White), filepath.Join(input, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var last BatchProgress
+	config := BatchConfig{
+		InputDir:       input,
+		OutputDir:      t.TempDir(),
+		Workers:        2,
+		Image:          &ImageWatermarkConfig{WatermarkPos: Center},
+		WatermarkImage: panicImage{},
+		Progress:       func(p BatchProgress) { last = p },
+	}
+	result, err := Batch(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Succeeded != 0 || len(result.Failed) != 2 || last.Done != 2 || last.Total != 2 {
+		t.Fatalf("result = %+v, last progress = %+v", result, last)
+	}
+	if !strings.Contains(result.Failed[0].Error(), "corrupt image") {
+		t.Errorf("failed error = %v", result.Failed[0].Err)
+	}
+}
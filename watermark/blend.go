@@ -0,0 +1,196 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// BlendMode 水印与原图的混合模式
+type BlendMode string
+
+const (
+	BlendNormal     BlendMode = ""           // 正常：按透明度覆盖（默认）
+	BlendMultiply   BlendMode = "multiply"   // 正片叠底，结果更暗
+	BlendScreen     BlendMode = "screen"     // 滤色，结果更亮
+	BlendOverlay    BlendMode = "overlay"    // 叠加，增强原图对比度
+	BlendSoftLight  BlendMode = "soft_light" // 柔光
+	BlendDifference BlendMode = "difference" // 差值
+	BlendLuminosity BlendMode = "luminosity" // 明度：保留原图的色相和饱和度，只使用水印的明度
+	BlendAdaptive   BlendMode = "adaptive"   // 自适应：水印与下方区域的平均亮度同为亮色或暗色时反色，保证可读性
+)
+
+// validate 校验混合模式
+func (m BlendMode) validate() error {
+	switch m {
+	case BlendNormal, BlendMultiply, BlendScreen, BlendOverlay, BlendSoftLight, BlendDifference, BlendLuminosity, BlendAdaptive:
+		return nil
+	}
+	return errors.New("watermark blend mode error: " + string(m))
+}
+
+// overlayMark 将水印按透明度和混合模式叠加到dst的pt位置，直接修改dst
+// 正常模式的计算与imaging.Overlay一致
+func overlayMark(dst, mark *image.NRGBA, pt image.Point, opacity float64, mode BlendMode) error {
+	if err := mode.validate(); err != nil {
+		return err
+	}
+	opacity = math.Min(math.Max(opacity, 0), 1)
+	markRect := image.Rectangle{Min: pt, Max: pt.Add(mark.Bounds().Size())}
+	inter := markRect.Intersect(dst.Bounds())
+	if inter.Empty() {
+		return nil
+	}
+	if mode == BlendAdaptive {
+		mark = adaptMark(dst, mark, pt, inter)
+		mode = BlendNormal
+	}
+	for y := inter.Min.Y; y < inter.Max.Y; y++ {
+		i := dst.PixOffset(inter.Min.X, y)
+		j := mark.PixOffset(mark.Bounds().Min.X+inter.Min.X-pt.X, mark.Bounds().Min.Y+y-pt.Y)
+		for x := inter.Min.X; x < inter.Max.X; x, i, j = x+1, i+4, j+4 {
+			d := dst.Pix[i : i+4 : i+4]
+			s := mark.Pix[j : j+4 : j+4]
+			if mode != BlendNormal {
+				blendPixel(d, s, opacity, mode)
+				continue
+			}
+			a1, a2 := float64(d[3]), float64(s[3])
+			coef2 := opacity * a2 / 255
+			coef1 := (1 - coef2) * a1 / 255
+			coefSum := coef1 + coef2
+			if coefSum == 0 {
+				continue
+			}
+			coef1 /= coefSum
+			coef2 /= coefSum
+			d[0] = uint8(float64(d[0])*coef1 + float64(s[0])*coef2)
+			d[1] = uint8(float64(d[1])*coef1 + float64(s[1])*coef2)
+			d[2] = uint8(float64(d[2])*coef1 + float64(s[2])*coef2)
+			d[3] = uint8(math.Min(a1+a2*opacity*(255-a1)/255, 255))
+		}
+	}
+	return nil
+}
+
+// blendPixel 按W3C合成规范混合单个像素：先用混合函数计算颜色，再按透明度做source-over合成
+func blendPixel(d, s []uint8, opacity float64, mode BlendMode) {
+	as := float64(s[3]) / 255 * opacity
+	if as == 0 {
+		return
+	}
+	ab := float64(d[3]) / 255
+	cb := [3]float64{float64(d[0]) / 255, float64(d[1]) / 255, float64(d[2]) / 255}
+	cs := [3]float64{float64(s[0]) / 255, float64(s[1]) / 255, float64(s[2]) / 255}
+
+	var mixed [3]float64
+	if mode == BlendLuminosity {
+		mixed = setLum(cb, lum(cs))
+	} else {
+		for c := 0; c < 3; c++ {
+			mixed[c] = blendChannel(cb[c], cs[c], mode)
+		}
+	}
+	ao := as + ab*(1-as)
+	for c := 0; c < 3; c++ {
+		// 原图透明的区域直接显示水印颜色
+		v := (1-ab)*cs[c] + ab*mixed[c]
+		co := (as*v + (1-as)*ab*cb[c]) / ao
+		d[c] = uint8(math.Round(math.Min(math.Max(co, 0), 1) * 255))
+	}
+	d[3] = uint8(math.Round(ao * 255))
+}
+
+// blendChannel 可分离混合模式的单通道混合函数，cb为原图，cs为水印，取值0-1
+func blendChannel(cb, cs float64, mode BlendMode) float64 {
+	switch mode {
+	case BlendMultiply:
+		return cb * cs
+	case BlendScreen:
+		return cb + cs - cb*cs
+	case BlendOverlay:
+		// 叠加等价于交换参数的强光
+		if cb <= 0.5 {
+			return 2 * cb * cs
+		}
+		return 1 - 2*(1-cb)*(1-cs)
+	case BlendSoftLight:
+		if cs <= 0.5 {
+			return cb - (1-2*cs)*cb*(1-cb)
+		}
+		var dc float64
+		if cb <= 0.25 {
+			dc = ((16*cb-12)*cb + 4) * cb
+		} else {
+			dc = math.Sqrt(cb)
+		}
+		return cb + (2*cs-1)*(dc-cb)
+	case BlendDifference:
+		return math.Abs(cb - cs)
+	}
+	return cs
+}
+
+// lum 计算颜色的明度
+func lum(c [3]float64) float64 {
+	return 0.3*c[0] + 0.59*c[1] + 0.11*c[2]
+}
+
+// setLum 将颜色的明度设置为l，保持色相和饱和度
+func setLum(c [3]float64, l float64) [3]float64 {
+	d := l - lum(c)
+	for i := range c {
+		c[i] += d
+	}
+	// 裁剪到0-1范围内
+	l = lum(c)
+	n := math.Min(c[0], math.Min(c[1], c[2]))
+	x := math.Max(c[0], math.Max(c[1], c[2]))
+	for i := range c {
+		if n < 0 {
+			c[i] = l + (c[i]-l)*l/(l-n)
+		}
+		if x > 1 {
+			c[i] = l + (c[i]-l)*(1-l)/(x-l)
+		}
+	}
+	return c
+}
+
+// adaptMark 自适应模式：水印的平均明度与下方区域的平均明度同为亮色或暗色时，返回反色后的水印
+func adaptMark(dst, mark *image.NRGBA, pt image.Point, region image.Rectangle) *image.NRGBA {
+	var regionSum, regionWeight, markSum, markWeight float64
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		i := dst.PixOffset(region.Min.X, y)
+		j := mark.PixOffset(mark.Bounds().Min.X+region.Min.X-pt.X, mark.Bounds().Min.Y+y-pt.Y)
+		for x := region.Min.X; x < region.Max.X; x, i, j = x+1, i+4, j+4 {
+			d := dst.Pix[i : i+4 : i+4]
+			s := mark.Pix[j : j+4 : j+4]
+			// 只统计水印实际覆盖的像素，按水印的不透明度加权
+			w := float64(s[3])
+			regionSum += w * float64(d[3]) / 255 * pixelLum(d)
+			regionWeight += w * float64(d[3]) / 255
+			markSum += w * pixelLum(s)
+			markWeight += w
+		}
+	}
+	if regionWeight == 0 || markWeight == 0 {
+		return mark
+	}
+	if (regionSum/regionWeight >= 0.5) != (markSum/markWeight >= 0.5) {
+		return mark
+	}
+	inverted := image.NewNRGBA(mark.Bounds())
+	for i := 0; i < len(mark.Pix); i += 4 {
+		inverted.Pix[i] = 255 - mark.Pix[i]
+		inverted.Pix[i+1] = 255 - mark.Pix[i+1]
+		inverted.Pix[i+2] = 255 - mark.Pix[i+2]
+		inverted.Pix[i+3] = mark.Pix[i+3]
+	}
+	return inverted
+}
+
+// pixelLum 计算NRGBA像素的明度，取值0-1
+func pixelLum(p []uint8) float64 {
+	return (0.3*float64(p[0]) + 0.59*float64(p[1]) + 0.11*float64(p[2])) / 255
+}
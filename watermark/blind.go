@@ -0,0 +1,553 @@
+package watermark
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"hash/fnv"
+	"image"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+// 盲水印以8x8像素块为单位，在亮度通道的DCT中频系数(1,2)与(2,1)之差的符号中嵌入一位数据。
+// 16x11个块组成一个数据帧（同步字节+长度+数据+CRC32，共176位），在整张图片上循环平铺，
+// 提取时对所有重复位累加投票，并搜索块网格偏移、帧起点和缩放比例，以抵抗JPEG压缩、裁剪和缩放。
+const (
+	blindBlockSize = 8
+	blindTileCols  = 16
+	blindTileRows  = 11
+	blindFrameBits = blindTileCols * blindTileRows
+	blindSyncByte  = 0xA5
+	blindTileW     = blindTileCols * blindBlockSize
+	blindTileH     = blindTileRows * blindBlockSize
+	// blindDecodeSize 提取时分析的最大区域边长，水印在整张图片上循环平铺，
+	// 中心区域已包含足够的重复帧，限制区域大小使提取耗时和内存与原图尺寸无关
+	blindDecodeSize = 1024
+
+	// MaxBlindPayload 盲水印可嵌入的最大字节数
+	MaxBlindPayload = 16
+	// DefaultBlindStrength 默认嵌入强度
+	DefaultBlindStrength = 14.0
+)
+
+// blindKernel 两个DCT基函数之差，与像素块的内积即为两个系数之差
+var blindKernel = func() [blindBlockSize][blindBlockSize]float64 {
+	var k [blindBlockSize][blindBlockSize]float64
+	for y := 0; y < blindBlockSize; y++ {
+		for x := 0; x < blindBlockSize; x++ {
+			k[y][x] = dctBasis(1, 2, x, y) - dctBasis(2, 1, x, y)
+		}
+	}
+	return k
+}()
+
+// blindBasis 一维DCT基函数，blindKernel可分解为blindBasis[1](x)*blindBasis[2](y) - blindBasis[2](x)*blindBasis[1](y)，
+// 提取时据此按行、列两次一维滤波计算所有位置的块响应
+var blindBasis = func() [3][blindBlockSize]float64 {
+	var b [3][blindBlockSize]float64
+	for u := range b {
+		for x := 0; x < blindBlockSize; x++ {
+			b[u][x] = dctBasis1D(u, x)
+		}
+	}
+	return b
+}()
+
+// dctBasis 8x8正交DCT基函数在(x, y)处的值，u为水平频率，v为垂直频率
+func dctBasis(u, v, x, y int) float64 {
+	return dctBasis1D(u, x) * dctBasis1D(v, y)
+}
+
+// dctBasis1D 8点正交DCT基函数在x处的值，u为频率
+func dctBasis1D(u, x int) float64 {
+	alpha := math.Sqrt(2.0 / blindBlockSize)
+	if u == 0 {
+		alpha = math.Sqrt(1.0 / blindBlockSize)
+	}
+	return alpha * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*blindBlockSize))
+}
+
+// BlindWatermarkConfig 盲水印配置
+type BlindWatermarkConfig struct {
+	OriginImagePath    string        // 原图地址
+	CompositeImagePath string        // 合成图地址
+	Payload            []byte        // 嵌入内容（如用户ID、时间戳），最长16字节
+	Key                string        // 密钥，用于打乱嵌入位，提取时必须使用相同密钥
+	Strength           float64       // 嵌入强度，越大越抗压缩但越容易察觉，为0时使用默认值
+	Output             OutputOptions // 输出格式及编码质量选项，建议JPEG质量不低于80
+	AutoOrient         bool          // 是否根据EXIF方向信息自动旋转原图
+	KeepMetadata       bool          // 是否将原图的EXIF（方向除外）、ICC和XMP元数据写入JPEG输出
+}
+
+// CreateBlindWatermark 根据配置中的文件路径嵌入盲水印
+func CreateBlindWatermark(config BlindWatermarkConfig) error {
+	originFile, err := os.Open(config.OriginImagePath)
+	if err != nil {
+		return errors.New("open origin image file error:" + err.Error())
+	}
+	defer originFile.Close()
+
+	if err = PrepareOutputPath(config.CompositeImagePath); err != nil {
+		return errors.New("prepare composite image path error:" + err.Error())
+	}
+	src, err := decodeSource(originFile, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	format, err := config.Output.resolveFormat(src.format, config.CompositeImagePath)
+	if err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	destImg, err := AddBlindWatermark(src.img, config)
+	if err != nil {
+		return err
+	}
+	if err = saveComposite(&composite{img: destImg}, config.CompositeImagePath, format, src.meta, config.Output); err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	return nil
+}
+
+// CreateBlindWatermarkStream 从io.Reader读取原图，嵌入盲水印后写入io.Writer
+func CreateBlindWatermarkStream(origin io.Reader, w io.Writer, config BlindWatermarkConfig) error {
+	src, err := decodeSource(origin, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	format, err := config.Output.resolveFormat(src.format, "")
+	if err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	destImg, err := AddBlindWatermark(src.img, config)
+	if err != nil {
+		return err
+	}
+	if err = encodeImage(w, destImg, format, src.meta, config.Output); err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	return nil
+}
+
+// AddBlindWatermark 在内存中为图片嵌入盲水印，返回嵌入后的图片
+// 图片宽高至少需要容纳一个完整数据帧（128x88像素），越大越抗攻击
+func AddBlindWatermark(img image.Image, config BlindWatermarkConfig) (image.Image, error) {
+	if img == nil {
+		return nil, errors.New("origin image must not be nil")
+	}
+	if len(config.Payload) == 0 || len(config.Payload) > MaxBlindPayload {
+		return nil, errors.New("blind watermark payload error: Ensure 1 <= len(payload) <= 16")
+	}
+	if config.Strength < 0 {
+		return nil, errors.New("blind watermark strength error: Ensure strength >= 0")
+	}
+	if config.Strength == 0 {
+		config.Strength = DefaultBlindStrength
+	}
+	dst := imaging.Clone(img)
+	width, height := dst.Bounds().Dx(), dst.Bounds().Dy()
+	if width < blindTileW || height < blindTileH {
+		return nil, errors.New("blind watermark error: image is too small")
+	}
+
+	bits := blindFrame(config.Payload)
+	pn := blindPN(config.Key)
+	for by := 0; (by+1)*blindBlockSize <= height; by++ {
+		for bx := 0; (bx+1)*blindBlockSize <= width; bx++ {
+			idx := (by%blindTileRows)*blindTileCols + bx%blindTileCols
+			sign := -1.0
+			if bits[idx]^pn[idx] == 1 {
+				sign = 1.0
+			}
+			x0, y0 := bx*blindBlockSize, by*blindBlockSize
+			d := 0.0
+			for y := 0; y < blindBlockSize; y++ {
+				for x := 0; x < blindBlockSize; x++ {
+					d += nrgbaLuminance(dst, x0+x, y0+y) * blindKernel[y][x]
+				}
+			}
+			if sign*d >= config.Strength {
+				continue
+			}
+			// 基函数之差的范数平方为2，叠加delta*kernel使系数之差变化2*delta
+			delta := (sign*config.Strength - d) / 2
+			for y := 0; y < blindBlockSize; y++ {
+				for x := 0; x < blindBlockSize; x++ {
+					addNRGBALuminance(dst, x0+x, y0+y, delta*blindKernel[y][x])
+				}
+			}
+		}
+	}
+	return dst, nil
+}
+
+// ExtractBlindWatermark 从图片中提取盲水印内容，key必须与嵌入时一致
+// 支持经过JPEG重新压缩、裁剪和缩放后的图片，未检测到水印时返回错误
+func ExtractBlindWatermark(img image.Image, key string) ([]byte, error) {
+	if img == nil {
+		return nil, errors.New("image must not be nil")
+	}
+	pn := blindPN(key)
+	// 保留足够的区域，使按最大比例（2倍）还原后仍能填满分析区域
+	gray := newLumaPlane(imaging.Crop(img, centerRect(img.Bounds(), 2*blindDecodeSize)))
+	if payload, ok := gray.crop(blindDecodeSize).decodeBlind(pn); ok {
+		return payload, nil
+	}
+
+	// 估计缩放比例后在其附近还原尺寸再尝试，估计失败时才依次尝试常见缩放比例
+	var candidates [][2]float64
+	if sx, sy, ok := gray.crop(blindDecodeSize).estimateBlindScale(); ok {
+		for _, e := range []float64{0, -0.004, 0.004, -0.008, 0.008} {
+			candidates = append(candidates, [2]float64{sx * (1 + e), sy * (1 + e)})
+		}
+	} else {
+		for _, s := range []float64{0.5, 0.75, 0.8, 0.9, 1.1, 1.25, 1.5, 2} {
+			candidates = append(candidates, [2]float64{s, s})
+		}
+	}
+	for _, c := range candidates {
+		if math.Abs(c[0]-1) < 0.002 && math.Abs(c[1]-1) < 0.002 {
+			continue
+		}
+		scaled := gray.resize(c[0], c[1], blindDecodeSize)
+		if scaled == nil {
+			continue
+		}
+		if payload, ok := scaled.decodeBlind(pn); ok {
+			return payload, nil
+		}
+	}
+	return nil, errors.New("blind watermark not found")
+}
+
+// blindFrame 将内容编码为176位的数据帧：同步字节、长度、16字节数据（不足补0）、CRC32
+func blindFrame(payload []byte) []byte {
+	frame := make([]byte, 0, blindFrameBits/8)
+	frame = append(frame, blindSyncByte, byte(len(payload)))
+	data := make([]byte, MaxBlindPayload)
+	copy(data, payload)
+	frame = append(frame, data...)
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame[1:]))
+
+	bits := make([]byte, blindFrameBits)
+	for i := range bits {
+		bits[i] = (frame[i/8] >> (7 - uint(i%8))) & 1
+	}
+	return bits
+}
+
+// parseBlindFrame 解析数据帧，校验同步字节、长度和CRC32
+func parseBlindFrame(bits []byte) ([]byte, bool) {
+	frame := make([]byte, blindFrameBits/8)
+	for i, b := range bits {
+		frame[i/8] |= b << (7 - uint(i%8))
+	}
+	if frame[0] != blindSyncByte || frame[1] == 0 || frame[1] > MaxBlindPayload {
+		return nil, false
+	}
+	end := 2 + MaxBlindPayload
+	if crc32.ChecksumIEEE(frame[1:end]) != binary.BigEndian.Uint32(frame[end:]) {
+		return nil, false
+	}
+	return frame[2 : 2+int(frame[1])], true
+}
+
+// blindPN 根据密钥生成用于打乱数据位的伪随机序列
+func blindPN(key string) []byte {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	r := rand.New(rand.NewSource(int64(h.Sum64())))
+	pn := make([]byte, blindFrameBits)
+	for i := range pn {
+		pn[i] = byte(r.Intn(2))
+	}
+	return pn
+}
+
+// nrgbaLuminance 计算像素亮度
+func nrgbaLuminance(img *image.NRGBA, x, y int) float64 {
+	i := img.PixOffset(x, y)
+	return 0.299*float64(img.Pix[i]) + 0.587*float64(img.Pix[i+1]) + 0.114*float64(img.Pix[i+2])
+}
+
+// addNRGBALuminance 在不改变色度的情况下调整像素亮度
+func addNRGBALuminance(img *image.NRGBA, x, y int, delta float64) {
+	i := img.PixOffset(x, y)
+	for c := 0; c < 3; c++ {
+		img.Pix[i+c] = clampUint8(float64(img.Pix[i+c]) + delta)
+	}
+}
+
+// clampUint8 四舍五入并限制在0-255之间
+func clampUint8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+// lumaPlane 亮度平面
+type lumaPlane struct {
+	w, h int
+	pix  []float64
+}
+
+// newLumaPlane 提取图片的亮度平面
+func newLumaPlane(img image.Image) *lumaPlane {
+	src := imaging.Clone(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	p := &lumaPlane{w: w, h: h, pix: make([]float64, w*h)}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p.pix[y*w+x] = nrgbaLuminance(src, x, y)
+		}
+	}
+	return p
+}
+
+// at 返回(x, y)处的亮度，越界时返回0
+func (p *lumaPlane) at(x, y int) float64 {
+	if x < 0 || y < 0 || x >= p.w || y >= p.h {
+		return 0
+	}
+	return p.pix[y*p.w+x]
+}
+
+// resize 将亮度平面按1/sx、1/sy缩放（即还原被缩放sx、sy倍的图片），使用双线性插值，
+// 只生成结果中心最多size x size的区域
+func (p *lumaPlane) resize(sx, sy float64, size int) *lumaPlane {
+	w, h := int(float64(p.w)/sx+0.5), int(float64(p.h)/sy+0.5)
+	if w < blindTileW || h < blindTileH {
+		return nil
+	}
+	r := centerRect(image.Rect(0, 0, w, h), size)
+	dst := &lumaPlane{w: r.Dx(), h: r.Dy(), pix: make([]float64, r.Dx()*r.Dy())}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		fy := (float64(y)+0.5)*sy - 0.5
+		y0 := int(math.Floor(fy))
+		ty := fy - float64(y0)
+		for x := r.Min.X; x < r.Max.X; x++ {
+			fx := (float64(x)+0.5)*sx - 0.5
+			x0 := int(math.Floor(fx))
+			tx := fx - float64(x0)
+			x0c, x1c := clampInt(x0, 0, p.w-1), clampInt(x0+1, 0, p.w-1)
+			y0c, y1c := clampInt(y0, 0, p.h-1), clampInt(y0+1, 0, p.h-1)
+			top := p.pix[y0c*p.w+x0c]*(1-tx) + p.pix[y0c*p.w+x1c]*tx
+			bottom := p.pix[y1c*p.w+x0c]*(1-tx) + p.pix[y1c*p.w+x1c]*tx
+			dst.pix[(y-r.Min.Y)*dst.w+x-r.Min.X] = top*(1-ty) + bottom*ty
+		}
+	}
+	return dst
+}
+
+// crop 返回亮度平面中心最多size x size的区域，不超过时返回自身
+func (p *lumaPlane) crop(size int) *lumaPlane {
+	r := centerRect(image.Rect(0, 0, p.w, p.h), size)
+	if r.Dx() == p.w && r.Dy() == p.h {
+		return p
+	}
+	dst := &lumaPlane{w: r.Dx(), h: r.Dy(), pix: make([]float64, r.Dx()*r.Dy())}
+	for y := 0; y < dst.h; y++ {
+		copy(dst.pix[y*dst.w:(y+1)*dst.w], p.pix[(y+r.Min.Y)*p.w+r.Min.X:])
+	}
+	return dst
+}
+
+// centerRect 返回bounds中心最多size x size的矩形
+func centerRect(bounds image.Rectangle, size int) image.Rectangle {
+	w, h := min(bounds.Dx(), size), min(bounds.Dy(), size)
+	x0 := bounds.Min.X + (bounds.Dx()-w)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-h)/2
+	return image.Rect(x0, y0, x0+w, y0+h)
+}
+
+// clampInt 将整数限制在[min, max]之间
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// decodeBlind 搜索所有块网格偏移和帧起点，返回第一个通过校验的数据
+func (p *lumaPlane) decodeBlind(pn []byte) ([]byte, bool) {
+	if p.w < blindTileW || p.h < blindTileH {
+		return nil, false
+	}
+	resp := p.blockResponse()
+	rw, rh := p.w-blindBlockSize+1, p.h-blindBlockSize+1
+	bits := make([]byte, blindFrameBits)
+	for oy := 0; oy < blindBlockSize; oy++ {
+		for ox := 0; ox < blindBlockSize; ox++ {
+			var acc [blindTileRows][blindTileCols]float64
+			for by := 0; oy+by*blindBlockSize < rh; by++ {
+				row := resp[(oy+by*blindBlockSize)*rw:]
+				for bx := 0; ox+bx*blindBlockSize < rw; bx++ {
+					// 限幅，避免纹理强烈的块主导投票
+					d := math.Max(-3*DefaultBlindStrength, math.Min(3*DefaultBlindStrength, row[ox+bx*blindBlockSize]))
+					acc[by%blindTileRows][bx%blindTileCols] += d
+				}
+			}
+			for sy := 0; sy < blindTileRows; sy++ {
+				for sx := 0; sx < blindTileCols; sx++ {
+					for r := 0; r < blindTileRows; r++ {
+						for c := 0; c < blindTileCols; c++ {
+							idx := r*blindTileCols + c
+							var bit byte
+							if acc[(r+sy)%blindTileRows][(c+sx)%blindTileCols] > 0 {
+								bit = 1
+							}
+							bits[idx] = bit ^ pn[idx]
+						}
+					}
+					if payload, ok := parseBlindFrame(bits); ok {
+						return payload, true
+					}
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// blockResponse 计算以每个像素为左上角的8x8块中两个DCT系数之差，
+// 所有块网格偏移共用同一结果，结果宽为w-7、高为h-7
+func (p *lumaPlane) blockResponse() []float64 {
+	rw, rh := p.w-blindBlockSize+1, p.h-blindBlockSize+1
+	// 先按行分别与两个一维基函数做滤波，再按列组合
+	row1 := make([]float64, rw*p.h)
+	row2 := make([]float64, rw*p.h)
+	for y := 0; y < p.h; y++ {
+		line := p.pix[y*p.w : (y+1)*p.w]
+		for x := 0; x < rw; x++ {
+			var s1, s2 float64
+			for i := 0; i < blindBlockSize; i++ {
+				s1 += line[x+i] * blindBasis[1][i]
+				s2 += line[x+i] * blindBasis[2][i]
+			}
+			row1[y*rw+x], row2[y*rw+x] = s1, s2
+		}
+	}
+	resp := make([]float64, rw*rh)
+	for y := 0; y < rh; y++ {
+		for x := 0; x < rw; x++ {
+			d := 0.0
+			for j := 0; j < blindBlockSize; j++ {
+				d += row1[(y+j)*rw+x]*blindBasis[2][j] - row2[(y+j)*rw+x]*blindBasis[1][j]
+			}
+			resp[y*rw+x] = d
+		}
+	}
+	return resp
+}
+
+// estimateBlindScale 通过水印图案的平铺周期（128x88像素）估计图片的缩放比例
+func (p *lumaPlane) estimateBlindScale() (float64, float64, bool) {
+	residual := p.highPass()
+	sx, okX := residual.periodScale(blindTileW, true)
+	sy, okY := residual.periodScale(blindTileH, false)
+	switch {
+	case okX && okY:
+		return sx, sy, true
+	case okX:
+		return sx, sx, true
+	case okY:
+		return sy, sy, true
+	}
+	return 0, 0, false
+}
+
+// highPass 去除图片内容的低频部分，保留水印图案
+func (p *lumaPlane) highPass() *lumaPlane {
+	dst := &lumaPlane{w: p.w, h: p.h, pix: make([]float64, len(p.pix))}
+	for y := 0; y < p.h; y++ {
+		for x := 0; x < p.w; x++ {
+			sum, n := 0.0, 0.0
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					if xx, yy := x+dx, y+dy; xx >= 0 && yy >= 0 && xx < p.w && yy < p.h {
+						sum += p.pix[yy*p.w+xx]
+						n++
+					}
+				}
+			}
+			dst.pix[y*p.w+x] = p.pix[y*p.w+x] - sum/n
+		}
+	}
+	return dst
+}
+
+// periodScale 在0.5到2倍范围内搜索平铺周期对应的自相关峰值，返回缩放比例
+func (p *lumaPlane) periodScale(period int, horizontal bool) (float64, bool) {
+	minLag, maxLag := period/2, period*2
+	size := p.w
+	if !horizontal {
+		size = p.h
+	}
+	if maxLag >= size {
+		maxLag = size - 1
+	}
+	if minLag >= maxLag {
+		return 0, false
+	}
+	corr := make([]float64, maxLag+2)
+	for lag := minLag - 1; lag <= maxLag+1 && lag < size; lag++ {
+		sum, n := 0.0, 0
+		for y := 0; y < p.h; y += 2 {
+			for x := 0; x < p.w; x++ {
+				var a, b float64
+				if horizontal {
+					if x+lag >= p.w {
+						break
+					}
+					a, b = p.pix[y*p.w+x], p.pix[y*p.w+x+lag]
+				} else {
+					if y+lag >= p.h {
+						break
+					}
+					a, b = p.pix[y*p.w+x], p.pix[(y+lag)*p.w+x]
+				}
+				sum += a * b
+				n++
+			}
+		}
+		if n > 0 {
+			corr[lag] = sum / float64(n)
+		}
+	}
+	best := -1
+	for lag := minLag; lag <= maxLag; lag++ {
+		if corr[lag] > 0 && (best < 0 || corr[lag] > corr[best]) {
+			best = lag
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	// 峰值可能是周期的整数倍，优先选择最小的周期
+	for k := 4; k >= 2; k-- {
+		if lag := int(float64(best)/float64(k) + 0.5); lag >= minLag && corr[lag] > 0.5*corr[best] {
+			best = lag
+			break
+		}
+	}
+	// 抛物线插值得到亚像素精度的周期
+	peak := float64(best)
+	if best > 0 && best+1 < len(corr) {
+		l, c, r := corr[best-1], corr[best], corr[best+1]
+		if denom := l - 2*c + r; denom != 0 {
+			peak += 0.5 * (l - r) / denom
+		}
+	}
+	return peak / float64(period), true
+}
@@ -0,0 +1,107 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// syntheticPhoto 生成带有渐变和纹理的测试图片
+func syntheticPhoto(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fx, fy := float64(x), float64(y)
+			r := 128 + 60*math.Sin(fx/37) + 30*math.Cos(fy/23)
+			g := 110 + 50*math.Sin((fx+fy)/51) + 20*math.Sin(fx/7)*math.Cos(fy/11)
+			b := 90 + 70*math.Cos(fy/41) + 15*math.Sin(fx*fy/900)
+			img.Set(x, y, color.NRGBA{clampUint8(r), clampUint8(g), clampUint8(b), 255})
+		}
+	}
+	return img
+}
+
+func TestBlindWatermarkRoundTrip(t *testing.T) {
+	payload := []byte("uid:10086@1697")
+	marked, err := AddBlindWatermark(syntheticPhoto(640, 480), BlindWatermarkConfig{Payload: payload, Key: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recompress := func(img image.Image, quality int) image.Image {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := jpeg.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	cases := []struct {
+		name string
+		img  image.Image
+	}{
+		{"original", marked},
+		{"jpeg75", recompress(marked, 75)},
+		{"crop", imaging.Crop(recompress(marked, 85), image.Rect(37, 53, 517, 413))},
+		{"resize", recompress(imaging.Resize(marked, 480, 360, imaging.Linear), 85)},
+		{"crop+resize", recompress(imaging.Resize(imaging.Crop(marked, image.Rect(21, 13, 621, 463)), 420, 0, imaging.Linear), 85)},
+	}
+	for _, c := range cases {
+		got, err := ExtractBlindWatermark(c.img, "secret")
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%s: payload = %q, want %q", c.name, got, payload)
+		}
+	}
+
+	if got, err := ExtractBlindWatermark(marked, "wrong key"); err == nil {
+		t.Errorf("wrong key extracted %q", got)
+	}
+	if got, err := ExtractBlindWatermark(syntheticPhoto(640, 480), "secret"); err == nil {
+		t.Errorf("unmarked image extracted %q", got)
+	}
+}
+
+func TestBlindBlockResponse(t *testing.T) {
+	p := newLumaPlane(syntheticPhoto(40, 30))
+	resp := p.blockResponse()
+	rw := p.w - blindBlockSize + 1
+	for _, pt := range []image.Point{{0, 0}, {5, 3}, {32, 22}} {
+		want := 0.0
+		for y := 0; y < blindBlockSize; y++ {
+			for x := 0; x < blindBlockSize; x++ {
+				want += p.at(pt.X+x, pt.Y+y) * blindKernel[y][x]
+			}
+		}
+		if got := resp[pt.Y*rw+pt.X]; math.Abs(got-want) > 1e-9 {
+			t.Errorf("response at %v = %v, want %v", pt, got, want)
+		}
+	}
+}
+
+func TestBlindWatermarkLargeImage(t *testing.T) {
+	// 大图只分析中心区域，偏离中心的裁剪和缩放后仍能提取
+	payload := []byte("large")
+	marked, err := AddBlindWatermark(syntheticPhoto(3000, 2000), BlindWatermarkConfig{Payload: payload, Key: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cropped := imaging.Resize(imaging.Crop(marked, image.Rect(203, 117, 2803, 1917)), 2080, 0, imaging.Linear)
+	for name, img := range map[string]image.Image{"original": marked, "crop+resize": cropped} {
+		if got, err := ExtractBlindWatermark(img, "k"); err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("%s: payload = %q, %v", name, got, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"os"
+)
+
+// CodeType 码图类型
+type CodeType string
+
+const (
+	CodeQR      CodeType = ""        // 二维码（默认）
+	CodeCode128 CodeType = "code128" // Code128条形码
+)
+
+// CodeOptions 二维码/条形码渲染选项
+type CodeOptions struct {
+	Content               string     // 编码内容，如商品页链接
+	Type                  CodeType   // 码图类型，默认二维码
+	Level                 QRLevel    // 二维码纠错级别，默认M
+	ModuleSize            int        // 每个模块（条形码为最窄条）的像素数，默认4
+	QuietZone             int        // 静区宽度（模块数），为0时使用标准值（二维码4、条形码10），负数表示不留静区
+	BarHeight             int        // 条形码高度像素（仅Code128时使用），默认为ModuleSize的15倍
+	Foreground            color.RGBA // 深色模块颜色，默认黑色
+	Background            color.RGBA // 浅色模块及静区颜色，默认白色
+	TransparentBackground bool       // 是否只绘制深色模块，浅色模块和静区保持透明
+}
+
+// RenderCode 将内容渲染为二维码或条形码图片，每个模块对齐到整像素以保证可扫描
+func RenderCode(opts CodeOptions) (*image.NRGBA, error) {
+	if opts.ModuleSize < 0 || opts.BarHeight < 0 {
+		return nil, errors.New("code module size error: Ensure module_size >= 0 and bar_height >= 0")
+	}
+	if opts.ModuleSize == 0 {
+		opts.ModuleSize = 4
+	}
+	if opts.Foreground == (color.RGBA{}) {
+		opts.Foreground = Black
+	}
+	if opts.Background == (color.RGBA{}) {
+		opts.Background = White
+	}
+	if opts.TransparentBackground {
+		opts.Background = color.RGBA{}
+	}
+
+	var modules [][]bool
+	quietZone := opts.QuietZone
+	switch opts.Type {
+	case CodeQR:
+		if opts.Content == "" {
+			return nil, errors.New("qr code content must not be empty")
+		}
+		qr, err := encodeQR(opts.Content, opts.Level)
+		if err != nil {
+			return nil, err
+		}
+		modules = qr.modules
+		if quietZone == 0 {
+			quietZone = 4
+		}
+	case CodeCode128:
+		bars, err := encodeCode128(opts.Content)
+		if err != nil {
+			return nil, err
+		}
+		// 条形码按单行模块渲染，纵向拉伸到BarHeight
+		modules = [][]bool{bars}
+		if quietZone == 0 {
+			quietZone = 10
+		}
+	default:
+		return nil, errors.New("code type error: " + string(opts.Type))
+	}
+	quietZone = max(quietZone, 0)
+
+	moduleW, moduleH := opts.ModuleSize, opts.ModuleSize
+	quietX, quietY := quietZone*opts.ModuleSize, quietZone*opts.ModuleSize
+	if opts.Type == CodeCode128 {
+		moduleH = opts.BarHeight
+		if moduleH == 0 {
+			moduleH = opts.ModuleSize * 15
+		}
+		quietY = 0
+	}
+	width := len(modules[0])*moduleW + quietX*2
+	height := len(modules)*moduleH + quietY*2
+
+	fg := color.NRGBAModel.Convert(opts.Foreground).(color.NRGBA)
+	bg := color.NRGBAModel.Convert(opts.Background).(color.NRGBA)
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row := (y - quietY) / moduleH
+		for x := 0; x < width; x++ {
+			col := (x - quietX) / moduleW
+			c := bg
+			if x >= quietX && y >= quietY && row < len(modules) && col < len(modules[row]) && modules[row][col] {
+				c = fg
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img, nil
+}
+
+// CodeWatermarkConfig 二维码/条形码水印配置
+// 码图按Code渲染后作为图片水印，位置、偏移、透明度、混合模式和输出选项与图片水印相同
+// WatermarkImagePath会被忽略；ScaleMode默认不缩放，需要缩放时默认使用最近邻滤波保持模块边缘锐利
+type CodeWatermarkConfig struct {
+	ImageWatermarkConfig
+	Code CodeOptions // 码图内容及渲染选项
+}
+
+// imageConfig 返回放置码图使用的图片水印配置
+func (c CodeWatermarkConfig) imageConfig() ImageWatermarkConfig {
+	config := c.ImageWatermarkConfig
+	if config.ScaleMode == ScaleDefault {
+		config.ScaleMode = ScaleNone
+	}
+	if config.ResampleFilter == FilterLanczos {
+		config.ResampleFilter = FilterNearest
+	}
+	return config
+}
+
+// CreateCodeWatermark 根据配置中的文件路径为图片添加二维码/条形码水印
+func CreateCodeWatermark(config CodeWatermarkConfig) error {
+	codeImg, err := RenderCode(config.Code)
+	if err != nil {
+		return errors.New("render code error:" + err.Error())
+	}
+	originFile, err := os.Open(config.OriginImagePath)
+	if err != nil {
+		return errors.New("open origin image file error:" + err.Error())
+	}
+	defer originFile.Close()
+	// 删除旧的合成图片并创建输出目录
+	if err = PrepareOutputPath(config.CompositeImagePath); err != nil {
+		return errors.New("prepare composite image path error:" + err.Error())
+	}
+	src, err := decodeSource(originFile, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	format, err := config.Output.resolveFormat(src.format, config.CompositeImagePath)
+	if err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	result, err := composeImageWatermark(src, format, codeImg, config.imageConfig())
+	if err != nil {
+		return err
+	}
+	if err = saveComposite(result, config.CompositeImagePath, format, src.meta, config.Output); err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	return nil
+}
+
+// CreateCodeWatermarkStream 从io.Reader读取原图，添加二维码/条形码水印后写入io.Writer
+// 默认输出格式与原图格式保持一致，可通过Output选项指定，配置中的路径字段会被忽略
+func CreateCodeWatermarkStream(origin io.Reader, w io.Writer, config CodeWatermarkConfig) error {
+	codeImg, err := RenderCode(config.Code)
+	if err != nil {
+		return errors.New("render code error:" + err.Error())
+	}
+	src, err := decodeSource(origin, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	format, err := config.Output.resolveFormat(src.format, "")
+	if err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	result, err := composeImageWatermark(src, format, codeImg, config.imageConfig())
+	if err != nil {
+		return err
+	}
+	if err = result.encode(w, format, src.meta, config.Output); err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	return nil
+}
+
+// AddCodeWatermark 在内存中为图片添加二维码/条形码水印，返回合成后的图片
+func AddCodeWatermark(originImg image.Image, config CodeWatermarkConfig) (image.Image, error) {
+	codeImg, err := RenderCode(config.Code)
+	if err != nil {
+		return nil, errors.New("render code error:" + err.Error())
+	}
+	return AddImageWatermark(originImg, codeImg, config.imageConfig())
+}
+
+// CodeLayer 创建二维码/条形码水印图层，码图在创建时渲染
+func CodeLayer(config CodeWatermarkConfig) (Layer, error) {
+	codeImg, err := RenderCode(config.Code)
+	if err != nil {
+		return Layer{}, errors.New("render code error:" + err.Error())
+	}
+	return ImageLayer(codeImg, config.imageConfig()), nil
+}
@@ -0,0 +1,73 @@
+package watermark
+
+import "errors"
+
+// Code128条形码编码器，纯数字且长度为偶数时使用字符集C，其余使用字符集B
+
+// code128Patterns 各符号值的条/空宽度（模块数），依次为条、空交替，最后一项为终止符
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Code128特殊符号值
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// encodeCode128 将内容编码为条/空序列，true为条（深色），每个元素对应一个模块宽度
+func encodeCode128(content string) ([]bool, error) {
+	if content == "" {
+		return nil, errors.New("code128 content must not be empty")
+	}
+	digits := len(content)%2 == 0
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c < 32 || c > 126 {
+			return nil, errors.New("code128 content error: only printable ascii characters are supported")
+		}
+		if c < '0' || c > '9' {
+			digits = false
+		}
+	}
+
+	var values []int
+	if digits {
+		values = append(values, code128StartC)
+		for i := 0; i < len(content); i += 2 {
+			values = append(values, int(content[i]-'0')*10+int(content[i+1]-'0'))
+		}
+	} else {
+		values = append(values, code128StartB)
+		for i := 0; i < len(content); i++ {
+			values = append(values, int(content[i])-32)
+		}
+	}
+	// 校验符号：起始符加上各符号值乘以位置，对103取模
+	checksum := values[0]
+	for i, v := range values[1:] {
+		checksum += (i + 1) * v
+	}
+	values = append(values, checksum%103, code128Stop)
+
+	var bars []bool
+	for _, v := range values {
+		for i, w := range code128Patterns[v] {
+			for n := 0; n < int(w-'0'); n++ {
+				bars = append(bars, i%2 == 0)
+			}
+		}
+	}
+	return bars, nil
+}
@@ -0,0 +1,284 @@
+package watermark
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// FontRegistry 命名字体注册表，字体在首次使用时加载并缓存，可并发使用
+type FontRegistry struct {
+	mu    sync.Mutex
+	fonts map[string]*fontEntry
+}
+
+// fontEntry 注册表中的一个字体，只加载一次
+type fontEntry struct {
+	path  string
+	data  []byte
+	index int
+	once  sync.Once
+	font  *truetype.Font
+	err   error
+}
+
+// load 加载并解析字体，结果会被缓存
+func (e *fontEntry) load() (*truetype.Font, error) {
+	e.once.Do(func() {
+		data := e.data
+		if data == nil {
+			if data, e.err = os.ReadFile(e.path); e.err != nil {
+				e.err = fmt.Errorf("failed to read font file: %w", e.err)
+				return
+			}
+		}
+		e.font, e.err = ParseFontCollection(data, e.index)
+	})
+	return e.font, e.err
+}
+
+// DefaultFontRegistry 默认字体注册表，文字水印配置中的字体名和字体路径都通过它解析
+var DefaultFontRegistry = NewFontRegistry()
+
+// NewFontRegistry 创建字体注册表
+func NewFontRegistry() *FontRegistry {
+	return &FontRegistry{fonts: make(map[string]*fontEntry)}
+}
+
+// Register 注册字体文件，index为TTC字体集合中的字体序号，普通TTF文件为0
+func (r *FontRegistry) Register(name, path string, index int) {
+	r.set(name, &fontEntry{path: path, index: index})
+}
+
+// RegisterData 注册内存中的字体数据
+func (r *FontRegistry) RegisterData(name string, data []byte, index int) error {
+	if len(data) == 0 {
+		return errors.New("font data must not be empty")
+	}
+	r.set(name, &fontEntry{data: data, index: index})
+	return nil
+}
+
+// set 保存注册项，同名注册会覆盖之前的字体
+func (r *FontRegistry) set(name string, entry *fontEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fonts[name] = entry
+}
+
+// Load 按名称获取字体，未注册的名称作为字体文件路径加载，结果同样会被缓存
+func (r *FontRegistry) Load(nameOrPath string) (*truetype.Font, error) {
+	r.mu.Lock()
+	entry, ok := r.fonts[nameOrPath]
+	if !ok {
+		entry = &fontEntry{path: nameOrPath}
+		r.fonts[nameOrPath] = entry
+	}
+	r.mu.Unlock()
+	f, err := entry.load()
+	if err != nil && !ok {
+		// 按路径加载失败时不缓存错误，文件可能稍后才创建
+		r.mu.Lock()
+		if r.fonts[nameOrPath] == entry {
+			delete(r.fonts, nameOrPath)
+		}
+		r.mu.Unlock()
+	}
+	return f, err
+}
+
+// fontData 返回字体的原始数据及其在字体集合中的序号，用于在PDF中嵌入字体
+func (r *FontRegistry) fontData(nameOrPath string) ([]byte, int, error) {
+	r.mu.Lock()
+	entry, ok := r.fonts[nameOrPath]
+	r.mu.Unlock()
+	if !ok {
+		entry = &fontEntry{path: nameOrPath}
+	}
+	if entry.data != nil {
+		return entry.data, entry.index, nil
+	}
+	data, err := os.ReadFile(entry.path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read font file: %w", err)
+	}
+	return data, entry.index, nil
+}
+
+// RegisterFont 在默认注册表中注册字体文件
+func RegisterFont(name, path string, index int) {
+	DefaultFontRegistry.Register(name, path, index)
+}
+
+// RegisterFontData 在默认注册表中注册内存中的字体数据
+func RegisterFontData(name string, data []byte, index int) error {
+	return DefaultFontRegistry.RegisterData(name, data, index)
+}
+
+// ParseFontCollection 解析TTF字体或TTC字体集合中的第index个字体
+func ParseFontCollection(data []byte, index int) (*truetype.Font, error) {
+	if len(data) < 12 || string(data[:4]) != "ttcf" {
+		if index != 0 {
+			return nil, fmt.Errorf("font index %d out of range: not a font collection", index)
+		}
+		return parseFont(data)
+	}
+	numFonts := int(binary.BigEndian.Uint32(data[8:]))
+	if index < 0 || index >= numFonts || len(data) < 12+4*numFonts {
+		return nil, fmt.Errorf("font index %d out of range: collection has %d fonts", index, numFonts)
+	}
+	if index == 0 {
+		return parseFont(data)
+	}
+	// truetype只解析集合中的第一个字体，将第一个偏移替换为目标字体的偏移
+	patched := make([]byte, len(data))
+	copy(patched, data)
+	copy(patched[12:16], data[12+4*index:16+4*index])
+	return parseFont(patched)
+}
+
+// parseFont 解析字体数据
+func parseFont(data []byte) (*truetype.Font, error) {
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	return f, nil
+}
+
+// loadFontChain 按顺序加载主字体和后备字体，DefaultFont总是作为最后的后备
+// 主字体为空时使用DefaultFont
+func loadFontChain(primary string, fallbacks []string) ([]*truetype.Font, error) {
+	var fonts []*truetype.Font
+	if primary == "" && DefaultFont != nil {
+		fonts = append(fonts, DefaultFont)
+	}
+	for _, ref := range append([]string{primary}, fallbacks...) {
+		if ref == "" {
+			continue
+		}
+		f, err := DefaultFontRegistry.Load(ref)
+		if err != nil {
+			return nil, err
+		}
+		fonts = append(fonts, f)
+	}
+	if DefaultFont != nil && len(fonts) > 0 && fonts[0] != DefaultFont {
+		fonts = append(fonts, DefaultFont)
+	}
+	if len(fonts) == 0 {
+		return nil, errors.New("no default font available and no font path provided")
+	}
+	return fonts, nil
+}
+
+// fallbackFace 字体回退链，文字整形后每个字素簇使用第一个包含其全部字形的字体绘制
+type fallbackFace struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+// newFallbackFace 创建指定字号的字体回退链
+func newFallbackFace(fonts []*truetype.Font, size float64) *fallbackFace {
+	f := &fallbackFace{fonts: fonts, faces: make([]font.Face, len(fonts))}
+	for i, ft := range fonts {
+		f.faces[i] = newFontFace(ft, size)
+	}
+	return f
+}
+
+// pick 返回包含字符r的第一个字体序号，都不包含时使用主字体
+func (f *fallbackFace) pick(r rune) int {
+	for i, ft := range f.fonts {
+		if ft.Index(r) != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// covers 第i个字体是否包含字符r的字形
+func (f *fallbackFace) covers(i int, r rune) bool {
+	return f.fonts[i].Index(r) != 0
+}
+
+// shape 将一行文字整形为按显示顺序排列的字形
+func (f *fallbackFace) shape(text string) []shapedGlyph {
+	return shapeText(text, len(f.fonts), f.covers)
+}
+
+// advance 计算整形后字形的总宽度，相邻字形来自同一字体时计入字距调整
+func (f *fallbackFace) advance(glyphs []shapedGlyph) fixed.Int26_6 {
+	var width fixed.Int26_6
+	for i, g := range glyphs {
+		if i > 0 && glyphs[i-1].face == g.face {
+			width += f.faces[g.face].Kern(glyphs[i-1].r, g.r)
+		}
+		a, _ := f.faces[g.face].GlyphAdvance(g.r)
+		width += a
+	}
+	return width
+}
+
+// draw 从基线起点dot开始绘制整形后的字形
+func (f *fallbackFace) draw(dst draw.Image, src image.Image, dot fixed.Point26_6, glyphs []shapedGlyph) {
+	for i, g := range glyphs {
+		face := f.faces[g.face]
+		if i > 0 && glyphs[i-1].face == g.face {
+			dot.X += face.Kern(glyphs[i-1].r, g.r)
+		}
+		dr, mask, maskp, advance, ok := face.Glyph(dot, g.r)
+		if ok {
+			draw.DrawMask(dst, dr, src, image.Point{}, mask, maskp, draw.Over)
+		}
+		dot.X += advance
+	}
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphAdvance(r)
+}
+
+// Kern 只有相邻两个字符来自同一字体时才有字距调整
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	i := f.pick(r0)
+	if i != f.pick(r1) {
+		return 0
+	}
+	return f.faces[i].Kern(r0, r1)
+}
+
+// Metrics 以主字体为准，行高、上升和下降取所有字体的最大值，避免后备字形被裁剪
+func (f *fallbackFace) Metrics() font.Metrics {
+	m := f.faces[0].Metrics()
+	for _, face := range f.faces[1:] {
+		fm := face.Metrics()
+		m.Height = max(m.Height, fm.Height)
+		m.Ascent = max(m.Ascent, fm.Ascent)
+		m.Descent = max(m.Descent, fm.Descent)
+	}
+	return m
+}
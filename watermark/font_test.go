@@ -0,0 +1,143 @@
+package watermark
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
+)
+
+// buildTTC 将多个TTF字体拼接为TTC字体集合，并修正各字体表目录中的偏移
+func buildTTC(fonts ...[]byte) []byte {
+	header := 12 + 4*len(fonts)
+	data := make([]byte, header)
+	copy(data, "ttcf")
+	binary.BigEndian.PutUint32(data[4:], 0x00010000)
+	binary.BigEndian.PutUint32(data[8:], uint32(len(fonts)))
+	for i, ttf := range fonts {
+		base := len(data)
+		binary.BigEndian.PutUint32(data[12+4*i:], uint32(base))
+		data = append(data, ttf...)
+		numTables := int(binary.BigEndian.Uint16(ttf[4:]))
+		for t := 0; t < numTables; t++ {
+			entry := base + 12 + 16*t + 8
+			binary.BigEndian.PutUint32(data[entry:], binary.BigEndian.Uint32(data[entry:])+uint32(base))
+		}
+	}
+	return data
+}
+
+func TestParseFontCollection(t *testing.T) {
+	ttc := buildTTC(goregular.TTF, gobold.TTF)
+	for index, want := range []string{"Go Regular", "Go Bold"} {
+		f, err := ParseFontCollection(ttc, index)
+		if err != nil {
+			t.Fatalf("index %d: %v", index, err)
+		}
+		if name := f.Name(truetype.NameIDFontFullName); name != want {
+			t.Errorf("index %d: name = %q, want %q", index, name, want)
+		}
+	}
+	if _, err := ParseFontCollection(ttc, 2); err == nil {
+		t.Error("expected error for index out of range")
+	}
+	if _, err := ParseFontCollection(goregular.TTF, 1); err == nil {
+		t.Error("expected error for index on a single font")
+	}
+}
+
+func TestFontRegistry(t *testing.T) {
+	registry := NewFontRegistry()
+	if err := registry.RegisterData("bold", buildTTC(goregular.TTF, gobold.TTF), 1); err != nil {
+		t.Fatal(err)
+	}
+	first, err := registry.Load("bold")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := registry.Load("bold")
+	if first != second {
+		t.Error("registered font should be loaded once and cached")
+	}
+	if name := first.Name(truetype.NameIDFontFullName); name != "Go Bold" {
+		t.Errorf("name = %q", name)
+	}
+
+	path := writeTestFont(t)
+	byPath, err := registry.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := registry.Load(path); again != byPath {
+		t.Error("font loaded by path should be cached")
+	}
+	if _, err := registry.Load(path + ".missing"); err == nil {
+		t.Error("expected error for missing font file")
+	}
+}
+
+func TestLoadFontChain(t *testing.T) {
+	saved := DefaultFont
+	defer func() { DefaultFont = saved }()
+	regular, _ := truetype.Parse(goregular.TTF)
+	DefaultFont = regular
+	if err := RegisterFontData("test-bold", gobold.TTF, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 主字体为空时使用DefaultFont
+	fonts, err := loadFontChain("", []string{"test-bold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fonts) != 2 || fonts[0] != regular {
+		t.Errorf("empty primary should use DefaultFont first, got %d fonts", len(fonts))
+	}
+	fonts, err = loadFontChain("test-bold", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fonts) != 2 || fonts[1] != regular {
+		t.Error("DefaultFont should be the last fallback")
+	}
+
+	img, err := createTextImage(TransparentTextWatermarkConfig{Text: "default", Size: 20, Color: Black}, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inkBounds(img).Empty() {
+		t.Error("text with default font not rendered")
+	}
+
+	DefaultFont = nil
+	if _, err := loadFontChain("", nil); err == nil {
+		t.Error("expected error without any font")
+	}
+}
+
+// kernFace 为固定字符对返回字距调整的测试字体
+type kernFace struct {
+	font.Face
+}
+
+func (kernFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if r0 == 'A' && r1 == 'V' {
+		return -fixed.I(3)
+	}
+	return 0
+}
+
+func TestMeasureTextKerning(t *testing.T) {
+	face := kernFace{basicfont.Face7x13}
+	if w, _ := measureText(face, "AV"); w != 11 {
+		t.Errorf("kerned width = %d, want 11", w)
+	}
+	if w, _ := measureText(face, "VA"); w != 14 {
+		t.Errorf("width = %d, want 14", w)
+	}
+}
@@ -0,0 +1,235 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+// FrameOffsetFunc 返回动图第index帧（共total帧）的水印偏移量
+type FrameOffsetFunc func(index, total int) (offsetX, offsetY int)
+
+// GIFOptions GIF动图处理选项
+type GIFOptions struct {
+	FirstFrameOnly bool            // 只处理第一帧并输出静态图片
+	FrameOffset    FrameOffsetFunc // 每一帧的水印偏移量，为空时所有帧使用OffsetX/OffsetY
+}
+
+// LinearFrameOffset 创建水印从起点匀速移动到终点的帧偏移函数
+func LinearFrameOffset(fromX, fromY, toX, toY int) FrameOffsetFunc {
+	return func(index, total int) (int, int) {
+		if total <= 1 {
+			return fromX, fromY
+		}
+		t := float64(index) / float64(total-1)
+		return fromX + int(float64(toX-fromX)*t+0.5), fromY + int(float64(toY-fromY)*t+0.5)
+	}
+}
+
+// frameStamper 为动图的一帧（已合成为完整画布）添加水印
+type frameStamper func(frame image.Image, index, total int) (image.Image, error)
+
+// composite 合成结果，静态图片或GIF动图二选一
+type composite struct {
+	img  image.Image
+	anim *gif.GIF
+}
+
+// encode 按输出格式编码合成结果，动图只在输出为GIF时完整输出
+func (c *composite) encode(w io.Writer, format imaging.Format, meta *imageMetadata, opts OutputOptions) error {
+	if c.anim != nil {
+		return gif.EncodeAll(w, c.anim)
+	}
+	return encodeImage(w, c.img, format, meta, opts)
+}
+
+// composeImageWatermark 为原图（或动图的每一帧）添加图片水印
+func composeImageWatermark(src *sourceImage, format imaging.Format, watermarkImg image.Image, config ImageWatermarkConfig) (*composite, error) {
+	if src.anim != nil && format == imaging.GIF && !config.GIF.FirstFrameOnly {
+		anim, err := AddImageWatermarkGIF(src.anim, watermarkImg, config)
+		if err != nil {
+			return nil, err
+		}
+		return &composite{anim: anim}, nil
+	}
+	img, err := AddImageWatermark(src.img, watermarkImg, config)
+	if err != nil {
+		return nil, err
+	}
+	return &composite{img: img}, nil
+}
+
+// composeTextWatermark 为原图（或动图的每一帧）添加透明文字水印
+func composeTextWatermark(src *sourceImage, format imaging.Format, config TransparentTextWatermarkConfig) (*composite, error) {
+	if src.anim != nil && format == imaging.GIF && !config.GIF.FirstFrameOnly {
+		anim, err := addTextWatermarkGIF(src.anim, config, src.templateContext())
+		if err != nil {
+			return nil, err
+		}
+		return &composite{anim: anim}, nil
+	}
+	img, err := addTextWatermark(src.img, config, src.templateContext())
+	if err != nil {
+		return nil, err
+	}
+	return &composite{img: img}, nil
+}
+
+// AddImageWatermarkGIF 为GIF动图的每一帧添加图片水印
+// 帧延时、处置方式和循环次数保持不变，可通过GIF.FrameOffset为每帧指定不同位置
+func AddImageWatermarkGIF(g *gif.GIF, watermarkImg image.Image, config ImageWatermarkConfig) (*gif.GIF, error) {
+	if watermarkImg == nil {
+		return nil, errors.New("watermark image must not be nil")
+	}
+	return stampGIF(g, func(frame image.Image, index, total int) (image.Image, error) {
+		frameConfig := config
+		if config.GIF.FrameOffset != nil {
+			frameConfig.OffsetX, frameConfig.OffsetY = config.GIF.FrameOffset(index, total)
+		}
+		return AddImageWatermark(frame, watermarkImg, frameConfig)
+	})
+}
+
+// AddTransparentTextWatermarkGIF 为GIF动图的每一帧添加透明文字水印
+// 文字只渲染一次，帧延时、处置方式和循环次数保持不变
+func AddTransparentTextWatermarkGIF(g *gif.GIF, config TransparentTextWatermarkConfig) (*gif.GIF, error) {
+	return addTextWatermarkGIF(g, config, templateContext{})
+}
+
+// addTextWatermarkGIF 展开文字模板后为GIF动图的每一帧添加透明文字水印
+func addTextWatermarkGIF(g *gif.GIF, config TransparentTextWatermarkConfig, ctx templateContext) (*gif.GIF, error) {
+	if err := normalizeTextConfig(&config); err != nil {
+		return nil, err
+	}
+	if g == nil || len(g.Image) == 0 {
+		return nil, errors.New("gif has no frames")
+	}
+	ctx.width, ctx.height = g.Config.Width, g.Config.Height
+	if ctx.width == 0 || ctx.height == 0 {
+		ctx.width, ctx.height = g.Image[0].Bounds().Dx(), g.Image[0].Bounds().Dy()
+	}
+	config.Text = config.expandText(ctx)
+	textWatermarkImg, err := createTextImage(config, ctx.width)
+	if err != nil {
+		return nil, err
+	}
+	return stampGIF(g, func(frame image.Image, index, total int) (image.Image, error) {
+		frameConfig := config
+		if config.GIF.FrameOffset != nil {
+			frameConfig.OffsetX, frameConfig.OffsetY = config.GIF.FrameOffset(index, total)
+		}
+		return overlayTextWatermark(frame, textWatermarkImg, frameConfig)
+	})
+}
+
+// stampGIF 按处置方式逐帧合成完整画布，添加水印后重新量化为调色板图像
+func stampGIF(g *gif.GIF, stamp frameStamper) (*gif.GIF, error) {
+	if g == nil || len(g.Image) == 0 {
+		return nil, errors.New("gif has no frames")
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+
+	out := &gif.GIF{
+		Image:           make([]*image.Paletted, len(g.Image)),
+		Delay:           make([]int, len(g.Image)),
+		Disposal:        make([]byte, len(g.Image)),
+		LoopCount:       g.LoopCount,
+		Config:          g.Config,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+	copy(out.Delay, g.Delay)
+	copy(out.Disposal, g.Disposal)
+	out.Config.Width, out.Config.Height = bounds.Dx(), bounds.Dy()
+
+	canvas := image.NewNRGBA(bounds)
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = imaging.Clone(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		stamped, err := stamp(canvas, i, len(g.Image))
+		if err != nil {
+			return nil, err
+		}
+		out.Image[i] = quantizeFrame(stamped, bounds, frame.Palette)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return out, nil
+}
+
+// quantizeFrame 将添加水印后的帧转换为调色板图像
+// 保留原帧调色板，空余的调色板位置用水印引入的最常见新颜色填充
+func quantizeFrame(img image.Image, bounds image.Rectangle, palette color.Palette) *image.Paletted {
+	pal := make(color.Palette, len(palette), 256)
+	copy(pal, palette)
+	if free := 256 - len(pal); free > 0 {
+		pal = append(pal, frequentNewColors(img, palette, free)...)
+	}
+	dst := image.NewPaletted(bounds, pal)
+	draw.Draw(dst, bounds, img, img.Bounds().Min, draw.Src)
+	return dst
+}
+
+// frequentNewColors 统计图片中不在调色板内的颜色，按出现次数返回最多n个
+func frequentNewColors(img image.Image, palette color.Palette, n int) []color.Color {
+	existing := make(map[color.RGBA]bool, len(palette))
+	for _, c := range palette {
+		existing[color.RGBAModel.Convert(c).(color.RGBA)] = true
+	}
+	counts := make(map[color.RGBA]int)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if !existing[c] {
+				counts[c]++
+			}
+		}
+	}
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		if counts[colors[i]] != counts[colors[j]] {
+			return counts[colors[i]] > counts[colors[j]]
+		}
+		return colorKey(colors[i]) < colorKey(colors[j])
+	})
+	if len(colors) > n {
+		colors = colors[:n]
+	}
+	result := make([]color.Color, len(colors))
+	for i, c := range colors {
+		result[i] = c
+	}
+	return result
+}
+
+// colorKey 颜色排序键，保证相同出现次数时结果稳定
+func colorKey(c color.RGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
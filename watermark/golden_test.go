@@ -0,0 +1,297 @@
+package watermark
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/freetype"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// 金样回归测试：对生成的输入图按各种位置、平铺、旋转和透明度组合叠加水印，
+// 与testdata/golden下提交的PNG逐像素做感知差异比较。
+// 有意修改渲染结果后，使用 UPDATE_GOLDEN=1 go test -run TestGolden 重新生成金样并检查差异后提交。
+
+const goldenDir = "testdata/golden"
+
+// goldenTolerance 感知差异容差
+type goldenTolerance struct {
+	pixel float64 // 单个像素的YIQ色差阈值（0-1），超过时视为不同
+	ratio float64 // 允许不同的像素比例
+}
+
+// defaultGoldenTolerance 允许浮点运算和抗锯齿带来的细微差异，整体偏移一个像素即会失败
+var defaultGoldenTolerance = goldenTolerance{pixel: 0.1, ratio: 0.002}
+
+// goldenOrigin 生成带渐变和网格线的原图，网格便于在差异图中看出水印的偏移
+func goldenOrigin() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 240, 160))
+	for y := 0; y < 160; y++ {
+		for x := 0; x < 240; x++ {
+			c := color.NRGBA{uint8(60 + x*3/4), uint8(90 + y/2), uint8(200 - y/2), 255}
+			if x%20 == 0 || y%20 == 0 {
+				c = color.NRGBA{40, 40, 40, 255}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// goldenLogo 生成带半透明填充、不透明边框和对角线的水印图，方向不对称以便发现翻转
+func goldenLogo() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 48, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 48; x++ {
+			switch {
+			case x < 2 || y < 2 || x >= 46 || y >= 22:
+				img.SetNRGBA(x, y, color.NRGBA{220, 20, 20, 255})
+			case x == 2*y || x < 10 && y < 8:
+				img.SetNRGBA(x, y, color.NRGBA{255, 255, 255, 255})
+			default:
+				img.SetNRGBA(x, y, color.NRGBA{255, 220, 0, 128})
+			}
+		}
+	}
+	return img
+}
+
+// yiqDelta 两个不透明像素在YIQ空间的加权色差，归一化到0-1
+func yiqDelta(a, b color.NRGBA) float64 {
+	yiq := func(c color.NRGBA) (float64, float64, float64) {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		return 0.29889531*r + 0.58662247*g + 0.11448223*b,
+			0.59597799*r - 0.27417610*g - 0.32180189*b,
+			0.21147017*r - 0.52261711*g + 0.31114694*b
+	}
+	y1, i1, q1 := yiq(a)
+	y2, i2, q2 := yiq(b)
+	dy, di, dq := y1-y2, i1-i2, q1-q2
+	// 35215为最大可能的加权差值
+	return math.Sqrt((0.5053*dy*dy + 0.299*di*di + 0.1957*dq*dq) / 35215)
+}
+
+// perceptualDiff 比较两张图，返回超过像素阈值的像素比例和标出这些像素的差异图
+// 透明像素先叠加在白色上再比较；尺寸不同时比例为1
+func perceptualDiff(got, want image.Image, pixel float64) (float64, *image.NRGBA) {
+	gb, wb := got.Bounds(), want.Bounds()
+	if gb.Size() != wb.Size() {
+		return 1, nil
+	}
+	flatten := func(img image.Image, x, y int) color.NRGBA {
+		c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		a := float64(c.A) / 255
+		blend := func(v uint8) uint8 { return uint8(float64(v)*a + 255*(1-a) + 0.5) }
+		return color.NRGBA{blend(c.R), blend(c.G), blend(c.B), 255}
+	}
+	diff := image.NewNRGBA(image.Rect(0, 0, gb.Dx(), gb.Dy()))
+	count := 0
+	for y := 0; y < gb.Dy(); y++ {
+		for x := 0; x < gb.Dx(); x++ {
+			g, w := flatten(got, gb.Min.X+x, gb.Min.Y+y), flatten(want, wb.Min.X+x, wb.Min.Y+y)
+			if yiqDelta(g, w) > pixel {
+				count++
+				diff.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+				continue
+			}
+			// 相同的像素以淡灰度显示，方便对照位置
+			l := uint8(255 - (255-(uint16(w.R)*3+uint16(w.G)*6+uint16(w.B))/10)/4)
+			diff.SetNRGBA(x, y, color.NRGBA{l, l, l, 255})
+		}
+	}
+	return float64(count) / float64(gb.Dx()*gb.Dy()), diff
+}
+
+// writeGoldenPNG 将图片写为PNG
+func writeGoldenPNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err = png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkGolden 将渲染结果与金样比较，设置UPDATE_GOLDEN环境变量时改为写入金样
+// 比较失败时将实际结果和差异图写入系统临时目录，便于查看
+func checkGolden(t *testing.T, name string, got image.Image, tol goldenTolerance) {
+	t.Helper()
+	path := filepath.Join(goldenDir, name+".png")
+	if os.Getenv("UPDATE_GOLDEN") != "" {
+		writeGoldenPNG(t, path, got)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v (run with UPDATE_GOLDEN=1 to create it)", err)
+	}
+	defer file.Close()
+	want, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratio, diff := perceptualDiff(got, want, tol.pixel)
+	if ratio <= tol.ratio {
+		return
+	}
+	out := filepath.Join(os.TempDir(), "watermark-golden")
+	writeGoldenPNG(t, filepath.Join(out, name+".actual.png"), got)
+	if diff != nil {
+		writeGoldenPNG(t, filepath.Join(out, name+".diff.png"), diff)
+	}
+	t.Errorf("%s differs from golden: %.2f%% pixels changed (tolerance %.2f%%), got %v want %v; actual and diff written to %s",
+		name, ratio*100, tol.ratio*100, got.Bounds().Size(), want.Bounds().Size(), out)
+}
+
+// useGoldenFont 将DefaultFont替换为Go Regular，避免渲染结果依赖系统字体
+func useGoldenFont(t *testing.T) {
+	t.Helper()
+	f, err := freetype.ParseFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := DefaultFont
+	DefaultFont = f
+	t.Cleanup(func() { DefaultFont = saved })
+}
+
+func TestPerceptualDiff(t *testing.T) {
+	origin := goldenOrigin()
+	if ratio, _ := perceptualDiff(origin, origin, 0.1); ratio != 0 {
+		t.Errorf("identical images ratio = %v", ratio)
+	}
+	// 轻微的亮度抖动在容差内
+	noisy := image.NewNRGBA(origin.Bounds())
+	copy(noisy.Pix, origin.Pix)
+	for i := 0; i < len(noisy.Pix); i += 4 {
+		noisy.Pix[i+1] = clampUint8(float64(noisy.Pix[i+1]) + float64(i/4%5) - 2)
+	}
+	if ratio, _ := perceptualDiff(noisy, origin, 0.1); ratio > defaultGoldenTolerance.ratio {
+		t.Errorf("noisy image ratio = %v", ratio)
+	}
+	// 水印偏移一个像素应被发现
+	logo := goldenLogo()
+	a, err := AddImageWatermark(origin, logo, ImageWatermarkConfig{WatermarkPos: LeftTop, OffsetX: 10, OffsetY: 10, ScaleMode: ScaleNone, Opacity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := AddImageWatermark(origin, logo, ImageWatermarkConfig{WatermarkPos: LeftTop, OffsetX: 11, OffsetY: 10, ScaleMode: ScaleNone, Opacity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ratio, _ := perceptualDiff(a, b, 0.1); ratio <= defaultGoldenTolerance.ratio {
+		t.Errorf("shifted watermark ratio = %v", ratio)
+	}
+	if ratio, _ := perceptualDiff(a, logo, 0.1); ratio != 1 {
+		t.Errorf("size mismatch ratio = %v", ratio)
+	}
+}
+
+func TestGoldenImageWatermark(t *testing.T) {
+	origin, logo := goldenOrigin(), goldenLogo()
+	base := ImageWatermarkConfig{ScaleMode: ScaleNone, Opacity: 0.8, OffsetX: 6, OffsetY: 6}
+	with := func(f func(c *ImageWatermarkConfig)) ImageWatermarkConfig {
+		c := base
+		f(&c)
+		return c
+	}
+	cases := []struct {
+		name   string
+		config ImageWatermarkConfig
+	}{
+		{"image_left_top", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = LeftTop })},
+		{"image_right_top", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = RightTop })},
+		{"image_left_bottom", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = LeftBottom })},
+		{"image_right_bottom", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = RightBottom })},
+		{"image_center", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = Center })},
+		{"image_top_center", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = TopCenter })},
+		{"image_bottom_center", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = BottomCenter })},
+		{"image_left_center", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = LeftCenter })},
+		{"image_right_center", with(func(c *ImageWatermarkConfig) { c.WatermarkPos = RightCenter })},
+		{"image_relative", with(func(c *ImageWatermarkConfig) {
+			c.WatermarkPos, c.AnchorX, c.AnchorY, c.OffsetX, c.OffsetY = Relative, 0.25, 0.75, 0, 0
+		})},
+		{"image_offset_percent", with(func(c *ImageWatermarkConfig) {
+			c.WatermarkPos, c.OffsetXPercent, c.OffsetYPercent = RightBottom, 10, 20
+		})},
+		{"image_opacity_25", with(func(c *ImageWatermarkConfig) { c.WatermarkPos, c.Opacity = Center, 0.25 })},
+		{"image_opacity_100", with(func(c *ImageWatermarkConfig) { c.WatermarkPos, c.Opacity = Center, 1 })},
+		{"image_scale_default", with(func(c *ImageWatermarkConfig) { c.WatermarkPos, c.ScaleMode = LeftTop, ScaleDefault })},
+		{"image_tiled_rows_cols", with(func(c *ImageWatermarkConfig) { c.WatermarkPos, c.TiledRows, c.TiledCols = Tiled, 3, 4 })},
+		{"image_tile_pattern", with(func(c *ImageWatermarkConfig) {
+			c.WatermarkPos, c.TilePattern = Tiled, &TilePattern{SpacingX: 12, SpacingY: 8}
+		})},
+		{"image_tile_pattern_stagger", with(func(c *ImageWatermarkConfig) {
+			c.WatermarkPos, c.TilePattern = Tiled, &TilePattern{SpacingX: 5, SpacingY: 10, SpacingUnit: SpacingPercent, Stagger: 0.5}
+		})},
+		{"image_tile_pattern_rotated", with(func(c *ImageWatermarkConfig) {
+			c.WatermarkPos, c.TilePattern = Tiled, &TilePattern{SpacingX: 16, SpacingY: 16, Rotation: 30}
+		})},
+	}
+	for _, c := range cases {
+		img, err := AddImageWatermark(origin, logo, c.config)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		checkGolden(t, c.name, img, defaultGoldenTolerance)
+	}
+}
+
+func TestGoldenTextWatermark(t *testing.T) {
+	useGoldenFont(t)
+	origin := goldenOrigin()
+	base := TransparentTextWatermarkConfig{
+		FontPath: writeTestFont(t),
+		Text:     "Golden",
+		Size:     20,
+		Color:    White,
+		Opacity:  0.8,
+		OffsetX:  6,
+		OffsetY:  6,
+	}
+	with := func(f func(c *TransparentTextWatermarkConfig)) TransparentTextWatermarkConfig {
+		c := base
+		f(&c)
+		return c
+	}
+	cases := []struct {
+		name   string
+		config TransparentTextWatermarkConfig
+	}{
+		{"text_left_top", with(func(c *TransparentTextWatermarkConfig) { c.WatermarkPos = LeftTop })},
+		{"text_right_bottom", with(func(c *TransparentTextWatermarkConfig) { c.WatermarkPos = RightBottom })},
+		{"text_center", with(func(c *TransparentTextWatermarkConfig) { c.WatermarkPos = Center })},
+		{"text_rotation_30", with(func(c *TransparentTextWatermarkConfig) { c.WatermarkPos, c.Rotation = Center, 30 })},
+		{"text_rotation_-45", with(func(c *TransparentTextWatermarkConfig) { c.WatermarkPos, c.Rotation = Center, -45 })},
+		{"text_opacity_30", with(func(c *TransparentTextWatermarkConfig) { c.WatermarkPos, c.Opacity = Center, 0.3 })},
+		{"text_multiline_center", with(func(c *TransparentTextWatermarkConfig) {
+			c.WatermarkPos, c.Text, c.Align = Center, "Golden\nimage test", AlignCenter
+		})},
+		{"text_tiled_rows_cols", with(func(c *TransparentTextWatermarkConfig) {
+			c.WatermarkPos, c.TiledRows, c.TiledCols, c.Rotation, c.Size = Tiled, 3, 3, -45, 14
+		})},
+		{"text_tile_pattern_rotated", with(func(c *TransparentTextWatermarkConfig) {
+			c.WatermarkPos, c.Size, c.TilePattern = Tiled, 14, &TilePattern{SpacingX: 20, SpacingY: 20, Stagger: 0.5, Rotation: 30}
+		})},
+	}
+	for _, c := range cases {
+		img, err := AddTransparentTextWatermark(origin, c.config)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		checkGolden(t, c.name, img, defaultGoldenTolerance)
+	}
+}
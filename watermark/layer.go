@@ -0,0 +1,300 @@
+package watermark
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+// stamp 将一个已渲染（已缩放）的水印叠加到画布上所需的参数
+type stamp struct {
+	placement   placement
+	rows, cols  int          // 旧的行列平铺
+	pattern     *TilePattern // 平铺图案
+	opacity     float64
+	blend       BlendMode
+	textSpacing bool // 文字水印的行列平铺使用完整间距作为边距
+}
+
+// stamp 提取图片水印的叠加参数
+func (c ImageWatermarkConfig) stamp() stamp {
+	return stamp{
+		placement: c.placement(),
+		rows:      c.TiledRows,
+		cols:      c.TiledCols,
+		pattern:   c.TilePattern,
+		opacity:   c.Opacity,
+		blend:     c.BlendMode,
+	}
+}
+
+// stamp 提取文字水印的叠加参数
+func (c TransparentTextWatermarkConfig) stamp() stamp {
+	return stamp{
+		placement:   c.placement(),
+		rows:        c.TiledRows,
+		cols:        c.TiledCols,
+		pattern:     c.TilePattern,
+		opacity:     c.Opacity,
+		blend:       c.BlendMode,
+		textSpacing: true,
+	}
+}
+
+// drawWatermark 按位置、平铺和混合模式将水印叠加到画布上，直接修改dst
+func drawWatermark(dst, mark *image.NRGBA, s stamp) error {
+	if s.placement.pos != Tiled {
+		pt, err := s.placement.point(dst.Bounds().Dx(), dst.Bounds().Dy(), mark.Bounds().Dx(), mark.Bounds().Dy())
+		if err != nil {
+			return err
+		}
+		return overlayMark(dst, mark, pt, s.opacity, s.blend)
+	}
+	if s.pattern != nil {
+		return drawTilePattern(dst, mark, *s.pattern, s.opacity, s.blend)
+	}
+	if s.cols == 0 || s.rows == 0 {
+		return errors.New("watermark position tiled need tiled_cols and tiled_rows")
+	}
+
+	// 计算行间距和列间距
+	watermarkBounds := mark.Bounds()
+	extraWidth := dst.Bounds().Dx() - s.cols*watermarkBounds.Dx()
+	extraHeight := dst.Bounds().Dy() - s.rows*watermarkBounds.Dy()
+	// 水印总尺寸超过原图时不再留间距，避免间距为负导致水印错位
+	rowSpacing := max(extraHeight, 0) / (s.rows + 1)
+	colSpacing := max(extraWidth, 0) / (s.cols + 1)
+	// 每个水印按透明度和混合模式单独叠加，与其他位置的透明度含义一致
+	for r := 0; r < s.rows; r++ {
+		for c := 0; c < s.cols; c++ {
+			x := c*(watermarkBounds.Dx()+colSpacing) + colSpacing/2
+			y := r*(watermarkBounds.Dy()+rowSpacing) + rowSpacing/2
+			if s.textSpacing {
+				x, y = c*(watermarkBounds.Dx()+colSpacing)+colSpacing, r*(watermarkBounds.Dy()+rowSpacing)+rowSpacing
+			}
+			if err := overlayMark(dst, mark, image.Pt(x, y), s.opacity, s.blend); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Layer 水印图层，Image和Text二选一
+// 每个图层使用各自配置中的位置、透明度和混合模式，配置中的原图和合成图路径会被忽略
+type Layer struct {
+	Image          *ImageWatermarkConfig           // 图片水印配置
+	WatermarkImage image.Image                     // 图片图层的水印图，为空时从Image.WatermarkImagePath加载
+	Text           *TransparentTextWatermarkConfig // 文字水印配置
+}
+
+// ImageLayer 创建图片水印图层
+func ImageLayer(watermarkImg image.Image, config ImageWatermarkConfig) Layer {
+	return Layer{Image: &config, WatermarkImage: watermarkImg}
+}
+
+// TextLayer 创建文字水印图层
+func TextLayer(config TransparentTextWatermarkConfig) Layer {
+	return Layer{Text: &config}
+}
+
+// LayeredWatermarkConfig 多图层水印配置
+type LayeredWatermarkConfig struct {
+	OriginImagePath    string        // 原图地址
+	CompositeImagePath string        // 合成图地址
+	Layers             []Layer       // 水印图层，按顺序从下到上叠加
+	Output             OutputOptions // 输出格式及编码质量选项
+	AutoOrient         bool          // 是否根据EXIF方向信息自动旋转原图
+	KeepMetadata       bool          // 是否将原图的EXIF（方向除外）、ICC和XMP元数据写入JPEG输出
+	FirstFrameOnly     bool          // GIF动图只处理第一帧并输出静态图片，各图层的GIF.FrameOffset仍对动图生效
+}
+
+// preparedLayer 已缩放或已渲染、可直接叠加的图层
+type preparedLayer struct {
+	mark        *image.NRGBA
+	stamp       stamp
+	frameOffset FrameOffsetFunc
+}
+
+// prepareLayers 校验图层并按画布尺寸缩放水印图、渲染文字，每个图层只处理一次
+// ctx中的宽高即画布尺寸
+func prepareLayers(layers []Layer, ctx templateContext) ([]preparedLayer, error) {
+	canvasW, canvasH := ctx.width, ctx.height
+	if len(layers) == 0 {
+		return nil, errors.New("watermark layers must not be empty")
+	}
+	prepared := make([]preparedLayer, len(layers))
+	for i, layer := range layers {
+		var err error
+		switch {
+		case layer.Image != nil && layer.Text == nil:
+			config := *layer.Image
+			if err = normalizeImageConfig(&config); err != nil {
+				break
+			}
+			mark := layer.WatermarkImage
+			if mark == nil {
+				if mark, err = loadWatermarkImage(config.WatermarkImagePath); err != nil {
+					break
+				}
+			}
+			prepared[i].mark, err = scaleWatermark(mark, canvasW, canvasH, config)
+			prepared[i].stamp, prepared[i].frameOffset = config.stamp(), config.GIF.FrameOffset
+		case layer.Text != nil && layer.Image == nil:
+			config := *layer.Text
+			if err = normalizeTextConfig(&config); err != nil {
+				break
+			}
+			config.Text = config.expandText(ctx)
+			prepared[i].mark, err = createTextImage(config, canvasW)
+			prepared[i].stamp, prepared[i].frameOffset = config.stamp(), config.GIF.FrameOffset
+		default:
+			err = errors.New("layer needs exactly one of image or text watermark config")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %w", i, err)
+		}
+	}
+	return prepared, nil
+}
+
+// loadWatermarkImage 从文件加载水印图
+func loadWatermarkImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("open watermark image file error:" + err.Error())
+	}
+	defer file.Close()
+	img, _, err := decodeImage(file)
+	if err != nil {
+		return nil, errors.New("decode watermark image error:" + err.Error())
+	}
+	return img, nil
+}
+
+// drawLayers 在同一张画布上依次叠加所有图层，total大于0时表示动图的第index帧
+func drawLayers(dst *image.NRGBA, layers []preparedLayer, index, total int) error {
+	for i, layer := range layers {
+		s := layer.stamp
+		if total > 0 && layer.frameOffset != nil {
+			s.placement.offsetX, s.placement.offsetY = layer.frameOffset(index, total)
+		}
+		if err := drawWatermark(dst, layer.mark, s); err != nil {
+			return fmt.Errorf("layer %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// AddWatermarkLayers 在内存中将多个水印图层依次叠加到同一张画布上，返回合成后的图片
+func AddWatermarkLayers(originImg image.Image, layers []Layer) (image.Image, error) {
+	if originImg == nil {
+		return nil, errors.New("origin image must not be nil")
+	}
+	return addWatermarkLayers(originImg, layers, templateContext{})
+}
+
+// addWatermarkLayers 展开文字模板后在同一张画布上叠加所有图层
+func addWatermarkLayers(originImg image.Image, layers []Layer, ctx templateContext) (image.Image, error) {
+	if originImg == nil {
+		return nil, errors.New("origin image must not be nil")
+	}
+	ctx.width, ctx.height = originImg.Bounds().Dx(), originImg.Bounds().Dy()
+	prepared, err := prepareLayers(layers, ctx)
+	if err != nil {
+		return nil, err
+	}
+	destImg := imaging.Clone(originImg)
+	if err = drawLayers(destImg, prepared, 0, 0); err != nil {
+		return nil, err
+	}
+	return destImg, nil
+}
+
+// composeLayers 为原图（或动图的每一帧）叠加所有图层
+func composeLayers(src *sourceImage, format imaging.Format, config LayeredWatermarkConfig) (*composite, error) {
+	if src.anim == nil || format != imaging.GIF || config.FirstFrameOnly {
+		img, err := addWatermarkLayers(src.img, config.Layers, src.templateContext())
+		if err != nil {
+			return nil, err
+		}
+		return &composite{img: img}, nil
+	}
+	// 动图所有帧共用同一画布尺寸，图层只需准备一次
+	bounds := src.img.Bounds()
+	if src.anim.Config.Width > 0 && src.anim.Config.Height > 0 {
+		bounds = image.Rect(0, 0, src.anim.Config.Width, src.anim.Config.Height)
+	}
+	ctx := src.templateContext()
+	ctx.width, ctx.height = bounds.Dx(), bounds.Dy()
+	prepared, err := prepareLayers(config.Layers, ctx)
+	if err != nil {
+		return nil, err
+	}
+	anim, err := stampGIF(src.anim, func(frame image.Image, index, total int) (image.Image, error) {
+		destImg := imaging.Clone(frame)
+		if err := drawLayers(destImg, prepared, index, total); err != nil {
+			return nil, err
+		}
+		return destImg, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &composite{anim: anim}, nil
+}
+
+// CreateLayeredWatermark 根据配置中的文件路径为原图叠加多个水印图层
+// 原图只解码一次，所有图层合成后只编码一次
+func CreateLayeredWatermark(config LayeredWatermarkConfig) error {
+	originFile, err := os.Open(config.OriginImagePath)
+	if err != nil {
+		return errors.New("open origin image file error:" + err.Error())
+	}
+	defer originFile.Close()
+	if err = PrepareOutputPath(config.CompositeImagePath); err != nil {
+		return errors.New("prepare composite image path error:" + err.Error())
+	}
+	src, err := decodeSource(originFile, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	src.name = config.OriginImagePath
+	format, err := config.Output.resolveFormat(src.format, config.CompositeImagePath)
+	if err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	result, err := composeLayers(src, format, config)
+	if err != nil {
+		return err
+	}
+	if err = saveComposite(result, config.CompositeImagePath, format, src.meta, config.Output); err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	return nil
+}
+
+// CreateLayeredWatermarkStream 从io.Reader读取原图，叠加多个水印图层后写入io.Writer
+// 默认输出格式与原图格式保持一致，可通过Output选项指定，配置中的路径字段会被忽略
+func CreateLayeredWatermarkStream(origin io.Reader, w io.Writer, config LayeredWatermarkConfig) error {
+	src, err := decodeSource(origin, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	format, err := config.Output.resolveFormat(src.format, "")
+	if err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	result, err := composeLayers(src, format, config)
+	if err != nil {
+		return err
+	}
+	if err = result.encode(w, format, src.meta, config.Output); err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	return nil
+}
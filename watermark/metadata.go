@@ -0,0 +1,158 @@
+package watermark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// JPEG标记
+const (
+	jpegMarkerSOI  = 0xD8
+	jpegMarkerSOS  = 0xDA
+	jpegMarkerEOI  = 0xD9
+	jpegMarkerAPP1 = 0xE1
+	jpegMarkerAPP2 = 0xE2
+)
+
+// 元数据段标识
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// exifTagOrientation EXIF方向标签
+const exifTagOrientation = 0x0112
+
+// jpegSegment JPEG元数据段
+type jpegSegment struct {
+	marker  byte
+	payload []byte // 不含标记和长度的段内容
+}
+
+// imageMetadata 从JPEG原图中提取的元数据
+type imageMetadata struct {
+	exif []byte            // EXIF段内容（含Exif头）
+	icc  []jpegSegment     // ICC配置文件，可能分为多段
+	xmp  []byte            // XMP段内容（含命名空间头）
+	tags map[string]string // 重置方向标签之前解析的EXIF标签
+}
+
+// isEmpty 判断是否没有可保留的元数据
+func (m *imageMetadata) isEmpty() bool {
+	return m == nil || (m.exif == nil && len(m.icc) == 0 && m.xmp == nil)
+}
+
+// readJPEGMetadata 从JPEG数据中提取EXIF、ICC和XMP段，非JPEG数据返回nil
+// autoOrient为true表示像素已按EXIF方向旋转，此时将方向标签重置为1；否则保留原方向，由查看器负责旋转
+func readJPEGMetadata(data []byte, autoOrient bool) *imageMetadata {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != jpegMarkerSOI {
+		return nil
+	}
+	meta := &imageMetadata{}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		// 填充字节
+		if marker == 0xFF {
+			pos++
+			continue
+		}
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			break
+		}
+		payload := data[pos+4 : pos+2+length]
+		switch {
+		case marker == jpegMarkerAPP1 && bytes.HasPrefix(payload, exifHeader) && meta.exif == nil:
+			meta.exif = append([]byte(nil), payload...)
+		case marker == jpegMarkerAPP1 && bytes.HasPrefix(payload, xmpHeader) && meta.xmp == nil:
+			meta.xmp = append([]byte(nil), payload...)
+		case marker == jpegMarkerAPP2 && bytes.HasPrefix(payload, iccHeader):
+			meta.icc = append(meta.icc, jpegSegment{marker: marker, payload: append([]byte(nil), payload...)})
+		}
+		pos += 2 + length
+	}
+	if meta.isEmpty() {
+		return nil
+	}
+	if meta.exif != nil {
+		meta.tags = parseEXIFTags(meta.exif[len(exifHeader):])
+	}
+	if autoOrient && meta.exif != nil {
+		resetEXIFOrientation(meta.exif[len(exifHeader):])
+	}
+	return meta
+}
+
+// resetEXIFOrientation 将EXIF中IFD0的方向标签重置为1（正常方向）
+// 用于已按方向旋转过像素的图片，保留原方向会导致查看器再次旋转
+func resetEXIFOrientation(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset < 8 || ifdOffset+2 > len(tiff) {
+		return
+	}
+	count := int(order.Uint16(tiff[ifdOffset:]))
+	for i := 0; i < count; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return
+		}
+		if order.Uint16(tiff[entry:]) == exifTagOrientation {
+			// 方向标签类型为SHORT，值直接存放在条目的值字段中
+			order.PutUint16(tiff[entry+8:], 1)
+			return
+		}
+	}
+}
+
+// writeJPEGMetadata 将元数据段插入到已编码的JPEG数据的SOI之后
+func writeJPEGMetadata(jpegData []byte, meta *imageMetadata) ([]byte, error) {
+	if meta.isEmpty() {
+		return jpegData, nil
+	}
+	if len(jpegData) < 2 || jpegData[0] != 0xFF || jpegData[1] != jpegMarkerSOI {
+		return nil, errors.New("invalid jpeg data")
+	}
+	segments := make([]jpegSegment, 0, len(meta.icc)+2)
+	if meta.exif != nil {
+		segments = append(segments, jpegSegment{marker: jpegMarkerAPP1, payload: meta.exif})
+	}
+	segments = append(segments, meta.icc...)
+	if meta.xmp != nil {
+		segments = append(segments, jpegSegment{marker: jpegMarkerAPP1, payload: meta.xmp})
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(jpegData) + 64*1024)
+	buf.Write(jpegData[:2])
+	for _, seg := range segments {
+		if len(seg.payload)+2 > 0xFFFF {
+			return nil, errors.New("jpeg metadata segment too large")
+		}
+		buf.Write([]byte{0xFF, seg.marker})
+		_ = binary.Write(&buf, binary.BigEndian, uint16(len(seg.payload)+2))
+		buf.Write(seg.payload)
+	}
+	buf.Write(jpegData[2:])
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package watermark
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+// OutputFormat 输出图片格式
+type OutputFormat string
+
+const (
+	FormatAuto OutputFormat = ""     // 自动：路径版本按输出文件扩展名，流式版本保持输入格式
+	FormatJPEG OutputFormat = "jpeg" // JPEG格式
+	FormatPNG  OutputFormat = "png"  // PNG格式
+	FormatGIF  OutputFormat = "gif"  // GIF格式
+	FormatBMP  OutputFormat = "bmp"  // BMP格式
+	FormatTIFF OutputFormat = "tiff" // TIFF格式
+)
+
+// OutputOptions 输出编码选项
+type OutputOptions struct {
+	Format          OutputFormat         // 输出格式，为空时自动决定
+	KeepInputFormat bool                 // 是否保持输入图片的格式（优先于Format）
+	JPEGQuality     int                  // JPEG质量 1-100，为0时使用默认值95
+	PNGCompression  png.CompressionLevel // PNG压缩级别，默认png.DefaultCompression
+}
+
+// validate 校验输出选项
+func (o OutputOptions) validate() error {
+	if o.JPEGQuality < 0 || o.JPEGQuality > 100 {
+		return errors.New("jpeg quality error: Ensure 0 <= quality <= 100")
+	}
+	switch o.PNGCompression {
+	case png.DefaultCompression, png.NoCompression, png.BestSpeed, png.BestCompression:
+	default:
+		return fmt.Errorf("png compression level error: %d", o.PNGCompression)
+	}
+	return nil
+}
+
+// resolveFormat 根据选项、输入格式和输出路径确定最终输出格式
+// outputPath为空时表示流式输出，自动模式下保持输入格式
+func (o OutputOptions) resolveFormat(inputFormat imaging.Format, outputPath string) (imaging.Format, error) {
+	if err := o.validate(); err != nil {
+		return 0, err
+	}
+	if o.KeepInputFormat {
+		return inputFormat, nil
+	}
+	if o.Format != FormatAuto {
+		return imaging.FormatFromExtension(string(o.Format))
+	}
+	if outputPath == "" {
+		return inputFormat, nil
+	}
+	return imaging.FormatFromFilename(outputPath)
+}
+
+// encodeImage 按输出选项将图片编码写入io.Writer
+// 输出为JPEG且meta不为空时，会将原图的元数据写入输出
+func encodeImage(w io.Writer, img image.Image, format imaging.Format, meta *imageMetadata, opts OutputOptions) error {
+	encodeOpts := []imaging.EncodeOption{imaging.PNGCompressionLevel(opts.PNGCompression)}
+	if opts.JPEGQuality > 0 {
+		encodeOpts = append(encodeOpts, imaging.JPEGQuality(opts.JPEGQuality))
+	}
+	if format != imaging.JPEG || meta.isEmpty() {
+		return imaging.Encode(w, img, format, encodeOpts...)
+	}
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format, encodeOpts...); err != nil {
+		return err
+	}
+	data, err := writeJPEGMetadata(buf.Bytes(), meta)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// saveComposite 按输出选项将合成结果保存到文件
+func saveComposite(result *composite, path string, format imaging.Format, meta *imageMetadata, opts OutputOptions) (err error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return result.encode(file, format, meta, opts)
+}
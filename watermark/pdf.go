@@ -0,0 +1,460 @@
+package watermark
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// PDFWatermarkConfig PDF水印配置，Text和Image（或ImagePath）二选一
+// 水印以矢量文字或图片XObject的形式写入页面内容，通过增量更新追加到原文件之后
+// 位置、偏移、透明度和旋转的含义与TransparentTextWatermarkConfig相同，长度单位为pt（1/72英寸）
+type PDFWatermarkConfig struct {
+	OriginPDFPath    string       // 原PDF地址
+	CompositePDFPath string       // 合成PDF地址
+	Pages            string       // 页码范围，如"1-3,5,8-"，页码从1开始，为空时处理所有页
+	Text             string       // 文字内容，支持多行
+	FontPath         string       // TrueType字体文件路径或已注册的字体名，为空时使用PDF内置的Helvetica（仅支持西文字符）
+	Size             float64      // 文字大小（pt），为0时为24
+	Color            color.RGBA   // 文字颜色，颜色的透明度与Opacity相乘
+	Align            TextAlign    // 多行文字的对齐方式，默认左对齐
+	LineSpacing      float64      // 行距倍数，为0时为1倍行高
+	ImagePath        string       // 水印图地址
+	Image            image.Image  // 内存中的水印图，优先于ImagePath
+	ImageWidth       float64      // 水印图宽度（pt），为0时为页面宽度的1/5，高度按比例缩放
+	WatermarkPos     WatermarkPos // 水印位置
+	OffsetX          int          // 水印位置偏移量X（pt）
+	OffsetY          int          // 水印位置偏移量Y（pt）
+	OffsetXPercent   float64      // 水印位置偏移量X，按页面宽度的百分比计算，与OffsetX叠加
+	OffsetYPercent   float64      // 水印位置偏移量Y，按页面高度的百分比计算，与OffsetY叠加
+	AnchorX          float64      // 水印锚点X比例 0-1（仅Relative位置时使用）
+	AnchorY          float64      // 水印锚点Y比例 0-1（仅Relative位置时使用）
+	Opacity          float64      // 水印透明度
+	Rotation         float64      // 旋转角度，正数为逆时针
+	TiledRows        int          // 平铺行数（仅Tiled位置时使用）
+	TiledCols        int          // 平铺列数（仅Tiled位置时使用）
+}
+
+// placement 提取PDF水印的定位参数
+func (c PDFWatermarkConfig) placement() placement {
+	return placement{
+		pos:            c.WatermarkPos,
+		offsetX:        c.OffsetX,
+		offsetY:        c.OffsetY,
+		offsetXPercent: c.OffsetXPercent,
+		offsetYPercent: c.OffsetYPercent,
+		anchorX:        c.AnchorX,
+		anchorY:        c.AnchorY,
+	}
+}
+
+// CreatePDFWatermark 根据配置中的文件路径为PDF添加水印
+func CreatePDFWatermark(config PDFWatermarkConfig) error {
+	data, err := os.ReadFile(config.OriginPDFPath)
+	if err != nil {
+		return errors.New("read origin pdf file error:" + err.Error())
+	}
+	// 删除旧的合成文件并创建输出目录
+	if err = PrepareOutputPath(config.CompositePDFPath); err != nil {
+		return errors.New("prepare composite pdf path error:" + err.Error())
+	}
+	var buf bytes.Buffer
+	if err = writePDFWatermark(data, &buf, config); err != nil {
+		return err
+	}
+	if err = os.WriteFile(config.CompositePDFPath, buf.Bytes(), 0644); err != nil {
+		return errors.New("create composite pdf error:" + err.Error())
+	}
+	return nil
+}
+
+// CreatePDFWatermarkStream 从io.Reader读取PDF，添加水印后写入io.Writer，配置中的路径字段会被忽略
+func CreatePDFWatermarkStream(origin io.Reader, w io.Writer, config PDFWatermarkConfig) error {
+	data, err := io.ReadAll(origin)
+	if err != nil {
+		return errors.New("read origin pdf error:" + err.Error())
+	}
+	return writePDFWatermark(data, w, config)
+}
+
+// AddPDFWatermark 在内存中为PDF添加水印，返回原文件加上增量更新后的数据
+func AddPDFWatermark(data []byte, config PDFWatermarkConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writePDFWatermark(data, &buf, config); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pdfMark 一个页面上的水印内容，尺寸单位为pt
+type pdfMark struct {
+	width, height float64
+	draw          func(b *bytes.Buffer, width, height float64) // 以水印中心为原点绘制
+}
+
+// writePDFWatermark 为选中的页面添加水印并写出增量更新
+func writePDFWatermark(data []byte, w io.Writer, config PDFWatermarkConfig) error {
+	if err := normalizePDFConfig(&config); err != nil {
+		return err
+	}
+	f, err := openPDF(data)
+	if err != nil {
+		return errors.New("open pdf error:" + err.Error())
+	}
+	pages, err := f.pages()
+	if err != nil {
+		return errors.New("read pdf pages error:" + err.Error())
+	}
+	selected, err := parsePageRange(config.Pages, len(pages))
+	if err != nil {
+		return err
+	}
+
+	u := newPDFUpdate(f)
+	// 文字或图片水印资源，所有页面共用
+	resources := pdfDict{}
+	var mark func(pageW, pageH float64) pdfMark
+	if config.Text != "" {
+		mark, err = pdfTextMark(u, config, resources)
+	} else {
+		mark, err = pdfImageMark(u, config, resources)
+	}
+	if err != nil {
+		return err
+	}
+	opacity := config.Opacity
+	if config.Text != "" {
+		opacity *= float64(color.NRGBAModel.Convert(config.Color).(color.NRGBA).A) / 255
+	}
+	if opacity < 1 {
+		resources["ExtGState"] = u.add(pdfDict{"Type": pdfName("ExtGState"), "ca": opacity, "CA": opacity})
+	}
+
+	// 原内容包裹在q/Q中，避免其图形状态影响水印
+	save := u.add(&pdfStream{dict: pdfDict{}, data: []byte("q\n")})
+	contentRefs := make(map[string]pdfRef)
+	for _, index := range selected {
+		page := pages[index]
+		width, height, matrix := pdfPageMatrix(page)
+		content, err := pdfMarkContent(config, mark(width, height), width, height, matrix, opacity < 1)
+		if err != nil {
+			return err
+		}
+
+		pageResources, names := mergePDFResources(f, page.resources, resources)
+		var buf bytes.Buffer
+		// 前面的内容流可能不以空白结尾
+		buf.WriteString("\nQ\n")
+		// 资源名在不同页面上可能不同
+		replacer := strings.NewReplacer("/WMFont ", "/"+names["Font"]+" ", "/WMImage ", "/"+names["XObject"]+" ", "/WMState ", "/"+names["ExtGState"]+" ")
+		buf.WriteString(replacer.Replace(content))
+		ref, ok := contentRefs[buf.String()]
+		if !ok {
+			ref = u.add(&pdfStream{dict: pdfDict{}, data: buf.Bytes()})
+			contentRefs[buf.String()] = ref
+		}
+
+		contents := pdfArray{save}
+		switch v := page.dict["Contents"].(type) {
+		case pdfRef:
+			if arr, ok := f.resolve(v).(pdfArray); ok {
+				contents = append(contents, arr...)
+			} else {
+				contents = append(contents, v)
+			}
+		case pdfArray:
+			contents = append(contents, v...)
+		}
+		contents = append(contents, ref)
+
+		dict := make(pdfDict, len(page.dict)+2)
+		for k, v := range page.dict {
+			dict[k] = v
+		}
+		dict["Contents"] = contents
+		dict["Resources"] = pageResources
+		u.set(page.ref, dict)
+	}
+
+	if err = u.write(w); err != nil {
+		return errors.New("write pdf error:" + err.Error())
+	}
+	return nil
+}
+
+// normalizePDFConfig 校验PDF水印配置并填充默认值
+func normalizePDFConfig(config *PDFWatermarkConfig) error {
+	if config.Opacity < 0 || config.Opacity > 1 {
+		return errors.New("watermark opacity error: Ensure 0.0 <= opacity <= 1.0")
+	}
+	if config.Opacity == 0 {
+		config.Opacity = 1
+	}
+	hasImage := config.Image != nil || config.ImagePath != ""
+	if (config.Text == "") == !hasImage {
+		return errors.New("pdf watermark needs exactly one of text and image")
+	}
+	if config.Size < 0 || config.LineSpacing < 0 || config.ImageWidth < 0 {
+		return errors.New("pdf watermark size error: Ensure size, line_spacing and image_width >= 0")
+	}
+	if config.Size == 0 {
+		config.Size = 24
+	}
+	if config.LineSpacing == 0 {
+		config.LineSpacing = 1
+	}
+	if config.WatermarkPos == Tiled && (config.TiledCols <= 0 || config.TiledRows <= 0) {
+		return errors.New("watermark position tiled need tiled_cols and tiled_rows")
+	}
+	return nil
+}
+
+// parsePageRange 解析页码范围，返回从0开始的页面序号
+func parsePageRange(spec string, total int) ([]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		pages := make([]int, total)
+		for i := range pages {
+			pages[i] = i
+		}
+		return pages, nil
+	}
+	selected := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		start, end := 1, total
+		var err error
+		if from = strings.TrimSpace(from); from != "" {
+			if start, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("pdf page range error: %q", part)
+			}
+		}
+		if !isRange {
+			end = start
+		} else if to = strings.TrimSpace(to); to != "" {
+			if end, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("pdf page range error: %q", part)
+			}
+		}
+		if part == "" || part == "-" || start < 1 || start > end || start > total {
+			return nil, fmt.Errorf("pdf page range error: %q (document has %d pages)", part, total)
+		}
+		for p := start; p <= min(end, total); p++ {
+			selected[p-1] = true
+		}
+	}
+	pages := make([]int, 0, len(selected))
+	for p := range selected {
+		pages = append(pages, p)
+	}
+	sort.Ints(pages)
+	return pages, nil
+}
+
+// pdfPageMatrix 返回页面显示时的宽高，以及从显示坐标（左下角为原点）到页面坐标的变换矩阵
+func pdfPageMatrix(page pdfPage) (float64, float64, [6]float64) {
+	x0, y0, x1, y1 := page.box[0], page.box[1], page.box[2], page.box[3]
+	w, h := x1-x0, y1-y0
+	switch page.rotate {
+	case 90:
+		return h, w, [6]float64{0, 1, -1, 0, x1, y0}
+	case 180:
+		return w, h, [6]float64{-1, 0, 0, -1, x1, y1}
+	case 270:
+		return h, w, [6]float64{0, -1, 1, 0, x0, y1}
+	}
+	return w, h, [6]float64{1, 0, 0, 1, x0, y0}
+}
+
+// pdfMarkContent 生成一个页面的水印内容流，资源名使用占位名/WMFont、/WMImage和/WMState
+func pdfMarkContent(config PDFWatermarkConfig, mark pdfMark, pageW, pageH float64, matrix [6]float64, transparent bool) (string, error) {
+	// 旋转后的外接矩形用于定位
+	rad := config.Rotation * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	boxW := math.Abs(mark.width*cos) + math.Abs(mark.height*sin)
+	boxH := math.Abs(mark.width*sin) + math.Abs(mark.height*cos)
+
+	// 外接矩形左上角（显示坐标，向下为正）
+	var corners [][2]float64
+	if config.WatermarkPos == Tiled {
+		colSpacing := max(pageW-float64(config.TiledCols)*boxW, 0) / float64(config.TiledCols+1)
+		rowSpacing := max(pageH-float64(config.TiledRows)*boxH, 0) / float64(config.TiledRows+1)
+		for r := 0; r < config.TiledRows; r++ {
+			for c := 0; c < config.TiledCols; c++ {
+				corners = append(corners, [2]float64{
+					float64(c)*(boxW+colSpacing) + colSpacing,
+					float64(r)*(boxH+rowSpacing) + rowSpacing,
+				})
+			}
+		}
+	} else {
+		x, y, err := config.placement().pointF(pageW, pageH, boxW, boxH)
+		if err != nil {
+			return "", err
+		}
+		corners = append(corners, [2]float64{x, y})
+	}
+
+	var b bytes.Buffer
+	b.WriteString("q\n")
+	if transparent {
+		b.WriteString("/WMState gs\n")
+	}
+	writePDFMatrix(&b, matrix)
+	for _, corner := range corners {
+		cx := corner[0] + boxW/2
+		cy := pageH - (corner[1] + boxH/2)
+		b.WriteString("q\n")
+		writePDFMatrix(&b, [6]float64{cos, sin, -sin, cos, cx, cy})
+		mark.draw(&b, mark.width, mark.height)
+		b.WriteString("Q\n")
+	}
+	b.WriteString("Q\n")
+	return b.String(), nil
+}
+
+// writePDFMatrix 写入cm变换矩阵
+func writePDFMatrix(b *bytes.Buffer, m [6]float64) {
+	for _, v := range m {
+		b.WriteString(formatPDFNumber(v))
+		b.WriteByte(' ')
+	}
+	b.WriteString("cm\n")
+}
+
+// pdfTextMark 编码文字并注册字体资源
+func pdfTextMark(u *pdfUpdate, config PDFWatermarkConfig, resources pdfDict) (func(pageW, pageH float64) pdfMark, error) {
+	font, err := newPDFFont(config.FontPath)
+	if err != nil {
+		return nil, errors.New("load pdf font error:" + err.Error())
+	}
+	lines := splitLines(config.Text)
+	encoded := make([][]byte, len(lines))
+	widths := make([]float64, len(lines))
+	blockW := 0.0
+	for i, line := range lines {
+		if encoded[i], widths[i], err = font.encode(line); err != nil {
+			return nil, err
+		}
+		widths[i] *= config.Size / 1000
+		blockW = max(blockW, widths[i])
+	}
+	resources["Font"] = font.object(u)
+
+	lineHeight := font.lineHeight * config.Size / 1000
+	pitch := lineHeight * config.LineSpacing
+	blockH := lineHeight + float64(len(lines)-1)*pitch
+	// 基线位于行高中按上行、下行比例分配的位置
+	baseline := lineHeight * font.ascent / (font.ascent - font.descent)
+	c := color.NRGBAModel.Convert(config.Color).(color.NRGBA)
+	text := func(b *bytes.Buffer, width, height float64) {
+		fmt.Fprintf(b, "BT\n/WMFont %s Tf\n%s %s %s rg\n", formatPDFNumber(config.Size),
+			formatPDFNumber(float64(c.R)/255), formatPDFNumber(float64(c.G)/255), formatPDFNumber(float64(c.B)/255))
+		for i := range lines {
+			x := -width / 2
+			switch config.Align {
+			case AlignCenter:
+				x += (width - widths[i]) / 2
+			case AlignRight:
+				x += width - widths[i]
+			}
+			y := height/2 - baseline - float64(i)*pitch
+			fmt.Fprintf(b, "1 0 0 1 %s %s Tm <%X> Tj\n", formatPDFNumber(x), formatPDFNumber(y), encoded[i])
+		}
+		b.WriteString("ET\n")
+	}
+	return func(pageW, pageH float64) pdfMark {
+		return pdfMark{width: blockW, height: blockH, draw: text}
+	}, nil
+}
+
+// pdfImageMark 将水印图写入为图片XObject，透明通道写入SMask
+func pdfImageMark(u *pdfUpdate, config PDFWatermarkConfig, resources pdfDict) (func(pageW, pageH float64) pdfMark, error) {
+	img := config.Image
+	if img == nil {
+		var err error
+		if img, err = loadWatermarkImage(config.ImagePath); err != nil {
+			return nil, err
+		}
+	}
+	src := imaging.Clone(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w == 0 || h == 0 {
+		return nil, errors.New("watermark image is empty")
+	}
+	rgb := make([]byte, 0, w*h*3)
+	alpha := make([]byte, 0, w*h)
+	opaque := true
+	for i := 0; i < len(src.Pix); i += 4 {
+		rgb = append(rgb, src.Pix[i], src.Pix[i+1], src.Pix[i+2])
+		alpha = append(alpha, src.Pix[i+3])
+		opaque = opaque && src.Pix[i+3] == 255
+	}
+	dict := pdfDict{
+		"Type":             pdfName("XObject"),
+		"Subtype":          pdfName("Image"),
+		"Width":            w,
+		"Height":           h,
+		"ColorSpace":       pdfName("DeviceRGB"),
+		"BitsPerComponent": 8,
+	}
+	if !opaque {
+		dict["SMask"] = u.add(flateStream(pdfDict{
+			"Type":             pdfName("XObject"),
+			"Subtype":          pdfName("Image"),
+			"Width":            w,
+			"Height":           h,
+			"ColorSpace":       pdfName("DeviceGray"),
+			"BitsPerComponent": 8,
+		}, alpha))
+	}
+	resources["XObject"] = u.add(flateStream(dict, rgb))
+
+	draw := func(b *bytes.Buffer, width, height float64) {
+		writePDFMatrix(b, [6]float64{width, 0, 0, height, -width / 2, -height / 2})
+		b.WriteString("/WMImage Do\n")
+	}
+	return func(pageW, pageH float64) pdfMark {
+		width := config.ImageWidth
+		if width == 0 {
+			width = pageW / 5
+		}
+		return pdfMark{width: width, height: width * float64(h) / float64(w), draw: draw}
+	}, nil
+}
+
+// mergePDFResources 将水印资源合并到页面资源的副本中，返回新资源字典和各类资源实际使用的名称
+func mergePDFResources(f *pdfFile, pageResources, marks pdfDict) (pdfDict, map[string]string) {
+	merged := make(pdfDict, len(pageResources)+3)
+	for k, v := range pageResources {
+		merged[k] = v
+	}
+	names := make(map[string]string)
+	placeholders := map[pdfName]string{"Font": "WMFont", "XObject": "WMImage", "ExtGState": "WMState"}
+	for category, ref := range marks {
+		existing, _ := f.resolve(merged[category]).(pdfDict)
+		sub := make(pdfDict, len(existing)+1)
+		for k, v := range existing {
+			sub[k] = v
+		}
+		// 避免与页面已有的资源重名
+		name := placeholders[category]
+		for i := 1; sub[pdfName(name)] != nil; i++ {
+			name = placeholders[category] + strconv.Itoa(i)
+		}
+		sub[pdfName(name)] = ref
+		merged[category] = sub
+		names[string(category)] = name
+	}
+	return merged, names
+}
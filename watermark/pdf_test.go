@@ -0,0 +1,476 @@
+package watermark
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// buildClassicPDF 生成使用交叉引用表的两页PDF
+// 第一页继承页面树的MediaBox和间接引用的资源字典，第二页旋转90度且内容为数组
+func buildClassicPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 600 800] /Resources 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Rotate 90 /Contents [6 0 R 7 0 R] /Resources << /Font << /WMFont 8 0 R >> >> >>",
+		"<< /Font << /F1 8 0 R >> >>",
+		"<< /Length 44 >>\nstream\nBT /F1 12 Tf 72 720 Td (Contract page) Tj ET\nendstream",
+		"<< /Length 5 >>\nstream\n0 0 m\nendstream",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// buildXrefStreamPDF 生成使用交叉引用流（PNG预测器）和对象流的单页PDF
+func buildXrefStreamPDF() []byte {
+	compressed := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 400 300] /Contents 4 0 R /Resources << >> >>",
+	}
+	var header, body bytes.Buffer
+	for i, obj := range compressed {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	objStm := zlibData(append(header.Bytes(), body.Bytes()...))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.5\n")
+	contentOffset := buf.Len()
+	buf.WriteString("4 0 obj\n<< /Length 9 >>\nstream\n0 0 1 rg\nendstream\nendobj\n")
+	objStmOffset := buf.Len()
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /ObjStm /N 3 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", header.Len(), len(objStm))
+	buf.Write(objStm)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	// 每行：类型(1) 字段2(2) 字段3(1)，使用PNG Up预测器
+	rows := [][]byte{
+		{0, 0, 0, 255},
+		{2, 0, 5, 0},
+		{2, 0, 5, 1},
+		{2, 0, 5, 2},
+		{1, byte(contentOffset >> 8), byte(contentOffset), 0},
+		{1, byte(objStmOffset >> 8), byte(objStmOffset), 0},
+		{1, 0, 0, 0},
+	}
+	xrefOffset := buf.Len()
+	rows[6][1], rows[6][2] = byte(xrefOffset>>8), byte(xrefOffset)
+	var predicted []byte
+	prev := make([]byte, 4)
+	for _, row := range rows {
+		predicted = append(predicted, 2)
+		for i, b := range row {
+			predicted = append(predicted, b-prev[i])
+		}
+		prev = row
+	}
+	xrefData := zlibData(predicted)
+	fmt.Fprintf(&buf, "6 0 obj\n<< /Type /XRef /Size 7 /Root 1 0 R /W [1 2 1] /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n", len(xrefData))
+	buf.Write(xrefData)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+func zlibData(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// pageContent 解码并拼接页面的所有内容流
+func pageContent(t *testing.T, f *pdfFile, page pdfPage) string {
+	t.Helper()
+	var sb strings.Builder
+	for _, ref := range page.dict["Contents"].(pdfArray) {
+		stream, ok := f.resolve(ref).(*pdfStream)
+		if !ok {
+			t.Fatalf("content %v is not a stream", ref)
+		}
+		data, err := f.decodeStream(stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// pageResource 返回页面资源中指定类别和名称的对象
+func pageResource(f *pdfFile, page pdfPage, category, name string) pdfObject {
+	sub, _ := f.resolve(page.resources[pdfName(category)]).(pdfDict)
+	return f.resolve(sub[pdfName(name)])
+}
+
+func TestPDFParse(t *testing.T) {
+	l := &pdfLexer{data: []byte(`<< /A [1 0 R -2 +3 .5 (a\(b\)\101) <48 49 4>] /B#20C true /D null /E << >> >>`)}
+	obj, err := l.object()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pdfDict{
+		"A":   pdfArray{pdfRef{1, 0}, -2, 3, 0.5, pdfString("a(b)A"), pdfString("HI@")},
+		"B C": true,
+		"E":   pdfDict{},
+	}
+	if !reflect.DeepEqual(obj, want) {
+		t.Errorf("parsed %#v, want %#v", obj, want)
+	}
+
+	var buf bytes.Buffer
+	writePDFObject(&buf, pdfDict{"B C": pdfArray{1.5, -0.00001, pdfName("x/y")}, "A": pdfString("()")})
+	if got := buf.String(); got != "<</A <2829> /B#20C [1.5 0 /x#2Fy]>>" {
+		t.Errorf("serialized %q", got)
+	}
+
+	for _, data := range [][]byte{buildClassicPDF(), buildXrefStreamPDF()} {
+		f, err := openPDF(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages, err := f.pages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) == 0 || pages[0].ref.num != 3 {
+			t.Fatalf("pages = %v", pages)
+		}
+	}
+
+	f, _ := openPDF(buildClassicPDF())
+	pages, _ := f.pages()
+	if pages[0].box != [4]float64{0, 0, 600, 800} || pages[0].resources["Font"] == nil {
+		t.Errorf("page 1 did not inherit attributes: %+v", pages[0])
+	}
+	if pages[1].rotate != 90 || pages[1].box != [4]float64{0, 0, 612, 792} {
+		t.Errorf("page 2 = %+v", pages[1])
+	}
+}
+
+func TestParsePageRange(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"", []int{0, 1, 2, 3, 4}},
+		{"2", []int{1}},
+		{"1-2, 4-", []int{0, 1, 3, 4}},
+		{"-2,5,2", []int{0, 1, 4}},
+		{"3-9", []int{2, 3, 4}},
+	}
+	for _, tt := range tests {
+		got, err := parsePageRange(tt.spec, 5)
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+	for _, spec := range []string{"0", "6", "3-1", "a", "1,,2", "-"} {
+		if _, err := parsePageRange(spec, 5); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestPDFTextWatermark(t *testing.T) {
+	origin := buildClassicPDF()
+	out, err := AddPDFWatermark(origin, PDFWatermarkConfig{
+		Text:         "CONFIDENTIAL\nCopy 1",
+		Size:         36,
+		Color:        Red,
+		Opacity:      0.3,
+		Rotation:     45,
+		WatermarkPos: Center,
+		Align:        AlignCenter,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, origin) {
+		t.Fatal("incremental update must keep the original bytes")
+	}
+	f, err := openPDF(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.xrefStream || f.trailer["Prev"] == nil {
+		t.Errorf("expected xref table with /Prev, trailer = %v", f.trailer)
+	}
+	pages, err := f.pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, page := range pages {
+		content := pageContent(t, f, page)
+		if !strings.HasPrefix(content, "q\n") || !strings.Contains(content, "Tj") {
+			t.Errorf("page %d content = %q", i+1, content)
+		}
+		font, _ := pageResource(f, page, "Font", "WMFont").(pdfDict)
+		if i == 1 {
+			// 第二页已有同名资源
+			font, _ = pageResource(f, page, "Font", "WMFont1").(pdfDict)
+			if !strings.Contains(content, "/WMFont1 36 Tf") {
+				t.Errorf("page 2 should use renamed font resource: %q", content)
+			}
+		}
+		if font["BaseFont"] != pdfName("Helvetica") {
+			t.Errorf("page %d font = %v", i+1, font)
+		}
+		if state, _ := pageResource(f, page, "ExtGState", "WMState").(pdfDict); state["ca"] != 0.3 {
+			t.Errorf("page %d ExtGState = %v", i+1, state)
+		}
+		if pageResource(f, page, "Font", "F1") == nil && i == 0 {
+			t.Error("original font resource lost")
+		}
+	}
+	// 第一页居中：外接矩形中心为页面中心
+	if content := pageContent(t, f, pages[0]); !strings.Contains(content, " 300 400 cm\n") || !strings.Contains(content, "1 0 0 rg") {
+		t.Errorf("page 1 content = %q", content)
+	}
+	// 第二页旋转90度：显示尺寸为792x612，先变换到页面坐标
+	if content := pageContent(t, f, pages[1]); !strings.Contains(content, "0 1 -1 0 612 0 cm\n") || !strings.Contains(content, " 396 306 cm\n") {
+		t.Errorf("page 2 content = %q", content)
+	}
+
+	// 仅处理第二页，再次增量更新
+	out2, err := AddPDFWatermark(out, PDFWatermarkConfig{Text: "Draft", Color: Black, Pages: "2", WatermarkPos: LeftTop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := openPDF(out2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages2, _ := f2.pages()
+	if got := len(pages2[0].dict["Contents"].(pdfArray)); got != 3 {
+		t.Errorf("page 1 contents = %d, want 3 (unchanged)", got)
+	}
+	if got := len(pages2[1].dict["Contents"].(pdfArray)); got != 6 {
+		t.Errorf("page 2 contents = %d, want 6", got)
+	}
+
+	if _, err = AddPDFWatermark(origin, PDFWatermarkConfig{Text: "中文", Color: Black, WatermarkPos: Center}); err == nil {
+		t.Error("expected error for non-latin text with Helvetica")
+	}
+	if _, err = AddPDFWatermark(origin, PDFWatermarkConfig{Text: "x", Pages: "3", WatermarkPos: Center}); err == nil {
+		t.Error("expected error for page out of range")
+	}
+	if _, err = AddPDFWatermark([]byte("not a pdf"), PDFWatermarkConfig{Text: "x"}); err == nil {
+		t.Error("expected error for invalid pdf")
+	}
+}
+
+func TestPDFEmbeddedFont(t *testing.T) {
+	out, err := AddPDFWatermark(buildXrefStreamPDF(), PDFWatermarkConfig{
+		Text:         "Ωmega €",
+		FontPath:     writeTestFont(t),
+		Color:        Blue,
+		WatermarkPos: RightBottom,
+		OffsetX:      10,
+		OffsetY:      10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := openPDF(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.xrefStream {
+		t.Error("update of an xref stream file should use an xref stream")
+	}
+	pages, err := f.pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fontDict, _ := pageResource(f, pages[0], "Font", "WMFont").(pdfDict)
+	if fontDict["Subtype"] != pdfName("Type0") || fontDict["Encoding"] != pdfName("Identity-H") {
+		t.Fatalf("font = %v", fontDict)
+	}
+	cid, _ := f.resolve(fontDict["DescendantFonts"].(pdfArray)[0]).(pdfDict)
+	descriptor, _ := f.resolve(cid["FontDescriptor"]).(pdfDict)
+	fontFile, _ := f.resolve(descriptor["FontFile2"]).(*pdfStream)
+	if fontFile == nil {
+		t.Fatal("font file not embedded")
+	}
+	data, _ := f.decodeStream(fontFile)
+	if fontFile.dict["Length1"] != len(data) || len(data) > len(goregular.TTF)/4 {
+		t.Errorf("embedded font should be a subset: %d of %d bytes", len(data), len(goregular.TTF))
+	}
+	if sum := fontChecksum(data); sum != 0xB1B0AFBA {
+		t.Errorf("font checksum = %#x", sum)
+	}
+	if name, _ := fontDict["BaseFont"].(pdfName); len(name) < 8 || name[6] != '+' || name != cid["BaseFont"] {
+		t.Errorf("subset font name = %v", fontDict["BaseFont"])
+	}
+	// 子集字体中用到的字形与原字体一致，未用到的字形为空
+	full, _ := parseFont(goregular.TTF)
+	subset, err := parseFont(data)
+	if err != nil {
+		t.Fatalf("subset font does not parse: %v", err)
+	}
+	var fullGlyph, subsetGlyph truetype.GlyphBuf
+	for _, r := range "Ωmega €A" {
+		index := full.Index(r)
+		if err = fullGlyph.Load(full, 2048, index, font.HintingNone); err != nil {
+			t.Fatal(err)
+		}
+		if err = subsetGlyph.Load(subset, 2048, index, font.HintingNone); err != nil {
+			t.Fatalf("glyph %q: %v", r, err)
+		}
+		if r == 'A' {
+			if len(subsetGlyph.Points) != 0 {
+				t.Error("unused glyph should be empty")
+			}
+			continue
+		}
+		if !reflect.DeepEqual(subsetGlyph.Points, fullGlyph.Points) || subsetGlyph.AdvanceWidth != fullGlyph.AdvanceWidth {
+			t.Errorf("glyph %q differs from the original font", r)
+		}
+	}
+	toUnicode, _ := f.resolve(fontDict["ToUnicode"]).(*pdfStream)
+	cmap, _ := f.decodeStream(toUnicode)
+	if !strings.Contains(string(cmap), "<03A9>") || !strings.Contains(string(cmap), "<20AC>") {
+		t.Errorf("ToUnicode cmap = %s", cmap)
+	}
+	content := pageContent(t, f, pages[0])
+	if !strings.Contains(content, "0 0 1 rg") || strings.Contains(content, "gs") {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestPDFImageWatermark(t *testing.T) {
+	mark := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for i := range mark.Pix {
+		mark.Pix[i] = 200
+	}
+	mark.SetNRGBA(0, 0, color.NRGBA{})
+	out, err := AddPDFWatermark(buildClassicPDF(), PDFWatermarkConfig{
+		Image:        mark,
+		WatermarkPos: Tiled,
+		TiledRows:    2,
+		TiledCols:    3,
+		Opacity:      0.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := openPDF(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, _ := f.pages()
+	xobj, _ := pageResource(f, pages[0], "XObject", "WMImage").(*pdfStream)
+	if xobj == nil || xobj.dict["Width"] != 40 || xobj.dict["Height"] != 20 {
+		t.Fatalf("image xobject = %v", xobj)
+	}
+	smask, _ := f.resolve(xobj.dict["SMask"]).(*pdfStream)
+	if smask == nil {
+		t.Fatal("transparent image needs an SMask")
+	}
+	if alpha, _ := f.decodeStream(smask); len(alpha) != 800 || alpha[0] != 0 || alpha[1] != 200 {
+		t.Error("SMask data wrong")
+	}
+	if rgb, _ := f.decodeStream(xobj); len(rgb) != 2400 {
+		t.Errorf("rgb data = %d bytes", len(rgb))
+	}
+	content := pageContent(t, f, pages[0])
+	if got := strings.Count(content, "/WMImage Do"); got != 6 {
+		t.Errorf("tiles = %d, want 6", got)
+	}
+	// 默认宽度为页面宽度的1/5
+	if !strings.Contains(content, "120 0 0 60 -60 -30 cm") {
+		t.Errorf("content = %q", content)
+	}
+	// 两页相同尺寸时共用水印内容流不影响正确性，不同尺寸时各自生成
+	if pageContent(t, f, pages[0]) == pageContent(t, f, pages[1]) {
+		t.Error("pages with different sizes should have different watermark content")
+	}
+}
+
+func TestPDFReconstructXref(t *testing.T) {
+	data := buildClassicPDF()
+	// 破坏startxref偏移
+	i := bytes.LastIndex(data, []byte("startxref"))
+	broken := append(append([]byte{}, data[:i]...), []byte("startxref\n99999\n%%EOF\n")...)
+	out, err := AddPDFWatermark(broken, PDFWatermarkConfig{Text: "Recovered", Color: Black, WatermarkPos: BottomCenter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := openPDF(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.xrefStream || f.trailer["Prev"] != nil {
+		t.Errorf("expected full xref stream without /Prev, trailer = %v", f.trailer)
+	}
+	pages, err := f.pages()
+	if err != nil || len(pages) != 2 {
+		t.Fatalf("pages = %v, %v", pages, err)
+	}
+	if !strings.Contains(pageContent(t, f, pages[0]), "Contract page") {
+		t.Error("original content lost")
+	}
+}
+
+func TestGlyphComponents(t *testing.T) {
+	// 复合字形：字形头10字节，部件1使用字坐标参数和统一缩放，部件2使用字节参数和2x2矩阵
+	composite := []byte{0xFF, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0}
+	composite = append(composite, 0x00, 0x29, 0x00, 0x05, 0, 1, 0, 2, 0x40, 0x00)
+	composite = append(composite, 0x00, 0x80, 0x01, 0x2C, 1, 2, 0x40, 0, 0, 0, 0, 0, 0x40, 0)
+	if got := glyphComponents(composite); !reflect.DeepEqual(got, []int{5, 300}) {
+		t.Errorf("components = %v, want [5 300]", got)
+	}
+	if got := glyphComponents([]byte{0, 1, 0, 0, 0, 0, 0, 0, 0, 0}); got != nil {
+		t.Errorf("simple glyph components = %v", got)
+	}
+	if _, err := subsetFont([]byte("not a font"), nil); err == nil {
+		t.Error("expected error for invalid font")
+	}
+}
+
+func TestExtractCollectionFont(t *testing.T) {
+	ttc := buildTTC(goregular.TTF, goregular.TTF)
+	font, err := extractCollectionFont(ttc, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = parseFont(font); err != nil {
+		t.Fatalf("extracted font does not parse: %v", err)
+	}
+	if _, err = extractCollectionFont(ttc, 2); err == nil {
+		t.Error("expected error for index out of range")
+	}
+	if got, _ := extractCollectionFont(goregular.TTF, 0); !bytes.Equal(got, goregular.TTF) {
+		t.Error("plain font should be returned unchanged")
+	}
+}
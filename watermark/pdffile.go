@@ -0,0 +1,650 @@
+package watermark
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// PDF文件读取：交叉引用表、交叉引用流、对象流和页面树
+
+// pdfXrefEntry 交叉引用条目
+type pdfXrefEntry struct {
+	compressed bool // 是否存放在对象流中
+	offset     int  // 非压缩对象在文件中的偏移
+	gen        int  // 非压缩对象的代号
+	stream     int  // 压缩对象所在对象流的对象号
+	index      int  // 压缩对象在对象流中的序号
+}
+
+// pdfFile 已解析交叉引用的PDF文件，对象按需解析
+type pdfFile struct {
+	data       []byte
+	xref       map[int]pdfXrefEntry
+	trailer    pdfDict // 最新的文件尾字典
+	size       int     // 对象号上限（文件尾中的Size）
+	startxref  int     // 最后一个交叉引用段的偏移，重建交叉引用时为-1
+	xrefStream bool    // 最后一个交叉引用段是否为交叉引用流
+	objects    map[int]pdfObject
+	resolving  map[int]bool
+	objStreams map[int]*pdfObjectStream
+}
+
+// pdfObjectStream 已解码的对象流
+type pdfObjectStream struct {
+	nums    []int    // 对象号
+	objects [][]byte // 各对象的数据
+}
+
+// pdfPage 页面及其继承的属性
+type pdfPage struct {
+	ref       pdfRef
+	dict      pdfDict
+	resources pdfDict
+	box       [4]float64 // 可见区域，优先CropBox
+	rotate    int        // 顺时针旋转角度 0/90/180/270
+}
+
+// openPDF 解析PDF的交叉引用，交叉引用损坏时扫描全文重建
+func openPDF(data []byte) (*pdfFile, error) {
+	// 文件头允许前面有少量垃圾数据
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, errors.New("not a pdf file")
+	}
+	f := &pdfFile{
+		data:       data,
+		xref:       make(map[int]pdfXrefEntry),
+		objects:    make(map[int]pdfObject),
+		resolving:  make(map[int]bool),
+		objStreams: make(map[int]*pdfObjectStream),
+	}
+	if err := f.readXrefChain(); err != nil {
+		f.xref = make(map[int]pdfXrefEntry)
+		f.objects = make(map[int]pdfObject)
+		f.objStreams = make(map[int]*pdfObjectStream)
+		if rerr := f.reconstructXref(); rerr != nil {
+			return nil, errors.New("read pdf xref error:" + err.Error())
+		}
+	}
+	if _, ok := f.trailer["Encrypt"]; ok {
+		return nil, errors.New("encrypted pdf is not supported")
+	}
+	if _, ok := f.trailer["Root"].(pdfRef); !ok {
+		return nil, errors.New("pdf trailer has no root")
+	}
+	return f, nil
+}
+
+// readXrefChain 从startxref开始沿Prev读取所有交叉引用段，较新的条目优先
+func (f *pdfFile) readXrefChain() error {
+	tail := f.data[max(0, len(f.data)-1024):]
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return errors.New("startxref not found")
+	}
+	l := &pdfLexer{data: tail, pos: i + len("startxref")}
+	offset, err := l.integer()
+	if err != nil {
+		return err
+	}
+	f.startxref = offset
+	visited := make(map[int]bool)
+	for first := true; ; first = false {
+		if visited[offset] || offset <= 0 || offset >= len(f.data) {
+			return fmt.Errorf("invalid xref offset %d", offset)
+		}
+		visited[offset] = true
+		trailer, isStream, err := f.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if first {
+			f.trailer, f.xrefStream = trailer, isStream
+		}
+		prev, ok := trailer["Prev"].(int)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	size, _ := f.trailer["Size"].(int)
+	f.size = size
+	for num := range f.xref {
+		f.size = max(f.size, num+1)
+	}
+	return nil
+}
+
+// readXrefSection 读取一个交叉引用段，返回其文件尾字典
+func (f *pdfFile) readXrefSection(offset int) (pdfDict, bool, error) {
+	l := &pdfLexer{data: f.data, pos: offset}
+	l.skipSpace()
+	if !bytes.HasPrefix(f.data[l.pos:], []byte("xref")) {
+		_, _, obj, err := f.parseIndirect(offset)
+		if err != nil {
+			return nil, false, err
+		}
+		stream, ok := obj.(*pdfStream)
+		if !ok || stream.dict["Type"] != pdfName("XRef") {
+			return nil, false, errors.New("xref stream expected")
+		}
+		return stream.dict, true, f.readXrefStream(stream)
+	}
+
+	l.pos += len("xref")
+	for {
+		save := l.pos
+		if word := l.keyword(); word == "trailer" {
+			break
+		}
+		l.pos = save
+		start, err := l.integer()
+		if err != nil {
+			return nil, false, err
+		}
+		count, err := l.integer()
+		if err != nil {
+			return nil, false, err
+		}
+		for i := 0; i < count; i++ {
+			off, err := l.integer()
+			if err != nil {
+				return nil, false, err
+			}
+			gen, err := l.integer()
+			if err != nil {
+				return nil, false, err
+			}
+			kind := l.keyword()
+			if _, ok := f.xref[start+i]; ok || start+i == 0 {
+				continue
+			}
+			switch kind {
+			case "n":
+				f.xref[start+i] = pdfXrefEntry{offset: off, gen: gen}
+			case "f":
+				// 已释放的对象也占位，避免更早的段中的旧条目生效
+				f.xref[start+i] = pdfXrefEntry{offset: -1, gen: gen}
+			default:
+				return nil, false, fmt.Errorf("invalid xref entry type %q", kind)
+			}
+		}
+	}
+	obj, err := l.object()
+	if err != nil {
+		return nil, false, err
+	}
+	trailer, ok := obj.(pdfDict)
+	if !ok {
+		return nil, false, errors.New("pdf trailer dictionary expected")
+	}
+	// 混合引用文件：交叉引用表之外的对象记录在XRefStm中
+	if stmOffset, ok := trailer["XRefStm"].(int); ok {
+		if _, _, obj, err := f.parseIndirect(stmOffset); err == nil {
+			if stream, ok := obj.(*pdfStream); ok {
+				if err = f.readXrefStream(stream); err != nil {
+					return nil, false, err
+				}
+			}
+		}
+	}
+	return trailer, false, nil
+}
+
+// readXrefStream 解析交叉引用流中的条目
+func (f *pdfFile) readXrefStream(stream *pdfStream) error {
+	data, err := f.decodeStream(stream)
+	if err != nil {
+		return err
+	}
+	w, ok := stream.dict["W"].(pdfArray)
+	if !ok || len(w) != 3 {
+		return errors.New("invalid xref stream /W")
+	}
+	var widths [3]int
+	rowLen := 0
+	for i, v := range w {
+		n, ok := v.(int)
+		if !ok || n < 0 || n > 8 {
+			return errors.New("invalid xref stream /W")
+		}
+		widths[i] = n
+		rowLen += n
+	}
+	size, _ := stream.dict["Size"].(int)
+	index := pdfArray{0, size}
+	if idx, ok := stream.dict["Index"].(pdfArray); ok {
+		index = idx
+	}
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int)
+		count, ok2 := index[i+1].(int)
+		if !ok1 || !ok2 {
+			return errors.New("invalid xref stream /Index")
+		}
+		for j := 0; j < count; j++ {
+			if pos+rowLen > len(data) {
+				return errors.New("xref stream data too short")
+			}
+			var fields [3]int
+			for k, n := range widths {
+				for b := 0; b < n; b++ {
+					fields[k] = fields[k]<<8 | int(data[pos])
+					pos++
+				}
+			}
+			// 类型字段宽度为0时默认为1
+			if widths[0] == 0 {
+				fields[0] = 1
+			}
+			num := start + j
+			if _, ok := f.xref[num]; ok || num == 0 {
+				continue
+			}
+			switch fields[0] {
+			case 0:
+				f.xref[num] = pdfXrefEntry{offset: -1}
+			case 1:
+				f.xref[num] = pdfXrefEntry{offset: fields[1], gen: fields[2]}
+			case 2:
+				f.xref[num] = pdfXrefEntry{compressed: true, stream: fields[1], index: fields[2]}
+			}
+		}
+	}
+	return nil
+}
+
+// pdfObjHeader 匹配间接对象的开头
+var pdfObjHeader = regexp.MustCompile(`(?m)(?:^|[^0-9])(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+// reconstructXref 交叉引用损坏时扫描全文查找间接对象，文件尾取最后一个trailer或交叉引用流
+func (f *pdfFile) reconstructXref() error {
+	f.startxref = -1
+	f.xrefStream = false
+	f.trailer = nil
+	var objStreams []int
+	xrefOffset := -1
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(f.data, -1) {
+		num, _ := strconv.Atoi(string(f.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(f.data[m[4]:m[5]]))
+		f.xref[num] = pdfXrefEntry{offset: m[2], gen: gen}
+		f.size = max(f.size, num+1)
+	}
+	for num, entry := range f.xref {
+		_, _, obj, err := f.parseIndirect(entry.offset)
+		if err != nil {
+			continue
+		}
+		if stream, ok := obj.(*pdfStream); ok {
+			switch stream.dict["Type"] {
+			case pdfName("ObjStm"):
+				objStreams = append(objStreams, num)
+			case pdfName("XRef"):
+				// 取最靠后（最新）的交叉引用流
+				if entry.offset > xrefOffset {
+					f.trailer, xrefOffset = stream.dict, entry.offset
+				}
+			}
+		}
+	}
+	// 对象流中的对象，文件中直接出现的同号对象优先
+	sort.Ints(objStreams)
+	for _, num := range objStreams {
+		objStm, err := f.objectStream(num)
+		if err != nil {
+			continue
+		}
+		for i, n := range objStm.nums {
+			if _, ok := f.xref[n]; !ok {
+				f.xref[n] = pdfXrefEntry{compressed: true, stream: num, index: i}
+				f.size = max(f.size, n+1)
+			}
+		}
+	}
+	if i := bytes.LastIndex(f.data, []byte("trailer")); i >= 0 {
+		l := &pdfLexer{data: f.data, pos: i + len("trailer")}
+		if obj, err := l.object(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				f.trailer = dict
+			}
+		}
+	}
+	if f.trailer == nil {
+		return errors.New("pdf trailer not found")
+	}
+	return nil
+}
+
+// parseIndirect 解析指定偏移处的间接对象
+func (f *pdfFile) parseIndirect(offset int) (int, int, pdfObject, error) {
+	if offset < 0 || offset >= len(f.data) {
+		return 0, 0, nil, fmt.Errorf("invalid object offset %d", offset)
+	}
+	l := &pdfLexer{data: f.data, pos: offset}
+	num, err := l.integer()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	gen, err := l.integer()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if l.keyword() != "obj" {
+		return 0, 0, nil, fmt.Errorf("pdf obj keyword expected at offset %d", offset)
+	}
+	obj, err := l.object()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return num, gen, obj, nil
+	}
+	save := l.pos
+	if l.keyword() != "stream" {
+		l.pos = save
+		return num, gen, obj, nil
+	}
+	// stream关键字后为CRLF或LF
+	if l.pos < len(f.data) && f.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(f.data) && f.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	length := -1
+	switch v := dict["Length"].(type) {
+	case int:
+		length = v
+	case pdfRef:
+		if v.num != num {
+			if n, ok := f.resolve(v).(int); ok {
+				length = n
+			}
+		}
+	}
+	end := start + length
+	if length < 0 || end > len(f.data) || !bytes.HasPrefix(bytes.TrimLeft(f.data[end:min(end+32, len(f.data))], "\x00\t\n\f\r "), []byte("endstream")) {
+		// 长度缺失或错误时查找endstream
+		i := bytes.Index(f.data[start:], []byte("endstream"))
+		if i < 0 {
+			return 0, 0, nil, errors.New("pdf endstream not found")
+		}
+		end = start + i
+		if end > start && f.data[end-1] == '\n' {
+			end--
+		}
+		if end > start && f.data[end-1] == '\r' {
+			end--
+		}
+	}
+	return num, gen, &pdfStream{dict: dict, data: f.data[start:end]}, nil
+}
+
+// resolve 解析间接引用，非引用对象原样返回，不存在的对象返回nil
+func (f *pdfFile) resolve(obj pdfObject) pdfObject {
+	ref, ok := obj.(pdfRef)
+	if !ok {
+		return obj
+	}
+	if cached, ok := f.objects[ref.num]; ok {
+		return cached
+	}
+	entry, ok := f.xref[ref.num]
+	if !ok || f.resolving[ref.num] {
+		return nil
+	}
+	f.resolving[ref.num] = true
+	defer delete(f.resolving, ref.num)
+
+	var result pdfObject
+	if entry.compressed {
+		result = f.compressedObject(entry)
+	} else if entry.offset >= 0 {
+		if num, _, obj, err := f.parseIndirect(entry.offset); err == nil && num == ref.num {
+			result = obj
+		}
+	}
+	f.objects[ref.num] = result
+	return result
+}
+
+// objectStream 解码并缓存对象流
+func (f *pdfFile) objectStream(num int) (*pdfObjectStream, error) {
+	if objStm, ok := f.objStreams[num]; ok {
+		return objStm, nil
+	}
+	stream, ok := f.resolve(pdfRef{num, 0}).(*pdfStream)
+	if !ok {
+		return nil, fmt.Errorf("object stream %d not found", num)
+	}
+	data, err := f.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := stream.dict["N"].(int)
+	first, _ := stream.dict["First"].(int)
+	if n <= 0 || first <= 0 || first > len(data) {
+		return nil, fmt.Errorf("invalid object stream %d", num)
+	}
+	l := &pdfLexer{data: data[:first]}
+	objStm := &pdfObjectStream{nums: make([]int, n), objects: make([][]byte, n)}
+	offsets := make([]int, n)
+	for i := 0; i < n; i++ {
+		if objStm.nums[i], err = l.integer(); err != nil {
+			return nil, err
+		}
+		if offsets[i], err = l.integer(); err != nil {
+			return nil, err
+		}
+	}
+	for i, off := range offsets {
+		end := len(data)
+		if i+1 < n {
+			end = first + offsets[i+1]
+		}
+		if first+off > end || end > len(data) {
+			return nil, fmt.Errorf("invalid object stream %d", num)
+		}
+		objStm.objects[i] = data[first+off : end]
+	}
+	f.objStreams[num] = objStm
+	return objStm, nil
+}
+
+// compressedObject 从对象流中读取对象
+func (f *pdfFile) compressedObject(entry pdfXrefEntry) pdfObject {
+	objStm, err := f.objectStream(entry.stream)
+	if err != nil || entry.index >= len(objStm.objects) {
+		return nil
+	}
+	l := &pdfLexer{data: objStm.objects[entry.index]}
+	obj, err := l.object()
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// decodeStream 解码流数据，支持FlateDecode及PNG预测器
+func (f *pdfFile) decodeStream(stream *pdfStream) ([]byte, error) {
+	filters := pdfArray{}
+	params := pdfArray{}
+	switch v := f.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{v}
+		params = pdfArray{f.resolve(stream.dict["DecodeParms"])}
+	case pdfArray:
+		filters = v
+		if p, ok := f.resolve(stream.dict["DecodeParms"]).(pdfArray); ok {
+			params = p
+		}
+	}
+	data := stream.data
+	for i, filter := range filters {
+		if filter != pdfName("FlateDecode") {
+			return nil, fmt.Errorf("unsupported pdf stream filter %v", filter)
+		}
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.New("decode pdf stream error:" + err.Error())
+		}
+		decoded, err := io.ReadAll(r)
+		// 部分PDF的压缩流缺少校验和，已读出的数据仍可使用
+		if err != nil && len(decoded) == 0 {
+			return nil, errors.New("decode pdf stream error:" + err.Error())
+		}
+		data = decoded
+		if i < len(params) {
+			if parms, ok := f.resolve(params[i]).(pdfDict); ok {
+				if data, err = pngUnpredict(data, parms); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// pngUnpredict 还原PNG预测器编码的数据
+func pngUnpredict(data []byte, parms pdfDict) ([]byte, error) {
+	predictor, _ := parms["Predictor"].(int)
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, fmt.Errorf("unsupported pdf predictor %d", predictor)
+		}
+		return data, nil
+	}
+	columns, colors, bpc := 1, 1, 8
+	if v, ok := parms["Columns"].(int); ok {
+		columns = v
+	}
+	if v, ok := parms["Colors"].(int); ok {
+		colors = v
+	}
+	if v, ok := parms["BitsPerComponent"].(int); ok {
+		bpc = v
+	}
+	bpp := max(1, colors*bpc/8)
+	rowLen := (columns*colors*bpc + 7) / 8
+	prev := make([]byte, rowLen)
+	var out []byte
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up = prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("invalid png predictor row type %d", kind)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+// paeth PNG的Paeth预测函数
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+// pages 遍历页面树，返回按顺序排列的页面及继承的资源、页面框和旋转角度
+func (f *pdfFile) pages() ([]pdfPage, error) {
+	root, ok := f.resolve(f.trailer["Root"]).(pdfDict)
+	if !ok {
+		return nil, errors.New("pdf catalog not found")
+	}
+	tree, ok := root["Pages"].(pdfRef)
+	if !ok {
+		return nil, errors.New("pdf page tree not found")
+	}
+	var pages []pdfPage
+	visited := make(map[int]bool)
+	var walk func(ref pdfRef, inherited pdfDict) error
+	walk = func(ref pdfRef, inherited pdfDict) error {
+		if visited[ref.num] {
+			return errors.New("pdf page tree contains a cycle")
+		}
+		visited[ref.num] = true
+		node, ok := f.resolve(ref).(pdfDict)
+		if !ok {
+			return fmt.Errorf("pdf page object %d not found", ref.num)
+		}
+		attrs := pdfDict{}
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range []pdfName{"Resources", "MediaBox", "CropBox", "Rotate"} {
+			if v, ok := node[k]; ok {
+				attrs[k] = v
+			}
+		}
+		if kids, ok := f.resolve(node["Kids"]).(pdfArray); ok && node["Type"] != pdfName("Page") {
+			for _, kid := range kids {
+				kidRef, ok := kid.(pdfRef)
+				if !ok {
+					return errors.New("pdf page tree kid must be an indirect reference")
+				}
+				if err := walk(kidRef, attrs); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		page := pdfPage{ref: ref, dict: node, box: [4]float64{0, 0, 612, 792}}
+		page.resources, _ = f.resolve(attrs["Resources"]).(pdfDict)
+		for _, k := range []pdfName{"MediaBox", "CropBox"} {
+			if box, ok := f.resolve(attrs[k]).(pdfArray); ok && len(box) == 4 {
+				var r [4]float64
+				valid := true
+				for i, v := range box {
+					if r[i], ok = pdfNumber(f.resolve(v)); !ok {
+						valid = false
+					}
+				}
+				if valid {
+					page.box = [4]float64{min(r[0], r[2]), min(r[1], r[3]), max(r[0], r[2]), max(r[1], r[3])}
+				}
+			}
+		}
+		if rotate, ok := f.resolve(attrs["Rotate"]).(int); ok {
+			page.rotate = ((rotate % 360) + 360) % 360 / 90 * 90
+		}
+		pages = append(pages, page)
+		return nil
+	}
+	if err := walk(tree, pdfDict{}); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
@@ -0,0 +1,474 @@
+package watermark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// PDF水印文字使用的字体：内置Helvetica（WinAnsi编码）或以Type0/Identity-H方式嵌入的TrueType字体
+
+// helveticaWidths Helvetica在WinAnsi编码下32-126号字符的宽度（1/1000字号）
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// helveticaLatin1Widths Helvetica在WinAnsi编码下160-255号字符的宽度
+var helveticaLatin1Widths = [96]int{
+	278, 333, 556, 556, 556, 556, 260, 556, 333, 737, 370, 556, 584, 333, 737, 333,
+	400, 584, 333, 333, 333, 556, 537, 278, 333, 333, 365, 556, 834, 834, 834, 611,
+	667, 667, 667, 667, 667, 667, 1000, 722, 667, 667, 667, 667, 278, 278, 278, 278,
+	722, 722, 778, 778, 778, 778, 778, 584, 778, 722, 722, 722, 722, 667, 667, 611,
+	556, 556, 556, 556, 556, 556, 889, 500, 556, 556, 556, 556, 278, 278, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 584, 611, 556, 556, 556, 556, 500, 556, 500,
+}
+
+// winAnsiSpecial WinAnsi编码128-159号位置的字符及其Helvetica宽度
+var winAnsiSpecial = map[rune]struct {
+	code  byte
+	width int
+}{
+	'€': {0x80, 556}, '‚': {0x82, 222}, 'ƒ': {0x83, 556}, '„': {0x84, 333}, '…': {0x85, 1000},
+	'†': {0x86, 556}, '‡': {0x87, 556}, 'ˆ': {0x88, 333}, '‰': {0x89, 1000}, 'Š': {0x8A, 667},
+	'‹': {0x8B, 333}, 'Œ': {0x8C, 1000}, 'Ž': {0x8E, 611}, '‘': {0x91, 222}, '’': {0x92, 222},
+	'“': {0x93, 333}, '”': {0x94, 333}, '•': {0x95, 350}, '–': {0x96, 556}, '—': {0x97, 1000},
+	'˜': {0x98, 333}, '™': {0x99, 1000}, 'š': {0x9A, 500}, '›': {0x9B, 333}, 'œ': {0x9C, 944},
+	'ž': {0x9E, 500}, 'Ÿ': {0x9F, 667},
+}
+
+// pdfFont PDF水印文字字体
+type pdfFont struct {
+	ttf        *truetype.Font
+	data       []byte // 嵌入的TrueType字体数据，内置Helvetica时为空
+	unitsPerEm int
+	ascent     float64 // 上行高度（1/1000字号）
+	descent    float64 // 下行高度（1/1000字号，为负数）
+	lineHeight float64 // 行高（1/1000字号）
+	used       map[truetype.Index]rune
+}
+
+// newPDFFont 加载字体，fontPath为空时使用内置Helvetica
+func newPDFFont(fontPath string) (*pdfFont, error) {
+	if fontPath == "" {
+		return &pdfFont{ascent: 718, descent: -207, lineHeight: 1150}, nil
+	}
+	ttf, err := DefaultFontRegistry.Load(fontPath)
+	if err != nil {
+		return nil, err
+	}
+	data, index, err := DefaultFontRegistry.fontData(fontPath)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = extractCollectionFont(data, index); err != nil {
+		return nil, err
+	}
+	f := &pdfFont{ttf: ttf, data: data, unitsPerEm: int(ttf.FUnitsPerEm()), used: make(map[truetype.Index]rune)}
+	// 字号为1000时的度量即为1/1000字号单位
+	metrics := truetype.NewFace(ttf, &truetype.Options{Size: 1000, DPI: 72, Hinting: font.HintingNone}).Metrics()
+	f.ascent = float64(metrics.Ascent) / 64
+	f.descent = -float64(metrics.Descent) / 64
+	f.lineHeight = float64(metrics.Height) / 64
+	return f, nil
+}
+
+// encode 将文字编码为PDF字符串，返回编码结果和宽度（1/1000字号）
+// 使用TrueType字体时先整形，字形按显示顺序排列
+func (f *pdfFont) encode(text string) ([]byte, float64, error) {
+	var buf []byte
+	width := 0
+	if f.ttf == nil {
+		for _, r := range text {
+			code, w, ok := winAnsiCode(r)
+			if !ok {
+				return nil, 0, fmt.Errorf("character %q is not supported by the built-in Helvetica font, set FontPath to a TrueType font", r)
+			}
+			buf = append(buf, code)
+			width += w
+		}
+		return buf, float64(width), nil
+	}
+	covers := func(_ int, r rune) bool { return f.ttf.Index(r) != 0 }
+	for _, g := range shapeText(text, 1, covers) {
+		r := g.r
+		index := f.ttf.Index(r)
+		if index == 0 && r != ' ' {
+			return nil, 0, fmt.Errorf("font has no glyph for character %q", r)
+		}
+		f.used[index] = r
+		buf = append(buf, byte(index>>8), byte(index))
+		width += f.glyphWidth(index)
+	}
+	return buf, float64(width), nil
+}
+
+// winAnsiCode 返回字符的WinAnsi编码和Helvetica宽度
+func winAnsiCode(r rune) (byte, int, bool) {
+	switch {
+	case r >= 32 && r <= 126:
+		return byte(r), helveticaWidths[r-32], true
+	case r >= 160 && r <= 255:
+		return byte(r), helveticaLatin1Widths[r-160], true
+	}
+	if special, ok := winAnsiSpecial[r]; ok {
+		return special.code, special.width, true
+	}
+	return 0, 0, false
+}
+
+// glyphWidth 字形宽度（1/1000字号）
+func (f *pdfFont) glyphWidth(index truetype.Index) int {
+	advance := f.ttf.HMetric(fixed.Int26_6(f.unitsPerEm), index).AdvanceWidth
+	return int(advance) * 1000 / f.unitsPerEm
+}
+
+// object 将字体写入增量更新并返回字体字典的引用，应在所有文字编码完成后调用
+// 嵌入的字体只包含水印文字用到的字形，避免中文字体使输出文件增大数MB
+func (f *pdfFont) object(u *pdfUpdate) pdfRef {
+	if f.ttf == nil {
+		return u.add(pdfDict{
+			"Type":     pdfName("Font"),
+			"Subtype":  pdfName("Type1"),
+			"BaseFont": pdfName("Helvetica"),
+			"Encoding": pdfName("WinAnsiEncoding"),
+		})
+	}
+
+	indexes := make([]int, 0, len(f.used))
+	for index := range f.used {
+		indexes = append(indexes, int(index))
+	}
+	sort.Ints(indexes)
+	// 只嵌入用到的字形，子集化失败时（如字体结构异常）嵌入完整字体
+	name := pdfName(postScriptName(f.ttf))
+	data, err := subsetFont(f.data, f.used)
+	if err != nil {
+		data = f.data
+	} else {
+		name = pdfName(subsetTag(indexes) + "+" + string(name))
+	}
+	fontFile := u.add(flateStream(pdfDict{"Length1": len(data)}, data))
+	bounds := f.ttf.Bounds(fixed.Int26_6(f.unitsPerEm))
+	scale := func(v fixed.Int26_6) int { return int(v) * 1000 / f.unitsPerEm }
+	descriptor := u.add(pdfDict{
+		"Type":        pdfName("FontDescriptor"),
+		"FontName":    name,
+		"Flags":       4,
+		"FontBBox":    pdfArray{scale(bounds.Min.X), scale(bounds.Min.Y), scale(bounds.Max.X), scale(bounds.Max.Y)},
+		"ItalicAngle": 0,
+		"Ascent":      f.ascent,
+		"Descent":     f.descent,
+		"CapHeight":   f.ascent,
+		"StemV":       80,
+		"FontFile2":   fontFile,
+	})
+
+	widths := pdfArray{}
+	for _, index := range indexes {
+		widths = append(widths, index, pdfArray{f.glyphWidth(truetype.Index(index))})
+	}
+	cidFont := u.add(pdfDict{
+		"Type":           pdfName("Font"),
+		"Subtype":        pdfName("CIDFontType2"),
+		"BaseFont":       name,
+		"CIDSystemInfo":  pdfDict{"Registry": pdfString("Adobe"), "Ordering": pdfString("Identity"), "Supplement": 0},
+		"FontDescriptor": descriptor,
+		"W":              widths,
+		"CIDToGIDMap":    pdfName("Identity"),
+	})
+	toUnicode := u.add(flateStream(nil, f.toUnicode(indexes)))
+	return u.add(pdfDict{
+		"Type":            pdfName("Font"),
+		"Subtype":         pdfName("Type0"),
+		"BaseFont":        name,
+		"Encoding":        pdfName("Identity-H"),
+		"DescendantFonts": pdfArray{cidFont},
+		"ToUnicode":       toUnicode,
+	})
+}
+
+// toUnicode 生成字形到Unicode的映射表，使水印文字可以被复制和搜索
+func (f *pdfFont) toUnicode(indexes []int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	buf.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	buf.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	buf.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// 每个bfchar块最多100项
+	for i := 0; i < len(indexes); i += 100 {
+		chunk := indexes[i:min(i+100, len(indexes))]
+		fmt.Fprintf(&buf, "%d beginbfchar\n", len(chunk))
+		for _, index := range chunk {
+			fmt.Fprintf(&buf, "<%04X> <", index)
+			for _, u := range utf16.Encode([]rune{f.used[truetype.Index(index)]}) {
+				fmt.Fprintf(&buf, "%04X", u)
+			}
+			buf.WriteString(">\n")
+		}
+		buf.WriteString("endbfchar\n")
+	}
+	buf.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return buf.Bytes()
+}
+
+// postScriptName 返回字体的PostScript名称，只保留PDF名字中安全的字符
+func postScriptName(f *truetype.Font) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return -1
+	}, f.Name(truetype.NameIDPostscriptName))
+	if name == "" {
+		return "WatermarkFont"
+	}
+	return name
+}
+
+// extractCollectionFont 从TTC字体集合中提取指定序号的字体为独立的TrueType字体，普通字体原样返回
+// PDF的FontFile2只能嵌入单个TrueType字体
+func extractCollectionFont(data []byte, index int) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "ttcf" {
+		return data, nil
+	}
+	numFonts := int(binary.BigEndian.Uint32(data[8:]))
+	if index < 0 || index >= numFonts || len(data) < 12+4*numFonts {
+		return nil, errors.New("font collection index out of range")
+	}
+	offset := int(binary.BigEndian.Uint32(data[12+4*index:]))
+	if offset+12 > len(data) {
+		return nil, errors.New("invalid font collection")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[offset+4:]))
+	if offset+12+16*numTables > len(data) {
+		return nil, errors.New("invalid font collection")
+	}
+	out := make([]byte, 12+16*numTables)
+	copy(out, data[offset:offset+12])
+	for i := 0; i < numTables; i++ {
+		record := data[offset+12+16*i : offset+28+16*i]
+		tableOffset := int(binary.BigEndian.Uint32(record[8:]))
+		length := int(binary.BigEndian.Uint32(record[12:]))
+		if tableOffset+length > len(data) {
+			return nil, errors.New("invalid font collection")
+		}
+		// 表按4字节对齐
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+		entry := out[12+16*i : 28+16*i]
+		copy(entry, record[:8])
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(entry[12:], uint32(length))
+		out = append(out, data[tableOffset:tableOffset+length]...)
+	}
+	return out, nil
+}
+
+// subsetTables 子集字体保留的表（按标签排序），以CIDToGIDMap定位字形时不需要name、post、OS/2等表，
+// cmap保留给要求字体必须包含该表的阅读器
+var subsetTables = []string{"cmap", "cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep"}
+
+// subsetFont 生成只包含已用字形的TrueType字体：字形序号保持不变，未用到的字形轮廓置空，
+// 复合字形引用的部件字形一并保留；不支持没有glyf表的字体（如CFF轮廓的OpenType字体）
+func subsetFont(data []byte, used map[truetype.Index]rune) ([]byte, error) {
+	tables, err := fontTables(data)
+	if err != nil {
+		return nil, err
+	}
+	head, maxp, loca, glyf := tables["head"], tables["maxp"], tables["loca"], tables["glyf"]
+	if len(head) < 54 || len(maxp) < 6 || loca == nil || glyf == nil {
+		return nil, errors.New("font has no glyf table")
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	offsets := make([]int, numGlyphs+1)
+	longLoca := binary.BigEndian.Uint16(head[50:]) != 0
+	for i := range offsets {
+		switch {
+		case longLoca && 4*i+4 <= len(loca):
+			offsets[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		case !longLoca && 2*i+2 <= len(loca):
+			offsets[i] = 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+		default:
+			return nil, errors.New("invalid font loca table")
+		}
+	}
+	glyph := func(i int) ([]byte, error) {
+		if offsets[i] > offsets[i+1] || offsets[i+1] > len(glyf) {
+			return nil, errors.New("invalid font glyf table")
+		}
+		return glyf[offsets[i]:offsets[i+1]], nil
+	}
+
+	// 0号字形（.notdef）必须保留
+	keep := make([]bool, numGlyphs)
+	pending := []int{0}
+	for index := range used {
+		pending = append(pending, int(index))
+	}
+	for len(pending) > 0 {
+		i := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if i >= numGlyphs || keep[i] {
+			continue
+		}
+		keep[i] = true
+		g, err := glyph(i)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, glyphComponents(g)...)
+	}
+
+	// 重建glyf表和长格式的loca表
+	var newGlyf []byte
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	for i := 0; i < numGlyphs; i++ {
+		binary.BigEndian.PutUint32(newLoca[4*i:], uint32(len(newGlyf)))
+		if keep[i] {
+			g, _ := glyph(i)
+			newGlyf = append(newGlyf, g...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(len(newGlyf)))
+	newHead := bytes.Clone(head)
+	binary.BigEndian.PutUint32(newHead[8:], 0)
+	binary.BigEndian.PutUint16(newHead[50:], 1)
+	tables["head"], tables["loca"], tables["glyf"] = newHead, newLoca, newGlyf
+
+	var tags []string
+	for _, tag := range subsetTables {
+		if _, ok := tables[tag]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	return buildFont(data[:4], tags, tables), nil
+}
+
+// glyphComponents 返回复合字形引用的部件字形序号，简单字形返回nil
+func glyphComponents(g []byte) []int {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	var components []int
+	for p := 10; p+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[p:])
+		components = append(components, int(binary.BigEndian.Uint16(g[p+2:])))
+		p += 4
+		if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&0x0008 != 0: // WE_HAVE_A_SCALE
+			p += 2
+		case flags&0x0040 != 0: // WE_HAVE_AN_X_AND_Y_SCALE
+			p += 4
+		case flags&0x0080 != 0: // WE_HAVE_A_TWO_BY_TWO
+			p += 8
+		}
+		if flags&0x0020 == 0 { // MORE_COMPONENTS
+			break
+		}
+	}
+	return components
+}
+
+// fontTables 解析TrueType字体的表目录，返回表标签到表数据的映射
+func fontTables(data []byte) (map[string][]byte, error) {
+	if len(data) < 12 {
+		return nil, errors.New("invalid font data")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*numTables {
+		return nil, errors.New("invalid font data")
+	}
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		record := data[12+16*i : 28+16*i]
+		offset := int(binary.BigEndian.Uint32(record[8:]))
+		length := int(binary.BigEndian.Uint32(record[12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil, errors.New("invalid font data")
+		}
+		tables[string(record[:4])] = data[offset : offset+length]
+	}
+	return tables, nil
+}
+
+// buildFont 按标签顺序（必须已排序）写出TrueType字体，并计算表校验和及head表的checkSumAdjustment
+func buildFont(version []byte, tags []string, tables map[string][]byte) []byte {
+	searchRange, entrySelector := 1, 0
+	for searchRange*2 <= len(tags) {
+		searchRange *= 2
+		entrySelector++
+	}
+	out := make([]byte, 12+16*len(tags))
+	copy(out, version)
+	binary.BigEndian.PutUint16(out[4:], uint16(len(tags)))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange*16))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16((len(tags)-searchRange)*16))
+	headOffset := -1
+	for i, tag := range tags {
+		table := tables[tag]
+		entry := out[12+16*i : 28+16*i]
+		copy(entry, tag)
+		binary.BigEndian.PutUint32(entry[4:], fontChecksum(table))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(entry[12:], uint32(len(table)))
+		if tag == "head" {
+			headOffset = len(out)
+		}
+		out = append(out, table...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-fontChecksum(out))
+	}
+	return out
+}
+
+// fontChecksum TrueType表校验和：按大端uint32求和，不足4字节的部分补零
+func fontChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// subsetTag 子集字体名称的前缀：由字形集合生成的6个大写字母
+func subsetTag(indexes []int) string {
+	hash := uint32(2166136261)
+	for _, index := range indexes {
+		hash = (hash ^ uint32(index)) * 16777619
+	}
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + byte(hash%26)
+		hash /= 26
+	}
+	return string(tag)
+}
@@ -0,0 +1,407 @@
+package watermark
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PDF对象模型、词法解析和序列化
+// 对象用Go值表示：nil、bool、int、float64、pdfName、pdfString、pdfArray、pdfDict、pdfRef和*pdfStream
+
+// pdfObject PDF对象
+type pdfObject interface{}
+
+// pdfName 名字对象，不含开头的斜杠
+type pdfName string
+
+// pdfString 字符串对象（已解码的原始字节）
+type pdfString []byte
+
+// pdfArray 数组对象
+type pdfArray []pdfObject
+
+// pdfDict 字典对象
+type pdfDict map[pdfName]pdfObject
+
+// pdfRef 间接对象引用
+type pdfRef struct {
+	num, gen int
+}
+
+// pdfStream 流对象，data为未解码的原始数据
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// errPDFEOF 解析时意外遇到数据末尾
+var errPDFEOF = errors.New("unexpected end of pdf data")
+
+// isPDFSpace 判断是否为PDF空白字符
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+// isPDFDelimiter 判断是否为PDF分隔符
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfLexer 在字节数据上逐个解析PDF对象
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+// skipSpace 跳过空白和注释
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// keyword 读取一个由普通字符组成的关键字或数字
+func (l *pdfLexer) keyword() string {
+	l.skipSpace()
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// integer 读取一个非负整数
+func (l *pdfLexer) integer() (int, error) {
+	word := l.keyword()
+	n, err := strconv.Atoi(word)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("pdf integer expected at offset %d", l.pos-len(word))
+	}
+	return n, nil
+}
+
+// object 解析下一个对象，流对象由parseIndirect处理
+func (l *pdfLexer) object() (pdfObject, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEOF
+	}
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literalString()
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			return l.dict()
+		}
+		return l.hexString()
+	case c == '[':
+		return l.array()
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.number()
+	}
+	start := l.pos
+	switch word := l.keyword(); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		return nil, fmt.Errorf("pdf unexpected character %q at offset %d", l.data[start], start)
+	default:
+		return nil, fmt.Errorf("pdf unexpected keyword %q at offset %d", word, start)
+	}
+}
+
+// name 解析名字对象，处理#xx转义
+func (l *pdfLexer) name() pdfName {
+	l.pos++
+	var buf []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				buf = append(buf, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, c)
+		l.pos++
+	}
+	return pdfName(buf)
+}
+
+// literalString 解析圆括号字符串，处理嵌套括号和转义
+func (l *pdfLexer) literalString() (pdfString, error) {
+	l.pos++
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return buf, nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, errPDFEOF
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// 行连接符
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return nil, errPDFEOF
+}
+
+// hexString 解析十六进制字符串，奇数位时末尾补0
+func (l *pdfLexer) hexString() (pdfString, error) {
+	l.pos++
+	var buf []byte
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if len(digits) == 1 {
+				digits = append(digits, '0')
+			}
+			if len(digits) == 2 {
+				v, _ := strconv.ParseUint(string(digits), 16, 8)
+				buf = append(buf, byte(v))
+			}
+			return buf, nil
+		}
+		if isPDFSpace(c) {
+			continue
+		}
+		if _, err := strconv.ParseUint(string(c), 16, 8); err != nil {
+			return nil, fmt.Errorf("pdf invalid hex string at offset %d", l.pos-1)
+		}
+		digits = append(digits, c)
+		if len(digits) == 2 {
+			v, _ := strconv.ParseUint(string(digits), 16, 8)
+			buf = append(buf, byte(v))
+			digits = digits[:0]
+		}
+	}
+	return nil, errPDFEOF
+}
+
+// array 解析数组
+func (l *pdfLexer) array() (pdfArray, error) {
+	l.pos++
+	arr := pdfArray{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, errPDFEOF
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return arr, nil
+		}
+		obj, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, obj)
+	}
+}
+
+// dict 解析字典
+func (l *pdfLexer) dict() (pdfDict, error) {
+	l.pos += 2
+	dict := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 >= len(l.data) {
+			return nil, errPDFEOF
+		}
+		if l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return dict, nil
+		}
+		if l.data[l.pos] != '/' {
+			return nil, fmt.Errorf("pdf dictionary key expected at offset %d", l.pos)
+		}
+		key := l.name()
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		// 值为null的键等同于不存在
+		if value != nil {
+			dict[key] = value
+		}
+	}
+}
+
+// number 解析数字，整数后跟"整数 R"时解析为间接引用
+func (l *pdfLexer) number() (pdfObject, error) {
+	start := l.pos
+	word := l.keyword()
+	if n, err := strconv.Atoi(word); err == nil {
+		if n >= 0 && word[0] != '+' {
+			save := l.pos
+			if gen, err := strconv.Atoi(l.keyword()); err == nil && gen >= 0 {
+				if l.keyword() == "R" {
+					return pdfRef{n, gen}, nil
+				}
+			}
+			l.pos = save
+		}
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		return nil, fmt.Errorf("pdf invalid number %q at offset %d", word, start)
+	}
+	return f, nil
+}
+
+// pdfNumber 将整数或实数对象转换为float64
+func pdfNumber(obj pdfObject) (float64, bool) {
+	switch v := obj.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// formatPDFNumber 格式化数字，保留最多4位小数，PDF不支持指数形式
+func formatPDFNumber(v float64) string {
+	s := strings.TrimRight(strings.TrimRight(strconv.FormatFloat(v, 'f', 4, 64), "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// writePDFObject 序列化对象，字典按键名排序以保证输出稳定
+func writePDFObject(buf *bytes.Buffer, obj pdfObject) {
+	switch v := obj.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case float64:
+		buf.WriteString(formatPDFNumber(v))
+	case pdfName:
+		buf.WriteByte('/')
+		for i := 0; i < len(v); i++ {
+			c := v[i]
+			if c < 33 || c > 126 || c == '#' || isPDFDelimiter(c) {
+				fmt.Fprintf(buf, "#%02X", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	case pdfString:
+		fmt.Fprintf(buf, "<%X>", []byte(v))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", v.num, v.gen)
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFObject(buf, item)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writePDFObject(buf, pdfName(k))
+			buf.WriteByte(' ')
+			writePDFObject(buf, v[pdfName(k)])
+		}
+		buf.WriteString(">>")
+	case *pdfStream:
+		dict := make(pdfDict, len(v.dict)+1)
+		for k, item := range v.dict {
+			dict[k] = item
+		}
+		dict["Length"] = len(v.data)
+		writePDFObject(buf, dict)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.data)
+		buf.WriteString("\nendstream")
+	default:
+		panic(fmt.Sprintf("unsupported pdf object %T", obj))
+	}
+}
@@ -0,0 +1,179 @@
+package watermark
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// pdfUpdate PDF增量更新，新增和替换的对象连同新的交叉引用段追加在原文件之后，原文件内容保持不变
+type pdfUpdate struct {
+	file    *pdfFile
+	objects map[int]pdfObject
+	gens    map[int]int
+	next    int
+}
+
+// newPDFUpdate 创建增量更新，新对象号从原文件的Size开始分配
+func newPDFUpdate(f *pdfFile) *pdfUpdate {
+	return &pdfUpdate{
+		file:    f,
+		objects: make(map[int]pdfObject),
+		gens:    make(map[int]int),
+		next:    max(f.size, 1),
+	}
+}
+
+// add 添加新对象并返回其引用
+func (u *pdfUpdate) add(obj pdfObject) pdfRef {
+	ref := pdfRef{num: u.next}
+	u.next++
+	u.objects[ref.num] = obj
+	return ref
+}
+
+// set 替换原文件中的对象
+func (u *pdfUpdate) set(ref pdfRef, obj pdfObject) {
+	u.objects[ref.num] = obj
+	u.gens[ref.num] = ref.gen
+}
+
+// flateStream 创建FlateDecode压缩的流对象
+func flateStream(dict pdfDict, data []byte) *pdfStream {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	if dict == nil {
+		dict = pdfDict{}
+	}
+	dict["Filter"] = pdfName("FlateDecode")
+	return &pdfStream{dict: dict, data: buf.Bytes()}
+}
+
+// write 写出原文件和增量更新
+// 原文件最后一段为交叉引用流或交叉引用经过重建时写交叉引用流，否则写交叉引用表
+func (u *pdfUpdate) write(w io.Writer) error {
+	f := u.file
+	var buf bytes.Buffer
+	base := len(f.data)
+	if base > 0 && f.data[base-1] != '\n' && f.data[base-1] != '\r' {
+		buf.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(u.objects))
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	offsets := make(map[int]int, len(nums))
+	for _, num := range nums {
+		offsets[num] = base + buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", num, u.gens[num])
+		writePDFObject(&buf, u.objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	trailer := pdfDict{"Root": f.trailer["Root"]}
+	for _, k := range []pdfName{"Info", "ID"} {
+		if v, ok := f.trailer[k]; ok {
+			trailer[k] = v
+		}
+	}
+	if f.startxref >= 0 {
+		trailer["Prev"] = f.startxref
+	}
+
+	if f.xrefStream || f.startxref < 0 {
+		u.writeXrefStream(&buf, base, nums, offsets, trailer)
+	} else {
+		xrefOffset := base + buf.Len()
+		trailer["Size"] = u.next
+		buf.WriteString("xref\n")
+		for i := 0; i < len(nums); {
+			j := i + 1
+			for j < len(nums) && nums[j] == nums[j-1]+1 {
+				j++
+			}
+			fmt.Fprintf(&buf, "%d %d\n", nums[i], j-i)
+			for _, num := range nums[i:j] {
+				fmt.Fprintf(&buf, "%010d %05d n\r\n", offsets[num], u.gens[num])
+			}
+			i = j
+		}
+		buf.WriteString("trailer\n")
+		writePDFObject(&buf, trailer)
+		fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	}
+
+	if _, err := w.Write(f.data); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeXrefStream 写交叉引用流，交叉引用经过重建时包含原文件的所有对象
+func (u *pdfUpdate) writeXrefStream(buf *bytes.Buffer, base int, nums []int, offsets map[int]int, trailer pdfDict) {
+	f := u.file
+	type row struct{ kind, field2, field3 int }
+	rows := make(map[int]row)
+	if f.startxref < 0 {
+		rows[0] = row{0, 0, 65535}
+		for num, entry := range f.xref {
+			switch {
+			case entry.compressed:
+				rows[num] = row{2, entry.stream, entry.index}
+			case entry.offset >= 0:
+				rows[num] = row{1, entry.offset, entry.gen}
+			}
+		}
+	}
+	for _, num := range nums {
+		rows[num] = row{1, offsets[num], u.gens[num]}
+	}
+	self := u.next
+	u.next++
+	xrefOffset := base + buf.Len()
+	rows[self] = row{1, xrefOffset, 0}
+
+	all := make([]int, 0, len(rows))
+	for num := range rows {
+		all = append(all, num)
+	}
+	sort.Ints(all)
+	width := 1
+	for _, num := range all {
+		for rows[num].field2 >= 1<<(8*width) {
+			width++
+		}
+	}
+	var data []byte
+	index := pdfArray{}
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j] == all[j-1]+1 {
+			j++
+		}
+		index = append(index, all[i], j-i)
+		for _, num := range all[i:j] {
+			r := rows[num]
+			data = append(data, byte(r.kind))
+			for b := width - 1; b >= 0; b-- {
+				data = append(data, byte(r.field2>>(8*b)))
+			}
+			data = append(data, byte(r.field3>>8), byte(r.field3))
+		}
+		i = j
+	}
+
+	dict := pdfDict{"Type": pdfName("XRef"), "Size": u.next, "W": pdfArray{1, width, 2}, "Index": index}
+	for k, v := range trailer {
+		dict[k] = v
+	}
+	fmt.Fprintf(buf, "%d 0 obj\n", self)
+	writePDFObject(buf, flateStream(dict, data))
+	fmt.Fprintf(buf, "\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+}
@@ -0,0 +1,105 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// placement 单个水印（非平铺）的定位参数
+type placement struct {
+	pos            WatermarkPos
+	offsetX        int
+	offsetY        int
+	offsetXPercent float64
+	offsetYPercent float64
+	anchorX        float64
+	anchorY        float64
+}
+
+// placement 提取图片水印的定位参数
+func (c ImageWatermarkConfig) placement() placement {
+	return placement{
+		pos:            c.WatermarkPos,
+		offsetX:        c.OffsetX,
+		offsetY:        c.OffsetY,
+		offsetXPercent: c.OffsetXPercent,
+		offsetYPercent: c.OffsetYPercent,
+		anchorX:        c.AnchorX,
+		anchorY:        c.AnchorY,
+	}
+}
+
+// placement 提取文字水印的定位参数
+func (c TransparentTextWatermarkConfig) placement() placement {
+	return placement{
+		pos:            c.WatermarkPos,
+		offsetX:        c.OffsetX,
+		offsetY:        c.OffsetY,
+		offsetXPercent: c.OffsetXPercent,
+		offsetYPercent: c.OffsetYPercent,
+		anchorX:        c.AnchorX,
+		anchorY:        c.AnchorY,
+	}
+}
+
+// anchor 返回水印位置对应的锚点比例，0表示左/上边缘，0.5表示居中，1表示右/下边缘
+func (p placement) anchor() (float64, float64, error) {
+	switch p.pos {
+	case LeftTop:
+		return 0, 0, nil
+	case TopCenter:
+		return 0.5, 0, nil
+	case RightTop:
+		return 1, 0, nil
+	case LeftCenter:
+		return 0, 0.5, nil
+	case Center:
+		return 0.5, 0.5, nil
+	case RightCenter:
+		return 1, 0.5, nil
+	case LeftBottom:
+		return 0, 1, nil
+	case BottomCenter:
+		return 0.5, 1, nil
+	case RightBottom:
+		return 1, 1, nil
+	case Relative:
+		if p.anchorX < 0 || p.anchorX > 1 || p.anchorY < 0 || p.anchorY > 1 {
+			return 0, 0, errors.New("watermark anchor error: Ensure 0.0 <= anchor <= 1.0")
+		}
+		return p.anchorX, p.anchorY, nil
+	}
+	return 0, 0, errors.New("watermark position error")
+}
+
+// point 计算水印左上角在画布上的坐标
+// 水印上与锚点比例相同的点对齐到画布的锚点，偏移量从锚定的边缘向内计算，居中时向右/下为正
+func (p placement) point(canvasW, canvasH, markW, markH int) (image.Point, error) {
+	x, y, err := p.pointF(float64(canvasW), float64(canvasH), float64(markW), float64(markH))
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Pt(int(math.Round(x)), int(math.Round(y))), nil
+}
+
+// pointF 以浮点数计算水印左上角坐标，用于PDF等非像素坐标
+func (p placement) pointF(canvasW, canvasH, markW, markH float64) (float64, float64, error) {
+	ax, ay, err := p.anchor()
+	if err != nil {
+		return 0, 0, err
+	}
+	offsetX := float64(p.offsetX) + p.offsetXPercent*canvasW/100
+	offsetY := float64(p.offsetY) + p.offsetYPercent*canvasH/100
+	x := ax*(canvasW-markW) + offsetDirection(ax)*offsetX
+	y := ay*(canvasH-markH) + offsetDirection(ay)*offsetY
+	return x, y, nil
+}
+
+// offsetDirection 贴近右/下边缘时偏移量向内（负方向），否则向正方向
+func offsetDirection(anchor float64) float64 {
+	if anchor > 0.5 {
+		return -1
+	}
+	return 1
+}
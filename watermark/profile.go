@@ -0,0 +1,652 @@
+package watermark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 水印配置文件的图层类型
+const (
+	LayerImage = "image" // 图片水印图层
+	LayerText  = "text"  // 文字水印图层
+)
+
+// Profile 水印配置文件，按顺序描述多个叠加的水印图层，可从JSON或YAML加载
+// 输出、EXIF、GIF和模板变量选项对所有图层生效，模板中${date}的时间为渲染时的当前时间
+type Profile struct {
+	Name           string            `json:"name"`             // 配置名称
+	Layers         []ProfileLayer    `json:"layers"`           // 水印图层，按顺序从下到上叠加
+	Output         *ProfileOutput    `json:"output"`           // 输出格式及编码质量
+	AutoOrient     bool              `json:"auto_orient"`      // 是否根据EXIF方向信息自动旋转原图
+	KeepMetadata   bool              `json:"keep_metadata"`    // 是否将原图的EXIF、ICC和XMP元数据写入JPEG输出
+	FirstFrameOnly bool              `json:"first_frame_only"` // GIF动图只处理第一帧并输出静态图片
+	Variables      map[string]string `json:"variables"`        // 文字模板变量，优先于内置变量
+	BaseDir        string            `json:"-"`                // 相对路径的基准目录，LoadProfile时为配置文件所在目录
+
+	mu    sync.Mutex
+	marks map[string]image.Image // 已解码的水印图，按路径缓存
+}
+
+// ProfileLayer 配置文件中的一个水印图层，Type为image时使用图片相关字段，为text时使用文字相关字段
+// 颜色使用十六进制字符串，如 "#FFF"、"#FFFFFF80"，或预设颜色名 black、white、red、green、blue
+type ProfileLayer struct {
+	Type           string       `json:"type"`             // 图层类型：image 或 text
+	Position       WatermarkPos `json:"position"`         // 水印位置
+	OffsetX        int          `json:"offset_x"`         // 偏移量X
+	OffsetY        int          `json:"offset_y"`         // 偏移量Y
+	OffsetXPercent float64      `json:"offset_x_percent"` // 偏移量X，原图宽度的百分比
+	OffsetYPercent float64      `json:"offset_y_percent"` // 偏移量Y，原图高度的百分比
+	AnchorX        float64      `json:"anchor_x"`         // 锚点X比例（仅relative位置）
+	AnchorY        float64      `json:"anchor_y"`         // 锚点Y比例（仅relative位置）
+	Opacity        float64      `json:"opacity"`          // 透明度 0-1，为0时不透明
+	Blend          BlendMode    `json:"blend"`            // 混合模式
+	TiledRows      int          `json:"tiled_rows"`       // 平铺行数
+	TiledCols      int          `json:"tiled_cols"`       // 平铺列数
+	Tile           *ProfileTile `json:"tile"`             // 平铺图案
+	FrameOffset    *ProfileMove `json:"frame_offset"`     // GIF动图中水印偏移量的移动轨迹
+
+	Image        string         `json:"image"`         // 水印图路径
+	Scale        ScaleMode      `json:"scale"`         // 缩放模式
+	ScaleWidth   int            `json:"scale_width"`   // 固定缩放宽度
+	ScaleHeight  int            `json:"scale_height"`  // 固定缩放高度
+	ScalePercent float64        `json:"scale_percent"` // 长边占原图短边/长边的百分比
+	MinSize      int            `json:"min_size"`      // 缩放后长边的最小像素
+	MaxSize      int            `json:"max_size"`      // 缩放后长边的最大像素
+	Filter       ResampleFilter `json:"filter"`        // 重采样滤波器
+
+	Text          string             `json:"text"`           // 文字内容
+	Font          string             `json:"font"`           // 字体路径或已注册的字体名，为空时使用默认字体
+	FontFallbacks []string           `json:"font_fallbacks"` // 后备字体
+	Size          float64            `json:"size"`           // 字号
+	Color         string             `json:"color"`          // 文字颜色
+	Rotation      float64            `json:"rotation"`       // 旋转角度
+	Align         TextAlign          `json:"align"`          // 多行对齐方式
+	LineSpacing   float64            `json:"line_spacing"`   // 行距倍数
+	AutoFit       float64            `json:"auto_fit"`       // 自动字号，文字宽度占原图宽度的比例
+	Stroke        *ProfileStroke     `json:"stroke"`         // 描边
+	Shadow        *ProfileShadow     `json:"shadow"`         // 投影
+	Background    *ProfileBackground `json:"background"`     // 背景框
+	Gradient      *ProfileGradient   `json:"gradient"`       // 渐变填充
+}
+
+// ProfileTile 平铺图案，对应TilePattern
+type ProfileTile struct {
+	SpacingX float64     `json:"spacing_x"`
+	SpacingY float64     `json:"spacing_y"`
+	Unit     SpacingUnit `json:"unit"`
+	Stagger  float64     `json:"stagger"`
+	Rotation float64     `json:"rotation"`
+}
+
+// ProfileMove 水印在GIF动图中从起点偏移量匀速移动到终点偏移量，对应LinearFrameOffset
+type ProfileMove struct {
+	FromX int `json:"from_x"`
+	FromY int `json:"from_y"`
+	ToX   int `json:"to_x"`
+	ToY   int `json:"to_y"`
+}
+
+// ProfileOutput 输出选项，对应OutputOptions
+// PNGCompression为default、none、best_speed或best_compression
+type ProfileOutput struct {
+	Format          OutputFormat `json:"format"`
+	KeepInputFormat bool         `json:"keep_input_format"`
+	JPEGQuality     int          `json:"jpeg_quality"`
+	PNGCompression  string       `json:"png_compression"`
+}
+
+// pngCompressionLevels 配置中的PNG压缩级别名称
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"":                 png.DefaultCompression,
+	"default":          png.DefaultCompression,
+	"none":             png.NoCompression,
+	"best_speed":       png.BestSpeed,
+	"best_compression": png.BestCompression,
+}
+
+// ProfileStroke 文字描边，对应TextStroke
+type ProfileStroke struct {
+	Width int    `json:"width"`
+	Color string `json:"color"`
+}
+
+// ProfileShadow 文字投影，对应TextShadow
+type ProfileShadow struct {
+	OffsetX int     `json:"offset_x"`
+	OffsetY int     `json:"offset_y"`
+	Blur    float64 `json:"blur"`
+	Color   string  `json:"color"`
+}
+
+// ProfileBackground 文字背景框，对应TextBackground
+type ProfileBackground struct {
+	Padding int     `json:"padding"`
+	Radius  int     `json:"radius"`
+	Color   string  `json:"color"`
+	Opacity float64 `json:"opacity"`
+}
+
+// ProfileGradient 文字渐变填充，对应TextGradient
+type ProfileGradient struct {
+	From  string  `json:"from"`
+	To    string  `json:"to"`
+	Angle float64 `json:"angle"`
+}
+
+// ProfileError 配置文件中单个字段的错误
+type ProfileError struct {
+	Field   string // 字段路径，如 layers[1].color
+	Message string
+}
+
+func (e *ProfileError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// ProfileErrors 配置文件校验发现的所有错误
+type ProfileErrors []*ProfileError
+
+func (e ProfileErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid watermark profile:\n" + strings.Join(msgs, "\n")
+}
+
+// LoadProfile 从文件加载配置，按扩展名识别JSON（.json）或YAML（.yaml/.yml）格式
+// 配置中的相对路径以配置文件所在目录为基准
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profile *Profile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		profile, err = ParseProfileJSON(data)
+	case ".yaml", ".yml":
+		profile, err = ParseProfileYAML(data)
+	default:
+		return nil, fmt.Errorf("unsupported profile format: %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	profile.BaseDir = filepath.Dir(path)
+	return profile, nil
+}
+
+// ParseProfileJSON 解析并校验JSON格式的配置
+func ParseProfileJSON(data []byte) (*Profile, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	profile := &Profile{}
+	if err := dec.Decode(profile); err != nil {
+		return nil, profileDecodeError(err)
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// ParseProfileYAML 解析并校验YAML格式的配置
+// 只支持README中列出的YAML子集，锚点、行内映射、折叠文本等不支持的语法返回带行号的错误；以#开头的颜色值需要加引号
+func ParseProfileYAML(data []byte) (*Profile, error) {
+	tree, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProfileJSON(jsonData)
+}
+
+// profileDecodeError 将JSON解码错误转换为字段错误
+func profileDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return ProfileErrors{{Field: typeErr.Field, Message: "expected " + typeErr.Type.String() + ", got " + typeErr.Value}}
+	}
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		return ProfileErrors{{Field: strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`), Message: "unknown field"}}
+	}
+	return ProfileErrors{{Message: err.Error()}}
+}
+
+// profileValidator 收集校验错误
+type profileValidator struct {
+	errs ProfileErrors
+}
+
+// add 记录一个字段错误
+func (v *profileValidator) add(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ProfileError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// color 校验颜色字段，为空时返回默认颜色
+func (v *profileValidator) color(field, value string, def color.RGBA) color.RGBA {
+	if value == "" {
+		return def
+	}
+	c, err := ParseHexColor(value)
+	if err != nil {
+		v.add(field, "%v", err)
+	}
+	return c
+}
+
+// unit 校验0-1之间的比例
+func (v *profileValidator) unit(field string, value float64) {
+	if value < 0 || value > 1 {
+		v.add(field, "must be between 0 and 1")
+	}
+}
+
+// Validate 校验配置，返回的错误为ProfileErrors，包含所有字段错误
+func (p *Profile) Validate() error {
+	v := &profileValidator{}
+	if len(p.Layers) == 0 {
+		v.add("layers", "at least one layer is required")
+	}
+	for i, layer := range p.Layers {
+		layer.validate(v, fmt.Sprintf("layers[%d].", i))
+	}
+	if o := p.Output; o != nil {
+		switch o.Format {
+		case FormatAuto, FormatJPEG, FormatPNG, FormatGIF, FormatBMP, FormatTIFF:
+		default:
+			v.add("output.format", "unknown output format %q", o.Format)
+		}
+		if o.JPEGQuality < 0 || o.JPEGQuality > 100 {
+			v.add("output.jpeg_quality", "must be between 0 and 100")
+		}
+		if _, ok := pngCompressionLevels[o.PNGCompression]; !ok {
+			v.add("output.png_compression", "unknown png compression %q, expected default, none, best_speed or best_compression", o.PNGCompression)
+		}
+	}
+	for name := range p.Variables {
+		if name == "" || strings.ContainsAny(name, "}:") {
+			v.add("variables."+name, "invalid variable name %q", name)
+		}
+	}
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// OutputOptions 返回配置中的输出选项，未配置时使用默认值
+func (p *Profile) OutputOptions() OutputOptions {
+	if p.Output == nil {
+		return OutputOptions{}
+	}
+	return OutputOptions{
+		Format:          p.Output.Format,
+		KeepInputFormat: p.Output.KeepInputFormat,
+		JPEGQuality:     p.Output.JPEGQuality,
+		PNGCompression:  pngCompressionLevels[p.Output.PNGCompression],
+	}
+}
+
+// gifOptions 返回图层的GIF动图选项
+func (p *Profile) gifOptions(l ProfileLayer) GIFOptions {
+	options := GIFOptions{FirstFrameOnly: p.FirstFrameOnly}
+	if m := l.FrameOffset; m != nil {
+		options.FrameOffset = LinearFrameOffset(m.FromX, m.FromY, m.ToX, m.ToY)
+	}
+	return options
+}
+
+// validate 校验单个图层
+func (l ProfileLayer) validate(v *profileValidator, prefix string) {
+	switch l.Position {
+	case LeftTop, RightTop, LeftBottom, RightBottom, Center, TopCenter, BottomCenter, LeftCenter, RightCenter:
+	case Relative:
+		v.unit(prefix+"anchor_x", l.AnchorX)
+		v.unit(prefix+"anchor_y", l.AnchorY)
+	case Tiled:
+		if l.Tile == nil && (l.TiledRows <= 0 || l.TiledCols <= 0) {
+			v.add(prefix+"tile", "tiled position needs tile or tiled_rows and tiled_cols")
+		}
+	case "":
+		v.add(prefix+"position", "is required")
+	default:
+		v.add(prefix+"position", "unknown position %q", l.Position)
+	}
+	v.unit(prefix+"opacity", l.Opacity)
+	if err := l.Blend.validate(); err != nil {
+		v.add(prefix+"blend", "unknown blend mode %q", l.Blend)
+	}
+	if t := l.Tile; t != nil {
+		if t.SpacingX < 0 || t.SpacingY < 0 {
+			v.add(prefix+"tile", "spacing must be >= 0")
+		}
+		if t.Unit != SpacingPixel && t.Unit != SpacingPercent {
+			v.add(prefix+"tile.unit", "unknown spacing unit %q", t.Unit)
+		}
+		v.unit(prefix+"tile.stagger", t.Stagger)
+	}
+
+	switch l.Type {
+	case LayerImage:
+		l.validateImage(v, prefix)
+	case LayerText:
+		l.validateText(v, prefix)
+	case "":
+		v.add(prefix+"type", "is required")
+	default:
+		v.add(prefix+"type", "unknown layer type %q, expected image or text", l.Type)
+	}
+}
+
+// validateImage 校验图片图层的字段
+func (l ProfileLayer) validateImage(v *profileValidator, prefix string) {
+	if l.Image == "" {
+		v.add(prefix+"image", "is required")
+	}
+	switch l.Scale {
+	case ScaleDefault, ScaleNone:
+	case ScaleFixed:
+		if l.ScaleWidth <= 0 && l.ScaleHeight <= 0 {
+			v.add(prefix+"scale_width", "fixed scale needs scale_width or scale_height")
+		}
+	case ScaleShortEdge, ScaleLongEdge:
+		if l.ScalePercent <= 0 {
+			v.add(prefix+"scale_percent", "must be > 0")
+		}
+	default:
+		v.add(prefix+"scale", "unknown scale mode %q", l.Scale)
+	}
+	if l.MinSize < 0 || l.MaxSize < 0 || (l.MaxSize > 0 && l.MinSize > l.MaxSize) {
+		v.add(prefix+"max_size", "must be >= min_size >= 0")
+	}
+	switch l.Filter {
+	case FilterLanczos, FilterCatmullRom, FilterLinear, FilterBox, FilterNearest:
+	default:
+		v.add(prefix+"filter", "unknown resample filter %q", l.Filter)
+	}
+}
+
+// validateText 校验文字图层的字段
+func (l ProfileLayer) validateText(v *profileValidator, prefix string) {
+	if l.Text == "" {
+		v.add(prefix+"text", "is required")
+	}
+	if l.Size <= 0 && l.AutoFit == 0 {
+		v.add(prefix+"size", "must be > 0 unless auto_fit is set")
+	}
+	v.unit(prefix+"auto_fit", l.AutoFit)
+	if l.LineSpacing < 0 {
+		v.add(prefix+"line_spacing", "must be >= 0")
+	}
+	switch l.Align {
+	case AlignLeft, AlignCenter, AlignRight:
+	default:
+		v.add(prefix+"align", "unknown align %q", l.Align)
+	}
+	v.color(prefix+"color", l.Color, Black)
+	if s := l.Stroke; s != nil {
+		if s.Width < 0 {
+			v.add(prefix+"stroke.width", "must be >= 0")
+		}
+		v.color(prefix+"stroke.color", s.Color, Black)
+	}
+	if s := l.Shadow; s != nil {
+		if s.Blur < 0 {
+			v.add(prefix+"shadow.blur", "must be >= 0")
+		}
+		v.color(prefix+"shadow.color", s.Color, Black)
+	}
+	if b := l.Background; b != nil {
+		if b.Padding < 0 {
+			v.add(prefix+"background.padding", "must be >= 0")
+		}
+		if b.Radius < 0 {
+			v.add(prefix+"background.radius", "must be >= 0")
+		}
+		v.unit(prefix+"background.opacity", b.Opacity)
+		v.color(prefix+"background.color", b.Color, White)
+	}
+	if g := l.Gradient; g != nil {
+		if g.From == "" {
+			v.add(prefix+"gradient.from", "is required")
+		}
+		if g.To == "" {
+			v.add(prefix+"gradient.to", "is required")
+		}
+		v.color(prefix+"gradient.from", g.From, Black)
+		v.color(prefix+"gradient.to", g.To, Black)
+	}
+}
+
+// tilePattern 转换平铺图案
+func (l ProfileLayer) tilePattern() *TilePattern {
+	if l.Tile == nil {
+		return nil
+	}
+	return &TilePattern{
+		SpacingX:    l.Tile.SpacingX,
+		SpacingY:    l.Tile.SpacingY,
+		SpacingUnit: l.Tile.Unit,
+		Stagger:     l.Tile.Stagger,
+		Rotation:    l.Tile.Rotation,
+	}
+}
+
+// ImageConfig 将图片图层转换为ImageWatermarkConfig，WatermarkImagePath已按BaseDir解析
+func (p *Profile) ImageConfig(l ProfileLayer) ImageWatermarkConfig {
+	return ImageWatermarkConfig{
+		WatermarkImagePath: p.resolvePath(l.Image),
+		WatermarkPos:       l.Position,
+		OffsetX:            l.OffsetX,
+		OffsetY:            l.OffsetY,
+		OffsetXPercent:     l.OffsetXPercent,
+		OffsetYPercent:     l.OffsetYPercent,
+		AnchorX:            l.AnchorX,
+		AnchorY:            l.AnchorY,
+		Opacity:            l.Opacity,
+		BlendMode:          l.Blend,
+		TiledRows:          l.TiledRows,
+		TiledCols:          l.TiledCols,
+		TilePattern:        l.tilePattern(),
+		ScaleMode:          l.Scale,
+		ScaleWidth:         l.ScaleWidth,
+		ScaleHeight:        l.ScaleHeight,
+		ScalePercent:       l.ScalePercent,
+		MinWatermarkSize:   l.MinSize,
+		MaxWatermarkSize:   l.MaxSize,
+		ResampleFilter:     l.Filter,
+		Output:             p.OutputOptions(),
+		AutoOrient:         p.AutoOrient,
+		KeepMetadata:       p.KeepMetadata,
+		GIF:                p.gifOptions(l),
+	}
+}
+
+// TextConfig 将文字图层转换为TransparentTextWatermarkConfig，字体路径已按BaseDir解析
+// 图层需先通过Validate校验，颜色无效时使用默认颜色
+func (p *Profile) TextConfig(l ProfileLayer) TransparentTextWatermarkConfig {
+	v := &profileValidator{}
+	config := TransparentTextWatermarkConfig{
+		FontPath:       p.resolveFont(l.Font),
+		Text:           l.Text,
+		Size:           l.Size,
+		Color:          v.color("", l.Color, Black),
+		WatermarkPos:   l.Position,
+		OffsetX:        l.OffsetX,
+		OffsetY:        l.OffsetY,
+		OffsetXPercent: l.OffsetXPercent,
+		OffsetYPercent: l.OffsetYPercent,
+		AnchorX:        l.AnchorX,
+		AnchorY:        l.AnchorY,
+		Opacity:        l.Opacity,
+		BlendMode:      l.Blend,
+		TiledRows:      l.TiledRows,
+		TiledCols:      l.TiledCols,
+		TilePattern:    l.tilePattern(),
+		Rotation:       l.Rotation,
+		Align:          l.Align,
+		LineSpacing:    l.LineSpacing,
+		AutoFit:        l.AutoFit,
+		Output:         p.OutputOptions(),
+		AutoOrient:     p.AutoOrient,
+		KeepMetadata:   p.KeepMetadata,
+		GIF:            p.gifOptions(l),
+	}
+	if len(p.Variables) > 0 {
+		config.Variables = make(map[string]interface{}, len(p.Variables))
+		for name, value := range p.Variables {
+			config.Variables[name] = value
+		}
+	}
+	for _, ref := range l.FontFallbacks {
+		config.FontFallbacks = append(config.FontFallbacks, p.resolveFont(ref))
+	}
+	if s := l.Stroke; s != nil {
+		config.Stroke = &TextStroke{Width: s.Width, Color: v.color("", s.Color, Black)}
+	}
+	if s := l.Shadow; s != nil {
+		config.Shadow = &TextShadow{OffsetX: s.OffsetX, OffsetY: s.OffsetY, Blur: s.Blur, Color: v.color("", s.Color, Black)}
+	}
+	if b := l.Background; b != nil {
+		config.Background = &TextBackground{Padding: b.Padding, Radius: b.Radius, Color: v.color("", b.Color, White), Opacity: b.Opacity}
+	}
+	if g := l.Gradient; g != nil {
+		config.Gradient = &TextGradient{From: v.color("", g.From, Black), To: v.color("", g.To, Black), Angle: g.Angle}
+	}
+	return config
+}
+
+// resolvePath 将相对路径解析为相对于BaseDir的路径
+func (p *Profile) resolvePath(path string) string {
+	if path == "" || p.BaseDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(p.BaseDir, path)
+}
+
+// resolveFont 解析字体引用，相对于BaseDir的文件存在时使用该文件，否则视为已注册的字体名或原路径
+func (p *Profile) resolveFont(ref string) string {
+	if resolved := p.resolvePath(ref); resolved != ref {
+		if _, err := os.Stat(resolved); err == nil {
+			return resolved
+		}
+	}
+	return ref
+}
+
+// watermarkImage 加载并缓存图片图层的水印图
+func (p *Profile) watermarkImage(path string) (image.Image, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if img, ok := p.marks[path]; ok {
+		return img, nil
+	}
+	img, err := loadWatermarkImage(path)
+	if err != nil {
+		return nil, err
+	}
+	if p.marks == nil {
+		p.marks = make(map[string]image.Image)
+	}
+	p.marks[path] = img
+	return img, nil
+}
+
+// WatermarkLayers 将配置转换为水印图层，图片图层的水印图只加载一次
+func (p *Profile) WatermarkLayers() ([]Layer, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	layers := make([]Layer, len(p.Layers))
+	for i, layer := range p.Layers {
+		if layer.Type == LayerText {
+			layers[i] = TextLayer(p.TextConfig(layer))
+			continue
+		}
+		config := p.ImageConfig(layer)
+		mark, err := p.watermarkImage(config.WatermarkImagePath)
+		if err != nil {
+			return nil, fmt.Errorf("layers[%d]: %w", i, err)
+		}
+		layers[i] = ImageLayer(mark, config)
+	}
+	return layers, nil
+}
+
+// LayeredConfig 将配置转换为多图层水印配置，包含配置中的输出、EXIF和GIF选项
+func (p *Profile) LayeredConfig(originPath, compositePath string) (LayeredWatermarkConfig, error) {
+	layers, err := p.WatermarkLayers()
+	if err != nil {
+		return LayeredWatermarkConfig{}, err
+	}
+	return LayeredWatermarkConfig{
+		OriginImagePath:    originPath,
+		CompositeImagePath: compositePath,
+		Layers:             layers,
+		Output:             p.OutputOptions(),
+		AutoOrient:         p.AutoOrient,
+		KeepMetadata:       p.KeepMetadata,
+		FirstFrameOnly:     p.FirstFrameOnly,
+	}, nil
+}
+
+// Apply 在同一张画布上按顺序叠加所有水印图层，可并发调用
+func (p *Profile) Apply(img image.Image) (image.Image, error) {
+	layers, err := p.WatermarkLayers()
+	if err != nil {
+		return nil, err
+	}
+	return AddWatermarkLayers(img, layers)
+}
+
+// ParseHexColor 解析十六进制颜色（#RGB、#RGBA、#RRGGBB、#RRGGBBAA，#可省略）或预设颜色名
+func ParseHexColor(s string) (color.RGBA, error) {
+	switch strings.ToLower(s) {
+	case "black":
+		return Black, nil
+	case "white":
+		return White, nil
+	case "red":
+		return Red, nil
+	case "green":
+		return Green, nil
+	case "blue":
+		return Blue, nil
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 || len(hex) == 4 {
+		var expanded strings.Builder
+		for _, c := range hex {
+			expanded.WriteString(strings.Repeat(string(c), 2))
+		}
+		hex = expanded.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #RGB, #RGBA, #RRGGBB or #RRGGBBAA", s)
+	}
+	// 十六进制颜色为非预乘值，转换为预乘的color.RGBA
+	c := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
+}
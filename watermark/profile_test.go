@@ -0,0 +1,227 @@
+package watermark
+
+import (
+	"errors"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestParseYAML(t *testing.T) {
+	src := `# 注释
+name: demo   # 行尾注释
+list:
+- 1
+- "two # not a comment"
+- [a, 'b c', 3.5]
+nested:
+  - key: value
+    other: true
+  -
+    key: ~
+text: |
+  line one
+    indented
+
+  line three
+empty:
+`
+	got, err := parseYAML([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name": "demo",
+		"list": []interface{}{1.0, "two # not a comment", []interface{}{"a", "b c", 3.5}},
+		"nested": []interface{}{
+			map[string]interface{}{"key": "value", "other": true},
+			map[string]interface{}{"key": nil},
+		},
+		"text":  "line one\n  indented\n\nline three\n",
+		"empty": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML =\n%#v\nwant\n%#v", got, want)
+	}
+
+	for _, bad := range []string{"a: 1\n  b: 2", "a: 1\na: 2", "a: \"open", "\ta: 1", "just text"} {
+		if _, err := parseYAML([]byte(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseYAMLUnsupported(t *testing.T) {
+	tests := []struct {
+		name, src, feature string
+	}{
+		{"anchor", "base: &base\n  size: 12\n", "anchors"},
+		{"alias", "a: 1\nb: *a\n", "aliases"},
+		{"sequence anchor", "list:\n  - &x item\n", "anchors"},
+		{"tag", "size: !!int 12\n", "tags"},
+		{"flow mapping", "tile: {spacing_x: 10}\n", "flow mappings"},
+		{"flow mapping item", "layers:\n  - {type: text}\n", "flow mappings"},
+		{"nested flow", "list: [[1, 2], 3]\n", "nested flow collections"},
+		{"folded", "text: >\n  a\n  b\n", "folded block scalars"},
+		{"keep literal", "text: |+\n  a\n", "block scalar indicators"},
+		{"multi-line plain", "text: first line\n  continued\n", "multi-line scalars"},
+		{"merge key", "a:\n  <<: x\n", "merge keys"},
+		{"complex key", "? a\n: b\n", "complex mapping keys"},
+		{"directive", "%YAML 1.2\n---\na: 1\n", "directives"},
+		{"multiple documents", "a: 1\n---\nb: 2\n", "multiple documents"},
+		{"anchored key", "&k key: 1\n", "mapping keys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.src))
+			if !errors.Is(err, errYAMLUnsupported) || !strings.Contains(err.Error(), tt.feature) {
+				t.Errorf("parseYAML(%q) error = %v, want unsupported %s", tt.src, err, tt.feature)
+			}
+		})
+	}
+
+	// 引号内的特殊字符不受影响
+	got, err := parseYAML([]byte("a: \"&not anchor\"\nb: '{x: 1}'\nc: ['[1]', \"*\"]\n"))
+	want := map[string]interface{}{"a": "&not anchor", "b": "{x: 1}", "c": []interface{}{"[1]", "*"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("quoted indicators = %#v, %v", got, err)
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	cases := map[string]color.RGBA{
+		"#fff":      White,
+		"#FF0000":   Red,
+		"00ff00":    Green,
+		"blue":      Blue,
+		"#00000080": {0, 0, 0, 128},
+		"#F008":     {136, 0, 0, 136},
+	}
+	for s, want := range cases {
+		if got, err := ParseHexColor(s); err != nil || got != want {
+			t.Errorf("ParseHexColor(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "#12", "#GGGGGG", "#1234567"} {
+		if _, err := ParseHexColor(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	dir := t.TempDir()
+	if err := imaging.Save(imaging.New(40, 20, Red), filepath.Join(dir, "logo.png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "font.ttf"), goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	yaml := `name: shop
+output:
+  format: jpeg
+  jpeg_quality: 85
+auto_orient: true
+keep_metadata: true
+variables:
+  shop: "© Shop"
+layers:
+  - type: image
+    image: logo.png        # 相对于配置文件目录
+    position: left_top
+    scale: none
+    frame_offset:
+      to_x: 10
+  - type: text
+    text: "${shop}"
+    font: font.ttf
+    size: 24
+    color: "#0000FF"
+    position: right_bottom
+    offset_x: 5
+    offset_y: 5
+    stroke:
+      width: 1
+      color: white
+`
+	path := filepath.Join(dir, "profile.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := LoadProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profile.Layers) != 2 || profile.Layers[1].Stroke == nil || profile.Layers[1].Stroke.Width != 1 {
+		t.Fatalf("layers = %+v", profile.Layers)
+	}
+	imageConfig, textConfig := profile.ImageConfig(profile.Layers[0]), profile.TextConfig(profile.Layers[1])
+	if imageConfig.Output.Format != FormatJPEG || imageConfig.Output.JPEGQuality != 85 || !imageConfig.AutoOrient || !textConfig.KeepMetadata {
+		t.Errorf("output options = %+v, auto orient %v, keep metadata %v", imageConfig.Output, imageConfig.AutoOrient, textConfig.KeepMetadata)
+	}
+	if move := imageConfig.GIF.FrameOffset; move == nil || textConfig.GIF.FrameOffset != nil {
+		t.Error("frame offset should only be set on the image layer")
+	} else if dx, _ := move(2, 3); dx != 10 {
+		t.Errorf("last frame offset = %d", dx)
+	}
+	if textConfig.Variables["shop"] != "© Shop" {
+		t.Errorf("variables = %v", textConfig.Variables)
+	}
+	if layered, err := profile.LayeredConfig("in.jpg", "out.jpg"); err != nil || len(layered.Layers) != 2 || layered.Output.JPEGQuality != 85 || !layered.KeepMetadata {
+		t.Errorf("layered config = %+v, %v", layered, err)
+	}
+	img, err := profile.Apply(imaging.New(300, 200, color.White))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, _, _ := img.At(10, 10).RGBA(); r>>8 != 255 || g>>8 != 0 {
+		t.Error("image layer missing")
+	}
+	blue := 0
+	for y := 150; y < 200; y++ {
+		for x := 200; x < 300; x++ {
+			if r, _, b, _ := img.At(x, y).RGBA(); b>>8 > 200 && r>>8 < 100 {
+				blue++
+			}
+		}
+	}
+	if blue == 0 {
+		t.Error("text layer missing")
+	}
+
+	jsonProfile := `{"layers": [
+		{"type": "image", "position": "middle"},
+		{"type": "text", "text": "x", "size": 12, "color": "#ZZZ", "opacity": 2, "background": {"color": "#12"}},
+		{"type": "video", "position": "center"}
+	], "output": {"format": "webp", "jpeg_quality": 101, "png_compression": "max"}, "variables": {"a}": "x"}}`
+	_, err = ParseProfileJSON([]byte(jsonProfile))
+	var errs ProfileErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ProfileErrors, got %v", err)
+	}
+	fields := map[string]bool{}
+	for _, e := range errs {
+		fields[e.Field] = true
+	}
+	for _, field := range []string{"layers[0].position", "layers[0].image", "layers[1].color", "layers[1].opacity", "layers[1].background.color", "layers[1].position", "layers[2].type",
+		"output.format", "output.jpeg_quality", "output.png_compression", "variables.a}"} {
+		if !fields[field] {
+			t.Errorf("missing error for %s in:\n%v", field, err)
+		}
+	}
+
+	_, err = ParseProfileJSON([]byte(`{"layers": [{"type": "text", "colour": "#fff"}]}`))
+	if !errors.As(err, &errs) || errs[0].Field != "colour" {
+		t.Errorf("unknown field error = %v", err)
+	}
+	_, err = ParseProfileYAML([]byte("layers:\n  - type: text\n    size: big\n"))
+	if !errors.As(err, &errs) || !strings.HasSuffix(errs[0].Field, "size") {
+		t.Errorf("type error = %v", err)
+	}
+}
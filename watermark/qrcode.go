@@ -0,0 +1,551 @@
+package watermark
+
+import (
+	"errors"
+	"strings"
+)
+
+// 二维码（QR Code Model 2）编码器，支持版本1-40、L/M/Q/H四个纠错级别，
+// 自动选择数字、字母数字或字节模式及最小版本，并按惩罚分选择最佳掩码
+
+// QRLevel 二维码纠错级别
+type QRLevel string
+
+const (
+	QRLevelL QRLevel = "L" // 约7%的纠错能力
+	QRLevelM QRLevel = "M" // 约15%的纠错能力（默认）
+	QRLevelQ QRLevel = "Q" // 约25%的纠错能力
+	QRLevelH QRLevel = "H" // 约30%的纠错能力，适合水印被部分遮挡或透明度较低时
+)
+
+// index 返回纠错级别在表中的序号
+func (l QRLevel) index() (int, error) {
+	switch l {
+	case QRLevelL:
+		return 0, nil
+	case QRLevelM, "":
+		return 1, nil
+	case QRLevelQ:
+		return 2, nil
+	case QRLevelH:
+		return 3, nil
+	}
+	return 0, errors.New("qr code error correction level error: " + string(l))
+}
+
+// qrFormatBits 格式信息中纠错级别的编码，顺序为L、M、Q、H
+var qrFormatBits = [4]int{1, 0, 3, 2}
+
+// qrECCPerBlock 每个块的纠错码字数，按纠错级别和版本索引
+var qrECCPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// qrBlocks 纠错块数，按纠错级别和版本索引
+var qrBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// qrAlphanumeric 字母数字模式的字符集
+const qrAlphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// qrMode 数据编码模式
+type qrMode struct {
+	indicator int
+	countBits [3]int // 版本1-9、10-26、27-40的字符数位数
+}
+
+var (
+	qrModeNumeric      = qrMode{0x1, [3]int{10, 12, 14}}
+	qrModeAlphanumeric = qrMode{0x2, [3]int{9, 11, 13}}
+	qrModeByte         = qrMode{0x4, [3]int{8, 16, 16}}
+)
+
+// bits 返回指定版本下字符数的位数
+func (m qrMode) bits(version int) int {
+	switch {
+	case version <= 9:
+		return m.countBits[0]
+	case version <= 26:
+		return m.countBits[1]
+	}
+	return m.countBits[2]
+}
+
+// qrBitBuffer 按位写入的缓冲区
+type qrBitBuffer []bool
+
+// append 追加value的低n位，高位在前
+func (b *qrBitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 != 0)
+	}
+}
+
+// qrSegment 单一模式的数据段
+type qrSegment struct {
+	mode  qrMode
+	count int // 字符数（字节模式为字节数）
+	data  qrBitBuffer
+}
+
+// newQRSegment 为内容选择最紧凑的编码模式
+func newQRSegment(content string) qrSegment {
+	isNumeric := content != ""
+	isAlnum := content != ""
+	for _, r := range content {
+		if r < '0' || r > '9' {
+			isNumeric = false
+		}
+		if !strings.ContainsRune(qrAlphanumeric, r) {
+			isAlnum = false
+		}
+	}
+	var seg qrSegment
+	switch {
+	case isNumeric:
+		seg = qrSegment{mode: qrModeNumeric, count: len(content)}
+		for i := 0; i < len(content); i += 3 {
+			n := min(3, len(content)-i)
+			value := 0
+			for _, c := range content[i : i+n] {
+				value = value*10 + int(c-'0')
+			}
+			seg.data.append(value, n*3+1)
+		}
+	case isAlnum:
+		seg = qrSegment{mode: qrModeAlphanumeric, count: len(content)}
+		for i := 0; i+1 < len(content); i += 2 {
+			seg.data.append(strings.IndexByte(qrAlphanumeric, content[i])*45+strings.IndexByte(qrAlphanumeric, content[i+1]), 11)
+		}
+		if len(content)%2 == 1 {
+			seg.data.append(strings.IndexByte(qrAlphanumeric, content[len(content)-1]), 6)
+		}
+	default:
+		seg = qrSegment{mode: qrModeByte, count: len(content)}
+		for i := 0; i < len(content); i++ {
+			seg.data.append(int(content[i]), 8)
+		}
+	}
+	return seg
+}
+
+// qrCode 已编码的二维码矩阵
+type qrCode struct {
+	version  int
+	size     int
+	level    int
+	modules  [][]bool // true为深色模块
+	function [][]bool // 功能图形区域，不参与数据填充和掩码
+}
+
+// encodeQR 将内容编码为二维码，自动选择能容纳内容的最小版本
+func encodeQR(content string, level QRLevel) (*qrCode, error) {
+	ecl, err := level.index()
+	if err != nil {
+		return nil, err
+	}
+	seg := newQRSegment(content)
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if seg.count < 1<<seg.mode.bits(v) && 4+seg.mode.bits(v)+len(seg.data) <= qrDataCodewords(v, ecl)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errors.New("qr code content too long")
+	}
+
+	qr := &qrCode{version: version, size: version*4 + 17, level: ecl}
+	qr.modules = make([][]bool, qr.size)
+	qr.function = make([][]bool, qr.size)
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, qr.size)
+		qr.function[i] = make([]bool, qr.size)
+	}
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qr.addECCAndInterleave(qrDataBytes(seg, version, ecl)))
+
+	// 选择惩罚分最低的掩码
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask)
+	}
+	qr.applyMask(best)
+	qr.drawFormatBits(best)
+	return qr, nil
+}
+
+// qrDataBytes 生成数据码字：模式指示符、字符数、数据、终止符和填充
+func qrDataBytes(seg qrSegment, version, ecl int) []byte {
+	capacity := qrDataCodewords(version, ecl) * 8
+	var bits qrBitBuffer
+	bits.append(seg.mode.indicator, 4)
+	bits.append(seg.count, seg.mode.bits(version))
+	bits = append(bits, seg.data...)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	data := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			data[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return data
+}
+
+// qrRawDataModules 版本中可用于数据和纠错码的模块数
+func qrRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrDataCodewords 版本和纠错级别下的数据码字数
+func qrDataCodewords(version, ecl int) int {
+	return qrRawDataModules(version)/8 - qrECCPerBlock[ecl][version]*qrBlocks[ecl][version]
+}
+
+// qrAlignmentPositions 校正图形中心的坐标
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// set 设置功能图形模块
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFunctionPatterns 绘制定位、分隔符、定时、校正图形和版本信息，并预留格式信息区域
+func (q *qrCode) drawFunctionPatterns() {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	q.drawFinder(3, 3)
+	q.drawFinder(q.size-4, 3)
+	q.drawFinder(3, q.size-4)
+
+	align := qrAlignmentPositions(q.version)
+	for i, x := range align {
+		for j, y := range align {
+			// 与定位图形重叠的三个位置不绘制
+			if (i == 0 && j == 0) || (i == 0 && j == len(align)-1) || (i == len(align)-1 && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	// 预留格式信息区域，实际内容在选择掩码后写入
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+// drawFinder 以(cx, cy)为中心绘制定位图形及分隔符
+func (q *qrCode) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= q.size || y < 0 || y >= q.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			q.set(x, y, d != 2 && d != 4)
+		}
+	}
+}
+
+// drawFormatBits 写入纠错级别和掩码的格式信息（BCH(15,5)编码，两份）
+func (q *qrCode) drawFormatBits(mask int) {
+	data := qrFormatBits[q.level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	// 深色模块
+	q.set(8, q.size-8, true)
+}
+
+// drawVersion 版本7及以上写入版本信息（BCH(18,6)编码，两份）
+func (q *qrCode) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := q.size-11+i%3, i/3
+		q.set(a, b, dark)
+		q.set(b, a, dark)
+	}
+}
+
+// addECCAndInterleave 将数据分块、计算Reed-Solomon纠错码并交织
+func (q *qrCode) addECCAndInterleave(data []byte) []byte {
+	numBlocks := qrBlocks[q.level][q.version]
+	eccLen := qrECCPerBlock[q.level][q.version]
+	raw := qrRawDataModules(q.version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShort {
+			// 短块在数据末尾补一个占位字节，交织时跳过
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, raw)
+	for i := 0; i < len(blocks[0]); i++ {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords 按之字形顺序将码字填入非功能模块
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				upward := (right+1)&2 == 0
+				y := vert
+				if upward {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = (data[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask 对数据模块应用掩码，再次调用即可撤销
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 按规范的四条规则计算惩罚分
+func (q *qrCode) penalty() int {
+	penalty := 0
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < q.size; y++ {
+			// 规则1：连续5个及以上同色模块
+			run := 1
+			for x := 1; x <= q.size; x++ {
+				if x < q.size && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+			// 规则3：类似定位图形的1:1:3:1:1图案，且一侧有4个浅色模块
+			for x := 0; x+7 <= q.size; x++ {
+				match := true
+				for k, dark := range finder {
+					if at(x+k, y, transpose) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (q.lightRun(x-4, x, y, transpose) || q.lightRun(x+7, x+11, y, transpose)) {
+					penalty += 40
+				}
+			}
+		}
+	}
+	// 规则2：2x2同色块
+	dark := 0
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+	// 规则4：深色模块比例偏离50%
+	total := q.size * q.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return penalty + max(k, 0)*10
+}
+
+// lightRun 判断[from, to)范围内是否都是浅色模块，超出边界视为浅色
+func (q *qrCode) lightRun(from, to, y int, transpose bool) bool {
+	for x := from; x < to; x++ {
+		if x < 0 || x >= q.size {
+			continue
+		}
+		if (transpose && q.modules[x][y]) || (!transpose && q.modules[y][x]) {
+			return false
+		}
+	}
+	return true
+}
+
+// reedSolomonDivisor 计算指定次数的Reed-Solomon生成多项式（最高次项系数省略）
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder 计算数据除以生成多项式的余数，即纠错码字
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply GF(2^8)上的乘法，本原多项式为x^8+x^4+x^3+x^2+1
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// abs 整数绝对值
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,466 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD"以1-M编码的数据码字及纠错码字
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := qrDataBytes(newQRSegment("HELLO WORLD"), 1, 1); !bytes.Equal(got, data) {
+		t.Fatalf("data codewords = %v, want %v", got, data)
+	}
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Fatalf("ecc = %v, want %v", got, want)
+	}
+}
+
+func TestQRCapacity(t *testing.T) {
+	tests := []struct {
+		version, ecl, want int
+	}{
+		{1, 0, 19}, {1, 3, 9}, {5, 2, 62}, {10, 1, 216}, {40, 0, 2956}, {40, 3, 1276},
+	}
+	for _, tt := range tests {
+		if got := qrDataCodewords(tt.version, tt.ecl); got != tt.want {
+			t.Errorf("qrDataCodewords(%d, %d) = %d, want %d", tt.version, tt.ecl, got, tt.want)
+		}
+	}
+	if got := qrAlignmentPositions(32); len(got) != 6 || got[1] != 34 || got[5] != 138 {
+		t.Errorf("alignment positions of version 32 = %v", got)
+	}
+}
+
+// readQRFormat 读取第一份格式信息，返回纠错级别序号和掩码
+func readQRFormat(t *testing.T, q *qrCode) (int, int) {
+	t.Helper()
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		bits |= qrBit(q.modules[i][8]) << i
+	}
+	bits |= qrBit(q.modules[7][8])<<6 | qrBit(q.modules[8][8])<<7 | qrBit(q.modules[8][7])<<8
+	for i := 9; i < 15; i++ {
+		bits |= qrBit(q.modules[8][14-i]) << i
+	}
+	// 第二份格式信息必须一致
+	second := 0
+	for i := 0; i < 8; i++ {
+		second |= qrBit(q.modules[8][q.size-1-i]) << i
+	}
+	for i := 8; i < 15; i++ {
+		second |= qrBit(q.modules[q.size-15+i][8]) << i
+	}
+	if bits != second {
+		t.Fatalf("format copies differ: %015b vs %015b", bits, second)
+	}
+	data := (bits ^ 0x5412) >> 10
+	for ecl, f := range qrFormatBits {
+		if f == data>>3 {
+			return ecl, data & 7
+		}
+	}
+	t.Fatalf("invalid format bits %015b", bits)
+	return 0, 0
+}
+
+func qrBit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
+
+// decodeQR 独立于编码流程读取二维码：解掩码、按之字形读取码字、解交织、校验纠错码并解析数据
+func decodeQR(t *testing.T, q *qrCode) string {
+	t.Helper()
+	ecl, mask := readQRFormat(t, q)
+	if ecl != q.level {
+		t.Fatalf("format level = %d, want %d", ecl, q.level)
+	}
+	q.applyMask(mask)
+	defer q.applyMask(mask)
+
+	var raw []byte
+	var cur byte
+	n := 0
+	upward := true
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for vert := 0; vert < q.size; vert++ {
+			y := vert
+			if upward {
+				y = q.size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if q.function[y][x] {
+					continue
+				}
+				cur = cur<<1 | byte(qrBit(q.modules[y][x]))
+				if n++; n%8 == 0 {
+					raw = append(raw, cur)
+					cur = 0
+				}
+			}
+		}
+		upward = !upward
+	}
+	total := qrRawDataModules(q.version) / 8
+	raw = raw[:total]
+
+	numBlocks := qrBlocks[ecl][q.version]
+	eccLen := qrECCPerBlock[ecl][q.version]
+	numShort := numBlocks - total%numBlocks
+	shortData := total/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortData; i++ {
+		for j := range blocks {
+			if i < shortData || j >= numShort {
+				blocks[j] = append(blocks[j], raw[k])
+				k++
+			}
+		}
+	}
+	// 第i个纠错码字依次来自各个块
+	var data []byte
+	for j, block := range blocks {
+		data = append(data, block...)
+		ecc := make([]byte, eccLen)
+		for i := range ecc {
+			ecc[i] = raw[k+i*numBlocks+j]
+		}
+		if want := reedSolomonRemainder(block, reedSolomonDivisor(eccLen)); !bytes.Equal(ecc, want) {
+			t.Fatalf("block %d ecc mismatch", j)
+		}
+	}
+
+	// 仅解析字节模式
+	bit := func(pos, width int) int {
+		v := 0
+		for i := 0; i < width; i++ {
+			v = v<<1 | int(data[(pos+i)/8]>>(7-(pos+i)%8)&1)
+		}
+		return v
+	}
+	if mode := bit(0, 4); mode != qrModeByte.indicator {
+		t.Fatalf("mode = %d, want byte mode", mode)
+	}
+	countBits := qrModeByte.bits(q.version)
+	count := bit(4, countBits)
+	var sb strings.Builder
+	for i := 0; i < count; i++ {
+		sb.WriteByte(byte(bit(4+countBits+i*8, 8)))
+	}
+	return sb.String()
+}
+
+func TestEncodeQR(t *testing.T) {
+	tests := []struct {
+		content string
+		level   QRLevel
+		version int
+	}{
+		{"https://example.com/p/1", QRLevelL, 2},
+		{"https://shop.example.com/product/12345?utm_source=catalogue", QRLevelM, 4},
+		{strings.Repeat("catalogue-", 40), QRLevelQ, 0},
+		{strings.Repeat("x", 1000), QRLevelH, 0},
+	}
+	for _, tt := range tests {
+		qr, err := encodeQR(tt.content, tt.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.version != 0 && qr.version != tt.version {
+			t.Errorf("%q: version = %d, want %d", tt.content[:10], qr.version, tt.version)
+		}
+		if qr.size != qr.version*4+17 {
+			t.Errorf("size = %d", qr.size)
+		}
+		// 三个定位图形的中心为深色，分隔符为浅色
+		for _, p := range []image.Point{{3, 3}, {qr.size - 4, 3}, {3, qr.size - 4}} {
+			if !qr.modules[p.Y][p.X] || qr.modules[p.Y][p.X+2] || !qr.modules[p.Y][p.X-3] {
+				t.Errorf("finder at %v wrong", p)
+			}
+		}
+		if qr.modules[7][7] || !qr.modules[qr.size-8][8] {
+			t.Error("separator or dark module wrong")
+		}
+		if got := decodeQR(t, qr); got != tt.content {
+			t.Errorf("decoded %q, want %q", got, tt.content)
+		}
+	}
+
+	if _, err := encodeQR(strings.Repeat("x", 3000), QRLevelH); err == nil {
+		t.Error("expected error for content too long")
+	}
+	if _, err := encodeQR("x", "Z"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestQRKnownAnswer(t *testing.T) {
+	// 参考编码器（skip2/go-qrcode）输出的模块矩阵，不含静区，#为深色模块
+	tests := []struct {
+		content string
+		level   QRLevel
+		mask    int
+		modules []string
+	}{
+		{"01234567", QRLevelM, 2, []string{
+			"#######..#.##.#######",
+			"#.....#..####.#.....#",
+			"#.###.#.#.....#.###.#",
+			"#.###.#.##....#.###.#",
+			"#.###.#.#.###.#.###.#",
+			"#.....#.#...#.#.....#",
+			"#######.#.#.#.#######",
+			"........#..##........",
+			"#.#####..#..#.#####..",
+			"...#.#.##.#.#..#.##..",
+			"..#...##.#.#.#..#####",
+			"....#....#.....####..",
+			"...######..#.#..#....",
+			"........#.#####..##..",
+			"#######..##.#.##.....",
+			"#.....#.#.#####...#.#",
+			"#.###.#.#...#..#.##..",
+			"#.###.#.##..#..#.....",
+			"#.###.#.#.##.#..#.#..",
+			"#.....#........##.##.",
+			"#######.####.#..#.#..",
+		}},
+		{"HELLO WORLD", QRLevelQ, 0, []string{
+			"#######.##....#######",
+			"#.....#.#..#..#.....#",
+			"#.###.#.#..##.#.###.#",
+			"#.###.#.#.....#.###.#",
+			"#.###.#.#.#...#.###.#",
+			"#.....#...#...#.....#",
+			"#######.#.#.#.#######",
+			"........#............",
+			".##.#.##....#.#.#####",
+			".#......####....#...#",
+			"..##.###.##...#.##...",
+			".##.##.#..##.#.#.###.",
+			"#...#.#.#.###.###.#.#",
+			"........##.#..#...#.#",
+			"#######.#.#....#.##..",
+			"#.....#..#.##.##.#...",
+			"#.###.#.#.#...#######",
+			"#.###.#..#.#.#.#...#.",
+			"#.###.#.#..#.###.#..#",
+			"#.....#.#.####...#.##",
+			"#######....#.###....#",
+		}},
+		{"https://example.com/p/1", QRLevelL, 5, []string{
+			"#######....##.#...#######",
+			"#.....#..##..##.#.#.....#",
+			"#.###.#.....#.#...#.###.#",
+			"#.###.#.#...##..#.#.###.#",
+			"#.###.#.##...#..#.#.###.#",
+			"#.....#....##.#...#.....#",
+			"#######.#.#.#.#.#.#######",
+			"..........##..###........",
+			"##...###.#.#.#......##...",
+			".#.###.#.#..######.#####.",
+			"..###.#...#..####..#.#.##",
+			"#.##.#.#.#..#.#.#.##.#..#",
+			"#....###.#.##..##.##....#",
+			"###.#..#......###..#...#.",
+			"#...#.##.####..#..####.##",
+			"#.###..#.#.#..#..###.##.#",
+			"#..####...##.#..#####.#..",
+			"........##..##..#...#....",
+			"#######.#..#....#.#.#...#",
+			"#.....#.#...#.###...#..#.",
+			"#.###.#..##.##.######.###",
+			"#.###.#..#......###....##",
+			"#.###.#..####..#.....##.#",
+			"#.....#.#.##..####.##...#",
+			"#######.##..###.#.#..#..#",
+		}},
+	}
+	for _, tt := range tests {
+		qr, err := encodeQR(tt.content, tt.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, mask := readQRFormat(t, qr); mask != tt.mask {
+			t.Errorf("%q: mask = %d, want %d", tt.content, mask, tt.mask)
+		}
+		if qr.size != len(tt.modules) {
+			t.Fatalf("%q: size = %d, want %d", tt.content, qr.size, len(tt.modules))
+		}
+		for y, row := range tt.modules {
+			for x, c := range row {
+				if qr.modules[y][x] != (c == '#') {
+					t.Errorf("%q: module (%d, %d) = %v", tt.content, x, y, qr.modules[y][x])
+				}
+			}
+		}
+	}
+}
+
+func TestQRVersionInfo(t *testing.T) {
+	// 版本7和版本40的版本信息
+	for version, want := range map[int]int{7: 0x07C94, 40: 0x28C69} {
+		qr := &qrCode{version: version, size: version*4 + 17}
+		qr.modules = make([][]bool, qr.size)
+		qr.function = make([][]bool, qr.size)
+		for i := range qr.modules {
+			qr.modules[i] = make([]bool, qr.size)
+			qr.function[i] = make([]bool, qr.size)
+		}
+		qr.drawVersion()
+		got := 0
+		for i := 0; i < 18; i++ {
+			got |= qrBit(qr.modules[i/3][qr.size-11+i%3]) << i
+		}
+		if got != want {
+			t.Errorf("version %d info = %#x, want %#x", version, got, want)
+		}
+	}
+}
+
+func TestCode128(t *testing.T) {
+	for i, p := range code128Patterns {
+		sum := 0
+		for _, w := range p {
+			sum += int(w - '0')
+		}
+		if (i < code128Stop && sum != 11) || (i == code128Stop && sum != 13) {
+			t.Errorf("pattern %d width = %d", i, sum)
+		}
+	}
+
+	// 按宽度还原符号值并检查起始符和校验符
+	decode := func(bars []bool) []int {
+		var widths []byte
+		for i := 0; i < len(bars); {
+			j := i
+			for j < len(bars) && bars[j] == bars[i] {
+				j++
+			}
+			widths = append(widths, byte('0'+j-i))
+			i = j
+		}
+		var values []int
+		for i := 0; i+6 <= len(widths); i += 6 {
+			for v, p := range code128Patterns {
+				if p == string(widths[i:i+6]) {
+					values = append(values, v)
+					break
+				}
+			}
+		}
+		return values
+	}
+
+	bars, err := encodeCode128("PJJ123C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bars) != 11*10+2 {
+		t.Errorf("bars = %d modules", len(bars))
+	}
+	values := decode(bars)
+	if values[0] != code128StartB || values[8] != 55 {
+		t.Errorf("values = %v, want start B and checksum 55", values)
+	}
+
+	bars, err = encodeCode128("123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := decode(bars); values[0] != code128StartC || values[1] != 12 || values[3] != 56 {
+		t.Errorf("values = %v, want code C pairs", values)
+	}
+	if _, err = encodeCode128("价格"); err == nil {
+		t.Error("expected error for non-ascii content")
+	}
+}
+
+func TestRenderCode(t *testing.T) {
+	img, err := RenderCode(CodeOptions{Content: "https://example.com/p/1", Level: QRLevelL, ModuleSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 版本2为25个模块，加两侧各4个模块的静区
+	if got := img.Bounds().Size(); got != image.Pt((25+8)*3, (25+8)*3) {
+		t.Errorf("size = %v", got)
+	}
+	if c := img.NRGBAAt(0, 0); c.R != 255 || c.A != 255 {
+		t.Errorf("quiet zone = %v, want white", c)
+	}
+	if c := img.NRGBAAt(12, 12); c.R != 0 || c.A != 255 {
+		t.Errorf("finder corner = %v, want black", c)
+	}
+
+	img, err = RenderCode(CodeOptions{Content: "x", QuietZone: -1, TransparentBackground: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Dx(); got != 21*4 {
+		t.Errorf("width without quiet zone = %d", got)
+	}
+	if c := img.NRGBAAt(4*7, 4*7); c.A != 0 {
+		t.Errorf("separator = %v, want transparent", c)
+	}
+
+	img, err = RenderCode(CodeOptions{Content: "123456", Type: CodeCode128, ModuleSize: 2, BarHeight: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt((11*5+13+20)*2, 40) {
+		t.Errorf("code128 size = %v", got)
+	}
+
+	if _, err = RenderCode(CodeOptions{Content: "x", Type: "ean13"}); err == nil {
+		t.Error("expected error for unknown type")
+	}
+	if _, err = RenderCode(CodeOptions{}); err == nil {
+		t.Error("expected error for empty content")
+	}
+}
+
+func TestAddCodeWatermark(t *testing.T) {
+	origin := syntheticPhoto(400, 300)
+	config := CodeWatermarkConfig{
+		ImageWatermarkConfig: ImageWatermarkConfig{WatermarkPos: RightBottom, OffsetX: 10, OffsetY: 10},
+		Code:                 CodeOptions{Content: "https://example.com/p/1", ModuleSize: 2},
+	}
+	result, err := AddCodeWatermark(origin, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := RenderCode(config.Code)
+	// 不缩放，码图右下角距原图右下角10像素
+	x0, y0 := 400-10-code.Bounds().Dx(), 300-10-code.Bounds().Dy()
+	for _, p := range []image.Point{{0, 0}, {8, 8}, {9, 9}} {
+		got := imaging.Clone(result).NRGBAAt(x0+p.X, y0+p.Y)
+		want := code.NRGBAAt(p.X, p.Y)
+		if got.R != want.R || got.G != want.G || got.B != want.B {
+			t.Errorf("pixel %v = %v, want %v", p, got, want)
+		}
+	}
+
+	layer, err := CodeLayer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layered, err := AddWatermarkLayers(origin, []Layer{layer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(imaging.Clone(layered).Pix, imaging.Clone(result).Pix) {
+		t.Error("code layer differs from AddCodeWatermark")
+	}
+}
@@ -0,0 +1,127 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// ScaleMode 图片水印缩放模式
+type ScaleMode string
+
+const (
+	ScaleDefault   ScaleMode = ""           // 默认：水印宽度缩放为原图宽度的1/5
+	ScaleNone      ScaleMode = "none"       // 不缩放，保持水印原始尺寸
+	ScaleFixed     ScaleMode = "fixed"      // 固定像素尺寸，使用ScaleWidth/ScaleHeight，其一为0时按比例计算
+	ScaleShortEdge ScaleMode = "short_edge" // 水印长边为原图短边的ScalePercent%
+	ScaleLongEdge  ScaleMode = "long_edge"  // 水印长边为原图长边的ScalePercent%
+)
+
+// ResampleFilter 缩放时使用的重采样滤波器
+type ResampleFilter string
+
+const (
+	FilterLanczos    ResampleFilter = ""            // Lanczos，质量最好（默认）
+	FilterCatmullRom ResampleFilter = "catmull_rom" // Catmull-Rom，锐利且较快
+	FilterLinear     ResampleFilter = "linear"      // 双线性
+	FilterBox        ResampleFilter = "box"         // 盒式，适合缩小
+	FilterNearest    ResampleFilter = "nearest"     // 最近邻，适合像素风格图标
+)
+
+// imagingFilter 转换为imaging的重采样滤波器
+func (f ResampleFilter) imagingFilter() (imaging.ResampleFilter, error) {
+	switch f {
+	case FilterLanczos:
+		return imaging.Lanczos, nil
+	case FilterCatmullRom:
+		return imaging.CatmullRom, nil
+	case FilterLinear:
+		return imaging.Linear, nil
+	case FilterBox:
+		return imaging.Box, nil
+	case FilterNearest:
+		return imaging.NearestNeighbor, nil
+	}
+	return imaging.ResampleFilter{}, errors.New("watermark resample filter error")
+}
+
+// validateScale 校验缩放模式及其参数、尺寸限制和重采样滤波器
+func validateScale(config ImageWatermarkConfig) error {
+	if _, err := config.ResampleFilter.imagingFilter(); err != nil {
+		return err
+	}
+	if config.MinWatermarkSize < 0 || config.MaxWatermarkSize < 0 ||
+		(config.MaxWatermarkSize > 0 && config.MinWatermarkSize > config.MaxWatermarkSize) {
+		return errors.New("watermark size clamp error: Ensure 0 <= min <= max")
+	}
+	switch config.ScaleMode {
+	case ScaleDefault, ScaleNone:
+	case ScaleFixed:
+		if config.ScaleWidth < 0 || config.ScaleHeight < 0 || (config.ScaleWidth == 0 && config.ScaleHeight == 0) {
+			return errors.New("watermark scale fixed need scale_width or scale_height")
+		}
+	case ScaleShortEdge, ScaleLongEdge:
+		if config.ScalePercent <= 0 {
+			return errors.New("watermark scale percent error: Ensure percent > 0")
+		}
+	default:
+		return errors.New("watermark scale mode error")
+	}
+	return nil
+}
+
+// scaleWatermark 按配置的缩放模式计算水印尺寸并缩放水印图
+func scaleWatermark(watermarkImg image.Image, canvasW, canvasH int, config ImageWatermarkConfig) (*image.NRGBA, error) {
+	if err := validateScale(config); err != nil {
+		return nil, err
+	}
+	filter, _ := config.ResampleFilter.imagingFilter()
+	srcW, srcH := watermarkImg.Bounds().Dx(), watermarkImg.Bounds().Dy()
+	if srcW == 0 || srcH == 0 {
+		return nil, errors.New("watermark image is empty")
+	}
+
+	var w, h float64
+	switch config.ScaleMode {
+	case ScaleDefault:
+		if config.MinWatermarkSize == 0 && config.MaxWatermarkSize == 0 {
+			// 保持与旧版本完全一致的缩放结果
+			return imaging.Resize(watermarkImg, canvasW/5, 0, filter), nil
+		}
+		w = float64(canvasW) / 5
+		h = w * float64(srcH) / float64(srcW)
+	case ScaleNone:
+		w, h = float64(srcW), float64(srcH)
+	case ScaleFixed:
+		w, h = float64(config.ScaleWidth), float64(config.ScaleHeight)
+		if w == 0 {
+			w = h * float64(srcW) / float64(srcH)
+		}
+		if h == 0 {
+			h = w * float64(srcH) / float64(srcW)
+		}
+	case ScaleShortEdge, ScaleLongEdge:
+		edge := math.Min(float64(canvasW), float64(canvasH))
+		if config.ScaleMode == ScaleLongEdge {
+			edge = math.Max(float64(canvasW), float64(canvasH))
+		}
+		long := edge * config.ScalePercent / 100
+		ratio := long / math.Max(float64(srcW), float64(srcH))
+		w, h = float64(srcW)*ratio, float64(srcH)*ratio
+	}
+
+	// 按长边限制最小/最大尺寸
+	long := math.Max(w, h)
+	if config.MinWatermarkSize > 0 && long < float64(config.MinWatermarkSize) {
+		w, h = w*float64(config.MinWatermarkSize)/long, h*float64(config.MinWatermarkSize)/long
+	} else if config.MaxWatermarkSize > 0 && long > float64(config.MaxWatermarkSize) {
+		w, h = w*float64(config.MaxWatermarkSize)/long, h*float64(config.MaxWatermarkSize)/long
+	}
+	targetW, targetH := int(math.Max(1, math.Round(w))), int(math.Max(1, math.Round(h)))
+	if targetW == srcW && targetH == srcH {
+		return imaging.Clone(watermarkImg), nil
+	}
+	return imaging.Resize(watermarkImg, targetW, targetH, filter), nil
+}
@@ -0,0 +1,506 @@
+package watermark
+
+import (
+	"unicode"
+
+	"golang.org/x/text/unicode/bidi"
+	"golang.org/x/text/unicode/norm"
+)
+
+// 文字整形：freetype只能按字符逐个绘制字形，不会应用字体的GSUB/GPOS规则，
+// 绘制前先在字符层面完成以下处理：
+//   - 按字素簇切分文字，组合附加符号、emoji的ZWJ序列、变体选择符、肤色修饰符、国旗和天城文等的辅音连写
+//     作为整体选择字体，零宽连接符等不可见字符在字体中没有字形时不绘制，避免显示为方框
+//   - 阿拉伯文按连写规则替换为首、中、尾、独立形式的表现形式字符，并合成lam-alef连字
+//   - 天城文等印度系文字的前置元音符号移到辅音之前
+//   - 按Unicode双向算法（不含显式嵌入和括号配对）将从右到左的文字重排为显示顺序，并镜像括号
+// 字体的GSUB连字（如emoji的ZWJ组合、印度系文字的半字形）无法应用，ZWJ序列按组成字符逐个显示。
+
+// shapedGlyph 整形后按显示顺序排列的一个字形
+type shapedGlyph struct {
+	r    rune // 绘制的字符
+	face int  // 回退链中的字体序号
+}
+
+// cluster 一个字素簇
+type cluster struct {
+	runes []rune // 整形后的字符
+	plain []rune // 未替换阿拉伯文表现形式的字符，字体不包含表现形式时使用
+	split int    // lam-alef连字在plain中alef的位置
+	class bidi.Class
+	level int
+}
+
+// shapeText 将一行文字整形为按显示顺序排列的字形，covers报告第i个字体是否包含字符r
+func shapeText(text string, fonts int, covers func(i int, r rune) bool) []shapedGlyph {
+	clusters := segmentClusters([]rune(norm.NFC.String(text)))
+	clusters = joinArabic(clusters)
+	for _, c := range clusters {
+		reorderIndic(c.runes)
+	}
+	clusters = reorderBidi(clusters)
+
+	var glyphs []shapedGlyph
+	for _, c := range clusters {
+		runes := c.runes
+		face, ok := pickClusterFace(runes, fonts, covers)
+		if !ok && c.plain != nil {
+			// 字体不包含阿拉伯文表现形式时退回原字符，连字拆回两个字母后按显示顺序排列
+			runes = c.plain
+			if c.split > 0 && c.level%2 == 1 {
+				runes = append(append([]rune{}, c.plain[c.split:]...), c.plain[:c.split]...)
+			}
+			face, _ = pickClusterFace(runes, fonts, covers)
+		}
+		for _, r := range runes {
+			f := face
+			if !covers(f, r) {
+				if isDefaultIgnorable(r) {
+					continue
+				}
+				// 簇中个别字符仍可以从其他字体回退
+				for i := 0; i < fonts; i++ {
+					if covers(i, r) {
+						f = i
+						break
+					}
+				}
+			}
+			glyphs = append(glyphs, shapedGlyph{r: r, face: f})
+		}
+	}
+	return glyphs
+}
+
+// pickClusterFace 返回包含簇中所有可见字符的第一个字体，都不包含时返回包含首字符的字体
+func pickClusterFace(runes []rune, fonts int, covers func(i int, r rune) bool) (int, bool) {
+	for i := 0; i < fonts; i++ {
+		all := true
+		for _, r := range runes {
+			if !isDefaultIgnorable(r) && !covers(i, r) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return i, true
+		}
+	}
+	for i := 0; i < fonts; i++ {
+		if covers(i, runes[0]) {
+			return i, false
+		}
+	}
+	return 0, false
+}
+
+// segmentClusters 将文字切分为字素簇（扩展字素簇的简化实现）
+func segmentClusters(runes []rune) []*cluster {
+	var clusters []*cluster
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && extendsCluster(runes[i:j], runes[j]) {
+			j++
+		}
+		c := runes[i:j:j]
+		clusters = append(clusters, &cluster{runes: c, class: clusterClass(c)})
+		i = j
+	}
+	return clusters
+}
+
+// extendsCluster 字符r是否属于已有字符组成的簇
+func extendsCluster(runes []rune, r rune) bool {
+	prev := runes[len(runes)-1]
+	switch {
+	case isClusterExtend(r):
+		return true
+	case prev == zwj && isPictographic(r):
+		return true
+	case isVirama(prev) && unicode.IsLetter(r):
+		return true
+	case len(runes) == 1 && isRegionalIndicator(prev) && isRegionalIndicator(r):
+		return true
+	}
+	return false
+}
+
+// clusterClass 簇的双向类别，以第一个不是附加符号的字符为准
+func clusterClass(runes []rune) bidi.Class {
+	for _, r := range runes {
+		p, _ := bidi.LookupRune(r)
+		if c := p.Class(); c != bidi.NSM && c != bidi.BN {
+			return c
+		}
+	}
+	p, _ := bidi.LookupRune(runes[0])
+	return p.Class()
+}
+
+const (
+	zwj  = '\u200D'
+	zwnj = '\u200C'
+)
+
+// isClusterExtend 是否附加到前一个字符上：组合符号、零宽连接符、变体选择符、emoji肤色修饰符和标签字符
+func isClusterExtend(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		r == zwj || r == zwnj ||
+		(r >= 0xFE00 && r <= 0xFE0F) || (r >= 0xE0100 && r <= 0xE01EF) ||
+		(r >= 0x1F3FB && r <= 0x1F3FF) || (r >= 0xE0020 && r <= 0xE007F)
+}
+
+// isPictographic 是否为emoji等象形符号，ZWJ之后的象形符号与前面的字符组成一个簇
+func isPictographic(r rune) bool {
+	return r >= 0x1F000 && r <= 0x1FAFF || r >= 0x2600 && r <= 0x27BF ||
+		r >= 0x2300 && r <= 0x23FF || r >= 0x2B00 && r <= 0x2BFF ||
+		r == 0x00A9 || r == 0x00AE || r == 0x203C || r == 0x2049 || r == 0x2122
+}
+
+// isRegionalIndicator 是否为组成国旗的区域指示符
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isVirama 印度系文字的辅音连写符（virama/halant），之后的辅音与之前的辅音组成一个簇
+func isVirama(r rune) bool {
+	switch r {
+	case 0x094D, 0x09CD, 0x0A4D, 0x0ACD, 0x0B4D, 0x0BCD, 0x0C4D, 0x0CCD, 0x0D4D, 0x0DCA:
+		return true
+	}
+	return false
+}
+
+// isDefaultIgnorable 是否为默认不可见的格式字符，字体中没有字形时直接跳过
+func isDefaultIgnorable(r rune) bool {
+	switch {
+	case r == 0x00AD, r == 0x034F, r == 0x061C, r == 0xFEFF,
+		r >= 0x200B && r <= 0x200F, r >= 0x202A && r <= 0x202E,
+		r >= 0x2060 && r <= 0x206F, r >= 0xFE00 && r <= 0xFE0F,
+		r >= 0xE0000 && r <= 0xE0FFF:
+		return true
+	}
+	return false
+}
+
+// preBaseMatras 印度系文字中显示在辅音之前的元音符号
+var preBaseMatras = map[rune]bool{
+	0x093F: true, 0x094E: true, // 天城文
+	0x09BF: true, 0x09C7: true, 0x09C8: true, // 孟加拉文
+	0x0A3F: true,                             // 古木基文
+	0x0ABF: true,                             // 古吉拉特文
+	0x0B47: true,                             // 奥里亚文
+	0x0BC6: true, 0x0BC7: true, 0x0BC8: true, // 泰米尔文
+	0x0D46: true, 0x0D47: true, 0x0D48: true, // 马拉雅拉姆文
+	0x0DD9: true, 0x0DDA: true, 0x0DDB: true, // 僧伽罗文
+}
+
+// reorderIndic 将簇中的前置元音符号移到簇首
+func reorderIndic(runes []rune) {
+	for i := 1; i < len(runes); i++ {
+		if preBaseMatras[runes[i]] {
+			m := runes[i]
+			copy(runes[1:i+1], runes[:i])
+			runes[0] = m
+			return
+		}
+	}
+}
+
+// arabicForm 阿拉伯字母的表现形式，dual为true时有首、中、尾、独立四种形式（依次为isolated起的连续字符），
+// 否则只有独立和尾形式，只与前一个字母相连
+type arabicForm struct {
+	isolated rune
+	dual     bool
+}
+
+// arabicForms 阿拉伯字母及常用波斯字母到表现形式的映射，不与任何字母相连的hamza不需要替换
+var arabicForms = map[rune]arabicForm{
+	0x0622: {0xFE81, false}, 0x0623: {0xFE83, false}, 0x0624: {0xFE85, false},
+	0x0625: {0xFE87, false}, 0x0626: {0xFE89, true}, 0x0627: {0xFE8D, false}, 0x0628: {0xFE8F, true},
+	0x0629: {0xFE93, false}, 0x062A: {0xFE95, true}, 0x062B: {0xFE99, true}, 0x062C: {0xFE9D, true},
+	0x062D: {0xFEA1, true}, 0x062E: {0xFEA5, true}, 0x062F: {0xFEA9, false}, 0x0630: {0xFEAB, false},
+	0x0631: {0xFEAD, false}, 0x0632: {0xFEAF, false}, 0x0633: {0xFEB1, true}, 0x0634: {0xFEB5, true},
+	0x0635: {0xFEB9, true}, 0x0636: {0xFEBD, true}, 0x0637: {0xFEC1, true}, 0x0638: {0xFEC5, true},
+	0x0639: {0xFEC9, true}, 0x063A: {0xFECD, true}, 0x0641: {0xFED1, true}, 0x0642: {0xFED5, true},
+	0x0643: {0xFED9, true}, 0x0644: {0xFEDD, true}, 0x0645: {0xFEE1, true}, 0x0646: {0xFEE5, true},
+	0x0647: {0xFEE9, true}, 0x0648: {0xFEED, false}, 0x0649: {0xFEEF, false}, 0x064A: {0xFEF1, true},
+	0x067E: {0xFB56, true}, 0x0686: {0xFB7A, true}, 0x0698: {0xFB8A, false}, 0x06A9: {0xFB8E, true},
+	0x06AF: {0xFB92, true}, 0x06CC: {0xFBFC, true},
+}
+
+// lamAlef lam与各种alef组成的连字（独立形式，尾形式为其后一个字符）
+var lamAlef = map[rune]rune{0x0622: 0xFEF5, 0x0623: 0xFEF7, 0x0625: 0xFEF9, 0x0627: 0xFEFB}
+
+const (
+	arabicLam     = 0x0644
+	arabicTatweel = 0x0640
+)
+
+// joinsNext 簇是否与后一个字母相连
+func (c *cluster) joinsNext() bool {
+	for _, r := range c.runes[1:] {
+		if r == zwnj {
+			return false
+		}
+		if r == zwj {
+			return true
+		}
+	}
+	if c.runes[0] == arabicTatweel {
+		return true
+	}
+	form, ok := arabicForms[c.runes[0]]
+	return ok && form.dual
+}
+
+// joinsPrev 簇是否与前一个字母相连
+func (c *cluster) joinsPrev() bool {
+	_, ok := arabicForms[c.runes[0]]
+	return ok || c.runes[0] == arabicTatweel
+}
+
+// joinArabic 按连写规则将阿拉伯字母替换为表现形式，并合成lam-alef连字
+func joinArabic(clusters []*cluster) []*cluster {
+	out := clusters[:0]
+	prevJoins := false
+	for i := 0; i < len(clusters); i++ {
+		c := clusters[i]
+		form, ok := arabicForms[c.runes[0]]
+		if !ok {
+			out = append(out, c)
+			prevJoins = c.joinsNext()
+			continue
+		}
+		if c.runes[0] == arabicLam && i+1 < len(clusters) && !hasRune(c.runes, zwnj) {
+			if lig, ok := lamAlef[clusters[i+1].runes[0]]; ok {
+				if prevJoins {
+					lig++
+				}
+				next := clusters[i+1]
+				plain := append(append([]rune{}, c.runes...), next.runes...)
+				runes := append([]rune{lig}, c.runes[1:]...)
+				runes = append(runes, next.runes[1:]...)
+				out = append(out, &cluster{runes: runes, plain: plain, split: len(c.runes), class: c.class})
+				// alef只与前一个字母相连
+				prevJoins = false
+				i++
+				continue
+			}
+		}
+		nextJoins := i+1 < len(clusters) && c.joinsNext() && clusters[i+1].joinsPrev()
+		shaped := form.isolated
+		switch {
+		case form.dual && prevJoins && nextJoins:
+			shaped += 3
+		case form.dual && nextJoins:
+			shaped += 2
+		case prevJoins:
+			shaped++
+		}
+		c.plain = append([]rune{}, c.runes...)
+		c.runes = append([]rune{shaped}, c.runes[1:]...)
+		out = append(out, c)
+		prevJoins = nextJoins
+	}
+	return out
+}
+
+// hasRune 切片中是否包含字符r
+func hasRune(runes []rune, r rune) bool {
+	for _, v := range runes {
+		if v == r {
+			return true
+		}
+	}
+	return false
+}
+
+// bidiMirrors 从右到左显示时需要镜像的成对符号
+var bidiMirrors = map[rune]rune{
+	'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{', '<': '>', '>': '<',
+	'«': '»', '»': '«', '‹': '›', '›': '‹', '（': '）', '）': '（', '《': '》', '》': '《',
+	'【': '】', '】': '【', '「': '」', '」': '「', '『': '』', '』': '『',
+}
+
+// reorderBidi 计算每个簇的嵌入层级并按显示顺序重排，不处理显式嵌入、隔离和括号配对
+func reorderBidi(clusters []*cluster) []*cluster {
+	n := len(clusters)
+	if n == 0 {
+		return clusters
+	}
+	types := make([]bidi.Class, n)
+	base := bidi.L
+	baseFound := false
+	for i, c := range clusters {
+		types[i] = c.class
+		switch types[i] {
+		case bidi.Control, bidi.B:
+			types[i] = bidi.BN
+		}
+		if !baseFound && (types[i] == bidi.L || types[i] == bidi.R || types[i] == bidi.AL) {
+			base, baseFound = types[i], true
+		}
+	}
+	baseLevel := 0
+	if base != bidi.L {
+		baseLevel, base = 1, bidi.R
+	}
+	// 纯从左到右的文字无需处理
+	rtl := baseLevel == 1
+	for _, t := range types {
+		if t == bidi.R || t == bidi.AL || t == bidi.AN {
+			rtl = true
+		}
+	}
+	if !rtl {
+		return clusters
+	}
+
+	// W1-W3：附加符号取前一个字符的类别，阿拉伯字母之后的欧洲数字视为阿拉伯数字，AL视为R
+	last := base
+	for i, t := range types {
+		switch t {
+		case bidi.NSM:
+			if i == 0 {
+				types[i] = base
+			} else {
+				types[i] = types[i-1]
+			}
+		case bidi.EN:
+			if last == bidi.AL {
+				types[i] = bidi.AN
+			}
+		case bidi.L, bidi.R, bidi.AL:
+			last = t
+		}
+	}
+	for i, t := range types {
+		if t == bidi.AL {
+			types[i] = bidi.R
+		}
+	}
+	// W4：两个数字之间的单个分隔符
+	for i := 1; i+1 < n; i++ {
+		prev, next := types[i-1], types[i+1]
+		switch {
+		case types[i] == bidi.ES && prev == bidi.EN && next == bidi.EN,
+			types[i] == bidi.CS && prev == bidi.EN && next == bidi.EN:
+			types[i] = bidi.EN
+		case types[i] == bidi.CS && prev == bidi.AN && next == bidi.AN:
+			types[i] = bidi.AN
+		}
+	}
+	// W5：与欧洲数字相邻的终止符（如货币符号、百分号）视为欧洲数字
+	for i := 0; i < n; i++ {
+		if types[i] != bidi.ET {
+			continue
+		}
+		j := i
+		for j < n && types[j] == bidi.ET {
+			j++
+		}
+		if (i > 0 && types[i-1] == bidi.EN) || (j < n && types[j] == bidi.EN) {
+			for k := i; k < j; k++ {
+				types[k] = bidi.EN
+			}
+		}
+		i = j
+	}
+	// W6-W7：其余分隔符视为中性，从左到右文字之后的欧洲数字视为L
+	last = base
+	for i, t := range types {
+		switch t {
+		case bidi.ES, bidi.ET, bidi.CS:
+			types[i] = bidi.ON
+		case bidi.EN:
+			if last == bidi.L {
+				types[i] = bidi.L
+			}
+		case bidi.L, bidi.R:
+			last = t
+		}
+	}
+	// N1-N2：中性字符两侧方向相同时取该方向，否则取段落方向，数字视为R
+	strong := func(t bidi.Class) (bidi.Class, bool) {
+		switch t {
+		case bidi.L:
+			return bidi.L, true
+		case bidi.R, bidi.EN, bidi.AN:
+			return bidi.R, true
+		}
+		return 0, false
+	}
+	for i := 0; i < n; i++ {
+		if _, ok := strong(types[i]); ok {
+			continue
+		}
+		j := i
+		for j < n {
+			if _, ok := strong(types[j]); ok {
+				break
+			}
+			j++
+		}
+		before, after := base, base
+		if i > 0 {
+			before, _ = strong(types[i-1])
+		}
+		if j < n {
+			after, _ = strong(types[j])
+		}
+		dir := base
+		if before == after {
+			dir = before
+		}
+		for k := i; k < j; k++ {
+			types[k] = dir
+		}
+		i = j
+	}
+	// I1-I2：计算嵌入层级
+	maxLevel := baseLevel
+	for i, t := range types {
+		level := baseLevel
+		switch {
+		case baseLevel == 0 && t == bidi.R:
+			level = 1
+		case baseLevel == 0 && (t == bidi.AN || t == bidi.EN):
+			level = 2
+		case baseLevel == 1 && (t == bidi.L || t == bidi.AN || t == bidi.EN):
+			level = 2
+		}
+		clusters[i].level = level
+		maxLevel = max(maxLevel, level)
+	}
+	// L1：行尾空白使用段落层级
+	for i := n - 1; i >= 0 && unicode.IsSpace(clusters[i].runes[0]); i-- {
+		clusters[i].level = baseLevel
+	}
+	// L2：从最高层级到最低的奇数层级，依次反转层级不低于该值的连续序列
+	out := append([]*cluster{}, clusters...)
+	for level := maxLevel; level >= 1; level-- {
+		for i := 0; i < n; i++ {
+			if out[i].level < level {
+				continue
+			}
+			j := i
+			for j < n && out[j].level >= level {
+				j++
+			}
+			for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+				out[a], out[b] = out[b], out[a]
+			}
+			i = j
+		}
+	}
+	// L4：从右到左显示的成对符号镜像
+	for _, c := range out {
+		if c.level%2 == 1 {
+			if m, ok := bidiMirrors[c.runes[0]]; ok {
+				c.runes = append([]rune{m}, c.runes[1:]...)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package watermark
+
+import (
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// glyphRunes 返回字形的字符，用于比较整形结果
+func glyphRunes(glyphs []shapedGlyph) string {
+	runes := make([]rune, len(glyphs))
+	for i, g := range glyphs {
+		runes[i] = g.r
+	}
+	return string(runes)
+}
+
+func TestShapeText(t *testing.T) {
+	all := func(int, rune) bool { return true }
+	// 不包含阿拉伯文表现形式的字体
+	noForms := func(_ int, r rune) bool { return r < 0xFB50 || r > 0xFEFF }
+	tests := []struct {
+		name   string
+		text   string
+		covers func(int, rune) bool
+		want   string
+	}{
+		{"latin", "abc", all, "abc"},
+		{"arabic forms", "\u0633\u0644\u0627\u0645", all, "\uFEE1\uFEFC\uFEB3"},
+		{"arabic medial", "\u0628\u064A\u062A", all, "\uFE96\uFEF4\uFE91"},
+		{"arabic zwnj", "\u0628\u200C\u0628", all, "\uFE8F\uFE8F\u200C"},
+		{"arabic without forms", "\u0633\u0644\u0627\u0645", noForms, "\u0645\u0627\u0644\u0633"},
+		{"arabic numbers", "\u0631\u0642\u0645 123", all, "123 \uFEE2\uFED7\uFEAD"},
+		{"hebrew in latin", "abc \u05D0\u05D1\u05D2 123 def", all, "abc 123 \u05D2\u05D1\u05D0 def"},
+		{"mirrored brackets", "\u05D0(\u05D1)", all, "(\u05D1)\u05D0"},
+		{"devanagari pre-base matra", "\u0915\u093F", all, "\u093F\u0915"},
+		{"combining mark", "e\u0301", all, "\u00E9"},
+	}
+	for _, tt := range tests {
+		if got := glyphRunes(shapeText(tt.text, 1, tt.covers)); got != tt.want {
+			t.Errorf("%s: %+q, want %+q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestShapeTextClusterFallback(t *testing.T) {
+	// 主字体只有拉丁字母，后备字体有emoji但没有ZWJ和变体选择符
+	covers := func(i int, r rune) bool {
+		if i == 0 {
+			return r < 0x80
+		}
+		return r >= 0x2000 && !isDefaultIgnorable(r)
+	}
+	tests := []struct {
+		text  string
+		want  string
+		faces []int
+	}{
+		{"a\U0001F468\u200D\U0001F469\u200D\U0001F467", "a\U0001F468\U0001F469\U0001F467", []int{0, 1, 1, 1}},
+		{"\u2764\uFE0F!", "\u2764!", []int{1, 0}},
+		{"\U0001F44D\U0001F3FD", "\U0001F44D\U0001F3FD", []int{1, 1}},
+		{"\U0001F1E8\U0001F1F3\U0001F1FA\U0001F1F8", "\U0001F1E8\U0001F1F3\U0001F1FA\U0001F1F8", []int{1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		glyphs := shapeText(tt.text, 2, covers)
+		if got := glyphRunes(glyphs); got != tt.want {
+			t.Errorf("%+q: %+q, want %+q", tt.text, got, tt.want)
+			continue
+		}
+		for i, g := range glyphs {
+			if g.face != tt.faces[i] {
+				t.Errorf("%+q: glyph %d face = %d, want %d", tt.text, i, g.face, tt.faces[i])
+			}
+		}
+	}
+
+	if n := len(segmentClusters([]rune("a\U0001F468\u200D\U0001F469\u200D\U0001F467\U0001F1E8\U0001F1F3\U0001F1FA\U0001F1F8\u0915\u094D\u0937\u093F"))); n != 5 {
+		t.Errorf("clusters = %d, want 5", n)
+	}
+}
+
+func TestFallbackFaceIgnorable(t *testing.T) {
+	regular, _ := truetype.Parse(goregular.TTF)
+	face := newFallbackFace([]*truetype.Font{regular}, 20)
+	defer face.Close()
+	// 字体中没有的零宽字符不绘制为方框，不占宽度
+	plain := face.advance(face.shape("AB"))
+	if got := face.advance(face.shape("A\u200DB\uFE0F\u200B")); got != plain {
+		t.Errorf("width with ignorable characters = %v, want %v", got, plain)
+	}
+}
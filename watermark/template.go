@@ -0,0 +1,227 @@
+package watermark
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 文字模板变量使用与common.FormatTemplate、excel.ReportTemplate相同的 ${name} 语法，支持：
+//   ${date} ${date:2006-01-02}  渲染时间，可指定Go时间格式
+//   ${filename}                 原图文件名
+//   ${width} ${height}          原图宽高
+//   ${exif.DateTimeOriginal}    EXIF标签，日期标签同样可指定时间格式
+//   ${name}                     Variables中用户提供的值
+// 无法解析的变量保持原样
+
+// defaultTemplateDateLayout ${date}未指定格式时使用的时间格式
+const defaultTemplateDateLayout = "2006-01-02 15:04:05"
+
+// exifDateLayout EXIF日期标签的格式
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// templateContext 渲染文字模板时与当前图片相关的信息
+type templateContext struct {
+	filename string
+	width    int
+	height   int
+	exif     map[string]string
+}
+
+// templateContext 返回原图的模板信息
+func (s *sourceImage) templateContext() templateContext {
+	ctx := templateContext{exif: s.exif}
+	if s.name != "" {
+		ctx.filename = filepath.Base(s.name)
+	}
+	if s.img != nil {
+		ctx.width, ctx.height = s.img.Bounds().Dx(), s.img.Bounds().Dy()
+	}
+	return ctx
+}
+
+// hasTemplate 判断文字中是否包含模板变量
+func hasTemplate(text string) bool {
+	return strings.Contains(text, "${")
+}
+
+// expandText 展开文字水印中的模板变量
+func (c TransparentTextWatermarkConfig) expandText(ctx templateContext) string {
+	if !hasTemplate(c.Text) {
+		return c.Text
+	}
+	now := c.TemplateTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var b strings.Builder
+	text := c.Text
+	for {
+		start := strings.Index(text, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		b.WriteString(text[:start])
+		placeholder := text[start : start+end+1]
+		if value, ok := lookupTemplateVar(placeholder[2:len(placeholder)-1], ctx, c.Variables, now); ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(placeholder)
+		}
+		text = text[start+end+1:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+// lookupTemplateVar 查找模板变量的值，用户提供的值优先于内置变量
+func lookupTemplateVar(key string, ctx templateContext, vars map[string]interface{}, now time.Time) (string, bool) {
+	if value, ok := vars[key]; ok {
+		return fmt.Sprintf("%v", value), true
+	}
+	name, layout, hasLayout := strings.Cut(key, ":")
+	switch {
+	case name == "date":
+		if !hasLayout {
+			layout = defaultTemplateDateLayout
+		}
+		return now.Format(layout), true
+	case name == "filename" && !hasLayout:
+		return ctx.filename, ctx.filename != ""
+	case name == "width" && !hasLayout && ctx.width > 0:
+		return strconv.Itoa(ctx.width), true
+	case name == "height" && !hasLayout && ctx.height > 0:
+		return strconv.Itoa(ctx.height), true
+	case strings.HasPrefix(name, "exif."):
+		value, ok := ctx.exif[strings.TrimPrefix(name, "exif.")]
+		if !ok {
+			return "", false
+		}
+		if hasLayout {
+			if t, err := time.Parse(exifDateLayout, value); err == nil {
+				return t.Format(layout), true
+			}
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// exifTagNames 模板中可用的EXIF标签
+var exifTagNames = map[uint16]string{
+	0x010E: "ImageDescription",
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x920A: "FocalLength",
+	0xA434: "LensModel",
+}
+
+// exifTagExifIFD 指向Exif子IFD的标签
+const exifTagExifIFD = 0x8769
+
+// parseEXIFTags 解析EXIF（TIFF结构）中IFD0和Exif子IFD的常用标签，返回标签名到文本值的映射
+func parseEXIFTags(tiff []byte) map[string]string {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	tags := make(map[string]string)
+	ifd := int(order.Uint32(tiff[4:]))
+	for depth := 0; depth < 2 && ifd >= 8; depth++ {
+		ifd = parseEXIFIFD(tiff, order, ifd, tags)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// parseEXIFIFD 解析一个IFD中的标签，返回Exif子IFD的偏移（没有时为0）
+func parseEXIFIFD(tiff []byte, order binary.ByteOrder, offset int, tags map[string]string) int {
+	if offset+2 > len(tiff) {
+		return 0
+	}
+	subIFD := 0
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		tag := order.Uint16(tiff[entry:])
+		typ := order.Uint16(tiff[entry+2:])
+		n := int(order.Uint32(tiff[entry+4:]))
+		if tag == exifTagExifIFD {
+			subIFD = int(order.Uint32(tiff[entry+8:]))
+			continue
+		}
+		name, ok := exifTagNames[tag]
+		if !ok {
+			continue
+		}
+		if value, ok := exifValue(tiff, order, typ, n, entry+8); ok {
+			tags[name] = value
+		}
+	}
+	return subIFD
+}
+
+// exifValue 将EXIF条目的值转换为文本，支持ASCII、SHORT、LONG和RATIONAL类型的第一个值
+func exifValue(tiff []byte, order binary.ByteOrder, typ uint16, count, valueOffset int) (string, bool) {
+	sizes := map[uint16]int{2: 1, 3: 2, 4: 4, 5: 8}
+	size, ok := sizes[typ]
+	if !ok || count <= 0 || count > len(tiff) {
+		return "", false
+	}
+	data := valueOffset
+	if size*count > 4 {
+		data = int(order.Uint32(tiff[valueOffset:]))
+	}
+	if data < 0 || data+size*count > len(tiff) {
+		return "", false
+	}
+	switch typ {
+	case 2:
+		return strings.TrimRight(string(tiff[data:data+count]), "\x00 "), true
+	case 3:
+		return strconv.Itoa(int(order.Uint16(tiff[data:]))), true
+	case 4:
+		return strconv.FormatUint(uint64(order.Uint32(tiff[data:])), 10), true
+	}
+	num, den := order.Uint32(tiff[data:]), order.Uint32(tiff[data+4:])
+	if den == 0 {
+		return "", false
+	}
+	if num%den == 0 {
+		return strconv.FormatUint(uint64(num/den), 10), true
+	}
+	if num < den && den%num == 0 {
+		return fmt.Sprintf("1/%d", den/num), true
+	}
+	return strconv.FormatFloat(float64(num)/float64(den), 'f', -1, 64), true
+}
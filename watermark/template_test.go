@@ -0,0 +1,118 @@
+package watermark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testEXIF 构造包含Make、DateTimeOriginal、FNumber和ExposureTime的EXIF（小端TIFF结构）
+func testEXIF() []byte {
+	le := binary.LittleEndian
+	tiff := make([]byte, 122)
+	copy(tiff, "II")
+	le.PutUint16(tiff[2:], 42)
+	le.PutUint32(tiff[4:], 8)
+	entry := func(pos int, tag, typ uint16, count, value uint32) {
+		le.PutUint16(tiff[pos:], tag)
+		le.PutUint16(tiff[pos+2:], typ)
+		le.PutUint32(tiff[pos+4:], count)
+		le.PutUint32(tiff[pos+8:], value)
+	}
+	// IFD0
+	le.PutUint16(tiff[8:], 2)
+	entry(10, 0x010F, 2, 6, 38)
+	entry(22, 0x8769, 4, 1, 44)
+	copy(tiff[38:], "Canon\x00")
+	// Exif子IFD
+	le.PutUint16(tiff[44:], 3)
+	entry(46, 0x9003, 2, 20, 86)
+	entry(58, 0x829D, 5, 1, 106)
+	entry(70, 0x829A, 5, 1, 114)
+	copy(tiff[86:], "2024:05:06 07:08:09\x00")
+	le.PutUint32(tiff[106:], 28)
+	le.PutUint32(tiff[110:], 10)
+	le.PutUint32(tiff[114:], 1)
+	le.PutUint32(tiff[118:], 250)
+	return tiff
+}
+
+func TestParseEXIFTags(t *testing.T) {
+	tags := parseEXIFTags(testEXIF())
+	want := map[string]string{"Make": "Canon", "DateTimeOriginal": "2024:05:06 07:08:09", "FNumber": "2.8", "ExposureTime": "1/250"}
+	for name, value := range want {
+		if tags[name] != value {
+			t.Errorf("%s = %q, want %q", name, tags[name], value)
+		}
+	}
+	if parseEXIFTags([]byte("II*\x00\xff\xff\xff\xff")) != nil {
+		t.Error("invalid ifd offset should yield no tags")
+	}
+}
+
+func TestSourceEXIFBeforeOrientationReset(t *testing.T) {
+	origin, _ := orientedJPEG(t)
+	src, err := decodeSource(bytes.NewReader(origin), true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模板变量使用原图的方向，保存的元数据中方向已重置为1
+	if got := src.exif["Orientation"]; got != "6" {
+		t.Errorf("exif.Orientation = %q, want 6", got)
+	}
+	if src.meta == nil || !bytes.Equal(exifOrientation(append([]byte{}, src.meta.exif...)), []byte{0, 1}) {
+		t.Error("saved orientation should be reset to 1")
+	}
+}
+
+func TestTextTemplate(t *testing.T) {
+	config := TransparentTextWatermarkConfig{
+		Text:         "${user} ${date:2006-01-02 15:04} ${filename} ${width}x${height} ${exif.Make} ${exif.DateTimeOriginal:01/02} ${unknown} ${date",
+		Variables:    map[string]interface{}{"user": "alice@example.com"},
+		TemplateTime: time.Date(2024, 3, 1, 14, 3, 0, 0, time.UTC),
+	}
+	ctx := templateContext{filename: "a.jpg", width: 640, height: 480, exif: map[string]string{"Make": "Canon", "DateTimeOriginal": "2024:05:06 07:08:09"}}
+	want := "alice@example.com 2024-03-01 14:03 a.jpg 640x480 Canon 05/06 ${unknown} ${date"
+	if got := config.expandText(ctx); got != want {
+		t.Errorf("expandText = %q, want %q", got, want)
+	}
+
+	// 路径版本使用原图的文件名、尺寸和EXIF，结果应与直接写出展开后文字的结果相同
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, syntheticPhoto(200, 100), nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := writeJPEGMetadata(buf.Bytes(), &imageMetadata{exif: append(append([]byte{}, exifHeader...), testEXIF()...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := filepath.Join(dir, "photo.jpg")
+	if err := os.WriteFile(origin, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	render := func(text, output string) []byte {
+		t.Helper()
+		err := CreateTransparentTextWatermark(TransparentTextWatermarkConfig{
+			OriginImagePath: origin, CompositeImagePath: filepath.Join(dir, output), FontPath: writeTestFont(t),
+			Text: text, Size: 14, Color: White, WatermarkPos: LeftTop, Output: OutputOptions{Format: FormatPNG},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.ReadFile(filepath.Join(dir, output))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	templated := render("${filename} ${width}x${height} ${exif.DateTimeOriginal:2006/01/02}", "templated.png")
+	literal := render("photo.jpg 200x100 2024/05/06", "literal.png")
+	if !bytes.Equal(templated, literal) {
+		t.Error("templated text rendered differently from the expanded literal text")
+	}
+}
@@ -0,0 +1,173 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextAlign 多行文字对齐方式
+type TextAlign string
+
+const (
+	AlignLeft   TextAlign = ""       // 左对齐（默认）
+	AlignCenter TextAlign = "center" // 居中对齐
+	AlignRight  TextAlign = "right"  // 右对齐
+)
+
+// autoFitReferenceSize 自动字号时用于测量的参考字号
+const autoFitReferenceSize = 100
+
+// textLayout 多行文字的排版结果
+type textLayout struct {
+	lines      [][]shapedGlyph // 整形后的各行字形
+	lineWidths []int
+	width      int // 文字块宽度（最长行）
+	height     int // 文字块高度
+	lineHeight int
+	linePitch  int // 相邻两行基线的距离
+	ascent     int
+}
+
+// splitLines 按换行符拆分文字
+func splitLines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// measureText 计算给定文字的宽度和高度，宽度包含字距调整
+func measureText(face font.Face, text string) (int, int) {
+	width := font.MeasureString(face, text).Ceil()
+	height := face.Metrics().Height.Ceil()
+	return width, height
+}
+
+// layoutText 整形并计算多行文字的排版
+func layoutText(face *fallbackFace, lines []string, lineSpacing float64) textLayout {
+	metrics := face.Metrics()
+	layout := textLayout{
+		lines:      make([][]shapedGlyph, len(lines)),
+		lineWidths: make([]int, len(lines)),
+		lineHeight: metrics.Height.Ceil(),
+		ascent:     metrics.Ascent.Ceil(),
+	}
+	layout.linePitch = int(math.Round(float64(layout.lineHeight) * lineSpacing))
+	for i, line := range lines {
+		layout.lines[i] = face.shape(line)
+		layout.lineWidths[i] = face.advance(layout.lines[i]).Ceil()
+		if layout.lineWidths[i] > layout.width {
+			layout.width = layout.lineWidths[i]
+		}
+	}
+	layout.height = layout.lineHeight + (len(lines)-1)*layout.linePitch
+	return layout
+}
+
+// lineX 按对齐方式计算某一行在文字块中的起始X坐标
+func (l textLayout) lineX(i int, align TextAlign) int {
+	switch align {
+	case AlignCenter:
+		return (l.width - l.lineWidths[i]) / 2
+	case AlignRight:
+		return l.width - l.lineWidths[i]
+	}
+	return 0
+}
+
+// newFontFace 创建指定字号的字体
+func newFontFace(f *truetype.Font, size float64) font.Face {
+	return truetype.NewFace(f, &truetype.Options{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// fitFontSize 计算使文字块宽度约为目标宽度的字号
+func fitFontSize(fonts []*truetype.Font, lines []string, lineSpacing float64, targetWidth float64) float64 {
+	width := layoutText(newFallbackFace(fonts, autoFitReferenceSize), lines, lineSpacing).width
+	if width == 0 {
+		return autoFitReferenceSize
+	}
+	size := autoFitReferenceSize * targetWidth / float64(width)
+	// 字形微调会导致宽度与字号不完全成正比，逐步缩小直到不超过目标宽度
+	for i := 0; i < 5 && size > 1; i++ {
+		if float64(layoutText(newFallbackFace(fonts, size), lines, lineSpacing).width) <= targetWidth {
+			break
+		}
+		size *= 0.98
+	}
+	return size
+}
+
+// createTextImage 创建文字图像，canvasWidth为原图宽度，用于自动字号
+func createTextImage(config TransparentTextWatermarkConfig, canvasWidth int) (*image.NRGBA, error) {
+	if config.AutoFit < 0 || config.AutoFit > 1 {
+		return nil, errors.New("text auto fit error: Ensure 0.0 <= auto_fit <= 1.0")
+	}
+	if config.LineSpacing < 0 {
+		return nil, errors.New("text line spacing error: Ensure line_spacing >= 0")
+	}
+	if err := validateTextStyle(config); err != nil {
+		return nil, err
+	}
+	lineSpacing := config.LineSpacing
+	if lineSpacing == 0 {
+		lineSpacing = 1
+	}
+
+	// 加载字体及后备字体
+	fonts, err := loadFontChain(config.FontPath, config.FontFallbacks)
+	if err != nil {
+		return nil, err
+	}
+
+	// 设置字体大小
+	lines := splitLines(config.Text)
+	size := config.Size
+	if config.AutoFit > 0 {
+		size = fitFontSize(fonts, lines, lineSpacing, config.AutoFit*float64(canvasWidth))
+	}
+	face := newFallbackFace(fonts, size)
+	defer face.Close()
+
+	// 计算文字块的宽度和高度
+	layout := layoutText(face, lines, lineSpacing)
+
+	// 逐行绘制文字蒙版，再按样式合成描边、投影等效果
+	mask := image.NewAlpha(image.Rect(0, 0, layout.width, layout.height))
+	for i, glyphs := range layout.lines {
+		face.draw(mask, image.Opaque, fixed.P(layout.lineX(i, config.Align), i*layout.linePitch+layout.ascent), glyphs)
+	}
+	styled := styleText(mask, config)
+	textWidth, textHeight := styled.Bounds().Dx(), styled.Bounds().Dy()
+
+	// 文字需要旋转时，确保最终图像足够大以容纳旋转后的文本
+	padding := 0
+	if config.Rotation != 0 {
+		// 当旋转时，需要更大的画布以确保文本在旋转后不会被裁剪
+		diagonal := int(math.Sqrt(float64(textWidth*textWidth + textHeight*textHeight)))
+		padding = (diagonal - textWidth) / 2
+	}
+
+	// 创建一个完全透明的新图像
+	img := image.NewRGBA(image.Rect(0, 0, textWidth+padding*2, textHeight+padding*2))
+	draw.Draw(img, styled.Bounds().Add(image.Pt(padding, padding)), styled, image.Point{}, draw.Src)
+
+	// 如果需要旋转
+	var dst *image.NRGBA
+	if config.Rotation != 0 {
+		dst = imaging.Rotate(img, config.Rotation, color.Transparent)
+	} else {
+		dst = imaging.Clone(img)
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,211 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// TextStroke 文字描边
+type TextStroke struct {
+	Width int        // 描边宽度（像素）
+	Color color.RGBA // 描边颜色
+}
+
+// TextShadow 文字投影
+type TextShadow struct {
+	OffsetX int        // 投影水平偏移，正数向右
+	OffsetY int        // 投影垂直偏移，正数向下
+	Blur    float64    // 投影模糊半径（高斯模糊的sigma），为0时不模糊
+	Color   color.RGBA // 投影颜色
+}
+
+// TextBackground 文字背景框
+type TextBackground struct {
+	Padding int        // 文字（含描边）到背景框边缘的距离
+	Radius  int        // 圆角半径
+	Color   color.RGBA // 背景颜色
+	Opacity float64    // 背景透明度 0-1，为0时不透明
+}
+
+// TextGradient 文字线性渐变填充，设置后忽略Color
+type TextGradient struct {
+	From  color.RGBA // 起始颜色
+	To    color.RGBA // 结束颜色
+	Angle float64    // 渐变方向角度，0为从左到右，90为从上到下
+}
+
+// validateTextStyle 校验文字样式配置
+func validateTextStyle(config TransparentTextWatermarkConfig) error {
+	if config.Stroke != nil && config.Stroke.Width < 0 {
+		return errors.New("text stroke error: Ensure stroke width >= 0")
+	}
+	if config.Shadow != nil && config.Shadow.Blur < 0 {
+		return errors.New("text shadow error: Ensure shadow blur >= 0")
+	}
+	if bg := config.Background; bg != nil {
+		if bg.Padding < 0 || bg.Radius < 0 {
+			return errors.New("text background error: Ensure padding >= 0 and radius >= 0")
+		}
+		if bg.Opacity < 0 || bg.Opacity > 1 {
+			return errors.New("text background opacity error: Ensure 0.0 <= opacity <= 1.0")
+		}
+	}
+	return nil
+}
+
+// styleText 按描边、投影、背景框和渐变配置将文字蒙版合成为彩色图像
+// 图层从下到上依次为：背景框、投影、描边、文字填充
+func styleText(mask *image.Alpha, config TransparentTextWatermarkConfig) *image.RGBA {
+	textRect := mask.Bounds()
+	strokeWidth := 0
+	if config.Stroke != nil {
+		strokeWidth = config.Stroke.Width
+	}
+	outline := textRect.Inset(-strokeWidth)
+	canvasRect := outline
+	var boxRect, shadowRect image.Rectangle
+	if bg := config.Background; bg != nil {
+		boxRect = outline.Inset(-bg.Padding)
+		canvasRect = canvasRect.Union(boxRect)
+	}
+	if sh := config.Shadow; sh != nil {
+		shadowRect = outline.Add(image.Pt(sh.OffsetX, sh.OffsetY)).Inset(-int(math.Ceil(sh.Blur * 3)))
+		canvasRect = canvasRect.Union(shadowRect)
+	}
+
+	// 以画布左上角为原点
+	shift := canvasRect.Min.Mul(-1)
+	canvas := image.NewRGBA(image.Rect(0, 0, canvasRect.Dx(), canvasRect.Dy()))
+	textRect = textRect.Add(shift)
+
+	glyphs := image.NewAlpha(canvas.Bounds())
+	draw.Draw(glyphs, textRect, mask, mask.Bounds().Min, draw.Src)
+	outlineMask := glyphs
+	if strokeWidth > 0 {
+		outlineMask = dilateAlpha(glyphs, strokeWidth)
+	}
+
+	if bg := config.Background; bg != nil {
+		opacity := bg.Opacity
+		if opacity == 0 {
+			opacity = 1
+		}
+		boxColor := color.NRGBAModel.Convert(bg.Color).(color.NRGBA)
+		boxColor.A = uint8(float64(boxColor.A)*opacity + 0.5)
+		box := roundedRectMask(canvas.Bounds(), boxRect.Add(shift), bg.Radius)
+		draw.DrawMask(canvas, canvas.Bounds(), image.NewUniform(boxColor), image.Point{}, box, image.Point{}, draw.Over)
+	}
+	if sh := config.Shadow; sh != nil {
+		shadow := image.NewNRGBA(canvas.Bounds())
+		draw.DrawMask(shadow, shadow.Bounds().Add(image.Pt(sh.OffsetX, sh.OffsetY)), image.NewUniform(sh.Color), image.Point{}, outlineMask, image.Point{}, draw.Src)
+		var shadowImg image.Image = shadow
+		if sh.Blur > 0 {
+			shadowImg = imaging.Blur(shadow, sh.Blur)
+		}
+		draw.Draw(canvas, canvas.Bounds(), shadowImg, image.Point{}, draw.Over)
+	}
+	if strokeWidth > 0 {
+		draw.DrawMask(canvas, canvas.Bounds(), image.NewUniform(config.Stroke.Color), image.Point{}, outlineMask, image.Point{}, draw.Over)
+	}
+
+	var fill image.Image = image.NewUniform(config.Color)
+	if config.Gradient != nil {
+		fill = linearGradient(canvas.Bounds(), textRect, *config.Gradient)
+	}
+	draw.DrawMask(canvas, canvas.Bounds(), fill, image.Point{}, glyphs, image.Point{}, draw.Over)
+	return canvas
+}
+
+// dilateAlpha 以圆形结构元素对蒙版做膨胀，得到描边区域
+func dilateAlpha(src *image.Alpha, radius int) *image.Alpha {
+	var offsets []image.Point
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if dx*dx+dy*dy <= radius*radius {
+				offsets = append(offsets, image.Pt(dx, dy))
+			}
+		}
+	}
+	b := src.Bounds()
+	dst := image.NewAlpha(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			a := src.AlphaAt(x, y).A
+			if a == 0 {
+				continue
+			}
+			for _, o := range offsets {
+				p := image.Pt(x+o.X, y+o.Y)
+				if p.In(b) && dst.AlphaAt(p.X, p.Y).A < a {
+					dst.SetAlpha(p.X, p.Y, color.Alpha{A: a})
+				}
+			}
+		}
+	}
+	return dst
+}
+
+// roundedRectMask 生成圆角矩形蒙版，边缘做1像素抗锯齿
+func roundedRectMask(bounds, rect image.Rectangle, radius int) *image.Alpha {
+	mask := image.NewAlpha(bounds)
+	r := float64(radius)
+	if limit := float64(min(rect.Dx(), rect.Dy())) / 2; r > limit {
+		r = limit
+	}
+	left, top := float64(rect.Min.X)+r, float64(rect.Min.Y)+r
+	right, bottom := float64(rect.Max.X)-r, float64(rect.Max.Y)-r
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			// 像素中心到内部矩形的距离，落在圆角外的部分逐渐透明
+			px, py := float64(x)+0.5, float64(y)+0.5
+			dx := math.Max(math.Max(left-px, px-right), 0)
+			dy := math.Max(math.Max(top-py, py-bottom), 0)
+			coverage := r - math.Hypot(dx, dy) + 0.5
+			if coverage <= 0 {
+				continue
+			}
+			if coverage > 1 {
+				coverage = 1
+			}
+			mask.SetAlpha(x, y, color.Alpha{A: uint8(coverage*255 + 0.5)})
+		}
+	}
+	return mask
+}
+
+// linearGradient 生成覆盖文字区域的线性渐变图像
+func linearGradient(bounds, textRect image.Rectangle, gradient TextGradient) *image.NRGBA {
+	img := image.NewNRGBA(bounds)
+	rad := gradient.Angle * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	cx := float64(textRect.Min.X+textRect.Max.X) / 2
+	cy := float64(textRect.Min.Y+textRect.Max.Y) / 2
+	// 文字区域在渐变方向上的半长
+	half := (math.Abs(float64(textRect.Dx())*cos) + math.Abs(float64(textRect.Dy())*sin)) / 2
+	if half == 0 {
+		half = 1
+	}
+	from := color.NRGBAModel.Convert(gradient.From).(color.NRGBA)
+	to := color.NRGBAModel.Convert(gradient.To).(color.NRGBA)
+	lerp := func(a, b uint8, t float64) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t + 0.5)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			proj := (float64(x)+0.5-cx)*cos + (float64(y)+0.5-cy)*sin
+			t := math.Min(math.Max((proj/half+1)/2, 0), 1)
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: lerp(from.R, to.R, t),
+				G: lerp(from.G, to.G, t),
+				B: lerp(from.B, to.B, t),
+				A: lerp(from.A, to.A, t),
+			})
+		}
+	}
+	return img
+}
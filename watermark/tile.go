@@ -0,0 +1,90 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// SpacingUnit 平铺间距单位
+type SpacingUnit string
+
+const (
+	SpacingPixel   SpacingUnit = ""        // 像素（默认）
+	SpacingPercent SpacingUnit = "percent" // 原图宽/高的百分比
+)
+
+// TilePattern 平铺图案配置，设置后Tiled位置按图案自动铺满整张图片，忽略TiledRows/TiledCols
+type TilePattern struct {
+	SpacingX    float64     // 相邻水印的水平间距
+	SpacingY    float64     // 相邻水印的垂直间距
+	SpacingUnit SpacingUnit // 间距单位，像素或百分比
+	Stagger     float64     // 交错偏移 0-1，奇数行水平错开（水印宽度+间距）的比例，0.5为砖墙式排列
+	Rotation    float64     // 整个图案的旋转角度（逆时针），如30度可得到斜向铺满效果
+}
+
+// drawTilePattern 按平铺图案将水印铺满整个画布，直接修改dst
+// 旋转整个图案等价于将每个水印旋转后放在旋转后的网格点上，因此无需创建超大画布
+func drawTilePattern(dst, mark *image.NRGBA, pattern TilePattern, opacity float64, mode BlendMode) error {
+	if pattern.Stagger < 0 || pattern.Stagger > 1 {
+		return errors.New("watermark tile stagger error: Ensure 0.0 <= stagger <= 1.0")
+	}
+	if pattern.SpacingX < 0 || pattern.SpacingY < 0 {
+		return errors.New("watermark tile spacing error: Ensure spacing >= 0")
+	}
+	width, height := dst.Bounds().Dx(), dst.Bounds().Dy()
+	markW, markH := mark.Bounds().Dx(), mark.Bounds().Dy()
+	if markW == 0 || markH == 0 || width == 0 || height == 0 {
+		return nil
+	}
+
+	spacingX, spacingY := pattern.SpacingX, pattern.SpacingY
+	switch pattern.SpacingUnit {
+	case SpacingPixel:
+	case SpacingPercent:
+		spacingX = spacingX * float64(width) / 100
+		spacingY = spacingY * float64(height) / 100
+	default:
+		return errors.New("watermark tile spacing unit error")
+	}
+	stepX := float64(markW) + spacingX
+	stepY := float64(markH) + spacingY
+
+	rotated := mark
+	if pattern.Rotation != 0 {
+		rotated = imaging.Rotate(mark, pattern.Rotation, color.Transparent)
+	}
+	rotW, rotH := rotated.Bounds().Dx(), rotated.Bounds().Dy()
+	sin, cos := math.Sincos(pattern.Rotation * math.Pi / 180)
+
+	// 以原图中心为原点，覆盖原图外接圆范围内的所有网格点
+	centerX, centerY := float64(width)/2, float64(height)/2
+	radius := math.Hypot(float64(width), float64(height))/2 + math.Hypot(float64(rotW), float64(rotH))
+	rows := int(math.Ceil(radius/stepY)) + 1
+	cols := int(math.Ceil(radius/stepX)) + 1
+
+	layer := image.NewNRGBA(dst.Bounds())
+	for r := -rows; r <= rows; r++ {
+		shift := 0.0
+		if r%2 != 0 {
+			shift = pattern.Stagger * stepX
+		}
+		for c := -cols; c <= cols; c++ {
+			u := float64(c)*stepX + shift
+			v := float64(r) * stepY
+			// 逆时针旋转（图像坐标系y轴向下）
+			x := centerX + u*cos + v*sin
+			y := centerY - u*sin + v*cos
+			rect := image.Rect(0, 0, rotW, rotH).Add(image.Pt(int(math.Round(x-float64(rotW)/2)), int(math.Round(y-float64(rotH)/2))))
+			if !rect.Overlaps(layer.Bounds()) {
+				continue
+			}
+			draw.Draw(layer, rect, rotated, image.Point{}, draw.Over)
+		}
+	}
+	return overlayMark(dst, layer, dst.Bounds().Min, opacity, mode)
+}
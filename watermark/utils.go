@@ -1,10 +1,13 @@
 package watermark
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	"image/gif"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
@@ -45,6 +48,7 @@ func init() {
 }
 
 // LoadFont 加载字体文件，如果fontPath为空则使用默认字体
+// fontPath也可以是通过RegisterFont注册的字体名，加载结果会被缓存
 func LoadFont(fontPath string) (*truetype.Font, error) {
 	if fontPath == "" {
 		if DefaultFont == nil {
@@ -52,40 +56,12 @@ func LoadFont(fontPath string) (*truetype.Font, error) {
 		}
 		return DefaultFont, nil
 	}
-
-	fontData, err := os.ReadFile(fontPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read font file: %w", err)
-	}
-
-	font, err := freetype.ParseFont(fontData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse font: %w", err)
-	}
-
-	return font, nil
+	return DefaultFontRegistry.Load(fontPath)
 }
 
-// MeasureText 计算给定文字的宽度和高度
+// MeasureText 计算给定文字的宽度和高度，宽度包含字距调整
 func MeasureText(face font.Face, text string) (int, int) {
-	var (
-		width  int
-		height int
-	)
-	// 获取字体的度量信息
-	metrics := face.Metrics()
-
-	// 遍历每个字符，计算总宽度
-	for _, textRune := range text {
-		// 获取字符的水平间距
-		advance, _ := face.GlyphAdvance(textRune)
-		width += int(advance >> 6)
-	}
-
-	// 计算高度
-	height = int(metrics.Height >> 6)
-
-	return width, height
+	return measureText(face, text)
 }
 
 // CreateTextImage 创建文字图像
@@ -165,3 +141,70 @@ func PrepareOutputPath(path string) error {
 
 	return nil
 }
+
+// sourceImage 解码后的原图及其格式、元数据
+type sourceImage struct {
+	img    image.Image
+	format imaging.Format
+	meta   *imageMetadata    // 仅在要求保留元数据且原图为JPEG时存在
+	anim   *gif.GIF          // 仅在原图为多帧GIF动图时存在
+	name   string            // 原图文件路径，流式处理时为空
+	exif   map[string]string // 原图的EXIF标签，用于文字模板变量
+}
+
+// decodeSource 从io.Reader解码原图
+// autoOrient为true时按EXIF方向信息旋转图片，keepMetadata为true时提取EXIF、ICC和XMP元数据
+func decodeSource(r io.Reader, autoOrient, keepMetadata bool) (*sourceImage, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := decodeImageData(data, autoOrient)
+	if err != nil {
+		return nil, err
+	}
+	src := &sourceImage{img: img, format: format}
+	if format == imaging.JPEG {
+		// EXIF标签用于文字模板变量，只在要求时才保留元数据
+		meta := readJPEGMetadata(data, autoOrient)
+		if meta != nil {
+			src.exif = meta.tags
+		}
+		if keepMetadata {
+			src.meta = meta
+		}
+	}
+	if format == imaging.GIF {
+		if anim, err := gif.DecodeAll(bytes.NewReader(data)); err == nil && len(anim.Image) > 1 {
+			src.anim = anim
+		}
+	}
+	return src, nil
+}
+
+// decodeImage 从io.Reader解码水印等辅助图片，同时返回原图格式
+// 只解码第一帧，不读取元数据，原图请使用decodeSource
+func decodeImage(r io.Reader) (image.Image, imaging.Format, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return decodeImageData(data, false)
+}
+
+// decodeImageData 解码图片数据，autoOrient为true时按EXIF方向信息旋转图片
+func decodeImageData(data []byte, autoOrient bool) (image.Image, imaging.Format, error) {
+	_, formatName, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	format, err := imaging.FormatFromExtension(formatName)
+	if err != nil {
+		return nil, 0, err
+	}
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(autoOrient))
+	if err != nil {
+		return nil, 0, err
+	}
+	return img, format, nil
+}
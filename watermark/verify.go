@@ -0,0 +1,455 @@
+package watermark
+
+import (
+	"errors"
+	"image"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/disintegration/imaging"
+)
+
+// 水印检测：将参考水印转换为亮度模板，在候选图上做多尺度归一化互相关（NCC）模板匹配。
+// 先在缩小的候选图上粗搜所有缩放比例和位置，再从原图中裁出候选位置附近的区域按原分辨率精调，
+// 不生成整张原图的亮度平面，内存不随原图尺寸增长。
+// 模板取水印叠加在中性灰上的亮度，透明区域也参与匹配，因此单色的文字水印同样适用；
+// 得分取相关系数的绝对值，反色叠加（如自适应混合）的水印也能检出。
+const (
+	// DefaultVerifyThreshold 默认判定为含有水印的最低置信度
+	DefaultVerifyThreshold = 0.6
+
+	defaultVerifyMaxMatches = 16
+	verifyCoarseSize        = 200  // 粗搜时候选图长边的像素数
+	verifyMaxCoarse         = 1024 // 粗搜时候选图长边的最大像素数，极小的水印在大图上也不超过该尺寸
+	verifyMinTemplate       = 10   // 粗搜时模板短边的最小像素数
+	verifyScaleRatio        = 1.1  // 默认相邻两个搜索比例的倍数
+	verifyOverlap           = 0.3  // 两个匹配区域的交并比超过该值时只保留得分高的
+)
+
+// VerifyConfig 水印检测配置，Reference、Layers、Profile三选一
+type VerifyConfig struct {
+	Reference  image.Image // 参考水印图，按其原始尺寸乘以缩放比例搜索
+	Layers     []Layer     // 水印图层，按候选图尺寸缩放或渲染后作为参考水印
+	Profile    *Profile    // 水印配置文件，同Layers
+	MinScale   float64     // 参考水印的最小缩放比例，默认Reference为0.25，Layers和Profile为0.5
+	MaxScale   float64     // 参考水印的最大缩放比例，默认Reference为2，Layers和Profile为2
+	ScaleSteps int         // 最小到最大缩放比例之间等比搜索的步数，默认为范围内1.1的整数次幂
+	Threshold  float64     // 判定为含有水印的最低置信度（0-1），默认0.6
+	MaxMatches int         // 最多返回的匹配位置数，默认16
+}
+
+// VerifyMatch 检测到的一处水印
+type VerifyMatch struct {
+	Bounds image.Rectangle // 水印在候选图中的位置
+	Score  float64         // 匹配置信度（0-1）
+	Scale  float64         // 相对参考水印的缩放比例
+	Layer  int             // 匹配的参考水印序号，Reference固定为0
+}
+
+// VerifyResult 水印检测结果
+type VerifyResult struct {
+	Found      bool          // 最高置信度是否达到阈值
+	Confidence float64       // 所有位置中的最高匹配置信度
+	Matches    []VerifyMatch // 置信度达到阈值的位置，按置信度从高到低排列
+}
+
+// VerifyFile 检测图片文件中是否含有参考水印
+func VerifyFile(path string, config VerifyConfig) (*VerifyResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("open image file error:" + err.Error())
+	}
+	defer file.Close()
+	img, _, err := decodeImage(file)
+	if err != nil {
+		return nil, errors.New("decode image error:" + err.Error())
+	}
+	return Verify(img, config)
+}
+
+// Verify 在候选图中搜索参考水印，返回置信度和检测到的位置
+// 水印被裁掉或未添加时置信度较低，Found为false
+func Verify(img image.Image, config VerifyConfig) (*VerifyResult, error) {
+	if img == nil {
+		return nil, errors.New("image must not be nil")
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("image must not be empty")
+	}
+	refs, err := verifyReferences(bounds.Dx(), bounds.Dy(), &config)
+	if err != nil {
+		return nil, err
+	}
+	if config.MinScale <= 0 || config.MaxScale < config.MinScale {
+		return nil, errors.New("verify scale range error")
+	}
+	if config.Threshold == 0 {
+		config.Threshold = DefaultVerifyThreshold
+	}
+	if config.MaxMatches <= 0 {
+		config.MaxMatches = defaultVerifyMaxMatches
+	}
+	scales := verifyScales(config.MinScale, config.MaxScale, config.ScaleSteps)
+
+	planes := make(map[float64]*verifyPlane)
+	var candidates []VerifyMatch
+	for i, ref := range refs {
+		candidates = append(candidates, coarseSearch(img, planes, ref, i, scales, config.Threshold)...)
+	}
+
+	result := &VerifyResult{}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+	candidates = suppressMatches(candidates, 2*config.MaxMatches)
+	refined := make([]VerifyMatch, len(candidates))
+	for i, c := range candidates {
+		refined[i] = refine(img, refs[c.Layer], c)
+	}
+	refined = suppressMatches(refined, len(refined))
+	result.Confidence = refined[0].Score
+	result.Found = result.Confidence >= config.Threshold
+	for _, m := range refined {
+		if m.Score < config.Threshold || len(result.Matches) == config.MaxMatches {
+			break
+		}
+		m.Bounds = m.Bounds.Add(bounds.Min)
+		result.Matches = append(result.Matches, m)
+	}
+	return result, nil
+}
+
+// verifyScales 生成从小到大的搜索比例：steps大于0时在[min, max]内按等比取steps个，
+// 否则取1.1的整数次幂，保证原始尺寸（比例1）在范围内时被精确搜索
+func verifyScales(min, max float64, steps int) []float64 {
+	var scales []float64
+	if steps > 0 {
+		for i := 0; i < steps; i++ {
+			scale := min
+			if steps > 1 {
+				scale *= math.Pow(max/min, float64(i)/float64(steps-1))
+			}
+			scales = append(scales, scale)
+		}
+		return scales
+	}
+	first := int(math.Ceil(math.Log(min)/math.Log(verifyScaleRatio) - 1e-9))
+	last := int(math.Floor(math.Log(max)/math.Log(verifyScaleRatio) + 1e-9))
+	for k := first; k <= last; k++ {
+		scales = append(scales, math.Pow(verifyScaleRatio, float64(k)))
+	}
+	if len(scales) == 0 {
+		scales = append(scales, min)
+	}
+	return scales
+}
+
+// verifyReferences 加载参考水印并填充默认缩放范围
+func verifyReferences(width, height int, config *VerifyConfig) ([]*image.NRGBA, error) {
+	set := 0
+	if config.Reference != nil {
+		set++
+	}
+	if len(config.Layers) > 0 {
+		set++
+	}
+	if config.Profile != nil {
+		set++
+	}
+	if set != 1 {
+		return nil, errors.New("verify needs exactly one of reference, layers or profile")
+	}
+	if config.Reference != nil {
+		if config.Reference.Bounds().Empty() {
+			return nil, errors.New("reference watermark must not be empty")
+		}
+		if config.MinScale == 0 {
+			config.MinScale = 0.25
+		}
+		if config.MaxScale == 0 {
+			config.MaxScale = 2
+		}
+		return []*image.NRGBA{imaging.Clone(config.Reference)}, nil
+	}
+	layers := config.Layers
+	if config.Profile != nil {
+		var err error
+		if layers, err = config.Profile.WatermarkLayers(); err != nil {
+			return nil, err
+		}
+	}
+	prepared, err := prepareLayers(layers, templateContext{width: width, height: height})
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]*image.NRGBA, len(prepared))
+	for i, layer := range prepared {
+		refs[i] = layer.mark
+	}
+	if config.MinScale == 0 {
+		config.MinScale = 0.5
+	}
+	if config.MaxScale == 0 {
+		config.MaxScale = 2
+	}
+	return refs, nil
+}
+
+// verifyTemplate 参考水印在某一尺寸下的亮度模板，pix已减去均值
+type verifyTemplate struct {
+	w, h int
+	pix  []float64
+	norm float64 // 去均值后的平方和的平方根
+}
+
+// newVerifyTemplate 将水印缩放到w x h并叠加在中性灰上取亮度，模板无亮度变化时返回nil
+func newVerifyTemplate(mark *image.NRGBA, w, h int) *verifyTemplate {
+	if w < 2 || h < 2 {
+		return nil
+	}
+	if w != mark.Bounds().Dx() || h != mark.Bounds().Dy() {
+		mark = imaging.Resize(mark, w, h, imaging.Linear)
+	}
+	t := &verifyTemplate{w: w, h: h, pix: make([]float64, w*h)}
+	sum := 0.0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := float64(mark.Pix[mark.PixOffset(x, y)+3]) / 255
+			v := 128 + a*(nrgbaLuminance(mark, x, y)-128)
+			t.pix[y*w+x] = v
+			sum += v
+		}
+	}
+	mean := sum / float64(w*h)
+	for i := range t.pix {
+		t.pix[i] -= mean
+		t.norm += t.pix[i] * t.pix[i]
+	}
+	if t.norm < 1e-6*float64(w*h) {
+		return nil
+	}
+	t.norm = math.Sqrt(t.norm)
+	return t
+}
+
+// verifyPlane 候选图在某一缩放倍数下的亮度平面及其积分图
+type verifyPlane struct {
+	*lumaPlane
+	sum, sumSq []float64 // (w+1) x (h+1)的积分图
+}
+
+// newVerifyPlane 按factor缩放候选图并计算积分图
+func newVerifyPlane(img image.Image, factor float64) *verifyPlane {
+	if factor < 1 {
+		w := max(1, int(float64(img.Bounds().Dx())*factor+0.5))
+		h := max(1, int(float64(img.Bounds().Dy())*factor+0.5))
+		img = imaging.Resize(img, w, h, imaging.Linear)
+	}
+	p := &verifyPlane{lumaPlane: newLumaPlane(img)}
+	stride := p.w + 1
+	p.sum = make([]float64, stride*(p.h+1))
+	p.sumSq = make([]float64, stride*(p.h+1))
+	for y := 0; y < p.h; y++ {
+		rowSum, rowSq := 0.0, 0.0
+		for x := 0; x < p.w; x++ {
+			v := p.pix[y*p.w+x]
+			rowSum += v
+			rowSq += v * v
+			p.sum[(y+1)*stride+x+1] = p.sum[y*stride+x+1] + rowSum
+			p.sumSq[(y+1)*stride+x+1] = p.sumSq[y*stride+x+1] + rowSq
+		}
+	}
+	return p
+}
+
+// ncc 模板左上角位于(x, y)时的归一化互相关系数绝对值，区域无亮度变化时为0
+func (p *verifyPlane) ncc(t *verifyTemplate, x, y int) float64 {
+	stride := p.w + 1
+	a, b := y*stride+x, (y+t.h)*stride+x
+	sum := p.sum[b+t.w] - p.sum[b] - p.sum[a+t.w] + p.sum[a]
+	sumSq := p.sumSq[b+t.w] - p.sumSq[b] - p.sumSq[a+t.w] + p.sumSq[a]
+	n := float64(t.w * t.h)
+	variance := sumSq - sum*sum/n
+	if variance < 1e-6*n {
+		return 0
+	}
+	dot := 0.0
+	for ty := 0; ty < t.h; ty++ {
+		row := p.pix[(y+ty)*p.w+x : (y+ty)*p.w+x+t.w]
+		tpl := t.pix[ty*t.w : (ty+1)*t.w]
+		for tx, v := range row {
+			dot += v * tpl[tx]
+		}
+	}
+	return math.Min(1, math.Abs(dot)/(math.Sqrt(variance)*t.norm))
+}
+
+// coarseSearch 在缩小的候选图上搜索所有缩放比例，返回得分的局部极大值（原图坐标）
+// 得分低于阈值的位置只保留全局最高的一个，用于报告置信度
+func coarseSearch(img image.Image, planes map[float64]*verifyPlane, mark *image.NRGBA, layer int, scales []float64, threshold float64) []VerifyMatch {
+	markW, markH := float64(mark.Bounds().Dx()), float64(mark.Bounds().Dy())
+	var matches []VerifyMatch
+	best := VerifyMatch{Score: -1}
+	lenient := 0.7 * threshold
+	for _, scale := range scales {
+		factor := coarseFactor(img.Bounds().Size(), mark, scale)
+		plane := planes[factor]
+		if plane == nil {
+			plane = newVerifyPlane(img, factor)
+			planes[factor] = plane
+		}
+		t := newVerifyTemplate(mark, int(markW*scale*factor+0.5), int(markH*scale*factor+0.5))
+		if t == nil || t.w > plane.w || t.h > plane.h {
+			continue
+		}
+		mw, mh := plane.w-t.w+1, plane.h-t.h+1
+		scores := make([]float64, mw*mh)
+		parallelRows(mh, func(y int) {
+			for x := 0; x < mw; x++ {
+				scores[y*mw+x] = plane.ncc(t, x, y)
+			}
+		})
+		toMatch := func(x, y int, score float64) VerifyMatch {
+			x0, y0 := int(float64(x)/factor+0.5), int(float64(y)/factor+0.5)
+			w, h := int(markW*scale+0.5), int(markH*scale+0.5)
+			return VerifyMatch{Bounds: image.Rect(x0, y0, x0+w, y0+h), Score: score, Scale: scale, Layer: layer}
+		}
+		for y := 0; y < mh; y++ {
+			for x := 0; x < mw; x++ {
+				s := scores[y*mw+x]
+				if s > best.Score {
+					best = toMatch(x, y, s)
+				}
+				if s < lenient || !isLocalMax(scores, mw, mh, x, y) {
+					continue
+				}
+				matches = append(matches, toMatch(x, y, s))
+			}
+		}
+	}
+	if len(matches) == 0 && best.Score >= 0 {
+		matches = append(matches, best)
+	}
+	return matches
+}
+
+// parallelRows 用与CPU数相同的协程并发处理0到n-1行
+func parallelRows(n int, fn func(y int)) {
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for i := min(n, runtime.GOMAXPROCS(0)); i > 0; i-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := int(next.Add(1)) - 1; y < n; y = int(next.Add(1)) - 1 {
+				fn(y)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// coarseFactor 按某一缩放比例粗搜时尺寸为size的候选图的缩放倍数，长边缩小到约200像素，
+// 但模板短边不小于10像素，长边不超过1024像素
+// 倍数按1/64取整，便于不同比例和参考水印共用同一平面
+func coarseFactor(size image.Point, mark *image.NRGBA, scale float64) float64 {
+	short := float64(min(mark.Bounds().Dx(), mark.Bounds().Dy()))
+	long := float64(max(size.X, size.Y))
+	factor := float64(verifyCoarseSize) / long
+	factor = math.Max(factor, verifyMinTemplate/(scale*short))
+	factor = math.Min(factor, verifyMaxCoarse/long)
+	return math.Min(1, math.Ceil(factor*64)/64)
+}
+
+// isLocalMax 判断得分是否为3x3邻域内的极大值
+func isLocalMax(scores []float64, w, h, x, y int) bool {
+	s := scores[y*w+x]
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			nx, ny := x+dx, y+dy
+			if (dx == 0 && dy == 0) || nx < 0 || ny < 0 || nx >= w || ny >= h {
+				continue
+			}
+			if scores[ny*w+nx] > s {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// refineScales 精调时相对粗搜比例尝试的倍数
+var refineScales = []float64{1, 0.98, 1.02, 0.96, 1.04}
+
+// refine 在原图分辨率上于粗搜位置附近搜索位置和缩放比例，搜索半径略大于粗搜平面的一个像素
+// 只对覆盖所有尝试位置的原图区域计算亮度平面
+func refine(img image.Image, mark *image.NRGBA, c VerifyMatch) VerifyMatch {
+	markW, markH := float64(mark.Bounds().Dx()), float64(mark.Bounds().Dy())
+	size := img.Bounds().Size()
+	radius := int(math.Ceil(1/coarseFactor(size, mark, c.Scale))) + 1
+	maxScale := c.Scale * refineScales[len(refineScales)-1]
+	padX := radius + max(0, int(markW*maxScale+0.5)-c.Bounds.Dx())/2 + 1
+	padY := radius + max(0, int(markH*maxScale+0.5)-c.Bounds.Dy())/2 + 1
+	area := c.Bounds.Inset(-max(padX, padY)).Intersect(image.Rect(0, 0, size.X, size.Y))
+	p := newVerifyPlane(imaging.Crop(img, area.Add(img.Bounds().Min)), 1)
+	best := c
+	best.Score = 0
+	for _, k := range refineScales {
+		scale := c.Scale * k
+		t := newVerifyTemplate(mark, int(markW*scale+0.5), int(markH*scale+0.5))
+		if t == nil || t.w > p.w || t.h > p.h {
+			continue
+		}
+		// 平面坐标相对area左上角
+		cx := c.Bounds.Min.X + (c.Bounds.Dx()-t.w)/2 - area.Min.X
+		cy := c.Bounds.Min.Y + (c.Bounds.Dy()-t.h)/2 - area.Min.Y
+		for y := max(0, cy-radius); y <= min(p.h-t.h, cy+radius); y++ {
+			for x := max(0, cx-radius); x <= min(p.w-t.w, cx+radius); x++ {
+				if s := p.ncc(t, x, y); s > best.Score {
+					r := image.Rect(x, y, x+t.w, y+t.h).Add(area.Min)
+					best = VerifyMatch{Bounds: r, Score: s, Scale: scale, Layer: c.Layer}
+				}
+			}
+		}
+	}
+	return best
+}
+
+// suppressMatches 按得分从高到低排序，去掉与更高得分区域重叠过多的匹配，最多保留limit个
+func suppressMatches(matches []VerifyMatch, limit int) []VerifyMatch {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	kept := make([]VerifyMatch, 0, min(limit, len(matches)))
+	for _, m := range matches {
+		overlapped := false
+		for _, k := range kept {
+			if overlapRatio(m.Bounds, k.Bounds) > verifyOverlap {
+				overlapped = true
+				break
+			}
+		}
+		if !overlapped {
+			kept = append(kept, m)
+			if len(kept) == limit {
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// overlapRatio 两个矩形的交并比
+func overlapRatio(a, b image.Rectangle) float64 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	i := float64(inter.Dx() * inter.Dy())
+	return i / (float64(a.Dx()*a.Dy()+b.Dx()*b.Dy()) - i)
+}
@@ -0,0 +1,246 @@
+package watermark
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestVerify(t *testing.T) {
+	text := TransparentTextWatermarkConfig{
+		FontPath:     writeTestFont(t),
+		Text:         "SmartRick",
+		Size:         32,
+		Color:        White,
+		WatermarkPos: RightBottom,
+		OffsetX:      20,
+		OffsetY:      20,
+		Opacity:      0.6,
+	}
+	layers := []Layer{TextLayer(text)}
+	photo := syntheticPhoto(480, 320)
+	marked, err := AddWatermarkLayers(photo, layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, marked, &jpeg.Options{Quality: 80}); err != nil {
+		t.Fatal(err)
+	}
+	recompressed, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 水印实际所在的区域
+	mark, err := createTextImage(text, photo.Bounds().Dx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := image.Rect(480-20-mark.Bounds().Dx(), 320-20-mark.Bounds().Dy(), 480-20, 320-20)
+
+	cases := []struct {
+		name  string
+		img   image.Image
+		found bool
+	}{
+		{"marked", marked, true},
+		{"jpeg", recompressed, true},
+		{"resized", imaging.Resize(marked, 360, 0, imaging.Linear), true},
+		{"clean", photo, false},
+		{"cropped", imaging.Crop(marked, image.Rect(0, 0, 300, 240)), false},
+	}
+	for _, c := range cases {
+		result, err := Verify(c.img, VerifyConfig{Layers: layers})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if result.Found != c.found {
+			t.Errorf("%s: found = %v (confidence %.3f), want %v", c.name, result.Found, result.Confidence, c.found)
+		}
+		if c.found != (len(result.Matches) > 0) {
+			t.Errorf("%s: %d matches", c.name, len(result.Matches))
+		}
+	}
+
+	result, err := Verify(marked, VerifyConfig{Layers: layers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := result.Matches[0]; overlapRatio(m.Bounds, want) < 0.9 || m.Scale != 1 {
+		t.Errorf("match = %v at scale %v, want %v", m.Bounds, m.Scale, want)
+	}
+	// 候选图坐标不从原点开始时，位置按候选图坐标返回
+	sub := imaging.Clone(marked)
+	sub.Rect = sub.Rect.Add(image.Pt(100, 50))
+	if result, err = Verify(sub, VerifyConfig{Layers: layers}); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Found || overlapRatio(result.Matches[0].Bounds, want.Add(image.Pt(100, 50))) < 0.9 {
+		t.Errorf("offset image matches = %v", result.Matches)
+	}
+
+	if _, err = Verify(marked, VerifyConfig{}); err == nil {
+		t.Error("expected error without reference")
+	}
+	if _, err = Verify(marked, VerifyConfig{Reference: mark, Layers: layers}); err == nil {
+		t.Error("expected error with both reference and layers")
+	}
+}
+
+func TestVerifyLargeImage(t *testing.T) {
+	// 随机噪声参考水印，不与合成照片的周期纹理相似
+	ref := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	rng := rand.New(rand.NewSource(1))
+	for i := range ref.Pix {
+		ref.Pix[i] = uint8(rng.Intn(256))
+		if i%4 == 3 {
+			ref.Pix[i] = 255
+		}
+	}
+	photo := syntheticPhoto(3000, 2000)
+	want := image.Rect(2000, 1500, 2400, 1700)
+	draw.Draw(photo, want, ref, image.Point{}, draw.Src)
+
+	// 精调只处理候选位置附近的区域，不为整张原图生成每像素24字节的亮度平面和积分图
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	result, err := Verify(photo, VerifyConfig{Reference: ref, MinScale: 1, MaxScale: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+	if !result.Found || result.Matches[0].Bounds != want {
+		t.Errorf("matches = %v, confidence %.3f", result.Matches, result.Confidence)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 64<<20 {
+		t.Errorf("allocated %d MB", alloc>>20)
+	}
+}
+
+func TestVerifyTiledReference(t *testing.T) {
+	code := CodeOptions{Content: "SmartRick", ModuleSize: 3, TransparentBackground: true}
+	reference, err := RenderCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := CodeWatermarkConfig{Code: code}
+	config.WatermarkPos = Tiled
+	config.TiledRows, config.TiledCols = 2, 2
+	config.Opacity = 0.5
+	marked, err := AddCodeWatermark(syntheticPhoto(400, 400), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 缩小一半后仍能在参考水印0.5倍的比例上找到全部4处
+	small := imaging.Resize(marked, 200, 200, imaging.Linear)
+	result, err := Verify(small, VerifyConfig{Reference: reference})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Found || len(result.Matches) != 4 {
+		t.Fatalf("found = %v, %d matches", result.Found, len(result.Matches))
+	}
+	for _, m := range result.Matches {
+		if math.Abs(m.Scale-0.5) > 0.05 {
+			t.Errorf("match %v scale = %v, want 0.5", m.Bounds, m.Scale)
+		}
+	}
+}
+
+func TestVerifyProfile(t *testing.T) {
+	profile := &Profile{Layers: []ProfileLayer{{
+		Type:     LayerText,
+		Text:     "SmartRick",
+		Font:     writeTestFont(t),
+		Size:     32,
+		Color:    "white",
+		Position: RightBottom,
+		OffsetX:  20,
+		OffsetY:  20,
+		Opacity:  0.6,
+	}}}
+	photo := syntheticPhoto(480, 320)
+	marked, err := profile.Apply(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name  string
+		img   image.Image
+		found bool
+	}{
+		{"marked", marked, true},
+		{"clean", photo, false},
+	} {
+		result, err := Verify(c.img, VerifyConfig{Profile: profile})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if result.Found != c.found {
+			t.Errorf("%s: found = %v (confidence %.3f), want %v", c.name, result.Found, result.Confidence, c.found)
+		}
+	}
+	if _, err = Verify(marked, VerifyConfig{Profile: profile, Layers: []Layer{TextLayer(profile.TextConfig(profile.Layers[0]))}}); err == nil {
+		t.Error("expected error with both profile and layers")
+	}
+	invalid := &Profile{Layers: []ProfileLayer{{Type: LayerImage, Image: "missing.png"}}}
+	if _, err = Verify(marked, VerifyConfig{Profile: invalid}); err == nil {
+		t.Error("expected error for profile with missing watermark image")
+	}
+}
+
+func TestVerifyTiledText(t *testing.T) {
+	text := TransparentTextWatermarkConfig{
+		FontPath:     writeTestFont(t),
+		Text:         "CONFIDENTIAL",
+		Size:         20,
+		Color:        White,
+		WatermarkPos: Tiled,
+		TiledRows:    2,
+		TiledCols:    3,
+		Opacity:      0.5,
+	}
+	layers := []Layer{TextLayer(text)}
+	photo := syntheticPhoto(600, 400)
+	marked, err := AddWatermarkLayers(photo, layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Verify(marked, VerifyConfig{Layers: layers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Found || len(result.Matches) != 6 {
+		t.Fatalf("found = %v, %d matches", result.Found, len(result.Matches))
+	}
+	// 6处匹配分布在2行3列，坐标相差不超过3像素视为同一行（列）
+	var xs, ys []int
+	distinct := func(values []int, v int) []int {
+		for _, u := range values {
+			if abs(u-v) <= 3 {
+				return values
+			}
+		}
+		return append(values, v)
+	}
+	for _, m := range result.Matches {
+		xs = distinct(xs, m.Bounds.Min.X)
+		ys = distinct(ys, m.Bounds.Min.Y)
+		if m.Scale != 1 {
+			t.Errorf("match %v scale = %v, want 1", m.Bounds, m.Scale)
+		}
+	}
+	if len(xs) != 3 || len(ys) != 2 {
+		t.Errorf("matches = %v, want a 2x3 grid", result.Matches)
+	}
+	if result, err = Verify(photo, VerifyConfig{Layers: layers}); err != nil || result.Found {
+		t.Errorf("clean image: found = %v, err = %v", result != nil && result.Found, err)
+	}
+}
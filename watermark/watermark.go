@@ -4,28 +4,40 @@ import (
 	"errors"
 	"image"
 	"image/color"
-	"image/draw"
-	"math"
+	"io"
 	"os"
-	"path/filepath"
+	"time"
 
-	"github.com/SmartRick/my-go-sdk/common"
 	"github.com/disintegration/imaging"
-	"github.com/golang/freetype/truetype"
-	"golang.org/x/image/font"
-	"golang.org/x/image/math/fixed"
 )
 
 type ImageWatermarkConfig struct {
-	OriginImagePath    string       // 原图地址
-	WatermarkImagePath string       // 水印图地址
-	WatermarkPos       WatermarkPos // 水印位置
-	CompositeImagePath string       // 合成图地址
-	OffsetX            int          // 水印位置偏移量X
-	OffsetY            int          // 水印位置偏移量Y
-	Opacity            float64      // 水印透明度
-	TiledRows          int          // 水印图横向平铺行数
-	TiledCols          int          // 水印图横向平铺列数
+	OriginImagePath    string         // 原图地址
+	WatermarkImagePath string         // 水印图地址
+	WatermarkPos       WatermarkPos   // 水印位置
+	CompositeImagePath string         // 合成图地址
+	OffsetX            int            // 水印位置偏移量X
+	OffsetY            int            // 水印位置偏移量Y
+	OffsetXPercent     float64        // 水印位置偏移量X，按原图宽度的百分比计算，与OffsetX叠加
+	OffsetYPercent     float64        // 水印位置偏移量Y，按原图高度的百分比计算，与OffsetY叠加
+	AnchorX            float64        // 水印锚点X比例 0-1（仅Relative位置时使用）
+	AnchorY            float64        // 水印锚点Y比例 0-1（仅Relative位置时使用）
+	Opacity            float64        // 水印透明度
+	BlendMode          BlendMode      // 混合模式，默认正常覆盖
+	TiledRows          int            // 水印图横向平铺行数
+	TiledCols          int            // 水印图横向平铺列数
+	TilePattern        *TilePattern   // 平铺图案（仅Tiled位置时使用），设置后自动计算数量并忽略TiledRows/TiledCols
+	ScaleMode          ScaleMode      // 水印缩放模式，默认缩放为原图宽度的1/5
+	ScaleWidth         int            // 固定缩放宽度（仅ScaleFixed时使用）
+	ScaleHeight        int            // 固定缩放高度（仅ScaleFixed时使用）
+	ScalePercent       float64        // 水印长边占原图短边/长边的百分比（仅ScaleShortEdge/ScaleLongEdge时使用）
+	MinWatermarkSize   int            // 缩放后水印长边的最小像素，0表示不限制
+	MaxWatermarkSize   int            // 缩放后水印长边的最大像素，0表示不限制
+	ResampleFilter     ResampleFilter // 重采样滤波器，默认Lanczos
+	Output             OutputOptions  // 输出格式及编码质量选项
+	AutoOrient         bool           // 是否根据EXIF方向信息自动旋转原图
+	KeepMetadata       bool           // 是否将原图的EXIF（方向除外）、ICC和XMP元数据写入JPEG输出
+	GIF                GIFOptions     // GIF动图处理选项
 }
 
 type WatermarkPos string
@@ -36,8 +48,16 @@ const (
 	LeftBottom  WatermarkPos = "left_bottom"
 	RightBottom WatermarkPos = "right_bottom"
 	Tiled       WatermarkPos = "tiled"
+
+	Center       WatermarkPos = "center"        // 居中
+	TopCenter    WatermarkPos = "top_center"    // 顶部居中
+	BottomCenter WatermarkPos = "bottom_center" // 底部居中
+	LeftCenter   WatermarkPos = "left_center"   // 左侧居中
+	RightCenter  WatermarkPos = "right_center"  // 右侧居中
+	Relative     WatermarkPos = "relative"      // 按AnchorX/AnchorY比例定位
 )
 
+// CreateImageWatermark 根据配置中的文件路径创建图片水印
 func CreateImageWatermark(config ImageWatermarkConfig) error {
 	watermarkFile, err := os.Open(config.WatermarkImagePath)
 	if err != nil {
@@ -50,23 +70,81 @@ func CreateImageWatermark(config ImageWatermarkConfig) error {
 		return errors.New("open origin image file error:" + err.Error())
 	}
 	defer originFile.Close()
-	// 如果合成图片存在则删除重新生成
-	isExists, _ := common.PathExists(config.CompositeImagePath)
-	if isExists {
-		err = os.Remove(config.CompositeImagePath)
-		if err != nil {
-			return errors.New("old composite image remove error:" + err.Error())
-		}
-	}
-	// 判断文件夹是否存在，不存在创建
-	dirPath := filepath.Dir(config.CompositeImagePath)
-	isExist, _ := common.PathExists(dirPath)
-	if !isExist {
-		err = os.MkdirAll(dirPath, 0755)
-		if err != nil {
-			return err
-		}
+	// 删除旧的合成图片并创建输出目录
+	if err = PrepareOutputPath(config.CompositeImagePath); err != nil {
+		return errors.New("prepare composite image path error:" + err.Error())
+	}
+	src, err := decodeSource(originFile, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	watermarkImg, _, err := decodeImage(watermarkFile)
+	if err != nil {
+		return errors.New("decode watermark image error:" + err.Error())
+	}
+	format, err := config.Output.resolveFormat(src.format, config.CompositeImagePath)
+	if err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	result, err := composeImageWatermark(src, format, watermarkImg, config)
+	if err != nil {
+		return err
+	}
+	if err = saveComposite(result, config.CompositeImagePath, format, src.meta, config.Output); err != nil {
+		return errors.New("create composite image error:" + err.Error())
+	}
+	return nil
+}
+
+// CreateImageWatermarkStream 从io.Reader读取原图和水印图，合成后写入io.Writer
+// 默认输出格式与原图格式保持一致，可通过Output选项指定，配置中的路径字段会被忽略
+func CreateImageWatermarkStream(origin, watermark io.Reader, w io.Writer, config ImageWatermarkConfig) error {
+	src, err := decodeSource(origin, config.AutoOrient, config.KeepMetadata)
+	if err != nil {
+		return errors.New("decode origin image error:" + err.Error())
+	}
+	watermarkImg, _, err := decodeImage(watermark)
+	if err != nil {
+		return errors.New("decode watermark image error:" + err.Error())
+	}
+	format, err := config.Output.resolveFormat(src.format, "")
+	if err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	result, err := composeImageWatermark(src, format, watermarkImg, config)
+	if err != nil {
+		return err
+	}
+	if err = result.encode(w, format, src.meta, config.Output); err != nil {
+		return errors.New("encode composite image error:" + err.Error())
 	}
+	return nil
+}
+
+// AddImageWatermark 在内存中为图片添加图片水印，返回合成后的图片
+// 配置中的路径字段会被忽略，仅使用位置、偏移、透明度和平铺参数
+// 传入的图片应已按正确方向解码，AutoOrient和KeepMetadata选项仅对路径版本和流式版本生效
+func AddImageWatermark(originImg, watermarkImg image.Image, config ImageWatermarkConfig) (image.Image, error) {
+	if originImg == nil || watermarkImg == nil {
+		return nil, errors.New("origin image and watermark image must not be nil")
+	}
+	if err := normalizeImageConfig(&config); err != nil {
+		return nil, err
+	}
+	// 对水印图进行缩放(对比原图)
+	destwatermarkImg, err := scaleWatermark(watermarkImg, originImg.Bounds().Dx(), originImg.Bounds().Dy(), config)
+	if err != nil {
+		return nil, err
+	}
+	destImg := imaging.Clone(originImg)
+	if err = drawWatermark(destImg, destwatermarkImg, config.stamp()); err != nil {
+		return nil, err
+	}
+	return destImg, nil
+}
+
+// normalizeImageConfig 校验图片水印配置并填充默认值
+func normalizeImageConfig(config *ImageWatermarkConfig) error {
 	// 水印透明度判断
 	if config.Opacity < 0 || config.Opacity > 1 {
 		return errors.New("watermark opacity error:Ensure 0.0 <= opacity <= 1.0")
@@ -74,82 +152,47 @@ func CreateImageWatermark(config ImageWatermarkConfig) error {
 	if config.Opacity == 0 {
 		config.Opacity = 1
 	}
-	// 获取原图大小
-	originImg, _ := imaging.Decode(originFile)
-	watermarkImg, _ := imaging.Decode(watermarkFile)
-	originImgWidth := originImg.Bounds().Dx()
-	originImgHeight := originImg.Bounds().Dy()
-	// 对水印图进行缩放(对比原图)
-	targetWatermarkImgWidth := uint(originImgWidth / 5)
-	destwatermarkImg := imaging.Resize(watermarkImg, int(targetWatermarkImgWidth), 0, imaging.Lanczos)
-
-	// 根据水印位置合成图片
-	var destImg image.Image
-	switch config.WatermarkPos {
-	case LeftTop:
-		destImg = imaging.Overlay(originImg, destwatermarkImg, image.Pt(config.OffsetX, config.OffsetY), config.Opacity)
-	case RightTop:
-		destImg = imaging.Overlay(originImg, destwatermarkImg, image.Pt(originImgWidth-int(targetWatermarkImgWidth)-config.OffsetX, config.OffsetY), config.Opacity)
-	case LeftBottom:
-		destImg = imaging.Overlay(originImg, destwatermarkImg, image.Pt(config.OffsetX, originImgHeight-destwatermarkImg.Bounds().Dy()-config.OffsetY), config.Opacity)
-	case RightBottom:
-		destImg = imaging.Overlay(originImg, destwatermarkImg, image.Pt(originImgWidth-int(targetWatermarkImgWidth)-config.OffsetX, originImgHeight-destwatermarkImg.Bounds().Dy()-config.OffsetY), config.Opacity)
-	case Tiled:
-		if config.TiledCols == 0 || config.TiledRows == 0 {
-			return errors.New("watermark position tiled need tiled_cols and tiled_rows")
-		}
-		mainBounds := originImg.Bounds()
-		watermarkBounds := destwatermarkImg.Bounds()
-
-		// 创建一个与主图相同尺寸的新图像作为结果图像
-		result := image.NewNRGBA(mainBounds)
-		draw.Draw(result, mainBounds, originImg, image.Point{}, draw.Src)
-
-		// 计算水印在主图上平铺所需的行数和列数
-		rows := config.TiledRows
-		cols := config.TiledCols
-		// 计算行间距和列间距
-		totalWidth := cols * watermarkBounds.Dx()
-		totalHeight := rows * watermarkBounds.Dy()
-		extraWidth := mainBounds.Dx() - totalWidth
-		extraHeight := mainBounds.Dy() - totalHeight
-		rowSpacing := extraHeight / (rows + 1)
-		colSpacing := extraWidth / (cols + 1)
-		for r := 0; r < rows; r++ {
-			for c := 0; c < cols; c++ {
-				// 计算当前水印在主图上的位置
-				x := c*(watermarkBounds.Dx()+colSpacing) + colSpacing/2
-				y := r*(watermarkBounds.Dy()+rowSpacing) + rowSpacing/2
-
-				// 将水印粘贴到结果图像的相应位置
-				draw.DrawMask(result, image.Rect(x, y, x+watermarkBounds.Dx(), y+watermarkBounds.Dy()), destwatermarkImg, destwatermarkImg.Bounds().Min, destwatermarkImg, destwatermarkImg.Bounds().Min, draw.Over)
-			}
-		}
-		destImg = result
-	default:
-		return errors.New("watermark position error")
-	}
-	if err = imaging.Save(destImg, config.CompositeImagePath); err != nil {
-		return errors.New("create composite image error:" + err.Error())
+	if config.WatermarkPos == Tiled && config.TilePattern == nil && (config.TiledCols == 0 || config.TiledRows == 0) {
+		return errors.New("watermark position tiled need tiled_cols and tiled_rows")
 	}
 	return nil
 }
 
 // TransparentTextWatermarkConfig 透明文字水印配置
 type TransparentTextWatermarkConfig struct {
-	OriginImagePath    string       // 原图地址
-	CompositeImagePath string       // 合成图地址
-	FontPath           string       // 字体文件地址（可选，为空时使用系统默认字体）
-	Text               string       // 文字内容
-	Size               float64      // 文字大小
-	Color              color.RGBA   // 文字颜色
-	WatermarkPos       WatermarkPos // 水印位置
-	Opacity            float64      // 水印透明度
-	OffsetX            int          // 水印位置偏移量X
-	OffsetY            int          // 水印位置偏移量Y
-	Rotation           float64      // 文字旋转角度
-	TiledRows          int          // 水印图横向平铺行数(仅Tiled位置时使用)
-	TiledCols          int          // 水印图横向平铺列数(仅Tiled位置时使用)
+	OriginImagePath    string                 // 原图地址
+	CompositeImagePath string                 // 合成图地址
+	FontPath           string                 // 字体文件路径或已注册的字体名，为空时使用DefaultFont
+	FontFallbacks      []string               // 后备字体（路径或已注册的字体名），主字体缺少字形时按顺序查找（emoji序列等字素簇整体选择字体），DefaultFont总是最后的后备
+	Text               string                 // 文字内容，支持${date:2006-01-02}、${filename}、${width}、${exif.DateTimeOriginal}等模板变量
+	Variables          map[string]interface{} // 用户提供的模板变量，优先于内置变量
+	TemplateTime       time.Time              // 模板中${date}使用的时间，为零值时使用渲染时的当前时间
+	Size               float64                // 文字大小
+	Color              color.RGBA             // 文字颜色
+	WatermarkPos       WatermarkPos           // 水印位置
+	Opacity            float64                // 水印透明度
+	BlendMode          BlendMode              // 混合模式，默认正常覆盖
+	OffsetX            int                    // 水印位置偏移量X
+	OffsetY            int                    // 水印位置偏移量Y
+	OffsetXPercent     float64                // 水印位置偏移量X，按原图宽度的百分比计算，与OffsetX叠加
+	OffsetYPercent     float64                // 水印位置偏移量Y，按原图高度的百分比计算，与OffsetY叠加
+	AnchorX            float64                // 水印锚点X比例 0-1（仅Relative位置时使用）
+	AnchorY            float64                // 水印锚点Y比例 0-1（仅Relative位置时使用）
+	Rotation           float64                // 文字旋转角度
+	Align              TextAlign              // 多行文字的对齐方式，默认左对齐
+	LineSpacing        float64                // 行距倍数，为0时为1倍行高
+	AutoFit            float64                // 自动字号：文字块宽度占原图宽度的比例 0-1，设置后忽略Size
+	Stroke             *TextStroke            // 文字描边，为空时不描边
+	Shadow             *TextShadow            // 文字投影，为空时无投影
+	Background         *TextBackground        // 文字背景框，为空时无背景
+	Gradient           *TextGradient          // 线性渐变填充，设置后忽略Color
+	TiledRows          int                    // 水印图横向平铺行数(仅Tiled位置时使用)
+	TiledCols          int                    // 水印图横向平铺列数(仅Tiled位置时使用)
+	TilePattern        *TilePattern           // 平铺图案（仅Tiled位置时使用），设置后自动计算数量并忽略TiledRows/TiledCols
+	Output             OutputOptions          // 输出格式及编码质量选项
+	AutoOrient         bool                   // 是否根据EXIF方向信息自动旋转原图
+	KeepMetadata       bool                   // 是否将原图的EXIF（方向除外）、ICC和XMP元数据写入JPEG输出
+	GIF                GIFOptions             // GIF动图处理选项
 }
 
 // 创建几个预选颜色
@@ -161,42 +204,9 @@ var (
 	Blue  = color.RGBA{0, 0, 255, 255}
 )
 
-// measureText 计算给定文字的宽度和高度
-func measureText(face font.Face, text string) (int, int) {
-	var (
-		width  int
-		height int
-	)
-	// 获取字体的度量信息
-	metrics := face.Metrics()
-
-	// 遍历每个字符，计算总宽度
-	for _, textRune := range text {
-		// 获取字符的水平间距
-		advance, _ := face.GlyphAdvance(textRune)
-		width += int(advance >> 6)
-	}
-
-	// 计算高度
-	height = int(metrics.Height >> 6)
-
-	return width, height
-}
-
 // CreateTransparentTextWatermark 创建透明文字水印
 // 先将文字渲染到透明图层，然后作为图片叠加到目标图片上
 func CreateTransparentTextWatermark(config TransparentTextWatermarkConfig) error {
-	// 输入参数验证
-	if config.Opacity < 0 || config.Opacity > 1 {
-		return errors.New("watermark opacity error: Ensure 0.0 <= opacity <= 1.0")
-	}
-	if config.Opacity == 0 {
-		config.Opacity = 1
-	}
-	if config.WatermarkPos == Tiled && (config.TiledCols == 0 || config.TiledRows == 0) {
-		return errors.New("watermark position tiled need tiled_cols and tiled_rows")
-	}
-
 	// 打开原始图片
 	originFile, err := os.Open(config.OriginImagePath)
 	if err != nil {
@@ -205,159 +215,99 @@ func CreateTransparentTextWatermark(config TransparentTextWatermarkConfig) error
 	defer originFile.Close()
 
 	// 处理输出路径
-	isExists, _ := common.PathExists(config.CompositeImagePath)
-	if isExists {
-		err = os.Remove(config.CompositeImagePath)
-		if err != nil {
-			return errors.New("old composite image remove error:" + err.Error())
-		}
-	}
-
-	dirPath := filepath.Dir(config.CompositeImagePath)
-	isExist, _ := common.PathExists(dirPath)
-	if !isExist {
-		err = os.MkdirAll(dirPath, 0755)
-		if err != nil {
-			return err
-		}
+	if err = PrepareOutputPath(config.CompositeImagePath); err != nil {
+		return errors.New("prepare composite image path error:" + err.Error())
 	}
 
 	// 解码原始图片
-	originImg, err := imaging.Decode(originFile)
+	src, err := decodeSource(originFile, config.AutoOrient, config.KeepMetadata)
 	if err != nil {
 		return errors.New("decode origin image error: " + err.Error())
 	}
+	src.name = config.OriginImagePath
 
-	// 创建文字水印图像
-	textWatermarkImg, err := createTextImage(config)
+	format, err := config.Output.resolveFormat(src.format, config.CompositeImagePath)
 	if err != nil {
-		return err
+		return errors.New("create composite image error:" + err.Error())
 	}
-
-	// 根据水印位置合成图片
-	var destImg image.Image
-	originImgWidth := originImg.Bounds().Dx()
-	originImgHeight := originImg.Bounds().Dy()
-	textImgWidth := textWatermarkImg.Bounds().Dx()
-	textImgHeight := textWatermarkImg.Bounds().Dy()
-
-	switch config.WatermarkPos {
-	case LeftTop:
-		destImg = imaging.Overlay(originImg, textWatermarkImg, image.Pt(config.OffsetX, config.OffsetY), config.Opacity)
-	case RightTop:
-		destImg = imaging.Overlay(originImg, textWatermarkImg, image.Pt(originImgWidth-textImgWidth-config.OffsetX, config.OffsetY), config.Opacity)
-	case LeftBottom:
-		destImg = imaging.Overlay(originImg, textWatermarkImg, image.Pt(config.OffsetX, originImgHeight-textImgHeight-config.OffsetY), config.Opacity)
-	case RightBottom:
-		destImg = imaging.Overlay(originImg, textWatermarkImg, image.Pt(originImgWidth-textImgWidth-config.OffsetX, originImgHeight-textImgHeight-config.OffsetY), config.Opacity)
-	case Tiled:
-		mainBounds := originImg.Bounds()
-		watermarkBounds := textWatermarkImg.Bounds()
-
-		// 创建一个与主图相同尺寸的新图像作为结果图像
-		result := image.NewNRGBA(mainBounds)
-		draw.Draw(result, mainBounds, originImg, image.Point{}, draw.Src)
-
-		// 计算水印在主图上平铺所需的行数和列数
-		rows := config.TiledRows
-		cols := config.TiledCols
-
-		// 计算行间距和列间距
-		totalWidth := cols * watermarkBounds.Dx()
-		totalHeight := rows * watermarkBounds.Dy()
-		extraWidth := mainBounds.Dx() - totalWidth
-		extraHeight := mainBounds.Dy() - totalHeight
-		rowSpacing := extraHeight / (rows + 1)
-		colSpacing := extraWidth / (cols + 1)
-
-		// 创建一个临时的画布用于叠加水印图像
-		for r := 0; r < rows; r++ {
-			for c := 0; c < cols; c++ {
-				// 计算当前水印在主图上的位置
-				x := c*(watermarkBounds.Dx()+colSpacing) + colSpacing
-				y := r*(watermarkBounds.Dy()+rowSpacing) + rowSpacing
-
-				// 透明度混合处理
-				opacity := config.Opacity
-				if opacity == 1.0 {
-					draw.Draw(result, image.Rect(x, y, x+watermarkBounds.Dx(), y+watermarkBounds.Dy()),
-						textWatermarkImg, image.Point{}, draw.Over)
-				} else {
-					// 创建临时画布并设置不透明度
-					tmp := imaging.New(watermarkBounds.Dx(), watermarkBounds.Dy(), color.Transparent)
-					tmp = imaging.Overlay(tmp, textWatermarkImg, image.Point{}, opacity)
-					draw.Draw(result, image.Rect(x, y, x+watermarkBounds.Dx(), y+watermarkBounds.Dy()),
-						tmp, image.Point{}, draw.Over)
-				}
-			}
-		}
-		destImg = result
-	default:
-		return errors.New("watermark position error")
+	result, err := composeTextWatermark(src, format, config)
+	if err != nil {
+		return err
 	}
 
 	// 保存结果图片
-	if err = imaging.Save(destImg, config.CompositeImagePath); err != nil {
+	if err = saveComposite(result, config.CompositeImagePath, format, src.meta, config.Output); err != nil {
 		return errors.New("create composite image error:" + err.Error())
 	}
 	return nil
 }
 
-// createTextImage 创建文字图像
-func createTextImage(config TransparentTextWatermarkConfig) (*image.NRGBA, error) {
-	// 加载字体文件
-	fontData, err := os.ReadFile(config.FontPath)
+// CreateTransparentTextWatermarkStream 从io.Reader读取原图，添加透明文字水印后写入io.Writer
+// 默认输出格式与原图格式保持一致，可通过Output选项指定，配置中的路径字段会被忽略
+func CreateTransparentTextWatermarkStream(origin io.Reader, w io.Writer, config TransparentTextWatermarkConfig) error {
+	src, err := decodeSource(origin, config.AutoOrient, config.KeepMetadata)
 	if err != nil {
-		return nil, errors.New("failed to read font file:" + err.Error())
+		return errors.New("decode origin image error: " + err.Error())
 	}
-
-	fontFace, err := truetype.Parse(fontData)
+	format, err := config.Output.resolveFormat(src.format, "")
 	if err != nil {
-		return nil, errors.New("failed to parse font:" + err.Error())
+		return errors.New("encode composite image error:" + err.Error())
 	}
-
-	// 设置字体大小和选项
-	face := truetype.NewFace(fontFace, &truetype.Options{
-		Size:    config.Size,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
-
-	// 计算文字的宽度和高度
-	textWidth, textHeight := measureText(face, config.Text)
-
-	// 文字需要旋转时，确保最终图像足够大以容纳旋转后的文本
-	padding := 0
-	if config.Rotation != 0 {
-		// 当旋转时，需要更大的画布以确保文本在旋转后不会被裁剪
-		diagonal := int(math.Sqrt(float64(textWidth*textWidth + textHeight*textHeight)))
-		padding = (diagonal - textWidth) / 2
+	result, err := composeTextWatermark(src, format, config)
+	if err != nil {
+		return err
 	}
+	if err = result.encode(w, format, src.meta, config.Output); err != nil {
+		return errors.New("encode composite image error:" + err.Error())
+	}
+	return nil
+}
 
-	// 创建一个完全透明的新图像
-	img := image.NewRGBA(image.Rect(0, 0, textWidth+padding*2, textHeight+padding*2))
-	draw.Draw(img, img.Bounds(), image.Transparent, image.ZP, draw.Src)
+// AddTransparentTextWatermark 在内存中为图片添加透明文字水印，返回合成后的图片
+// 配置中的路径字段会被忽略（字体路径除外）
+func AddTransparentTextWatermark(originImg image.Image, config TransparentTextWatermarkConfig) (image.Image, error) {
+	return addTextWatermark(originImg, config, templateContext{})
+}
 
-	// 绘制文字
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(config.Color),
-		Face: face,
+// addTextWatermark 展开文字模板后为图片添加透明文字水印
+func addTextWatermark(originImg image.Image, config TransparentTextWatermarkConfig, ctx templateContext) (image.Image, error) {
+	if originImg == nil {
+		return nil, errors.New("origin image must not be nil")
+	}
+	if err := normalizeTextConfig(&config); err != nil {
+		return nil, err
 	}
 
-	// 设置绘制起点（添加边距）
-	d.Dot = fixed.P(padding, textHeight+padding-5)
-
-	// 绘制文字
-	d.DrawString(config.Text)
+	// 创建文字水印图像
+	ctx.width, ctx.height = originImg.Bounds().Dx(), originImg.Bounds().Dy()
+	config.Text = config.expandText(ctx)
+	textWatermarkImg, err := createTextImage(config, originImg.Bounds().Dx())
+	if err != nil {
+		return nil, err
+	}
+	return overlayTextWatermark(originImg, textWatermarkImg, config)
+}
 
-	// 如果需要旋转
-	var dst *image.NRGBA
-	if config.Rotation != 0 {
-		dst = imaging.Rotate(img, config.Rotation, color.Transparent)
-	} else {
-		dst = imaging.Clone(img)
+// normalizeTextConfig 校验文字水印配置并填充默认值
+func normalizeTextConfig(config *TransparentTextWatermarkConfig) error {
+	// 输入参数验证
+	if config.Opacity < 0 || config.Opacity > 1 {
+		return errors.New("watermark opacity error: Ensure 0.0 <= opacity <= 1.0")
+	}
+	if config.Opacity == 0 {
+		config.Opacity = 1
+	}
+	if config.WatermarkPos == Tiled && config.TilePattern == nil && (config.TiledCols == 0 || config.TiledRows == 0) {
+		return errors.New("watermark position tiled need tiled_cols and tiled_rows")
 	}
+	return nil
+}
 
-	return dst, nil
+// overlayTextWatermark 将已渲染的文字水印图像按配置叠加到原图上
+func overlayTextWatermark(originImg image.Image, textWatermarkImg *image.NRGBA, config TransparentTextWatermarkConfig) (image.Image, error) {
+	destImg := imaging.Clone(originImg)
+	if err := drawWatermark(destImg, textWatermarkImg, config.stamp()); err != nil {
+		return nil, err
+	}
+	return destImg, nil
 }
@@ -1,31 +1,118 @@
 package watermark
 
 import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
+// writeTestInputs 在临时目录中写入生成的原图（JPEG）和水印图（PNG），返回目录和两个文件路径
+func writeTestInputs(t *testing.T) (string, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	origin, logo := filepath.Join(dir, "origin.jpg"), filepath.Join(dir, "watermark.png")
+	writeImageFile(t, origin, goldenOrigin())
+	writeImageFile(t, logo, goldenLogo())
+	return dir, origin, logo
+}
+
+// writeImageFile 按扩展名将图片编码为JPEG或PNG写入文件
+func writeImageFile(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	if filepath.Ext(path) == ".png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readImageFile 解码图片文件
+func readImageFile(t *testing.T, path string) image.Image {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// changedRatio 返回区域内与原图亮度相差超过阈值的像素比例
+func changedRatio(got, origin image.Image, r image.Rectangle) float64 {
+	changed := 0
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			g := color.GrayModel.Convert(got.At(x, y)).(color.Gray).Y
+			o := color.GrayModel.Convert(origin.At(x, y)).(color.Gray).Y
+			if d := int(g) - int(o); d > 24 || d < -24 {
+				changed++
+			}
+		}
+	}
+	return float64(changed) / float64(r.Dx()*r.Dy())
+}
+
 func TestCreateImageWatermark(t *testing.T) {
+	dir, origin, logo := writeTestInputs(t)
 	config := ImageWatermarkConfig{
-		OriginImagePath:    "./testdata/origin.jpg",
-		WatermarkImagePath: "./testdata/watermark.png",
+		OriginImagePath:    origin,
+		WatermarkImagePath: logo,
 		WatermarkPos:       LeftTop,
-		CompositeImagePath: "./testdata/composite.jpg",
-		Opacity:            0.2,
+		CompositeImagePath: filepath.Join(dir, "out", "composite.jpg"),
+		ScaleMode:          ScaleNone,
+		Opacity:            0.8,
 	}
-	err := CreateImageWatermark(config)
-	if err != nil {
-		t.Error(err)
+	if err := CreateImageWatermark(config); err != nil {
+		t.Fatal(err)
+	}
+	got := readImageFile(t, config.CompositeImagePath)
+	if got.Bounds().Size() != image.Pt(240, 160) {
+		t.Fatalf("output size = %v, want 240x160", got.Bounds().Size())
+	}
+	// 左上角48x24的水印区域被覆盖，右下角保持原样
+	src := readImageFile(t, origin)
+	if r := changedRatio(got, src, image.Rect(0, 0, 48, 24)); r < 0.5 {
+		t.Errorf("watermark area changed ratio = %.2f", r)
+	}
+	if r := changedRatio(got, src, image.Rect(120, 80, 240, 160)); r > 0 {
+		t.Errorf("untouched area changed ratio = %.2f", r)
 	}
 }
 
 func TestCreateTransparentTextWatermark(t *testing.T) {
+	dir, origin, _ := writeTestInputs(t)
+	fontPath := writeTestFont(t)
+	src := readImageFile(t, origin)
+
 	// 测试固定位置的文字水印
 	config := TransparentTextWatermarkConfig{
-		OriginImagePath:    "./testdata/origin.jpg",
-		CompositeImagePath: "./testdata/composite_transparent_text.jpg",
-		FontPath:           "./testdata/font.ttf",
-		Text:               "透明文字水印测试",
-		Size:               72,
+		OriginImagePath:    origin,
+		CompositeImagePath: filepath.Join(dir, "composite_transparent_text.jpg"),
+		FontPath:           fontPath,
+		Text:               "Transparent text",
+		Size:               24,
 		Color:              White,
 		WatermarkPos:       LeftTop,
 		Opacity:            0.5, // 设置50%透明度
@@ -33,18 +120,24 @@ func TestCreateTransparentTextWatermark(t *testing.T) {
 		OffsetY:            20,
 		Rotation:           0, // 不旋转
 	}
-	err := CreateTransparentTextWatermark(config)
-	if err != nil {
-		t.Error(err)
+	if err := CreateTransparentTextWatermark(config); err != nil {
+		t.Fatal(err)
+	}
+	got := readImageFile(t, config.CompositeImagePath)
+	if r := changedRatio(got, src, image.Rect(20, 20, 180, 50)); r < 0.05 {
+		t.Errorf("text area changed ratio = %.2f", r)
+	}
+	if r := changedRatio(got, src, image.Rect(0, 100, 240, 160)); r > 0 {
+		t.Errorf("untouched area changed ratio = %.2f", r)
 	}
 
 	// 测试平铺水印
 	configTiled := TransparentTextWatermarkConfig{
-		OriginImagePath:    "./testdata/origin.jpg",
-		CompositeImagePath: "./testdata/composite_transparent_text_tiled.jpg",
-		FontPath:           "./testdata/font.ttf",
-		Text:               "透明文字水印",
-		Size:               48,
+		OriginImagePath:    origin,
+		CompositeImagePath: filepath.Join(dir, "composite_transparent_text_tiled.jpg"),
+		FontPath:           fontPath,
+		Text:               "Tiled",
+		Size:               16,
 		Color:              White,
 		WatermarkPos:       Tiled,
 		Opacity:            0.6, // 设置60%透明度
@@ -52,27 +145,663 @@ func TestCreateTransparentTextWatermark(t *testing.T) {
 		TiledCols:          5,
 		Rotation:           -45, // -45度旋转
 	}
-	err = CreateTransparentTextWatermark(configTiled)
-	if err != nil {
-		t.Error(err)
+	if err := CreateTransparentTextWatermark(configTiled); err != nil {
+		t.Fatal(err)
+	}
+	// 平铺的水印应分布在整张图上
+	got = readImageFile(t, configTiled.CompositeImagePath)
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 120, 80), image.Rect(120, 0, 240, 80), image.Rect(0, 80, 120, 160), image.Rect(120, 80, 240, 160)} {
+		if ratio := changedRatio(got, src, r); ratio < 0.02 {
+			t.Errorf("tiled watermark missing in %v, changed ratio = %.3f", r, ratio)
+		}
 	}
 }
 
 func TestCreateTransparentTextWatermarkWithDefaultFont(t *testing.T) {
+	useGoldenFont(t)
+	dir, origin, _ := writeTestInputs(t)
 	config := TransparentTextWatermarkConfig{
-		OriginImagePath:    "./testdata/origin.jpg",
-		CompositeImagePath: "./testdata/composite_default_font.jpg",
+		OriginImagePath:    origin,
+		CompositeImagePath: filepath.Join(dir, "composite_default_font.jpg"),
 		// FontPath is intentionally left empty to use default font
-		Text:         "默认字体水印测试",
-		Size:         72,
+		Text:         "Default font",
+		Size:         24,
 		Color:        White,
 		WatermarkPos: RightBottom,
 		Opacity:      0.5,
 		OffsetX:      20,
 		OffsetY:      20,
 	}
-	err := CreateTransparentTextWatermark(config)
+	if err := CreateTransparentTextWatermark(config); err != nil {
+		t.Fatal(err)
+	}
+	got, src := readImageFile(t, config.CompositeImagePath), readImageFile(t, origin)
+	if r := changedRatio(got, src, image.Rect(80, 110, 220, 140)); r < 0.05 {
+		t.Errorf("text area changed ratio = %.2f", r)
+	}
+	if r := changedRatio(got, src, image.Rect(0, 0, 240, 80)); r > 0 {
+		t.Errorf("untouched area changed ratio = %.2f", r)
+	}
+}
+
+func TestCreateImageWatermarkStream(t *testing.T) {
+	var originBuf, watermarkBuf, out bytes.Buffer
+	if err := png.Encode(&originBuf, imaging.New(400, 300, color.White)); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&watermarkBuf, imaging.New(100, 50, Red)); err != nil {
+		t.Fatal(err)
+	}
+	config := ImageWatermarkConfig{
+		WatermarkPos: RightBottom,
+		Opacity:      0.5,
+	}
+	if err := CreateImageWatermarkStream(&originBuf, &watermarkBuf, &out, config); err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" {
+		t.Errorf("output format = %s, want png", format)
+	}
+	if img.Bounds().Dx() != 400 || img.Bounds().Dy() != 300 {
+		t.Errorf("output size = %v, want 400x300", img.Bounds().Size())
+	}
+	// 右下角应被半透明红色覆盖，左上角保持白色
+	if r, g, _, _ := img.At(390, 290).RGBA(); r>>8 != 255 || g>>8 > 140 {
+		t.Errorf("watermark not found at right bottom, got %v", img.At(390, 290))
+	}
+	if _, g, _, _ := img.At(10, 10).RGBA(); g>>8 != 255 {
+		t.Errorf("left top should be untouched, got %v", img.At(10, 10))
+	}
+}
+
+func TestOutputOptions(t *testing.T) {
+	var originBuf bytes.Buffer
+	if err := png.Encode(&originBuf, imaging.New(200, 100, color.White)); err != nil {
+		t.Fatal(err)
+	}
+	logo := imaging.New(40, 20, Blue)
+
+	encode := func(opts OutputOptions) []byte {
+		var out bytes.Buffer
+		config := ImageWatermarkConfig{WatermarkPos: LeftTop, Output: opts}
+		var logoBuf bytes.Buffer
+		if err := png.Encode(&logoBuf, logo); err != nil {
+			t.Fatal(err)
+		}
+		if err := CreateImageWatermarkStream(bytes.NewReader(originBuf.Bytes()), &logoBuf, &out, config); err != nil {
+			t.Fatal(err)
+		}
+		return out.Bytes()
+	}
+
+	if _, format, err := image.DecodeConfig(bytes.NewReader(encode(OutputOptions{}))); err != nil || format != "png" {
+		t.Errorf("auto format = %s (%v), want png", format, err)
+	}
+	low := encode(OutputOptions{Format: FormatJPEG, JPEGQuality: 10})
+	high := encode(OutputOptions{Format: FormatJPEG, JPEGQuality: 100})
+	if _, format, err := image.DecodeConfig(bytes.NewReader(low)); err != nil || format != "jpeg" {
+		t.Errorf("explicit format = %s (%v), want jpeg", format, err)
+	}
+	if len(low) >= len(high) {
+		t.Errorf("jpeg quality 10 size %d should be smaller than quality 100 size %d", len(low), len(high))
+	}
+	if _, format, _ := image.DecodeConfig(bytes.NewReader(encode(OutputOptions{Format: FormatJPEG, KeepInputFormat: true}))); format != "png" {
+		t.Errorf("keep input format = %s, want png", format)
+	}
+
+	var out bytes.Buffer
+	err := CreateImageWatermarkStream(bytes.NewReader(originBuf.Bytes()), bytes.NewReader(originBuf.Bytes()), &out,
+		ImageWatermarkConfig{WatermarkPos: LeftTop, Output: OutputOptions{JPEGQuality: 101}})
+	if err == nil {
+		t.Error("expected error for invalid jpeg quality")
+	}
+}
+
+// orientedJPEG 构造200x100、EXIF方向为6（顺时针旋转90度）并带一个ICC段的JPEG
+func orientedJPEG(t *testing.T) (origin, icc []byte) {
+	t.Helper()
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, imaging.New(200, 100, color.White), nil); err != nil {
+		t.Fatal(err)
+	}
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	icc = append([]byte("ICC_PROFILE\x00\x01\x01"), bytes.Repeat([]byte{0x42}, 32)...)
+	origin, err := writeJPEGMetadata(plain.Bytes(), &imageMetadata{
+		exif: exif,
+		icc:  []jpegSegment{{marker: jpegMarkerAPP2, payload: icc}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return origin, icc
+}
+
+// exifOrientation 返回JPEG数据中orientedJPEG构造的EXIF段里方向标签的值
+func exifOrientation(data []byte) []byte {
+	idx := bytes.Index(data, exifHeader) + len(exifHeader) + 8 + 2 + 8
+	return data[idx : idx+2]
+}
+
+func TestAutoOrientAndKeepMetadata(t *testing.T) {
+	origin, icc := orientedJPEG(t)
+	tests := []struct {
+		name          string
+		autoOrient    bool
+		width, height int
+		orientation   []byte
+	}{
+		// 像素已旋转，方向标签应被重置为1
+		{"auto orient", true, 100, 200, []byte{0, 1}},
+		// 像素未旋转，保留原方向由查看器旋转
+		{"keep orientation", false, 200, 100, []byte{0, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logo := new(bytes.Buffer)
+			if err := png.Encode(logo, imaging.New(20, 20, Red)); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			config := ImageWatermarkConfig{
+				WatermarkPos: LeftTop,
+				AutoOrient:   tt.autoOrient,
+				KeepMetadata: true,
+			}
+			if err := CreateImageWatermarkStream(bytes.NewReader(origin), logo, &out, config); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.width || cfg.Height != tt.height {
+				t.Errorf("output size = %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.width, tt.height)
+			}
+			meta := readJPEGMetadata(out.Bytes(), false)
+			if meta == nil || meta.exif == nil || len(meta.icc) != 1 {
+				t.Fatalf("metadata not preserved: %+v", meta)
+			}
+			if !bytes.Equal(meta.icc[0].payload, icc) {
+				t.Error("icc profile changed")
+			}
+			if got := exifOrientation(out.Bytes()); !bytes.Equal(got, tt.orientation) {
+				t.Errorf("orientation = %v, want %v", got, tt.orientation)
+			}
+		})
+	}
+}
+
+func TestCreateImageWatermarkStreamAnimatedGIF(t *testing.T) {
+	palette := color.Palette{color.White, color.Black}
+	anim := &gif.GIF{LoopCount: 3}
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 100, 100), palette)
+		frame.SetColorIndex(i, i, 1)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10*(i+1))
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	var origin, logo, out bytes.Buffer
+	if err := gif.EncodeAll(&origin, anim); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&logo, imaging.New(50, 50, Red)); err != nil {
+		t.Fatal(err)
+	}
+	config := ImageWatermarkConfig{
+		WatermarkPos: LeftTop,
+		GIF:          GIFOptions{FrameOffset: LinearFrameOffset(0, 0, 80, 0)},
+	}
+	if err := CreateImageWatermarkStream(&origin, &logo, &out, config); err != nil {
+		t.Fatal(err)
+	}
+	result, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Image) != 3 || result.LoopCount != 3 {
+		t.Fatalf("frames = %d, loop = %d, want 3 frames and loop 3", len(result.Image), result.LoopCount)
+	}
+	for i, delay := range result.Delay {
+		if delay != 10*(i+1) {
+			t.Errorf("frame %d delay = %d, want %d", i, delay, 10*(i+1))
+		}
+	}
+	// 水印宽度为原图的1/5（20px），每帧向右移动40px
+	for i, x := range []int{5, 45, 85} {
+		if r, g, _, _ := result.Image[i].At(x, 5).RGBA(); r>>8 != 255 || g>>8 != 0 {
+			t.Errorf("frame %d: watermark not found at x=%d, got %v", i, x, result.Image[i].At(x, 5))
+		}
+	}
+}
+
+func TestPlacementPoint(t *testing.T) {
+	cases := []struct {
+		p    placement
+		want image.Point
+	}{
+		{placement{pos: LeftTop, offsetX: 10, offsetY: 5}, image.Pt(10, 5)},
+		{placement{pos: RightBottom, offsetX: 10, offsetY: 5}, image.Pt(290, 245)},
+		{placement{pos: Center}, image.Pt(150, 125)},
+		{placement{pos: Center, offsetX: 10, offsetY: -10}, image.Pt(160, 115)},
+		{placement{pos: TopCenter, offsetY: 8}, image.Pt(150, 8)},
+		{placement{pos: BottomCenter, offsetYPercent: 10}, image.Pt(150, 220)},
+		{placement{pos: LeftCenter, offsetXPercent: 5}, image.Pt(20, 125)},
+		{placement{pos: RightCenter, offsetXPercent: 5}, image.Pt(280, 125)},
+		{placement{pos: Relative, anchorX: 0.25, anchorY: 0.75}, image.Pt(75, 188)},
+	}
+	for _, c := range cases {
+		got, err := c.p.point(400, 300, 100, 50)
+		if err != nil {
+			t.Errorf("%+v: %v", c.p, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%+v: point = %v, want %v", c.p, got, c.want)
+		}
+	}
+	if _, err := (placement{pos: Relative, anchorX: 1.5}).point(400, 300, 100, 50); err == nil {
+		t.Error("expected error for anchor out of range")
+	}
+	if _, err := (placement{pos: "unknown"}).point(400, 300, 100, 50); err == nil {
+		t.Error("expected error for unknown position")
+	}
+}
+
+func TestScaleWatermark(t *testing.T) {
+	logo := imaging.New(200, 100, Red)
+	cases := []struct {
+		name   string
+		config ImageWatermarkConfig
+		w, h   int
+		canvas image.Point
+	}{
+		{"default", ImageWatermarkConfig{}, 200, 100, image.Pt(1000, 500)},
+		{"none", ImageWatermarkConfig{ScaleMode: ScaleNone}, 200, 100, image.Pt(1000, 500)},
+		{"fixed width", ImageWatermarkConfig{ScaleMode: ScaleFixed, ScaleWidth: 80}, 80, 40, image.Pt(1000, 500)},
+		{"fixed both", ImageWatermarkConfig{ScaleMode: ScaleFixed, ScaleWidth: 80, ScaleHeight: 80}, 80, 80, image.Pt(1000, 500)},
+		{"short edge panorama", ImageWatermarkConfig{ScaleMode: ScaleShortEdge, ScalePercent: 20}, 80, 40, image.Pt(4000, 400)},
+		{"long edge portrait", ImageWatermarkConfig{ScaleMode: ScaleLongEdge, ScalePercent: 10, ResampleFilter: FilterLinear}, 300, 150, image.Pt(1000, 3000)},
+		{"min clamp", ImageWatermarkConfig{ScaleMode: ScaleShortEdge, ScalePercent: 10, MinWatermarkSize: 120}, 120, 60, image.Pt(400, 400)},
+		{"max clamp", ImageWatermarkConfig{MaxWatermarkSize: 150}, 150, 75, image.Pt(8000, 6000)},
+	}
+	for _, c := range cases {
+		got, err := scaleWatermark(logo, c.canvas.X, c.canvas.Y, c.config)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got.Bounds().Dx() != c.w || got.Bounds().Dy() != c.h {
+			t.Errorf("%s: size = %v, want %dx%d", c.name, got.Bounds().Size(), c.w, c.h)
+		}
+	}
+	for _, config := range []ImageWatermarkConfig{
+		{ScaleMode: ScaleFixed},
+		{ScaleMode: ScaleLongEdge},
+		{ScaleMode: "unknown"},
+		{ResampleFilter: "unknown"},
+		{MinWatermarkSize: 100, MaxWatermarkSize: 50},
+	} {
+		if _, err := scaleWatermark(logo, 1000, 500, config); err == nil {
+			t.Errorf("%+v: expected error", config)
+		}
+	}
+}
+
+func TestTilePattern(t *testing.T) {
+	origin := imaging.New(300, 200, color.White)
+	logo := imaging.New(100, 50, Red)
+	coverage := func(img image.Image) float64 {
+		red := 0
+		for y := 0; y < 200; y++ {
+			for x := 0; x < 300; x++ {
+				if _, g, _, _ := img.At(x, y).RGBA(); g>>8 < 128 {
+					red++
+				}
+			}
+		}
+		return float64(red) / (300 * 200)
+	}
+	for _, pattern := range []TilePattern{
+		{SpacingX: 10, SpacingY: 10},
+		{SpacingX: 10, SpacingY: 10, Stagger: 0.5},
+		{SpacingX: 10, SpacingY: 10, Rotation: 30},
+		{SpacingX: 5, SpacingY: 5, SpacingUnit: SpacingPercent, Rotation: -45, Stagger: 0.5},
+	} {
+		p := pattern
+		// 水印缩放为60x30，间距10像素时覆盖率约为 1800/(70*40)
+		config := ImageWatermarkConfig{WatermarkPos: Tiled, TilePattern: &p, ScaleMode: ScaleFixed, ScaleWidth: 60}
+		img, err := AddImageWatermark(origin, logo, config)
+		if err != nil {
+			t.Fatalf("%+v: %v", pattern, err)
+		}
+		if c := coverage(img); c < 0.45 || c > 0.85 {
+			t.Errorf("%+v: coverage = %.2f", pattern, c)
+		}
+		if pattern.Rotation == 0 {
+			if _, g, _, _ := img.At(150, 100).RGBA(); g>>8 > 128 {
+				t.Errorf("%+v: center tile missing", pattern)
+			}
+		}
+	}
+
+	textConfig := TransparentTextWatermarkConfig{WatermarkPos: Tiled, TilePattern: &TilePattern{Stagger: 2}}
+	if _, err := overlayTextWatermark(origin, logo, textConfig); err == nil {
+		t.Error("expected error for invalid stagger")
+	}
+
+	// 水印比原图大时旧的行列平铺不应出现负间距
+	legacy := ImageWatermarkConfig{WatermarkPos: Tiled, TiledRows: 3, TiledCols: 3, ScaleMode: ScaleNone}
+	img, err := AddImageWatermark(origin, imaging.New(400, 300, Red), legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, g, _, _ := img.At(0, 0).RGBA(); g>>8 > 128 {
+		t.Error("legacy tiling with oversized watermark should start at the origin")
+	}
+
+	// 旧的行列平铺与其他位置的透明度含义相同
+	half := ImageWatermarkConfig{WatermarkPos: Tiled, TiledRows: 2, TiledCols: 2, ScaleMode: ScaleNone, Opacity: 0.5}
+	if img, err = AddImageWatermark(origin, logo, half); err != nil {
+		t.Fatal(err)
+	}
+	half.WatermarkPos = Center
+	single, err := AddImageWatermark(origin, logo, half)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tiled, centered := img.(*image.NRGBA).NRGBAAt(20, 20), single.(*image.NRGBA).NRGBAAt(150, 100)
+	if tiled != centered || tiled.G < 100 || tiled.G > 150 {
+		t.Errorf("tiled pixel with opacity 0.5 = %v, want %v", tiled, centered)
+	}
+}
+
+// writeTestFont 将Go Regular字体写入临时目录，返回字体路径
+func writeTestFont(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "goregular.ttf")
+	if err := os.WriteFile(path, goregular.TTF, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// inkBounds 返回图片中不透明像素的范围
+func inkBounds(img image.Image) image.Rectangle {
+	var r image.Rectangle
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a > 0 {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+func TestMultiLineText(t *testing.T) {
+	fontPath := writeTestFont(t)
+	base := TransparentTextWatermarkConfig{FontPath: fontPath, Text: "Watermark", Size: 20, Color: Black}
+
+	single, err := createTextImage(base, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi := base
+	multi.Text = "Watermark\r\nWM"
+	two, err := createTextImage(multi, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if two.Bounds().Dx() != single.Bounds().Dx() {
+		t.Errorf("block width = %d, want widest line %d", two.Bounds().Dx(), single.Bounds().Dx())
+	}
+	multi.LineSpacing = 2
+	spaced, err := createTextImage(multi, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spaced.Bounds().Dy() <= two.Bounds().Dy() {
+		t.Errorf("line spacing 2 height %d should exceed %d", spaced.Bounds().Dy(), two.Bounds().Dy())
+	}
+
+	// 第二行较短，对齐方式决定其起始位置
+	secondLineLeft := func(align TextAlign) int {
+		c := multi
+		c.Align = align
+		img, err := createTextImage(c, 400)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := img.Bounds().Dy()
+		return inkBounds(img.SubImage(image.Rect(0, h/2, img.Bounds().Dx(), h))).Min.X
+	}
+	left, center, right := secondLineLeft(AlignLeft), secondLineLeft(AlignCenter), secondLineLeft(AlignRight)
+	if !(left < center && center < right) {
+		t.Errorf("alignment offsets left=%d center=%d right=%d", left, center, right)
+	}
+
+	fit := base
+	fit.AutoFit = 0.5
+	for _, width := range []int{400, 1000} {
+		img, err := createTextImage(fit, width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := img.Bounds().Dx(); w > width/2 || w < width/2*9/10 {
+			t.Errorf("auto fit on %d: width = %d", width, w)
+		}
+	}
+	fit.AutoFit = 1.5
+	if _, err := createTextImage(fit, 400); err == nil {
+		t.Error("expected error for auto fit > 1")
+	}
+}
+
+func TestTextStyle(t *testing.T) {
+	fontPath := writeTestFont(t)
+	base := TransparentTextWatermarkConfig{FontPath: fontPath, Text: "Style", Size: 40, Color: White}
+	plain, err := createTextImage(base, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, h := plain.Bounds().Dx(), plain.Bounds().Dy()
+
+	stroked := base
+	stroked.Stroke = &TextStroke{Width: 3, Color: Black}
+	img, err := createTextImage(stroked, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != w+6 || img.Bounds().Dy() != h+6 {
+		t.Errorf("stroke size = %v, want %dx%d", img.Bounds().Size(), w+6, h+6)
+	}
+	dark := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] == 255 && img.Pix[i] < 64 {
+			dark++
+		}
+	}
+	if dark == 0 {
+		t.Error("stroke color not rendered")
+	}
+
+	shadowed := base
+	shadowed.Shadow = &TextShadow{OffsetX: 4, OffsetY: 5, Blur: 1, Color: Black}
+	img, err = createTextImage(shadowed, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != w+4+3 || img.Bounds().Dy() != h+5+3 {
+		t.Errorf("shadow size = %v", img.Bounds().Size())
+	}
+
+	boxed := base
+	boxed.Background = &TextBackground{Padding: 8, Radius: 6, Color: Blue, Opacity: 0.5}
+	img, err = createTextImage(boxed, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != w+16 {
+		t.Errorf("background width = %d, want %d", img.Bounds().Dx(), w+16)
+	}
+	if c := img.NRGBAAt(0, 0); c.A != 0 {
+		t.Errorf("rounded corner should be transparent, got %v", c)
+	}
+	if c := img.NRGBAAt(img.Bounds().Dx()/2, 2); c.B < 250 || c.A < 120 || c.A > 135 {
+		t.Errorf("background color = %v", c)
+	}
+
+	gradient := base
+	gradient.Gradient = &TextGradient{From: Red, To: Blue}
+	img, err = createTextImage(gradient, 400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ink := inkBounds(img)
+	avgRed := func(x0, x1 int) float64 {
+		sum, n := 0, 0
+		for y := ink.Min.Y; y < ink.Max.Y; y++ {
+			for x := x0; x < x1; x++ {
+				if c := img.NRGBAAt(x, y); c.A == 255 {
+					sum += int(c.R) - int(c.B)
+					n++
+				}
+			}
+		}
+		return float64(sum) / float64(max(n, 1))
+	}
+	third := ink.Dx() / 3
+	if left, right := avgRed(ink.Min.X, ink.Min.X+third), avgRed(ink.Max.X-third, ink.Max.X); left <= 0 || right >= 0 {
+		t.Errorf("gradient red-blue balance left=%.1f right=%.1f", left, right)
+	}
+
+	if _, err := createTextImage(TransparentTextWatermarkConfig{FontPath: fontPath, Text: "x", Size: 10, Stroke: &TextStroke{Width: -1}}, 400); err == nil {
+		t.Error("expected error for negative stroke width")
+	}
+}
+
+func TestWatermarkLayers(t *testing.T) {
+	origin := syntheticPhoto(320, 240)
+	logo := imaging.New(60, 30, Red)
+	imageConfig := ImageWatermarkConfig{WatermarkPos: LeftTop, OffsetX: 10, OffsetY: 10, Opacity: 0.7, ScaleMode: ScaleNone}
+	textConfig := TransparentTextWatermarkConfig{FontPath: writeTestFont(t), Text: "layered", Size: 24, Color: White, WatermarkPos: RightBottom, Opacity: 0.8}
+
+	// 单次叠加多个图层应与依次调用的结果一致
+	step, err := AddImageWatermark(origin, logo, imageConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := AddTransparentTextWatermark(step, textConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := AddWatermarkLayers(origin, []Layer{ImageLayer(logo, imageConfig), TextLayer(textConfig)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.(*image.NRGBA).Pix, want.(*image.NRGBA).Pix) {
+		t.Error("layered result differs from sequential watermarking")
+	}
+
+	// 流式处理GIF动图时每一帧都叠加所有图层
+	var in, out bytes.Buffer
+	frames := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		frames.Image = append(frames.Image, image.NewPaletted(image.Rect(0, 0, 320, 240), color.Palette{color.Black, color.White}))
+		frames.Delay = append(frames.Delay, 10)
+	}
+	if err := gif.EncodeAll(&in, frames); err != nil {
+		t.Fatal(err)
+	}
+	config := LayeredWatermarkConfig{Layers: []Layer{ImageLayer(logo, imageConfig), TextLayer(textConfig)}}
+	if err := CreateLayeredWatermarkStream(&in, &out, config); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 {
+		t.Fatalf("frames = %d", len(anim.Image))
+	}
+	for i, frame := range anim.Image {
+		if r, g, _, _ := frame.At(20, 20).RGBA(); r>>8 < 128 || g>>8 > 64 {
+			t.Errorf("frame %d: image layer missing", i)
+		}
+	}
+
+	if _, err := AddWatermarkLayers(origin, []Layer{{Image: &imageConfig, Text: &textConfig}}); err == nil {
+		t.Error("expected error for layer with both image and text")
+	}
+	if _, err := AddWatermarkLayers(origin, nil); err == nil {
+		t.Error("expected error for empty layers")
+	}
+}
+
+func TestBlendModes(t *testing.T) {
+	gray := color.NRGBA{128, 128, 128, 255}
+	blend := func(bg, fg color.NRGBA, mode BlendMode) color.NRGBA {
+		t.Helper()
+		dst := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+		mark := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+		draw.Draw(mark, mark.Bounds(), image.NewUniform(fg), image.Point{}, draw.Src)
+		if err := overlayMark(dst, mark, image.Pt(1, 1), 1, mode); err != nil {
+			t.Fatal(err)
+		}
+		if dst.NRGBAAt(0, 0) != bg {
+			t.Errorf("%s: pixel outside watermark changed", mode)
+		}
+		return dst.NRGBAAt(1, 1)
+	}
+	white, black := color.NRGBA{255, 255, 255, 255}, color.NRGBA{0, 0, 0, 255}
+	cases := []struct {
+		mode   BlendMode
+		bg, fg color.NRGBA
+		want   color.NRGBA
+	}{
+		{BlendMultiply, gray, white, gray},
+		{BlendMultiply, gray, black, black},
+		{BlendScreen, gray, black, gray},
+		{BlendScreen, gray, white, white},
+		{BlendDifference, gray, gray, black},
+		{BlendDifference, black, white, white},
+		{BlendOverlay, black, white, black},
+		{BlendSoftLight, gray, gray, gray},
+	}
+	for _, c := range cases {
+		if got := blend(c.bg, c.fg, c.mode); got != c.want {
+			t.Errorf("%s(%v, %v) = %v, want %v", c.mode, c.bg, c.fg, got, c.want)
+		}
+	}
+
+	// 明度模式保留原图色相
+	if got := blend(color.NRGBA{200, 40, 40, 255}, color.NRGBA{220, 220, 220, 255}, BlendLuminosity); got.R <= got.G || lum([3]float64{float64(got.R) / 255, float64(got.G) / 255, float64(got.B) / 255}) < 0.8 {
+		t.Errorf("luminosity = %v", got)
+	}
+
+	// 自适应模式：白色水印在亮背景上反色，在暗背景上保持不变
+	if got := blend(color.NRGBA{240, 240, 240, 255}, white, BlendAdaptive); got != black {
+		t.Errorf("adaptive on bright = %v", got)
+	}
+	if got := blend(color.NRGBA{20, 20, 20, 255}, white, BlendAdaptive); got != white {
+		t.Errorf("adaptive on dark = %v", got)
+	}
+
+	if _, err := AddImageWatermark(imaging.New(100, 100, color.White), imaging.New(10, 10, Red), ImageWatermarkConfig{WatermarkPos: Center, BlendMode: "dodge"}); err == nil {
+		t.Error("expected error for unknown blend mode")
+	}
+	img, err := AddImageWatermark(imaging.New(100, 100, gray), imaging.New(10, 10, color.Black), ImageWatermarkConfig{WatermarkPos: Tiled, TiledRows: 2, TiledCols: 2, BlendMode: BlendScreen, ScaleMode: ScaleNone})
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if c := img.(*image.NRGBA).NRGBAAt(50, 50); c != gray {
+		t.Errorf("screen with black tiles changed the image: %v", c)
 	}
 }
@@ -0,0 +1,390 @@
+package watermark
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 水印配置文件使用的YAML子集解析器
+// 支持块映射、块序列、带引号和不带引号的单行标量、行内注释、[a, b]行内序列和 | 、|- 多行文本；
+// 锚点、别名、标签、{a: b}行内映射、嵌套的行内集合、> 折叠文本、跨行的标量、复杂键、合并键、指令和多文档
+// 均不支持，遇到时返回包含行号的errYAMLUnsupported错误，而不是按其他含义解析
+
+// errYAMLUnsupported 配置中使用了YAML子集之外的语法
+var errYAMLUnsupported = errors.New("unsupported yaml feature")
+
+// yamlIndicators 不带引号的标量不能以这些字符开头，它们在完整的YAML中表示子集不支持的语法
+const yamlIndicators = "&*!{[>|@`"
+
+// unsupportedYAML 生成不支持的语法的错误
+func unsupportedYAML(num int, feature string) error {
+	return fmt.Errorf("yaml: line %d: %w: %s", num, errYAMLUnsupported, feature)
+}
+
+// yamlLine YAML源文件中的一行
+type yamlLine struct {
+	num    int    // 行号，从1开始
+	indent int    // 缩进空格数
+	text   string // 去掉缩进后的内容
+}
+
+// isBlank 判断是否为空行或纯注释行
+func (l yamlLine) isBlank() bool {
+	return l.text == "" || strings.HasPrefix(l.text, "#")
+}
+
+// isSeqItem 判断是否为序列项
+func (l yamlLine) isSeqItem() bool {
+	return l.text == "-" || strings.HasPrefix(l.text, "- ")
+}
+
+// yamlParser YAML解析器状态
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML 将YAML文档解析为map[string]interface{}、[]interface{}和标量组成的树
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	if p.lines[p.pos].text == "---" {
+		p.pos++
+		p.skipBlank()
+	}
+	for _, line := range p.lines[p.pos:] {
+		switch {
+		case line.isBlank():
+		case line.text == "---" || strings.HasPrefix(line.text, "--- ") || line.text == "...":
+			return nil, unsupportedYAML(line.num, "multiple documents")
+		case line.indent == 0 && strings.HasPrefix(line.text, "%"):
+			return nil, unsupportedYAML(line.num, "directives")
+		case line.text == "?" || strings.HasPrefix(line.text, "? "):
+			return nil, unsupportedYAML(line.num, "complex mapping keys")
+		}
+	}
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	node, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return node, nil
+}
+
+// skipBlank 跳过空行和注释行
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && p.lines[p.pos].isBlank() {
+		p.pos++
+	}
+}
+
+// parseBlock 解析从当前行开始、缩进为indent的块
+func (p *yamlParser) parseBlock(indent int) (interface{}, error) {
+	if p.lines[p.pos].isSeqItem() {
+		return p.parseSeq(indent)
+	}
+	return p.parseMap(indent)
+}
+
+// parseSeq 解析块序列
+func (p *yamlParser) parseSeq(indent int) ([]interface{}, error) {
+	seq := []interface{}{}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent != indent || !line.isSeqItem() {
+			break
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+		switch {
+		case rest == "":
+			p.pos++
+			item, err := p.parseNested(indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, item)
+		case isYAMLMapEntry(rest) && !strings.ContainsAny(rest[:1], yamlIndicators):
+			// "- key: value" 形式，将该行视为缩进更深的映射的第一行
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err := p.parseMap(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, item)
+		default:
+			p.pos++
+			item, err := parseYAMLScalar(rest, line.num)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, item)
+		}
+	}
+	return seq, nil
+}
+
+// parseMap 解析块映射
+func (p *yamlParser) parseMap(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	scalar := false // 上一个键的值是否为同一行的标量
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			if scalar {
+				return nil, unsupportedYAML(line.num, "multi-line scalars (use | for multi-line text)")
+			}
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
+		}
+		if line.isSeqItem() {
+			break
+		}
+		key, value, err := splitYAMLMapEntry(line.text, line.num)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[key]; ok {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key %q", line.num, key)
+		}
+		if key == "<<" {
+			return nil, unsupportedYAML(line.num, "merge keys")
+		}
+		if !strings.HasPrefix(line.text, `"`) && !strings.HasPrefix(line.text, "'") && key != "" && strings.ContainsAny(key[:1], yamlIndicators) {
+			return nil, unsupportedYAML(line.num, "anchors, tags or flow collections in mapping keys")
+		}
+		p.pos++
+		scalar = value != "" && value != "|" && value != "|-"
+		switch {
+		case value == "":
+			m[key], err = p.parseNested(indent)
+		case value == "|" || value == "|-":
+			m[key] = p.parseLiteral(indent, value == "|")
+		default:
+			m[key], err = parseYAMLScalar(value, line.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// parseNested 解析键或序列项后换行的嵌套块，没有嵌套内容时为null
+// 映射的值为序列时，序列项可以与键对齐
+func (p *yamlParser) parseNested(indent int) (interface{}, error) {
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent || (next.indent == indent && next.isSeqItem() && !p.inSeq(indent)) {
+		return p.parseBlock(next.indent)
+	}
+	return nil, nil
+}
+
+// inSeq 判断上一个非空行是否为同一缩进的序列项
+func (p *yamlParser) inSeq(indent int) bool {
+	for i := p.pos - 1; i >= 0; i-- {
+		if l := p.lines[i]; !l.isBlank() {
+			return l.indent == indent && l.isSeqItem()
+		}
+	}
+	return false
+}
+
+// parseLiteral 解析 | 多行文本块，keepNewline为false时去掉末尾换行
+func (p *yamlParser) parseLiteral(indent int, keepNewline bool) string {
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if line.text == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		lines = append(lines, strings.Repeat(" ", max(line.indent-blockIndent, 0))+line.text)
+	}
+	// 末尾的空行不属于文本块
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		p.pos--
+	}
+	text := strings.Join(lines, "\n")
+	if keepNewline && text != "" {
+		text += "\n"
+	}
+	return text
+}
+
+// isYAMLMapEntry 判断文本是否为 key: value 形式
+func isYAMLMapEntry(text string) bool {
+	_, _, err := splitYAMLMapEntry(text, 0)
+	return err == nil
+}
+
+// splitYAMLMapEntry 拆分映射项的键和值，值中的注释会被保留到标量解析时处理
+func splitYAMLMapEntry(text string, num int) (string, string, error) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := closingQuote(text)
+		if end < 0 || !strings.HasPrefix(text[end+1:], ":") {
+			return "", "", fmt.Errorf("yaml: line %d: invalid mapping key", num)
+		}
+		key, err := parseYAMLScalar(text[:end+1], num)
+		if err != nil {
+			return "", "", err
+		}
+		return key.(string), strings.TrimSpace(text[end+2:]), nil
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			value := strings.TrimSpace(text[i+1:])
+			if strings.HasPrefix(value, "#") {
+				value = ""
+			}
+			return text[:i], value, nil
+		}
+		if text[i] == '#' && i > 0 && text[i-1] == ' ' {
+			break
+		}
+	}
+	return "", "", fmt.Errorf("yaml: line %d: expected \"key: value\"", num)
+}
+
+// closingQuote 返回与开头引号配对的结束引号位置
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLScalar 解析标量或行内序列，去掉行内注释
+func parseYAMLScalar(text string, num int) (interface{}, error) {
+	if text == "" {
+		return nil, nil
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return nil, fmt.Errorf("yaml: line %d: unterminated string (quoted strings must end on the same line)", num)
+		}
+		if rest := strings.TrimSpace(text[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("yaml: line %d: unexpected text after string", num)
+		}
+		if text[0] == '\'' {
+			return strings.ReplaceAll(text[1:end], "''", "'"), nil
+		}
+		s, err := strconv.Unquote(text[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: invalid string: %v", num, err)
+		}
+		return s, nil
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	if strings.HasPrefix(text, "[") {
+		return parseYAMLFlowSeq(text, num)
+	}
+	switch {
+	case text[0] == '&':
+		return nil, unsupportedYAML(num, "anchors (&)")
+	case text[0] == '*':
+		return nil, unsupportedYAML(num, "aliases (*)")
+	case text[0] == '!':
+		return nil, unsupportedYAML(num, "tags (!)")
+	case text[0] == '{' && text != "{}":
+		return nil, unsupportedYAML(num, "flow mappings ({key: value})")
+	case text[0] == '>':
+		return nil, unsupportedYAML(num, "folded block scalars (>)")
+	case text[0] == '|':
+		return nil, unsupportedYAML(num, "block scalar indicators other than | and |-")
+	case text[0] == '@' || text[0] == '`':
+		return nil, unsupportedYAML(num, "reserved indicators (@, `)")
+	}
+	switch text {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "{}":
+		return map[string]interface{}{}, nil
+	}
+	if n, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXnN") {
+		return n, nil
+	}
+	return text, nil
+}
+
+// parseYAMLFlowSeq 解析 [a, b] 形式的行内序列，元素不能再嵌套
+func parseYAMLFlowSeq(text string, num int) ([]interface{}, error) {
+	if !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("yaml: line %d: unterminated flow sequence (flow sequences must end on the same line)", num)
+	}
+	seq := []interface{}{}
+	body := strings.TrimSpace(text[1 : len(text)-1])
+	for body != "" {
+		var item string
+		if body[0] == '"' || body[0] == '\'' {
+			end := closingQuote(body)
+			if end < 0 {
+				return nil, fmt.Errorf("yaml: line %d: unterminated string", num)
+			}
+			item, body = body[:end+1], strings.TrimSpace(body[end+1:])
+			if body != "" && !strings.HasPrefix(body, ",") {
+				return nil, fmt.Errorf("yaml: line %d: expected ',' in flow sequence", num)
+			}
+			body = strings.TrimPrefix(body, ",")
+		} else if body[0] == '[' || body[0] == '{' {
+			return nil, unsupportedYAML(num, "nested flow collections")
+		} else if i := strings.IndexByte(body, ','); i >= 0 {
+			item, body = body[:i], body[i+1:]
+		} else {
+			item, body = body, ""
+		}
+		value, err := parseYAMLScalar(strings.TrimSpace(item), num)
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, value)
+		body = strings.TrimSpace(body)
+	}
+	return seq, nil
+}